@@ -0,0 +1,261 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"sync"
+
+	"github.com/spezifisch/stmps/logger"
+	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spezifisch/stmps/remote"
+	"github.com/spezifisch/stmps/subsonic"
+)
+
+// remotePlayback drives the Core of a stmps daemon through its control
+// socket. The TUI uses it instead of a local Core when started with --attach,
+// so that music keeps playing after the TUI exits.
+type remotePlayback struct {
+	client *remote.ControlClient
+	logger logger.LoggerInterface
+
+	lock         sync.Mutex
+	consumers    []mpvplayer.EventConsumer
+	queueChanged func()
+
+	done chan struct{}
+}
+
+var _ Playback = (*remotePlayback)(nil)
+
+// attachPlayback connects to the daemon listening on the control socket at
+// path
+func attachPlayback(path string, logger logger.LoggerInterface) (*remotePlayback, error) {
+	client, err := remote.DialControlSocket(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Subscribe(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	p := &remotePlayback{
+		client: client,
+		logger: logger,
+		done:   make(chan struct{}),
+	}
+	go p.eventLoop()
+	return p, nil
+}
+
+// Close detaches from the daemon; playback goes on
+func (p *remotePlayback) Close() error {
+	return p.client.Close()
+}
+
+// eventLoop translates the daemon's events back into player events
+func (p *remotePlayback) eventLoop() {
+	defer close(p.done)
+
+	for e := range p.client.Events() {
+		var event mpvplayer.UiEvent
+		switch e.Event {
+		case remote.EventStopped:
+			event.Type = mpvplayer.EventStopped
+		case remote.EventPlaying:
+			event.Type = mpvplayer.EventPlaying
+		case remote.EventUnpaused:
+			event.Type = mpvplayer.EventUnpaused
+		case remote.EventPaused:
+			event.Type = mpvplayer.EventPaused
+		case remote.EventStatus:
+			event.Type = mpvplayer.EventStatus
+		case remote.EventQueue:
+			p.lock.Lock()
+			cb := p.queueChanged
+			p.lock.Unlock()
+			if cb != nil {
+				go cb()
+			}
+			continue
+		default:
+			p.logger.Printf("attach: unhandled event %q", e.Event)
+			continue
+		}
+
+		if e.Track != nil {
+			event.Data = newQueueItem(*e.Track)
+		} else if e.Status != nil {
+			event.Data = mpvplayer.StatusData{
+				Volume:   e.Status.Volume,
+				Position: e.Status.Position,
+				Duration: e.Status.Duration,
+			}
+		}
+
+		p.lock.Lock()
+		consumers := p.consumers
+		p.lock.Unlock()
+		for _, consumer := range consumers {
+			consumer.SendEvent(event)
+		}
+	}
+	p.logger.Print("attach: connection to daemon closed")
+}
+
+func (p *remotePlayback) Play() error {
+	return p.client.Call(remote.MethodPlay, nil, nil)
+}
+
+func (p *remotePlayback) TogglePause() error {
+	return p.client.Call(remote.MethodToggle, nil, nil)
+}
+
+func (p *remotePlayback) Stop() error {
+	return p.client.Call(remote.MethodStop, nil, nil)
+}
+
+func (p *remotePlayback) NextTrack() error {
+	return p.client.Call(remote.MethodNext, nil, nil)
+}
+
+func (p *remotePlayback) Seek(offset int) error {
+	return p.client.Call(remote.MethodSeek, remote.SeekParams{Offset: &offset}, nil)
+}
+
+func (p *remotePlayback) SeekAbsolute(position int) error {
+	return p.client.Call(remote.MethodSeek, remote.SeekParams{Position: &position}, nil)
+}
+
+func (p *remotePlayback) SetVolume(percentValue int) error {
+	return p.client.Call(remote.MethodVolume, remote.VolumeParams{Set: &percentValue}, nil)
+}
+
+func (p *remotePlayback) AdjustVolume(increment int) error {
+	return p.client.Call(remote.MethodVolume, remote.VolumeParams{Adjust: &increment}, nil)
+}
+
+func (p *remotePlayback) IsSeekable() (bool, error) {
+	var status remote.Status
+	if err := p.client.Call(remote.MethodStatus, nil, &status); err != nil {
+		return false, err
+	}
+	return status.State != remote.StateStopped, nil
+}
+
+func (p *remotePlayback) Status() remote.Status {
+	var status remote.Status
+	if err := p.client.Call(remote.MethodStatus, nil, &status); err != nil {
+		p.logger.PrintError("attach: status", err)
+		return remote.Status{State: remote.StateStopped}
+	}
+	return status
+}
+
+func (p *remotePlayback) GetQueueCopy() mpvplayer.PlayerQueue {
+	var tracks []remote.Track
+	if err := p.client.Call(remote.MethodQueue, nil, &tracks); err != nil {
+		p.logger.PrintError("attach: queue", err)
+		return mpvplayer.PlayerQueue{}
+	}
+	queue := make(mpvplayer.PlayerQueue, len(tracks))
+	for i, track := range tracks {
+		queue[i] = newQueueItem(track)
+	}
+	return queue
+}
+
+func (p *remotePlayback) AddSongs(entities ...subsonic.Entity) {
+	if len(entities) == 0 {
+		return
+	}
+	ids := make([]string, len(entities))
+	for i, entity := range entities {
+		ids[i] = entity.Id
+	}
+	if err := p.client.Call(remote.MethodEnqueue, remote.EnqueueParams{Ids: ids}, nil); err != nil {
+		p.logger.PrintError("attach: enqueue", err)
+	}
+}
+
+func (p *remotePlayback) AddSongsNext(entities ...subsonic.Entity) {
+	if len(entities) == 0 {
+		return
+	}
+	ids := make([]string, len(entities))
+	for i, entity := range entities {
+		ids[i] = entity.Id
+	}
+	if err := p.client.Call(remote.MethodEnqueue, remote.EnqueueParams{Ids: ids, Next: true}, nil); err != nil {
+		p.logger.PrintError("attach: enqueue next", err)
+	}
+}
+
+func (p *remotePlayback) PlaySong(entity subsonic.Entity) error {
+	return p.client.Call(remote.MethodPlayNow, remote.EnqueueParams{Ids: []string{entity.Id}}, nil)
+}
+
+func (p *remotePlayback) DeleteQueueItem(index int) error {
+	return p.client.Call(remote.MethodDelete, remote.IndexParams{Index: index}, nil)
+}
+
+func (p *remotePlayback) MoveQueueItem(from, to int) error {
+	return p.client.Call(remote.MethodMove, remote.MoveParams{From: from, To: to}, nil)
+}
+
+func (p *remotePlayback) DeleteQueueItems(indexes []int) error {
+	return p.client.Call(remote.MethodDelete, remote.IndexParams{Indexes: indexes}, nil)
+}
+
+func (p *remotePlayback) MoveQueueItems(indexes []int, to int) error {
+	return p.client.Call(remote.MethodMove, remote.MoveParams{Indexes: indexes, To: to}, nil)
+}
+
+func (p *remotePlayback) SetAutoDJ(enable bool) error {
+	return p.client.Call(remote.MethodAutoDJ, remote.AutoDJParams{Enable: enable}, nil)
+}
+
+func (p *remotePlayback) SetSleepTimer(params remote.SleepParams) error {
+	return p.client.Call(remote.MethodSleep, params, nil)
+}
+
+func (p *remotePlayback) SetStopAfter(index int, stop bool) error {
+	return p.client.Call(remote.MethodStopAfter, remote.StopAfterParams{Index: index, Stop: stop}, nil)
+}
+
+func (p *remotePlayback) PlayQueueItem(index int) error {
+	return p.client.Call(remote.MethodJump, remote.IndexParams{Index: index}, nil)
+}
+
+func (p *remotePlayback) ShuffleQueue() error {
+	return p.client.Call(remote.MethodShuffle, nil, nil)
+}
+
+func (p *remotePlayback) ClearQueue() error {
+	return p.client.Call(remote.MethodClear, nil, nil)
+}
+
+func (p *remotePlayback) UndoQueue() error {
+	return p.client.Call(remote.MethodUndo, nil, nil)
+}
+
+func (p *remotePlayback) RedoQueue() error {
+	return p.client.Call(remote.MethodRedo, nil, nil)
+}
+
+func (p *remotePlayback) RegisterEventConsumer(consumer mpvplayer.EventConsumer) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.consumers = append(p.consumers, consumer)
+}
+
+func (p *remotePlayback) OnQueueChanged(cb func()) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.queueChanged = cb
+}
+
+func (p *remotePlayback) Done() <-chan struct{} {
+	return p.done
+}
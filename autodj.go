@@ -0,0 +1,163 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spezifisch/stmps/subsonic"
+	"github.com/spf13/viper"
+)
+
+// how many of the songs played last the auto-DJ doesn't pick again
+const autoDJRecent = 200
+
+// songSource is where the auto-DJ gets songs from; *subsonic.Connection
+type songSource interface {
+	// GetRandomSongs returns songs similar to the song with the id
+	GetRandomSongs(id string) (subsonic.Entities, error)
+	GetSimilarSongs2(artistId string) (subsonic.Entities, error)
+	GetRandomSongsFiltered(filter subsonic.RandomSongsFilter) (subsonic.Entities, error)
+}
+
+// autoDJFilter limits the songs the auto-DJ picks. Zero values don't.
+type autoDJFilter struct {
+	Genre    string
+	FromYear int
+	ToYear   int
+}
+
+func (f autoDJFilter) matches(song subsonic.Entity) bool {
+	if f.Genre != "" && !strings.EqualFold(song.Genre, f.Genre) {
+		return false
+	}
+	if f.FromYear > 0 && song.Year < f.FromYear {
+		return false
+	}
+	if f.ToYear > 0 && (song.Year == 0 || song.Year > f.ToYear) {
+		return false
+	}
+	return true
+}
+
+// autoDJ keeps the queue filled: when fewer than minQueue songs are left after
+// the one playing, it picks songs similar to that one, or to its artist, or
+// else random ones. It doesn't pick songs that are queued or were played
+// recently.
+type autoDJ struct {
+	source   songSource
+	minQueue int
+	filter   autoDJFilter
+
+	lock    sync.Mutex
+	enabled bool
+	// ids of the songs played last, oldest first
+	recent []string
+	// the song played last, to seed from when the queue is empty
+	last mpvplayer.QueueItem
+}
+
+func newAutoDJ(source songSource) *autoDJ {
+	return &autoDJ{
+		source:   source,
+		minQueue: max(viper.GetInt("autodj.min-queue"), 1),
+		filter: autoDJFilter{
+			Genre:    viper.GetString("autodj.genre"),
+			FromYear: viper.GetInt("autodj.from-year"),
+			ToYear:   viper.GetInt("autodj.to-year"),
+		},
+		enabled: viper.GetBool("autodj.enable"),
+	}
+}
+
+func (dj *autoDJ) isEnabled() bool {
+	dj.lock.Lock()
+	defer dj.lock.Unlock()
+	return dj.enabled
+}
+
+func (dj *autoDJ) setEnabled(enabled bool) {
+	dj.lock.Lock()
+	defer dj.lock.Unlock()
+	dj.enabled = enabled
+}
+
+// songStarted remembers the song, to not pick it again for a while
+func (dj *autoDJ) songStarted(song mpvplayer.QueueItem) {
+	dj.lock.Lock()
+	defer dj.lock.Unlock()
+	dj.last = song
+	dj.recent = append(dj.recent, song.Id)
+	if len(dj.recent) > autoDJRecent {
+		dj.recent = dj.recent[len(dj.recent)-autoDJRecent:]
+	}
+}
+
+// songsToAdd returns the songs to add to the queue to have minQueue songs
+// after the one playing, none if the auto-DJ is off
+func (dj *autoDJ) songsToAdd(queue mpvplayer.PlayerQueue) ([]subsonic.Entity, error) {
+	dj.lock.Lock()
+	if !dj.enabled {
+		dj.lock.Unlock()
+		return nil, nil
+	}
+	seed := dj.last
+	if len(queue) > 0 {
+		// the song playing
+		seed = queue[0]
+	}
+	needed := dj.minQueue - max(len(queue)-1, 0)
+	exclude := make(map[string]bool, len(dj.recent)+len(queue))
+	for _, id := range dj.recent {
+		exclude[id] = true
+	}
+	dj.lock.Unlock()
+
+	if needed <= 0 {
+		return nil, nil
+	}
+	for _, song := range queue {
+		exclude[song.Id] = true
+	}
+
+	var picked []subsonic.Entity
+	var errs []error
+	pick := func(candidates subsonic.Entities, err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, song := range candidates {
+			if len(picked) == needed {
+				return
+			}
+			if song.IsDirectory || exclude[song.Id] || !dj.filter.matches(song) {
+				continue
+			}
+			exclude[song.Id] = true
+			picked = append(picked, song)
+		}
+	}
+
+	if seed.Id != "" {
+		pick(dj.source.GetRandomSongs(seed.Id))
+	}
+	if len(picked) < needed && seed.ArtistId != "" {
+		pick(dj.source.GetSimilarSongs2(seed.ArtistId))
+	}
+	if len(picked) < needed {
+		pick(dj.source.GetRandomSongsFiltered(subsonic.RandomSongsFilter{
+			Genre:    dj.filter.Genre,
+			FromYear: dj.filter.FromYear,
+			ToYear:   dj.filter.ToYear,
+		}))
+	}
+	if len(picked) > 0 {
+		// it's not a failure if one way to find songs didn't work
+		return picked, nil
+	}
+	return nil, errors.Join(errs...)
+}
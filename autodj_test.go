@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spezifisch/stmps/subsonic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSongSource returns songs with the ids it's given for each way of
+// finding them, and records how it was asked
+type fakeSongSource struct {
+	similar  []subsonic.Entity
+	similar2 []subsonic.Entity
+	random   []subsonic.Entity
+	calls    []string
+}
+
+func (f *fakeSongSource) GetRandomSongs(id string) (subsonic.Entities, error) {
+	f.calls = append(f.calls, "similar "+id)
+	if f.similar == nil {
+		return nil, errors.New("not found")
+	}
+	return f.similar, nil
+}
+
+func (f *fakeSongSource) GetSimilarSongs2(artistId string) (subsonic.Entities, error) {
+	f.calls = append(f.calls, "similar2 "+artistId)
+	return f.similar2, nil
+}
+
+func (f *fakeSongSource) GetRandomSongsFiltered(filter subsonic.RandomSongsFilter) (subsonic.Entities, error) {
+	f.calls = append(f.calls, "random "+filter.Genre)
+	return f.random, nil
+}
+
+func testSong(id, genre string, year int) subsonic.Entity {
+	var song subsonic.Entity
+	song.Id = id
+	song.Genre = genre
+	song.Year = year
+	return song
+}
+
+func entityIds(songs []subsonic.Entity) []string {
+	ids := make([]string, len(songs))
+	for i, song := range songs {
+		ids[i] = song.Id
+	}
+	return ids
+}
+
+func TestAutoDJSongsToAdd(t *testing.T) {
+	source := &fakeSongSource{
+		similar: []subsonic.Entity{
+			testSong("queued", "Rock", 1990),
+			testSong("played", "Rock", 1990),
+			testSong("s1", "Rock", 1990),
+			testSong("s1", "Rock", 1990),
+			testSong("s2", "Jazz", 1990),
+		},
+		similar2: []subsonic.Entity{testSong("a1", "rock", 1995)},
+		random:   []subsonic.Entity{testSong("r1", "Rock", 1980), testSong("r2", "Rock", 0), testSong("r3", "Rock", 1999)},
+	}
+	dj := &autoDJ{
+		source:   source,
+		minQueue: 4,
+		filter:   autoDJFilter{Genre: "Rock", FromYear: 1990, ToYear: 1999},
+		enabled:  true,
+	}
+	dj.songStarted(mpvplayer.QueueItem{Id: "played"})
+
+	queue := mpvplayer.PlayerQueue{{Id: "current", ArtistId: "artist"}, {Id: "queued"}}
+	songs, err := dj.songsToAdd(queue)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"s1", "a1", "r3"}, entityIds(songs))
+	assert.Equal(t, []string{"similar current", "similar2 artist", "random Rock"}, source.calls)
+
+	// enough songs queued
+	source.calls = nil
+	queue = append(queue, mpvplayer.QueueItem{Id: "x"}, mpvplayer.QueueItem{Id: "y"}, mpvplayer.QueueItem{Id: "z"})
+	songs, err = dj.songsToAdd(queue)
+	require.NoError(t, err)
+	assert.Empty(t, songs)
+	assert.Empty(t, source.calls)
+
+	dj.setEnabled(false)
+	songs, _ = dj.songsToAdd(nil)
+	assert.Empty(t, songs)
+}
+
+func TestAutoDJEmptyQueue(t *testing.T) {
+	source := &fakeSongSource{random: []subsonic.Entity{testSong("r1", "", 0)}}
+	dj := &autoDJ{source: source, minQueue: 2, enabled: true}
+
+	// nothing played yet, so only random songs
+	songs, err := dj.songsToAdd(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"r1"}, entityIds(songs))
+	assert.Equal(t, []string{"random "}, source.calls)
+
+	// then it goes on from the last song played
+	source.calls = nil
+	dj.songStarted(mpvplayer.QueueItem{Id: "last"})
+	_, err = dj.songsToAdd(nil)
+	assert.NoError(t, err, "finding songs in one way is enough")
+	assert.Equal(t, []string{"similar last", "random "}, source.calls)
+}
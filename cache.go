@@ -1,6 +1,9 @@
 package main
 
 import (
+	"slices"
+	"sync"
+
 	"github.com/spezifisch/stmps/logger"
 )
 
@@ -14,20 +17,33 @@ import (
 //
 // When an asset is requested, Cache returns the asset if it is cached.
 // Otherwise, it returns the zero object, and queues up a fetch for the object
-// in the background. When the fetch is complete, the callback function is
+// in the background. The last asset requested is fetched first, since it's
+// the one most likely still wanted, e.g. the cover art of an album that's on
+// screen; past maxQueuedFetches, the oldest requests are dropped. When the fetch is complete, the callback function is
 // called, allowing the caller to get the real asset. An invalidation function
 // allows Cache to manage the cache size by removing cached invalid objects.
 //
 // Caches are indexed by strings, because. They don't have to be, but
 // stmps doesn't need them to be anything different.
+//
+// A Cache can be used from several goroutines, and Get never blocks on
+// fetching; an asset that's being fetched isn't queued again while it's on
+// its way.
 type Cache[T any] struct {
-	zero       T
-	cache      map[string]T
-	pipeline   chan string
+	zero    T
+	cache   map[string]T
+	pending map[string]struct{}
+	lock    *sync.Mutex
+	// queue holds the keys waiting to be fetched, the next one last
+	queue      *[]string
+	wake       chan struct{}
 	quit       func()
 	cacheCheck func(string) string
 }
 
+// maxQueuedFetches is how many assets can wait to be fetched
+const maxQueuedFetches = 100
+
 // NewCache sets up a new cache, given
 //
 //   - a zeroValue, returned immediately on cache misses
@@ -49,44 +65,107 @@ func NewCache[T any](
 ) Cache[T] {
 
 	cache := make(map[string]T)
-	getPipe := make(chan string, 1000)
+	pending := make(map[string]struct{})
+	lock := &sync.Mutex{}
+	queue := &[]string{}
+	wake := make(chan struct{}, 1)
+	done := make(chan struct{})
+
+	// next takes the key to fetch next off the queue, or returns false once
+	// the queue is empty
+	next := func() (string, bool) {
+		lock.Lock()
+		defer lock.Unlock()
+		n := len(*queue)
+		if n == 0 {
+			return "", false
+		}
+		key := (*queue)[n-1]
+		*queue = (*queue)[:n-1]
+		return key, true
+	}
 
 	go func() {
-		for i := range getPipe {
-			asset, err := fetcher(i)
-			if err != nil {
-				logger.Printf("error fetching asset %s: %s", i, err)
-				continue
+		for {
+			select {
+			case <-done:
+				return
+			case <-wake:
 			}
-			cache[i] = asset
-			if remove := cacheCheck(i); remove != "" {
-				delete(cache, remove)
+			for key, ok := next(); ok; key, ok = next() {
+				asset, err := fetcher(key)
+				lock.Lock()
+				delete(pending, key)
+				if err != nil {
+					lock.Unlock()
+					logger.Printf("error fetching asset %s: %s", key, err)
+					continue
+				}
+				cache[key] = asset
+				if remove := cacheCheck(key); remove != "" {
+					delete(cache, remove)
+				}
+				lock.Unlock()
+				fetchedItem(key, asset)
+
+				select {
+				case <-done:
+					return
+				default:
+				}
 			}
-			fetchedItem(i, asset)
 		}
 	}()
 
 	return Cache[T]{
-		zero:     zeroValue,
-		cache:    cache,
-		pipeline: getPipe,
+		zero:    zeroValue,
+		cache:   cache,
+		pending: pending,
+		lock:    lock,
+		queue:   queue,
+		wake:    wake,
 		quit: func() {
-			close(getPipe)
+			close(done)
 		},
 		cacheCheck: cacheCheck,
 	}
 }
 
 // Get returns a cached asset, or the zero asset on a cache miss.
-// On a cache miss, the requested asset is queued for fetching.
+// On a cache miss, the requested asset is queued for fetching, unless it
+// already is.
 func (c *Cache[T]) Get(key string) T {
+	c.lock.Lock()
 	if v, ok := c.cache[key]; ok {
 		// We're just touching something in the cache, not putting anything in it,
 		// so we just call cacheCheck to refresh this key
 		c.cacheCheck(key)
+		c.lock.Unlock()
 		return v
 	}
-	c.pipeline <- key
+	if _, ok := c.pending[key]; ok {
+		// wanted again, so it goes first, unless it's being fetched already
+		if i := slices.Index(*c.queue, key); i >= 0 {
+			*c.queue = append(slices.Delete(*c.queue, i, i+1), key)
+		}
+		c.lock.Unlock()
+		return c.zero
+	}
+	c.pending[key] = struct{}{}
+	*c.queue = append(*c.queue, key)
+	if len(*c.queue) > maxQueuedFetches {
+		// it's been a while since this was asked for; it's queued again
+		// if it still is
+		delete(c.pending, (*c.queue)[0])
+		*c.queue = slices.Delete(*c.queue, 0, 1)
+	}
+	c.lock.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+		// the fetching goroutine is awake already
+	}
 	return c.zero
 }
 
@@ -99,8 +178,10 @@ func (c *Cache[T]) Get(key string) T {
 // mechanism may change and use other system resources, it's good practice to
 // call this on exit.
 func (c Cache[T]) Close() {
-	for k := range c.cache {
-		delete(c.cache, k)
-	}
+	c.lock.Lock()
+	clear(c.cache)
+	clear(c.pending)
+	*c.queue = nil
+	c.lock.Unlock()
 	c.quit()
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"strconv"
 	"testing"
 	"time"
 
@@ -16,8 +17,7 @@ func TestNewCache(t *testing.T) {
 			zero,
 			func(k string) (string, error) { return zero, nil },
 			func(k, v string) {},
-			func(k string) bool { return false },
-			time.Second,
+			func(k string) string { return "" },
 			&logger,
 		)
 		defer c.Close()
@@ -27,8 +27,8 @@ func TestNewCache(t *testing.T) {
 		if c.cache == nil || len(c.cache) != 0 {
 			t.Errorf("expected non-nil, empty map; got %#v", c.cache)
 		}
-		if c.pipeline == nil {
-			t.Errorf("expected non-nil chan; got %#v", c.pipeline)
+		if c.queue == nil {
+			t.Errorf("expected non-nil queue; got %#v", c.queue)
 		}
 	})
 
@@ -38,8 +38,7 @@ func TestNewCache(t *testing.T) {
 			zero,
 			func(k string) (int, error) { return zero, nil },
 			func(k string, v int) {},
-			func(k string) bool { return false },
-			time.Second,
+			func(k string) string { return "" },
 			&logger,
 		)
 		defer c.Close()
@@ -49,8 +48,8 @@ func TestNewCache(t *testing.T) {
 		if c.cache == nil || len(c.cache) != 0 {
 			t.Errorf("expected non-nil, empty map; got %#v", c.cache)
 		}
-		if c.pipeline == nil {
-			t.Errorf("expected non-nil chan; got %#v", c.pipeline)
+		if c.queue == nil {
+			t.Errorf("expected non-nil queue; got %#v", c.queue)
 		}
 	})
 }
@@ -65,8 +64,7 @@ func TestGet(t *testing.T) {
 			return items[k], nil
 		},
 		func(k, v string) {},
-		func(k string) bool { return false },
-		time.Second,
+		func(k string) string { return "" },
 		&logger,
 	)
 	defer c.Close()
@@ -90,7 +88,8 @@ func TestGet(t *testing.T) {
 func TestCallback(t *testing.T) {
 	logger := logger.Logger{}
 	zero := "zero"
-	var gotK, gotV string
+	type fetched struct{ k, v string }
+	got := make(chan fetched, 1)
 	expectedK := "a"
 	expectedV := "1"
 	c := NewCache(
@@ -99,110 +98,180 @@ func TestCallback(t *testing.T) {
 			return expectedV, nil
 		},
 		func(k, v string) {
-			gotK = k
-			gotV = v
+			got <- fetched{k, v}
 		},
-		func(k string) bool { return false },
-		time.Second,
+		func(k string) string { return "" },
 		&logger,
 	)
 	defer c.Close()
 	t.Run("callback gets called back", func(t *testing.T) {
 		c.Get(expectedK)
-		// Give the callback goroutine a chance to do its thing
-		time.Sleep(time.Millisecond)
-		if gotK != expectedK {
-			t.Errorf("expected key %q, got %q", expectedV, gotV)
-		}
-		if gotV != expectedV {
-			t.Errorf("expected value %q, got %q", expectedV, gotV)
+		select {
+		case f := <-got:
+			if f.k != expectedK {
+				t.Errorf("expected key %q, got %q", expectedK, f.k)
+			}
+			if f.v != expectedV {
+				t.Errorf("expected value %q, got %q", expectedV, f.v)
+			}
+		case <-time.After(time.Second):
+			t.Error("callback wasn't called")
 		}
 	})
 }
 
 func TestClose(t *testing.T) {
 	logger := logger.Logger{}
-	t.Run("pipeline is closed", func(t *testing.T) {
+	t.Run("nothing is fetched after closing", func(t *testing.T) {
+		fetched := make(chan struct{}, 2)
 		c0 := NewCache(
 			"",
 			func(k string) (string, error) { return "A", nil },
-			func(k, v string) {},
-			func(k string) bool { return false },
-			time.Second,
+			func(k, v string) { fetched <- struct{}{} },
+			func(k string) string { return "" },
 			&logger,
 		)
+		size := func() int {
+			c0.lock.Lock()
+			defer c0.lock.Unlock()
+			return len(c0.cache)
+		}
 		// Put something in the cache
 		c0.Get("")
-		// Give the cache time to populate the cache
-		time.Sleep(time.Millisecond)
+		// Wait for the cache to populate the cache
+		select {
+		case <-fetched:
+		case <-time.After(time.Second):
+		}
 		// Make sure the cache isn't empty
-		if len(c0.cache) == 0 {
+		if size() == 0 {
 			t.Fatalf("expected the cache to be non-empty, but it was. Probably a threading issue with the test, and we need a longer timeout.")
 		}
-		defer func() {
-			if r := recover(); r == nil {
-				t.Error("expected panic on pipeline use; got none")
-			}
-		}()
 		c0.Close()
-		if len(c0.cache) > 0 {
-			t.Errorf("expected empty cache; was %d", len(c0.cache))
+		if n := size(); n > 0 {
+			t.Errorf("expected empty cache; was %d", n)
+		}
+		if got := c0.Get("b"); got != "" {
+			t.Errorf("expected the zero value; got %q", got)
+		}
+		select {
+		case <-fetched:
+			t.Error("fetched after closing")
+		case <-time.After(10 * time.Millisecond):
 		}
-		c0.Get("")
 	})
+}
 
-	t.Run("callback gets called back", func(t *testing.T) {
-		c0 := NewCache(
-			"",
-			func(k string) (string, error) { return "", nil },
-			func(k, v string) {},
-			func(k string) bool { return false },
-			time.Second,
-			&logger,
-		)
-		defer func() {
-			if r := recover(); r == nil {
-				t.Error("expected panic on pipeline use; got none")
+func TestFetchOrder(t *testing.T) {
+	logger := logger.Logger{}
+	fetches := make(chan string, maxQueuedFetches+10)
+	release := make(chan struct{})
+	c := NewCache(
+		"",
+		func(k string) (string, error) {
+			fetches <- k
+			<-release
+			return k, nil
+		},
+		func(k, v string) {},
+		func(k string) string { return "" },
+		&logger,
+	)
+	defer c.Close()
+
+	// hold up the fetcher with one, and queue others meanwhile
+	c.Get("busy")
+	if got := <-fetches; got != "busy" {
+		t.Fatalf("expected %q to be fetched; got %q", "busy", got)
+	}
+	for i := 0; i < maxQueuedFetches+1; i++ {
+		c.Get(strconv.Itoa(i))
+	}
+	// wanted again, e.g. since it's still on screen
+	c.Get("5")
+	close(release)
+
+	want := []string{"5", strconv.Itoa(maxQueuedFetches), strconv.Itoa(maxQueuedFetches - 1)}
+	for _, w := range want {
+		select {
+		case got := <-fetches:
+			if got != w {
+				t.Errorf("expected %q to be fetched; got %q", w, got)
 			}
-		}()
-		c0.Close()
-		c0.Get("")
-	})
+		case <-time.After(time.Second):
+			t.Fatalf("%q wasn't fetched", w)
+		}
+	}
+	// the first one was dropped, and isn't pending anymore
+	time.Sleep(10 * time.Millisecond)
+	c.lock.Lock()
+	_, pending := c.pending["0"]
+	c.lock.Unlock()
+	if pending {
+		t.Error("expected the oldest request to be dropped")
+	}
 }
 
 func TestInvalidate(t *testing.T) {
 	logger := logger.Logger{}
 	zero := "zero"
-	var gotV string
-	expected := "1"
+	items := map[string]string{"a": "1", "b": "2"}
+	lru := NewLRU(1)
 	c := NewCache(
 		zero,
 		func(k string) (string, error) {
-			return expected, nil
-		},
-		func(k, v string) {
-			gotV = v
-		},
-		func(k string) bool {
-			return true
+			return items[k], nil
 		},
-		500*time.Millisecond,
+		func(k, v string) {},
+		lru.Touch,
 		&logger,
 	)
 	defer c.Close()
-	t.Run("basic invalidation", func(t *testing.T) {
-		if c.Get("a") != zero {
-			t.Errorf("expected %q, got %q", zero, gotV)
+	t.Run("least recently used is removed", func(t *testing.T) {
+		if got := c.Get("a"); got != zero {
+			t.Errorf("expected %q, got %q", zero, got)
 		}
 		// Give the callback goroutine a chance to do its thing
 		time.Sleep(time.Millisecond)
-		if c.Get("a") != expected {
-			t.Errorf("expected %q, got %q", expected, gotV)
+		if got := c.Get("a"); got != "1" {
+			t.Errorf("expected %q, got %q", "1", got)
+		}
+		c.Get("b")
+		time.Sleep(time.Millisecond)
+		if got := c.Get("b"); got != "2" {
+			t.Errorf("expected %q, got %q", "2", got)
 		}
-		// Give the invalidation time to be called
-		time.Sleep(600 * time.Millisecond)
-		if c.Get("a") != zero {
-			t.Errorf("expected %q, got %q", zero, gotV)
+		// the cache holds only one item, so a was pushed out by b
+		if got := c.Get("a"); got != zero {
+			t.Errorf("expected %q, got %q", zero, got)
+		}
+	})
+}
+
+func TestPending(t *testing.T) {
+	logger := logger.Logger{}
+	fetches := make(chan string, 10)
+	release := make(chan struct{})
+	c := NewCache(
+		"",
+		func(k string) (string, error) {
+			fetches <- k
+			<-release
+			return k, nil
+		},
+		func(k, v string) {},
+		func(k string) string { return "" },
+		&logger,
+	)
+	defer c.Close()
+	t.Run("a pending asset is fetched once", func(t *testing.T) {
+		c.Get("a")
+		c.Get("a")
+		c.Get("a")
+		close(release)
+		time.Sleep(time.Millisecond)
+		if len(fetches) != 1 {
+			t.Errorf("expected 1 fetch, got %d", len(fetches))
 		}
 	})
 }
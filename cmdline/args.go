@@ -0,0 +1,159 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package cmdline
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseTime parses a position in seconds ("90") or minutes and seconds
+// ("1:30"). With a sign ("+10", "-0:15"), it's relative to the current
+// position.
+func ParseTime(s string) (seconds int, relative bool, err error) {
+	sign := 1
+	t := s
+	switch {
+	case strings.HasPrefix(t, "-"):
+		sign, relative, t = -1, true, t[1:]
+	case strings.HasPrefix(t, "+"):
+		relative, t = true, t[1:]
+	}
+	min, sec, hasMinutes := strings.Cut(t, ":")
+	if !hasMinutes {
+		min, sec = "0", t
+	}
+	m, err := strconv.Atoi(min)
+	if err != nil || m < 0 {
+		return 0, false, fmt.Errorf("invalid time %q", s)
+	}
+	n, err := strconv.Atoi(sec)
+	if err != nil || n < 0 || (hasMinutes && n > 59) {
+		return 0, false, fmt.Errorf("invalid time %q", s)
+	}
+	return sign * (m*60 + n), relative, nil
+}
+
+// ParseVolume parses a volume in percent ("40"), or with a sign ("+5",
+// "-10"), a change of the volume
+func ParseVolume(s string) (percent int, relative bool, err error) {
+	relative = strings.HasPrefix(s, "+") || strings.HasPrefix(s, "-")
+	percent, err = strconv.Atoi(s)
+	if err != nil || (!relative && (percent < 0 || percent > 100)) {
+		return 0, false, fmt.Errorf("invalid volume %q", s)
+	}
+	return percent, relative, nil
+}
+
+// RandomOptions are the options of ":random", e.g. "genre=Jazz 30" or
+// "year=1990-1999 folder=2"
+type RandomOptions struct {
+	// 0 is the configured number
+	Size          int
+	Genre         string
+	FromYear      int
+	ToYear        int
+	MusicFolderId string
+}
+
+// ParseRandom parses the arguments of ":random": a number of songs, and
+// key=value filters genre, year (a year or a range, e.g. 1990-1999), from,
+// to, and folder
+func ParseRandom(args []string) (RandomOptions, error) {
+	var options RandomOptions
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			size, err := strconv.Atoi(arg)
+			if err != nil || size <= 0 {
+				return options, fmt.Errorf("invalid number of songs %q", arg)
+			}
+			options.Size = size
+			continue
+		}
+
+		var err error
+		switch strings.ToLower(key) {
+		case "genre":
+			options.Genre = value
+		case "year":
+			from, to, isRange := strings.Cut(value, "-")
+			if options.FromYear, err = parseYear(from); err != nil {
+				return options, err
+			}
+			options.ToYear = options.FromYear
+			if isRange {
+				options.ToYear, err = parseYear(to)
+			}
+		case "from":
+			options.FromYear, err = parseYear(value)
+		case "to":
+			options.ToYear, err = parseYear(value)
+		case "folder":
+			options.MusicFolderId = value
+		default:
+			return options, fmt.Errorf("unknown option %q", key)
+		}
+		if err != nil {
+			return options, err
+		}
+	}
+	if options.FromYear != 0 && options.ToYear != 0 && options.FromYear > options.ToYear {
+		return options, fmt.Errorf("%d is after %d", options.FromYear, options.ToYear)
+	}
+	return options, nil
+}
+
+func parseYear(s string) (int, error) {
+	year, err := strconv.Atoi(s)
+	if err != nil || year < 0 {
+		return 0, fmt.Errorf("invalid year %q", s)
+	}
+	return year, nil
+}
+
+// SleepOptions are the arguments of a sleep timer, e.g. "30 fade"
+type SleepOptions struct {
+	// Mode is "minutes", "track", "album", or "off"
+	Mode    string
+	Minutes int
+	Fade    bool
+}
+
+// ParseSleep parses the arguments of a sleep timer: a number of minutes (or
+// a duration like 1h30m), "track", "album", or "off", and optionally "fade"
+// to fade out over the last minute
+func ParseSleep(args []string) (SleepOptions, error) {
+	var options SleepOptions
+	if len(args) > 0 && (args[len(args)-1] == "fade" || args[len(args)-1] == "--fade") {
+		options.Fade = true
+		args = args[:len(args)-1]
+	}
+	if len(args) != 1 {
+		return options, fmt.Errorf("expected minutes, track, album, or off")
+	}
+
+	switch arg := strings.ToLower(args[0]); arg {
+	case "track", "album", "off":
+		options.Mode = arg
+		return options, nil
+	default:
+		options.Mode = "minutes"
+		minutes, err := strconv.Atoi(arg)
+		if err != nil {
+			duration, durationErr := time.ParseDuration(arg)
+			if durationErr != nil {
+				return options, fmt.Errorf("invalid time %q", args[0])
+			}
+			minutes = int(duration.Round(time.Minute) / time.Minute)
+		}
+		if minutes <= 0 {
+			return options, fmt.Errorf("invalid time %q", args[0])
+		}
+		options.Minutes = minutes
+		return options, nil
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+// Package cmdline parses the commands typed at the ":" prompt, e.g.
+// ":add artist Radiohead" or ":seek 1:30", and completes them. It doesn't
+// know about the UI; what a command does is up to the caller.
+package cmdline
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Command is a parsed command line
+type Command struct {
+	Name string
+	// the command was given with a trailing !, e.g. :save! to overwrite
+	Bang bool
+	Args []string
+}
+
+// Rest returns the arguments from the nth on as one string, for arguments
+// that are names with spaces, e.g. the playlist name of ":save My Playlist"
+func (c Command) Rest(n int) string {
+	if n >= len(c.Args) {
+		return ""
+	}
+	return strings.Join(c.Args[n:], " ")
+}
+
+// Parse parses a command line. A leading ":" is optional. Arguments are
+// separated by spaces, unless quoted with " or ' at the start of the
+// argument, and \ escapes the next character.
+func Parse(line string) (Command, error) {
+	line = strings.TrimPrefix(strings.TrimSpace(line), ":")
+	words, err := Split(line)
+	if err != nil {
+		return Command{}, err
+	}
+	if len(words) == 0 {
+		return Command{}, errors.New("no command")
+	}
+	command := Command{Name: words[0], Args: words[1:]}
+	if strings.HasSuffix(command.Name, "!") {
+		command.Name = strings.TrimSuffix(command.Name, "!")
+		command.Bang = true
+	}
+	if command.Name == "" {
+		return Command{}, errors.New("no command")
+	}
+	return command, nil
+}
+
+// Split splits a line into words, like Parse
+func Split(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case (r == '"' || r == '\'') && !inWord:
+			// only at the start of a word, so that names like Guns N' Roses
+			// don't need quotes
+			quote = r
+			inWord = true
+		case unicode.IsSpace(r):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("missing closing %c", quote)
+	}
+	if escaped {
+		return nil, errors.New("nothing to escape at the end")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// Join joins words into a line that Split splits into the same words
+func Join(words []string) string {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = Quote(word)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Quote quotes a word for a command line, if it needs it
+func Quote(word string) string {
+	if word != "" && !strings.ContainsAny(word, " \t\\") && !strings.ContainsAny(word[:1], "\"'") {
+		return word
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(word) + `"`
+}
@@ -0,0 +1,344 @@
+package cmdline
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		line string
+		want Command
+	}{
+		{":add artist Radiohead", Command{Name: "add", Args: []string{"artist", "Radiohead"}}},
+		{"seek 1:30", Command{Name: "seek", Args: []string{"1:30"}}},
+		{":save! My Playlist", Command{Name: "save", Bang: true, Args: []string{"My", "Playlist"}}},
+		{`:add album "OK Computer"`, Command{Name: "add", Args: []string{"album", "OK Computer"}}},
+		{`:add artist Guns N' Roses`, Command{Name: "add", Args: []string{"artist", "Guns", "N'", "Roses"}}},
+		{`:add song a\ b 'c "d"'`, Command{Name: "add", Args: []string{"song", "a b", `c "d"`}}},
+		{"  :vol   40  ", Command{Name: "vol", Args: []string{"40"}}},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.line)
+		if err != nil {
+			t.Errorf("%q: %v", test.line, err)
+			continue
+		}
+		if got.Args == nil {
+			got.Args = []string{}
+		}
+		if test.want.Args == nil {
+			test.want.Args = []string{}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %+v, want %+v", test.line, got, test.want)
+		}
+	}
+
+	for _, line := range []string{"", ":", " : ", "!", `:add "x`, `:add x\`} {
+		if _, err := Parse(line); err == nil {
+			t.Errorf("%q: no error", line)
+		}
+	}
+
+	command, _ := Parse(":save My  Playlist")
+	if rest := command.Rest(0); rest != "My Playlist" {
+		t.Errorf("rest: %q", rest)
+	}
+	if rest := command.Rest(2); rest != "" {
+		t.Errorf("rest after the end: %q", rest)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	for _, word := range []string{"Radiohead", "OK Computer", "", `a"b`, `"x`, "'x", `back\slash`, "N'"} {
+		words, err := Split("add " + Quote(word))
+		if err != nil || len(words) != 2 || words[1] != word {
+			t.Errorf("%q quoted as %s splits to %q, %v", word, Quote(word), words, err)
+		}
+	}
+	words := []string{"year>2000", "name~live at", ""}
+	if split, err := Split(Join(words)); err != nil || !reflect.DeepEqual(split, words) {
+		t.Errorf("joined as %s splits to %q, %v", Join(words), split, err)
+	}
+	if q := Quote("Radiohead"); q != "Radiohead" {
+		t.Errorf("quoted needlessly: %s", q)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		s        string
+		seconds  int
+		relative bool
+	}{
+		{"90", 90, false},
+		{"1:30", 90, false},
+		{"0:05", 5, false},
+		{"+10", 10, true},
+		{"-0:15", -15, true},
+		{"61:00", 3660, false},
+	}
+	for _, test := range tests {
+		seconds, relative, err := ParseTime(test.s)
+		if err != nil || seconds != test.seconds || relative != test.relative {
+			t.Errorf("%q: got %d, %v, %v", test.s, seconds, relative, err)
+		}
+	}
+	for _, s := range []string{"", "x", "1:60", "1:-1", "--1", "1:2:3"} {
+		if _, _, err := ParseTime(s); err == nil {
+			t.Errorf("%q: no error", s)
+		}
+	}
+}
+
+func TestParseVolume(t *testing.T) {
+	tests := []struct {
+		s        string
+		percent  int
+		relative bool
+	}{
+		{"40", 40, false},
+		{"0", 0, false},
+		{"+5", 5, true},
+		{"-10", -10, true},
+	}
+	for _, test := range tests {
+		percent, relative, err := ParseVolume(test.s)
+		if err != nil || percent != test.percent || relative != test.relative {
+			t.Errorf("%q: got %d, %v, %v", test.s, percent, relative, err)
+		}
+	}
+	for _, s := range []string{"", "loud", "101", "40%"} {
+		if _, _, err := ParseVolume(s); err == nil {
+			t.Errorf("%q: no error", s)
+		}
+	}
+}
+
+func TestParseRandom(t *testing.T) {
+	tests := []struct {
+		args []string
+		want RandomOptions
+	}{
+		{nil, RandomOptions{}},
+		{[]string{"genre=Jazz", "30"}, RandomOptions{Size: 30, Genre: "Jazz"}},
+		{[]string{"year=1990-1999"}, RandomOptions{FromYear: 1990, ToYear: 1999}},
+		{[]string{"year=1997"}, RandomOptions{FromYear: 1997, ToYear: 1997}},
+		{[]string{"from=2000", "folder=3"}, RandomOptions{FromYear: 2000, MusicFolderId: "3"}},
+	}
+	for _, test := range tests {
+		got, err := ParseRandom(test.args)
+		if err != nil || got != test.want {
+			t.Errorf("%q: got %+v, %v", test.args, got, err)
+		}
+	}
+	for _, args := range [][]string{{"0"}, {"many"}, {"year=199x"}, {"from=2000", "to=1990"}, {"mood=happy"}} {
+		if _, err := ParseRandom(args); err == nil {
+			t.Errorf("%q: no error", args)
+		}
+	}
+}
+
+func TestParseSleep(t *testing.T) {
+	tests := []struct {
+		args []string
+		want SleepOptions
+	}{
+		{[]string{"30"}, SleepOptions{Mode: "minutes", Minutes: 30}},
+		{[]string{"1h30m", "fade"}, SleepOptions{Mode: "minutes", Minutes: 90, Fade: true}},
+		{[]string{"Track", "--fade"}, SleepOptions{Mode: "track", Fade: true}},
+		{[]string{"album"}, SleepOptions{Mode: "album"}},
+		{[]string{"off"}, SleepOptions{Mode: "off"}},
+	}
+	for _, test := range tests {
+		got, err := ParseSleep(test.args)
+		if err != nil || got != test.want {
+			t.Errorf("%q: got %+v, %v", test.args, got, err)
+		}
+	}
+	for _, args := range [][]string{nil, {"fade"}, {"0"}, {"10s"}, {"soon"}, {"30", "40"}} {
+		if _, err := ParseSleep(args); err == nil {
+			t.Errorf("%q: no error", args)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	fields := []string{"name", "year", "genre"}
+	filter, err := ParseFilter("year>2000 genre=jazz live", fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Filter{{"year", ">", "2000"}, {"genre", "=", "jazz"}, {"name", "~", "live"}}
+	if !reflect.DeepEqual(filter, want) {
+		t.Fatalf("got %+v", filter)
+	}
+	if s := filter.String(); s != "year>2000 genre=jazz live" {
+		t.Errorf("string: %s", s)
+	}
+
+	tests := []struct {
+		fields Fields
+		match  bool
+	}{
+		{Fields{"name": "Live at Montreux", "year": "2004", "genre": "Jazz"}, true},
+		{Fields{"name": "Live at Montreux", "year": "1999", "genre": "Jazz"}, false},
+		{Fields{"name": "Studio", "year": "2004", "genre": "Jazz"}, false},
+		{Fields{"name": "Live", "year": "2004", "genre": "Jazz Fusion"}, false},
+		{Fields{"name": "Live"}, false},
+	}
+	for _, test := range tests {
+		if got := filter.Match(test.fields); got != test.match {
+			t.Errorf("%v: got %v", test.fields, got)
+		}
+	}
+
+	// numbers are compared as numbers, other values as text
+	if !(Condition{"year", "<", "1000"}).Match("999") {
+		t.Error("999 < 1000")
+	}
+	if !(Condition{"name", ">=", "b"}).Match("Beatles") {
+		t.Error("Beatles >= b")
+	}
+	if !(Condition{"genre", "!=", "rock"}).Match("Jazz") {
+		t.Error("Jazz != rock")
+	}
+
+	if _, err := ParseFilter("mood=happy", fields); err == nil {
+		t.Error("unknown field accepted")
+	}
+	if filter, err := ParseFilter("", fields); err != nil || len(filter) != 0 {
+		t.Errorf("empty filter: %v, %v", filter, err)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	names := map[string][]string{
+		"artist":   {"Radiohead", "Rage Against the Machine", "The Radio Dept."},
+		"playlist": {"My Playlist", "Mixtape"},
+	}
+	c := Completer{
+		Specs: []Spec{
+			{Name: "add", Args: func(args []string) ([]string, string) {
+				if len(args) == 0 {
+					return []string{"artist", "album", "song"}, ""
+				}
+				return nil, args[0]
+			}},
+			{Name: "save", Args: func(args []string) ([]string, string) {
+				return nil, "playlist"
+			}},
+			{Name: "seek"},
+			{Name: "stop"},
+		},
+		Names: func(kind, prefix string) []string {
+			return MatchNames(names[kind], prefix, 0)
+		},
+	}
+
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", []string{"add", "save", "seek", "stop"}},
+		{"s", []string{"save", "seek", "stop"}},
+		{"se", []string{"seek"}},
+		{"add ", []string{"add artist", "add album", "add song"}},
+		{"add AL", []string{"add album"}},
+		{"add artist ra", []string{"add artist Radiohead", "add artist Rage Against the Machine", "add artist The Radio Dept."}},
+		{"add artist rage a", []string{"add artist Rage Against the Machine"}},
+		{"save! M", []string{"save! Mixtape", "save! My Playlist"}},
+		{"save my p", []string{"save My Playlist"}},
+		{"seek 1", nil},
+		{"nope ", nil},
+		{`add "x`, nil},
+	}
+	for _, test := range tests {
+		if got := c.Complete(test.line); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+func TestMatchNames(t *testing.T) {
+	names := []string{"b", "ab", "a", "ba", "a"}
+	if got := MatchNames(names, "A", 0); !reflect.DeepEqual(got, []string{"a", "ab", "ba"}) {
+		t.Errorf("got %q", got)
+	}
+	if got := MatchNames(names, "a", 2); !reflect.DeepEqual(got, []string{"a", "ab"}) {
+		t.Errorf("limited: got %q", got)
+	}
+}
+
+func TestCommonPrefix(t *testing.T) {
+	tests := []struct {
+		lines []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"add album"}, "add album"},
+		{[]string{"add album", "add artist"}, "add a"},
+		// É and È only share their first byte
+		{[]string{"add album Élan", "add album Èze"}, "add album "},
+		{[]string{"shuffle", "add"}, ""},
+	}
+	for _, test := range tests {
+		if got := CommonPrefix(test.lines); got != test.want {
+			t.Errorf("%q: got %q, want %q", test.lines, got, test.want)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	h := NewHistory(3)
+	for _, line := range []string{"one", "two", "two", " ", "three", "four"} {
+		h.Add(line)
+	}
+	if got := h.Entries(); !reflect.DeepEqual(got, []string{"two", "three", "four"}) {
+		t.Fatalf("entries: %q", got)
+	}
+
+	steps := []struct {
+		previous bool
+		want     string
+		ok       bool
+	}{
+		{true, "four", true},
+		{true, "three", true},
+		{true, "two", true},
+		{true, "draft", false},
+		{false, "three", true},
+		{false, "four", true},
+		{false, "draft", true},
+		{false, "draft", false},
+	}
+	for i, step := range steps {
+		var line string
+		var ok bool
+		if step.previous {
+			line, ok = h.Previous("draft")
+		} else {
+			line, ok = h.Next()
+		}
+		if line != step.want || ok != step.ok {
+			t.Errorf("step %d: got %q, %v, want %q, %v", i, line, ok, step.want, step.ok)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "stmps", "history")
+	if err := h.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadHistory(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Entries(); !reflect.DeepEqual(got, []string{"three", "four"}) {
+		t.Errorf("loaded: %q", got)
+	}
+	if missing, err := LoadHistory(filepath.Join(t.TempDir(), "missing"), 2); err != nil || len(missing.Entries()) != 0 {
+		t.Errorf("missing file: %v, %v", missing.Entries(), err)
+	}
+}
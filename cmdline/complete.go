@@ -0,0 +1,160 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package cmdline
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Spec describes a command for completion and the help
+type Spec struct {
+	Name string
+	// the arguments, e.g. "artist|album|song <name>"
+	Usage string
+	Help  string
+	// Args says what the argument after args can be: one of choices, or a
+	// name of the kind (see Completer.Names) that takes the rest of the line.
+	// It may be nil if the arguments can't be completed.
+	Args func(args []string) (choices []string, kind string)
+}
+
+// Completer completes command lines
+type Completer struct {
+	Specs []Spec
+	// Names returns the names of a kind, e.g. artist, album, or playlist
+	// names, that match a prefix
+	Names func(kind, prefix string) []string
+}
+
+// Find returns the spec of a command, or nil
+func (c *Completer) Find(name string) *Spec {
+	for i := range c.Specs {
+		if c.Specs[i].Name == name {
+			return &c.Specs[i]
+		}
+	}
+	return nil
+}
+
+// Complete returns the lines that the line can be completed to: the command
+// names that start with it, or when the name is complete, the choices or
+// names for the argument being typed
+func (c *Completer) Complete(line string) []string {
+	words, err := Split(line)
+	if err != nil {
+		return nil
+	}
+	last, _ := utf8.DecodeLastRuneInString(line)
+	trailingSpace := line != "" && unicode.IsSpace(last)
+
+	if len(words) == 0 || (len(words) == 1 && !trailingSpace) {
+		prefix := ""
+		if len(words) == 1 {
+			prefix = words[0]
+		}
+		var lines []string
+		for _, spec := range c.Specs {
+			if strings.HasPrefix(spec.Name, prefix) {
+				lines = append(lines, spec.Name)
+			}
+		}
+		return lines
+	}
+
+	spec := c.Find(strings.TrimSuffix(words[0], "!"))
+	if spec == nil || spec.Args == nil {
+		return nil
+	}
+	args := words[1:]
+	prefix := ""
+	if !trailingSpace {
+		prefix, args = args[len(args)-1], args[:len(args)-1]
+	}
+
+	// the line up to the argument at i
+	head := func(i int) string {
+		quoted := make([]string, 0, i+1)
+		quoted = append(quoted, words[0])
+		for _, arg := range args[:i] {
+			quoted = append(quoted, Quote(arg))
+		}
+		return strings.Join(quoted, " ") + " "
+	}
+
+	for i := 0; i <= len(args); i++ {
+		choices, kind := spec.Args(args[:i])
+		if kind != "" {
+			if c.Names == nil {
+				return nil
+			}
+			// names may have spaces, so the rest of the line is the prefix
+			rest := strings.Join(append(append([]string{}, args[i:]...), prefix), " ")
+			rest = strings.TrimLeft(rest, " ")
+			var lines []string
+			for _, name := range c.Names(kind, rest) {
+				lines = append(lines, head(i)+name)
+			}
+			return lines
+		}
+		if i == len(args) {
+			var lines []string
+			for _, choice := range choices {
+				if strings.HasPrefix(strings.ToLower(choice), strings.ToLower(prefix)) {
+					lines = append(lines, head(i)+Quote(choice))
+				}
+			}
+			return lines
+		}
+	}
+	return nil
+}
+
+// CommonPrefix returns what all lines start with, in whole runes
+func CommonPrefix(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	prefix := lines[0]
+	for _, line := range lines[1:] {
+		for !strings.HasPrefix(line, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
+
+// MatchNames returns the names that start with the prefix, ignoring case,
+// followed by the ones that contain it, sorted and without duplicates, at
+// most max of them. It's for implementing Completer.Names.
+func MatchNames(names []string, prefix string, max int) []string {
+	prefix = strings.ToLower(prefix)
+	var starting, containing []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		lower := strings.ToLower(name)
+		switch {
+		case strings.HasPrefix(lower, prefix):
+			starting = append(starting, name)
+		case strings.Contains(lower, prefix):
+			containing = append(containing, name)
+		default:
+			continue
+		}
+		seen[name] = true
+	}
+	sort.Strings(starting)
+	sort.Strings(containing)
+	matches := append(starting, containing...)
+	if max > 0 && len(matches) > max {
+		matches = matches[:max]
+	}
+	return matches
+}
@@ -0,0 +1,131 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package cmdline
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Fields are the values of an item that a filter looks at, by field name,
+// e.g. "year": "1997". The "name" field is matched by words without a field.
+type Fields map[string]string
+
+// FieldName is what words without a field are matched against
+const FieldName = "name"
+
+// operators, longest first, so that >= isn't taken for >
+var operators = []string{"!=", ">=", "<=", "=", ">", "<", "~"}
+
+// Condition is one part of a filter, e.g. year>2000
+type Condition struct {
+	Field    string
+	Operator string
+	Value    string
+}
+
+// Filter matches items whose fields meet all of its conditions
+type Filter []Condition
+
+// ParseFilter parses a filter expression: conditions like year>2000,
+// genre=jazz, or album~live, separated by spaces. = and != compare
+// case-insensitively, ~ matches a part, and <, <=, >, >= compare numbers
+// if both sides are numbers, or else text. A word without an operator
+// matches part of the name. Only the given fields can be used.
+func ParseFilter(expr string, fields []string) (Filter, error) {
+	words, err := Split(expr)
+	if err != nil {
+		return nil, err
+	}
+	var filter Filter
+	for _, word := range words {
+		condition, err := parseCondition(word, fields)
+		if err != nil {
+			return nil, err
+		}
+		filter = append(filter, condition)
+	}
+	return filter, nil
+}
+
+func parseCondition(word string, fields []string) (Condition, error) {
+	at, operator := -1, ""
+	for _, op := range operators {
+		if i := strings.Index(word, op); i >= 0 && (at < 0 || i < at) {
+			at, operator = i, op
+		}
+	}
+	if at <= 0 {
+		// no field
+		return Condition{Field: FieldName, Operator: "~", Value: word}, nil
+	}
+
+	field := strings.ToLower(word[:at])
+	for _, known := range fields {
+		if field == known {
+			return Condition{Field: field, Operator: operator, Value: word[at+len(operator):]}, nil
+		}
+	}
+	return Condition{}, fmt.Errorf("unknown field %q; use one of %s", field, strings.Join(fields, ", "))
+}
+
+// Match returns whether the fields meet all conditions
+func (f Filter) Match(fields Fields) bool {
+	for _, c := range f {
+		if !c.Match(fields[c.Field]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Match returns whether a field's value meets the condition
+func (c Condition) Match(value string) bool {
+	switch c.Operator {
+	case "=":
+		return strings.EqualFold(value, c.Value)
+	case "!=":
+		return !strings.EqualFold(value, c.Value)
+	case "~":
+		return strings.Contains(strings.ToLower(value), strings.ToLower(c.Value))
+	}
+
+	var cmp int
+	a, errA := strconv.ParseFloat(value, 64)
+	b, errB := strconv.ParseFloat(c.Value, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case a < b:
+			cmp = -1
+		case a > b:
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(strings.ToLower(value), strings.ToLower(c.Value))
+	}
+	switch c.Operator {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+func (f Filter) String() string {
+	words := make([]string, len(f))
+	for i, c := range f {
+		if c.Field == FieldName && c.Operator == "~" {
+			words[i] = Quote(c.Value)
+		} else {
+			words[i] = c.Field + c.Operator + Quote(c.Value)
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,113 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package cmdline
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// History is the list of command lines that were run, oldest first, and a
+// position for going through it with up and down
+type History struct {
+	entries []string
+	max     int
+	// the position while going through the history, len(entries) if at the
+	// line being typed
+	at int
+	// the line being typed before going back
+	draft string
+}
+
+// NewHistory returns an empty history that keeps at most max lines
+func NewHistory(max int) *History {
+	return &History{max: max}
+}
+
+// LoadHistory reads a history saved with Save. A missing file is an empty
+// history.
+func LoadHistory(path string, max int) (*History, error) {
+	h := NewHistory(max)
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return h, nil
+	} else if err != nil {
+		return h, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		h.Add(scanner.Text())
+	}
+	return h, scanner.Err()
+}
+
+// Save writes the history, one line per entry
+func (h *History) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	var b strings.Builder
+	for _, entry := range h.entries {
+		b.WriteString(entry)
+		b.WriteByte('\n')
+	}
+	return os.WriteFile(path, []byte(b.String()), 0600)
+}
+
+// Add appends a line that was run, unless it's empty or the same as the
+// last one, and goes back to the end
+func (h *History) Add(line string) {
+	line = strings.TrimSpace(line)
+	if line != "" && (len(h.entries) == 0 || h.entries[len(h.entries)-1] != line) {
+		h.entries = append(h.entries, line)
+		if h.max > 0 && len(h.entries) > h.max {
+			h.entries = h.entries[len(h.entries)-h.max:]
+		}
+	}
+	h.Reset()
+}
+
+// Reset goes back to the end, e.g. when the prompt is opened
+func (h *History) Reset() {
+	h.at = len(h.entries)
+	h.draft = ""
+}
+
+// Previous returns the line before the current position. current is the
+// line being typed, which Next returns at the end again. ok is false at
+// the oldest line.
+func (h *History) Previous(current string) (line string, ok bool) {
+	if h.at == 0 {
+		return current, false
+	}
+	if h.at == len(h.entries) {
+		h.draft = current
+	}
+	h.at--
+	return h.entries[h.at], true
+}
+
+// Next returns the line after the current position, or the line that was
+// being typed at the end. ok is false if already at the end.
+func (h *History) Next() (line string, ok bool) {
+	if h.at >= len(h.entries) {
+		return h.draft, false
+	}
+	h.at++
+	if h.at == len(h.entries) {
+		return h.draft, true
+	}
+	return h.entries[h.at], true
+}
+
+// Entries returns the lines, oldest first
+func (h *History) Entries() []string {
+	return append([]string(nil), h.entries...)
+}
@@ -0,0 +1,765 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"errors"
+	"image"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spezifisch/stmps/logger"
+	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spezifisch/stmps/remote"
+	"github.com/spezifisch/stmps/subsonic"
+	"github.com/spf13/viper"
+)
+
+// Core owns playback: the player, its queue, scrobbling, and the connection
+// to the server. It runs with or without the TUI (see --daemon); the TUI and
+// the remote control interfaces (e.g. the control socket) all act on it.
+type Core struct {
+	connection  *subsonic.Connection
+	player      *mpvplayer.Player
+	mprisPlayer *remote.MprisPlayer
+	scrobbler   *scrobbler
+	history     *playHistory
+	autoDJ      *autoDJ
+	logger      logger.LoggerInterface
+
+	// queueChanged is called after the queue was modified, so that the UI
+	// can refresh. It may be nil.
+	queueChanged func()
+
+	subscribersLock sync.Mutex
+	subscribers     map[int]func(remote.Event)
+	nextSubscriber  int
+
+	// trackedSong is the ID of the song the scrobbler, the history, MPRIS,
+	// and the auto DJ were last told about. trackLock guards it and the
+	// scrobbler, since unpausing isn't reported from the player's event loop.
+	trackLock   sync.Mutex
+	trackedSong string
+
+	// sessionPath is where the session is saved, or "" if it isn't
+	sessionPath string
+	// sessionPage returns the page the TUI shows, to save it with the
+	// session. It may be nil.
+	sessionPage func() string
+	// restoredPage is the page of the restored session, for the TUI to show
+	restoredPage string
+
+	topUpLock sync.Mutex
+
+	sleep sleepTimer
+
+	done     chan struct{}
+	quitOnce sync.Once
+
+	// closing is closed by Close, to stop the goroutines that run until then
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+var _ remote.Controller = (*Core)(nil)
+var _ mpvplayer.EventConsumer = (*Core)(nil)
+var _ Playback = (*Core)(nil)
+var _ remote.Library = (*Core)(nil)
+
+// NewCore creates the Core. mprisPlayer may be nil.
+func NewCore(connection *subsonic.Connection, player *mpvplayer.Player, mprisPlayer *remote.MprisPlayer, logger logger.LoggerInterface) *Core {
+	queueDir, err := scrobbleQueueDir()
+	if err != nil {
+		logger.PrintError("scrobbler", err)
+	}
+	sessionPath, err := sessionFile()
+	if err != nil {
+		logger.PrintError("session", err)
+	}
+	c := &Core{
+		connection:  connection,
+		player:      player,
+		mprisPlayer: mprisPlayer,
+		scrobbler:   newScrobbler(newScrobbleSinks(connection, logger), queueDir, logger),
+		history:     newPlayHistory(logger),
+		autoDJ:      newAutoDJ(connection),
+		logger:      logger,
+		subscribers: make(map[int]func(remote.Event)),
+		sessionPath: sessionPath,
+		sleep:       sleepTimer{volume: -1},
+		done:        make(chan struct{}),
+		closing:     make(chan struct{}),
+	}
+	player.RegisterEventConsumer(c)
+	return c
+}
+
+// Run starts the player and the background tasks, and restores the last
+// session. Event consumers must be registered before.
+func (c *Core) Run() {
+	c.scrobbler.run()
+
+	// run mpv event handler
+	go c.player.EventLoop()
+
+	if c.sessionPath != "" {
+		c.restoreSession()
+		go c.saveSessions()
+	}
+	if c.autoDJ.isEnabled() {
+		go c.topUpQueue()
+	}
+}
+
+// Close saves the session, and the queue on the server, so that they can be
+// loaded again later, and shuts the player down. Only the first call does
+// anything.
+func (c *Core) Close() {
+	c.closeOnce.Do(func() {
+		close(c.closing)
+		c.saveSession()
+		if !c.saveQueueOnServer() {
+			// The only way to purge a saved play queue is to force an error by providing
+			// bad data. Therefore, we ignore errors.
+			_ = c.connection.SavePlayQueue([]string{"XXX"}, "XXX", 0)
+		}
+		c.player.Quit()
+		if c.history != nil {
+			c.history.Close()
+		}
+	})
+}
+
+// saveQueueOnServer saves the queue on the server, if there is one
+func (c *Core) saveQueueOnServer() bool {
+	queue := c.player.GetQueueCopy()
+	if len(queue) == 0 {
+		return false
+	}
+	ids := make([]string, len(queue))
+	for i, it := range queue {
+		ids[i] = it.Id
+	}
+	// stmps always only ever plays the first song in the queue
+	pos := c.player.GetTimePos()
+	if err := c.connection.SavePlayQueue(ids, ids[0], int(pos)); err != nil {
+		log.Printf("error stashing play queue: %s", err)
+	}
+	return true
+}
+
+// saveSession saves the queue, the position in its top song, the volume and
+// the page shown, to restore them on the next start
+func (c *Core) saveSession() {
+	if c.sessionPath == "" {
+		return
+	}
+	status := c.Status()
+	s := newSession(c.player.GetQueueCopy(), status.Position, status.Volume)
+	s.Playing = status.State == remote.StatePlaying
+	if c.sessionPage != nil {
+		s.Page = c.sessionPage()
+	}
+	if err := s.save(c.sessionPath); err != nil {
+		c.logger.PrintError("saveSession", err)
+	}
+}
+
+// saveSessions saves the session every session.interval seconds until Close,
+// so that little is lost if stmps doesn't quit cleanly. With
+// session.server-sync, the queue is saved on the server, too.
+func (c *Core) saveSessions() {
+	interval := viper.GetInt("session.interval")
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.saveSession()
+			if viper.GetBool("session.server-sync") {
+				c.saveQueueOnServer()
+			}
+		case <-c.closing:
+			return
+		}
+	}
+}
+
+// restoreSession loads the queue of the last session and goes back to where
+// it was in the top song. Playback resumes if it was playing, unless
+// session.paused is set.
+func (c *Core) restoreSession() {
+	s, err := loadSession(c.sessionPath)
+	if err != nil {
+		c.logger.PrintError("restoreSession", err)
+		return
+	} else if s == nil {
+		return
+	}
+	c.restoredPage = s.Page
+	if err := c.player.SetVolume(int(s.Volume)); err != nil {
+		c.logger.PrintError("restoreSession", err)
+	}
+	if len(s.Queue) == 0 {
+		return
+	}
+
+	paused := viper.GetBool("session.paused") || !s.Playing
+	if err := c.player.Load(s.queue(c.connection), paused); err != nil {
+		c.logger.PrintError("restoreSession", err)
+		return
+	}
+	c.notifyQueueChanged()
+	c.logger.Printf("restored %d songs from %s", len(s.Queue), s.SavedAt.Format(time.DateTime))
+
+	if s.Position > 0 {
+		go c.seekWhenLoaded(int(s.Position))
+	}
+}
+
+// seekWhenLoaded seeks to position once the song is loaded far enough, or
+// gives up after a while
+func (c *Core) seekWhenLoaded(position int) {
+	for i := 0; i < 100; i++ {
+		if seekable, err := c.player.IsSeekable(); err == nil && seekable {
+			if err := c.player.SeekAbsolute(position); err != nil {
+				c.logger.PrintError("seekWhenLoaded", err)
+			}
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	c.logger.Printf("seekWhenLoaded: song didn't load, not seeking to %d", position)
+}
+
+// songQueueItem makes the queue item for a song, filling in the album
+// information the player wants.
+func (c *Core) songQueueItem(entity subsonic.Entity) mpvplayer.QueueItem {
+	uri := c.connection.GetPlayUrl(entity)
+
+	album, err := c.connection.GetAlbum(entity.Parent)
+	albumName := ""
+	if err != nil {
+		c.logger.PrintError("songQueueItem", err)
+	} else {
+		switch {
+		case album.Name != "":
+			albumName = album.Name
+		case album.Title != "":
+			albumName = album.Title
+		case album.Album != "":
+			albumName = album.Album
+		}
+	}
+
+	// Populate the genre, by hook or crook
+	genre := entity.Genre
+	if genre == "" {
+		genre = album.Genre
+	}
+	if genre == "" && len(album.Genres) > 0 {
+		genre = album.Genres[0].Name
+	}
+
+	albumArtist := entity.DisplayAlbumArtist
+	if albumArtist == "" && len(entity.AlbumArtists) > 0 {
+		names := make([]string, len(entity.AlbumArtists))
+		for i, artist := range entity.AlbumArtists {
+			names[i] = artist.Name
+		}
+		albumArtist = strings.Join(names, ", ")
+	}
+	if albumArtist == "" {
+		albumArtist = album.Artist
+	}
+
+	var artistMbids []string
+	for _, artist := range entity.Artists {
+		if artist.MusicBrainzId != "" {
+			artistMbids = append(artistMbids, artist.MusicBrainzId)
+		}
+	}
+
+	return mpvplayer.QueueItem{
+		Id:                   entity.Id,
+		Uri:                  uri,
+		Title:                entity.GetSongTitle(),
+		Artist:               entity.Artist,
+		ArtistId:             entity.ArtistId,
+		AlbumId:              entity.AlbumId,
+		Duration:             entity.Duration,
+		Album:                albumName,
+		TrackNumber:          entity.Track,
+		CoverArtId:           entity.CoverArtId,
+		DiscNumber:           entity.DiscNumber,
+		Year:                 entity.Year,
+		Genre:                genre,
+		AlbumArtist:          albumArtist,
+		BitRate:              entity.BitRate,
+		Suffix:               entity.Suffix,
+		PlayCount:            entity.PlayCount,
+		Rating:               entity.UserRating,
+		MusicBrainzId:        entity.MusicBrainzId,
+		AlbumMusicBrainzId:   album.MusicBrainzId,
+		ArtistMusicBrainzIds: artistMbids,
+	}
+}
+
+// notifyQueueChanged tells the UI and remote subscribers that the queue was
+// changed
+func (c *Core) notifyQueueChanged() {
+	if c.queueChanged != nil {
+		// the change may have come from the UI itself, which then must not
+		// wait for its own refresh
+		go c.queueChanged()
+	}
+	c.publish(remote.Event{Event: remote.EventQueue})
+}
+
+// SendEvent receives player events and forwards them to remote subscribers
+func (c *Core) SendEvent(event mpvplayer.UiEvent) {
+	var e remote.Event
+	switch event.Type {
+	case mpvplayer.EventStopped:
+		e.Event = remote.EventStopped
+	case mpvplayer.EventPlaying:
+		e.Event = remote.EventPlaying
+	case mpvplayer.EventUnpaused:
+		e.Event = remote.EventUnpaused
+	case mpvplayer.EventPaused:
+		e.Event = remote.EventPaused
+	case mpvplayer.EventStatus:
+		e.Event = remote.EventStatus
+	default:
+		return
+	}
+
+	if event.Type == mpvplayer.EventStopped {
+		if c.history != nil {
+			c.history.songEnded()
+		}
+		c.sleepStopped()
+	}
+
+	switch data := event.Data.(type) {
+	case mpvplayer.QueueItem:
+		c.trackSong(event.Type, data)
+		track := newTrack(data)
+		e.Track = &track
+	case mpvplayer.StatusData:
+		c.trackLock.Lock()
+		c.scrobbler.progress(data)
+		c.trackLock.Unlock()
+		if c.history != nil {
+			c.history.progress(data)
+		}
+		status := c.Status()
+		status.Volume = data.Volume
+		status.Position = data.Position
+		status.Duration = data.Duration
+		e.Status = &status
+	}
+	c.publish(e)
+}
+
+// trackSong tells the scrobbler, the history, MPRIS, and the auto DJ about a
+// song that started playing. A song that was loaded paused, like that of a
+// restored session, is told about when it's first unpaused instead.
+func (c *Core) trackSong(typ mpvplayer.UiEventType, song mpvplayer.QueueItem) {
+	c.trackLock.Lock()
+	defer c.trackLock.Unlock()
+	started := typ == mpvplayer.EventPlaying ||
+		(typ == mpvplayer.EventUnpaused && song.Id != "" && song.Id != c.trackedSong)
+	if !started {
+		return
+	}
+	c.trackedSong = song.Id
+
+	// Update MprisPlayer with new track info
+	if c.mprisPlayer != nil {
+		c.mprisPlayer.OnSongChange(song)
+	}
+	c.scrobbler.songStarted(song)
+	if c.history != nil {
+		c.history.songStarted(song)
+	}
+	c.autoDJ.songStarted(song)
+	go c.topUpQueue()
+}
+
+func (c *Core) publish(e remote.Event) {
+	c.subscribersLock.Lock()
+	defer c.subscribersLock.Unlock()
+	for _, cb := range c.subscribers {
+		cb(e)
+	}
+}
+
+// remote.Controller implementation
+
+func (c *Core) Subscribe(cb func(remote.Event)) (unsubscribe func()) {
+	c.subscribersLock.Lock()
+	defer c.subscribersLock.Unlock()
+	id := c.nextSubscriber
+	c.nextSubscriber++
+	c.subscribers[id] = cb
+	return func() {
+		c.subscribersLock.Lock()
+		defer c.subscribersLock.Unlock()
+		delete(c.subscribers, id)
+	}
+}
+
+func (c *Core) Play() error {
+	return c.player.Play()
+}
+
+func (c *Core) Pause() error {
+	if playing, err := c.player.IsPlaying(); err != nil {
+		return err
+	} else if playing {
+		return c.player.Pause()
+	}
+	return nil
+}
+
+func (c *Core) TogglePause() error {
+	return c.player.Pause()
+}
+
+func (c *Core) Stop() error {
+	return c.player.Stop()
+}
+
+func (c *Core) NextTrack() error {
+	defer c.notifyQueueChanged()
+	return c.player.PlayNextTrack()
+}
+
+func (c *Core) PreviousTrack() error {
+	return c.player.PreviousTrack()
+}
+
+func (c *Core) Seek(offset int) error {
+	return c.player.Seek(offset)
+}
+
+func (c *Core) SeekAbsolute(position int) error {
+	return c.player.SeekAbsolute(position)
+}
+
+func (c *Core) SetVolume(percentValue int) error {
+	return c.player.SetVolume(percentValue)
+}
+
+func (c *Core) AdjustVolume(increment int) error {
+	return c.player.AdjustVolume(increment)
+}
+
+func (c *Core) Status() remote.Status {
+	queue := c.player.GetQueueCopy()
+	status := remote.Status{
+		State:       remote.StateStopped,
+		Volume:      c.player.GetVolume(),
+		Position:    int64(c.player.GetTimePos()),
+		QueueLength: len(queue),
+		AutoDJ:      c.autoDJ.isEnabled(),
+		Sleep:       c.sleepStatus(),
+	}
+	if loaded, err := c.player.IsSongLoaded(); err == nil && loaded {
+		if paused, err := c.player.IsPaused(); err == nil && paused {
+			status.State = remote.StatePaused
+		} else {
+			status.State = remote.StatePlaying
+		}
+	}
+	if len(queue) > 0 {
+		// stmps always plays the first song in the queue
+		track := newTrack(queue[0])
+		status.Track = &track
+		status.Duration = int64(track.Duration)
+	}
+	if status.State == remote.StateStopped {
+		status.Position = 0
+	}
+	return status
+}
+
+func (c *Core) Queue() []remote.Track {
+	queue := c.player.GetQueueCopy()
+	tracks := make([]remote.Track, len(queue))
+	for i, item := range queue {
+		tracks[i] = newTrack(item)
+	}
+	return tracks
+}
+
+func (c *Core) Enqueue(ids []string) (int, error) {
+	var errs []error
+	var songs []subsonic.Entity
+	for _, id := range ids {
+		song, err := c.connection.GetSong(id)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		songs = append(songs, song)
+	}
+	c.AddSongs(songs...)
+	return len(songs), errors.Join(errs...)
+}
+
+func (c *Core) EnqueueSearch(query string) (int, error) {
+	results, err := c.connection.Search(query, 0, 0, 0)
+	if err != nil {
+		return 0, err
+	}
+	c.AddSongs(results.Songs...)
+	return len(results.Songs), nil
+}
+
+// EnqueueNext inserts songs by song ID right after the one playing, to play
+// them next
+func (c *Core) EnqueueNext(ids []string) (int, error) {
+	var errs []error
+	songs := make([]subsonic.Entity, 0, len(ids))
+	for _, id := range ids {
+		song, err := c.connection.GetSong(id)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		songs = append(songs, song)
+	}
+	c.AddSongsNext(songs...)
+	return len(songs), errors.Join(errs...)
+}
+
+func (c *Core) PlayNow(ids []string) error {
+	songs := make([]subsonic.Entity, 0, len(ids))
+	for _, id := range ids {
+		song, err := c.connection.GetSong(id)
+		if err != nil {
+			return err
+		}
+		songs = append(songs, song)
+	}
+	if len(songs) == 0 {
+		return errors.New("no songs")
+	}
+	if err := c.PlaySong(songs[0]); err != nil {
+		return err
+	}
+	c.AddSongs(songs[1:]...)
+	return nil
+}
+
+func (c *Core) DeleteQueueItem(index int) error {
+	return c.DeleteQueueItems([]int{index})
+}
+
+// DeleteQueueItems removes the songs at the indexes from the queue at once
+func (c *Core) DeleteQueueItems(indexes []int) error {
+	if err := c.player.DeleteQueueItems(indexes); err != nil {
+		return err
+	}
+	c.notifyQueueChanged()
+	return nil
+}
+
+// MoveQueueItem moves a song in the queue. Moving a song to or from the top of
+// the queue stops playback, since the top song is the one playing.
+func (c *Core) MoveQueueItem(from, to int) error {
+	return c.MoveQueueItems([]int{from}, to)
+}
+
+// MoveQueueItems moves the songs at the indexes as a block, in their order,
+// so that the first of them ends up at index to. Like MoveQueueItem, this
+// stops playback if the top song changes.
+func (c *Core) MoveQueueItems(indexes []int, to int) error {
+	if err := c.player.MoveQueueItems(indexes, to); err != nil {
+		return err
+	}
+	c.notifyQueueChanged()
+	return nil
+}
+
+// PlayQueueItem skips to the song at index. The songs before it stay queued
+// after it.
+func (c *Core) PlayQueueItem(index int) error {
+	err := c.player.PlayQueueItem(index)
+	c.notifyQueueChanged()
+	return err
+}
+
+func (c *Core) ShuffleQueue() error {
+	// An error here won't affect re-arranging the queue.
+	_ = c.player.Stop()
+	c.player.Shuffle()
+	c.notifyQueueChanged()
+	return nil
+}
+
+func (c *Core) ClearQueue() error {
+	c.player.ClearQueue()
+	c.notifyQueueChanged()
+	return nil
+}
+
+// UndoQueue undoes the last edit of the queue
+func (c *Core) UndoQueue() error {
+	if err := c.player.UndoQueue(); err != nil {
+		return err
+	}
+	c.notifyQueueChanged()
+	return nil
+}
+
+// RedoQueue makes the last undone edit of the queue again
+func (c *Core) RedoQueue() error {
+	if err := c.player.RedoQueue(); err != nil {
+		return err
+	}
+	c.notifyQueueChanged()
+	return nil
+}
+
+// SetAutoDJ turns the auto-DJ on or off, which keeps the queue filled with
+// songs similar to the one playing
+func (c *Core) SetAutoDJ(enable bool) error {
+	c.autoDJ.setEnabled(enable)
+	// the UI shows whether it's on when refreshing the queue
+	c.notifyQueueChanged()
+	if enable {
+		go c.topUpQueue()
+	}
+	return nil
+}
+
+// topUpQueue has the auto-DJ add songs, if it's on and the queue is running
+// out
+func (c *Core) topUpQueue() {
+	// the songs are picked for the queue as it was, so only one at a time
+	c.topUpLock.Lock()
+	defer c.topUpLock.Unlock()
+
+	songs, err := c.autoDJ.songsToAdd(c.player.GetQueueCopy())
+	if err != nil {
+		c.logger.PrintError("autodj", err)
+	}
+	if len(songs) > 0 {
+		c.logger.Printf("autodj: adding %d songs", len(songs))
+		c.AddSongs(songs...)
+	}
+}
+
+// Quit closes Done, which makes stmps shut down
+func (c *Core) Quit() error {
+	c.quitOnce.Do(func() {
+		close(c.done)
+	})
+	return nil
+}
+
+// Playback implementation
+
+func (c *Core) IsSeekable() (bool, error) {
+	return c.player.IsSeekable()
+}
+
+func (c *Core) GetQueueCopy() mpvplayer.PlayerQueue {
+	return c.player.GetQueueCopy()
+}
+
+// AddSongs appends songs to the queue, as one edit
+func (c *Core) AddSongs(entities ...subsonic.Entity) {
+	if len(entities) == 0 {
+		return
+	}
+	items := make([]mpvplayer.QueueItem, len(entities))
+	for i, entity := range entities {
+		items[i] = c.songQueueItem(entity)
+	}
+	c.player.AppendToQueue(items)
+	c.notifyQueueChanged()
+}
+
+// AddSongsNext inserts songs right after the one playing, as one edit
+func (c *Core) AddSongsNext(entities ...subsonic.Entity) {
+	if len(entities) == 0 {
+		return
+	}
+	items := make([]mpvplayer.QueueItem, len(entities))
+	for i, entity := range entities {
+		items[i] = c.songQueueItem(entity)
+	}
+	c.player.InsertIntoQueue(items, 1)
+	c.notifyQueueChanged()
+}
+
+func (c *Core) PlaySong(entity subsonic.Entity) error {
+	uri := c.connection.GetPlayUrl(entity)
+	err := c.player.PlayUri(uri, entity.CoverArtId, entity)
+	c.notifyQueueChanged()
+	return err
+}
+
+func (c *Core) RegisterEventConsumer(consumer mpvplayer.EventConsumer) {
+	c.player.RegisterEventConsumer(consumer)
+}
+
+func (c *Core) OnQueueChanged(cb func()) {
+	c.queueChanged = cb
+}
+
+func (c *Core) Done() <-chan struct{} {
+	return c.done
+}
+
+// remote.Library implementation
+
+func (c *Core) Search(query string) (remote.SearchResult, error) {
+	results, err := c.connection.Search(query, 0, 0, 0)
+	if err != nil {
+		return remote.SearchResult{}, err
+	}
+
+	res := remote.SearchResult{
+		Artists: make([]remote.Artist, len(results.Artists)),
+		Albums:  make([]remote.Album, len(results.Albums)),
+		Songs:   make([]remote.Track, len(results.Songs)),
+	}
+	for i, artist := range results.Artists {
+		res.Artists[i] = remote.Artist{Id: artist.Id, Name: artist.Name, AlbumCount: artist.AlbumCount}
+	}
+	for i, album := range results.Albums {
+		name := album.Name
+		if name == "" {
+			name = album.Title
+		}
+		res.Albums[i] = remote.Album{
+			Id:         album.Id,
+			Name:       name,
+			Artist:     album.Artist,
+			Year:       album.Year,
+			CoverArtId: album.CoverArtId,
+		}
+	}
+	for i, song := range results.Songs {
+		track := remote.NewTrack(song)
+		track.Year = song.Year
+		track.CoverArtId = song.CoverArtId
+		res.Songs[i] = track
+	}
+	return res, nil
+}
+
+func (c *Core) CoverArt(id string) (image.Image, error) {
+	return c.connection.GetCoverArt(id)
+}
@@ -0,0 +1,291 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spezifisch/stmps/cmdline"
+	"github.com/spezifisch/stmps/remote"
+	"github.com/spf13/viper"
+)
+
+const ctlUsage = `USAGE: %s ctl [-socket path] [-config file] [-json] <command> [args]
+
+Controls a running stmps through its control socket.
+
+Commands:
+  play                     start or resume playback
+  pause                    pause playback
+  toggle                   toggle play/pause
+  stop                     stop playback
+  next                     skip to the next song
+  previous                 restart the current song
+  seek [+|-]<time>         seek to a position, or relative with +/-;
+                           time is seconds or mm:ss
+  volume [[+|-]<percent>]  set or adjust the volume; prints it without args
+  enqueue <song-id>...     add songs to the queue by ID
+  enqueue -q <query>       add the songs matching a search to the queue
+  enqueue -n <song-id>...  add songs to play next, after the current one
+  jump <n>                 play the nth song of the queue, keeping the ones
+                           before it queued after it
+  shuffle                  shuffle the queue
+  clear                    clear the queue
+  undo                     undo the last edit of the queue
+  redo                     redo the last undone edit of the queue
+  autodj [on|off]          turn the auto-DJ on or off; prints it without args
+  sleep <minutes> [fade]   stop playback after some minutes, or a duration
+                           like 1h30m; with fade, fade out over the last minute
+  sleep track|album [fade] stop after the current song, or its album
+  sleep off                cancel the sleep timer
+  stopafter <n> [off]      stop after the nth song of the queue, or not
+  status                   show what's playing
+  queue                    list the queue
+  events                   print player events as JSON lines until stopped
+  quit                     shut stmps down
+
+Flags:
+`
+
+// controlSocketPath returns the configured control socket location
+// (remote.socket.path), or stmps.sock in $XDG_RUNTIME_DIR; if that isn't set
+// either, a per-user file in the temp dir.
+func controlSocketPath() string {
+	if path := viper.GetString("remote.socket.path"); path != "" {
+		return os.ExpandEnv(path)
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "stmps.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("stmps-%d.sock", os.Getuid()))
+}
+
+// dialControl connects to the control socket at path, or at the configured
+// location if path is empty. It returns the path it tried.
+func dialControl(path string) (*remote.ControlClient, string, error) {
+	if path == "" {
+		path = controlSocketPath()
+	}
+	client, err := remote.DialControlSocket(path)
+	return client, path, err
+}
+
+// runCtl implements `stmps ctl`. It returns the process exit code.
+func runCtl(args []string) int {
+	flags := flag.NewFlagSet("ctl", flag.ContinueOnError)
+	socket := flags.String("socket", "", "control socket `path` (default from config, or $XDG_RUNTIME_DIR/stmps.sock)")
+	configFile := flags.String("config", "", "use config `file` to look up the socket path")
+	asJson := flags.Bool("json", false, "print results as JSON")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), ctlUsage, os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if *socket == "" {
+		// the config is only needed for the socket path, so a config that
+		// isn't complete enough to run stmps is fine here
+		_ = readConfig(configFile)
+	}
+
+	client, path, err := dialControl(*socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to connect to stmps at %s: %s\n", path, err)
+		return 1
+	}
+	defer client.Close()
+
+	if err := ctlCommand(client, flags.Arg(0), flags.Args()[1:], *asJson); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Arg(0), err)
+		return 1
+	}
+	return 0
+}
+
+func ctlCommand(client *remote.ControlClient, command string, args []string, asJson bool) error {
+	switch command {
+	case remote.MethodPlay, remote.MethodPause, remote.MethodToggle, remote.MethodStop,
+		remote.MethodNext, remote.MethodPrevious, remote.MethodShuffle, remote.MethodClear,
+		remote.MethodUndo, remote.MethodRedo, remote.MethodQuit:
+		return client.Call(command, nil, nil)
+
+	case remote.MethodSeek:
+		if len(args) != 1 {
+			return errors.New("expected one time argument")
+		}
+		seconds, relative, err := cmdline.ParseTime(args[0])
+		if err != nil {
+			return err
+		}
+		params := remote.SeekParams{Position: &seconds}
+		if relative {
+			params = remote.SeekParams{Offset: &seconds}
+		}
+		return client.Call(remote.MethodSeek, params, nil)
+
+	case remote.MethodVolume:
+		if len(args) == 0 {
+			var status remote.Status
+			if err := client.Call(remote.MethodStatus, nil, &status); err != nil {
+				return err
+			}
+			fmt.Printf("%d\n", status.Volume)
+			return nil
+		}
+		if len(args) != 1 {
+			return errors.New("expected one volume argument")
+		}
+		percent, relative, err := cmdline.ParseVolume(args[0])
+		if err != nil {
+			return err
+		}
+		params := remote.VolumeParams{Set: &percent}
+		if relative {
+			params = remote.VolumeParams{Adjust: &percent}
+		}
+		return client.Call(remote.MethodVolume, params, nil)
+
+	case remote.MethodEnqueue:
+		var params remote.EnqueueParams
+		if len(args) > 0 && (args[0] == "-q" || args[0] == "--query") {
+			params.Query = strings.Join(args[1:], " ")
+		} else if len(args) > 0 && (args[0] == "-n" || args[0] == "--next") {
+			params.Ids = args[1:]
+			params.Next = true
+		} else {
+			params.Ids = args
+		}
+		if params.Query == "" && len(params.Ids) == 0 {
+			return errors.New("expected song IDs or -q <query>")
+		}
+		var result remote.EnqueueResult
+		if err := client.Call(remote.MethodEnqueue, params, &result); err != nil {
+			return err
+		}
+		fmt.Printf("added %d songs\n", result.Added)
+		return nil
+
+	case remote.MethodAutoDJ:
+		if len(args) == 0 {
+			var status remote.Status
+			if err := client.Call(remote.MethodStatus, nil, &status); err != nil {
+				return err
+			}
+			if status.AutoDJ {
+				fmt.Println("on")
+			} else {
+				fmt.Println("off")
+			}
+			return nil
+		}
+		if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+			return errors.New("expected on or off")
+		}
+		return client.Call(remote.MethodAutoDJ, remote.AutoDJParams{Enable: args[0] == "on"}, nil)
+
+	case remote.MethodJump:
+		if len(args) != 1 {
+			return errors.New("expected one queue position")
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid queue position %q", args[0])
+		}
+		// numbered like the queue command lists it
+		return client.Call(remote.MethodJump, remote.IndexParams{Index: n - 1}, nil)
+
+	case remote.MethodSleep:
+		options, err := cmdline.ParseSleep(args)
+		if err != nil {
+			return err
+		}
+		return client.Call(remote.MethodSleep, remote.SleepParams{Mode: options.Mode, Minutes: options.Minutes, Fade: options.Fade}, nil)
+
+	case remote.MethodStopAfter:
+		if len(args) < 1 || len(args) > 2 || (len(args) == 2 && args[1] != "off") {
+			return errors.New("expected a queue position, and optionally off")
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid queue position %q", args[0])
+		}
+		return client.Call(remote.MethodStopAfter, remote.StopAfterParams{Index: n - 1, Stop: len(args) == 1}, nil)
+
+	case remote.MethodStatus:
+		var status remote.Status
+		if err := client.Call(remote.MethodStatus, nil, &status); err != nil {
+			return err
+		}
+		if asJson {
+			return json.NewEncoder(os.Stdout).Encode(status)
+		}
+		fmt.Println(formatCtlStatus(status))
+		return nil
+
+	case remote.MethodQueue:
+		var queue []remote.Track
+		if err := client.Call(remote.MethodQueue, nil, &queue); err != nil {
+			return err
+		}
+		if asJson {
+			return json.NewEncoder(os.Stdout).Encode(queue)
+		}
+		for i, track := range queue {
+			min, sec := iSecondsToMinAndSec(track.Duration)
+			stopAfter := ""
+			if track.StopAfter {
+				stopAfter = " (stop after)"
+			}
+			fmt.Printf("%3d. %s - %s (%d:%02d) [%s]%s\n", i+1, track.Artist, track.Title, min, sec, track.Id, stopAfter)
+		}
+		return nil
+
+	case "events":
+		if err := client.Subscribe(); err != nil {
+			return err
+		}
+		enc := json.NewEncoder(os.Stdout)
+		for event := range client.Events() {
+			if err := enc.Encode(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown command; see %s ctl -help", os.Args[0])
+}
+
+func formatCtlStatus(status remote.Status) string {
+	text := status.State
+	if status.Track != nil {
+		text += fmt.Sprintf(": %s - %s", status.Track.Artist, status.Track.Title)
+		if status.Track.Album != "" {
+			text += fmt.Sprintf(" (%s)", status.Track.Album)
+		}
+	}
+	posMin, posSec := secondsToMinAndSec(status.Position)
+	durMin, durSec := secondsToMinAndSec(status.Duration)
+	text += fmt.Sprintf(" [%02d:%02d/%02d:%02d] volume %d%%, %d in queue", posMin, posSec, durMin, durSec, status.Volume, status.QueueLength)
+	if status.AutoDJ {
+		text += ", auto-DJ"
+	}
+	if status.Sleep != nil {
+		sleepMin, sleepSec := secondsToMinAndSec(status.Sleep.Remaining)
+		text += fmt.Sprintf(", stopping in %02d:%02d", sleepMin, sleepSec)
+	}
+	return text
+}
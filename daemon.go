@@ -0,0 +1,61 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spezifisch/stmps/logger"
+	"github.com/spezifisch/stmps/remote"
+)
+
+// runDaemon runs the Core without the TUI (--daemon) until it's told to quit,
+// through a remote interface or with SIGINT/SIGTERM. It returns the exit code.
+func runDaemon(core *Core, logger *logger.Logger) int {
+	// there's no log page, so the log goes to stderr; draining it also keeps
+	// the logger from blocking
+	go func() {
+		for msg := range logger.Prints {
+			fmt.Fprintln(os.Stderr, msg)
+		}
+	}()
+
+	// the control socket is how clients reach the daemon, so it's not optional
+	socketPath := controlSocketPath()
+	ctlServer, err := remote.ListenControlSocket(socketPath, core, logger)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to open the control socket: %s\n", err)
+		return 1
+	}
+	defer ctlServer.Close()
+	logger.Printf("daemon: control socket listening on %s", socketPath)
+
+	if httpServer := startHTTPRemote(core, logger); httpServer != nil {
+		defer httpServer.Close()
+	}
+	if statusOutput := startStatusOutput(core, logger); statusOutput != nil {
+		defer statusOutput.Close()
+	}
+	if notifications := startNotifications(core, logger); notifications != nil {
+		defer notifications.Close()
+	}
+
+	core.Run()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case <-core.Done():
+		logger.Print("daemon: quit requested")
+	case sig := <-signals:
+		logger.Printf("daemon: received %s", sig)
+	}
+	core.Close()
+	return 0
+}
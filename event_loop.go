@@ -8,31 +8,12 @@ import (
 	"time"
 
 	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spezifisch/stmps/remote"
 )
 
-type eventLoop struct {
-	// scrobbles are handled by background loop
-	scrobbleNowPlaying      chan string
-	scrobbleSubmissionTimer *time.Timer
-}
-
-func (ui *Ui) initEventLoops() {
-	el := &eventLoop{
-		scrobbleNowPlaying: make(chan string, 5),
-	}
-	ui.eventLoop = el
-
-	// create reused timer to scrobble after delay
-	el.scrobbleSubmissionTimer = time.NewTimer(0)
-	if !el.scrobbleSubmissionTimer.Stop() {
-		<-el.scrobbleSubmissionTimer.C
-	}
-}
-
 func (ui *Ui) runEventLoops() {
 	go ui.logEventLoops()
 	go ui.guiEventLoop()
-	go ui.backgroundEventLoop()
 }
 
 // logEventLoops processes log events
@@ -89,8 +70,10 @@ func (ui *Ui) guiEventLoop() {
 				}
 
 				ui.app.QueueUpdateDraw(func() {
-					txt := formatPlayerStatus(ui.scanning, statusData.Volume, statusData.Position, statusData.Duration)
-					ui.playerStatus.SetText(txt)
+					ui.status.Volume = statusData.Volume
+					ui.status.Position = statusData.Position
+					ui.status.Duration = statusData.Duration
+					ui.updateStatusBar()
 					if ui.queuePage.lyrics != nil {
 						cl := ui.queuePage.currentLyrics.Lines
 						lcl := len(cl)
@@ -109,13 +92,13 @@ func (ui *Ui) guiEventLoop() {
 							if i < lcl && p < cl[i].Start {
 								txt := ""
 								if i > 1 {
-									txt = cl[i-2].Value + "\n"
+									txt = ui.theme.Styled(StyleLyrics, cl[i-2].Value) + "\n"
 								}
 								if i > 0 {
-									txt += "[::b]" + cl[i-1].Value + "[-:-:-]\n"
+									txt += ui.theme.Styled(StyleLyricsCurrent, cl[i-1].Value) + "\n"
 								}
 								for k := i; k < lcl && k-i < fh; k++ {
-									txt += cl[k].Value + "\n"
+									txt += ui.theme.Styled(StyleLyrics, cl[k].Value) + "\n"
 								}
 								ui.queuePage.lyrics.SetText(txt)
 							}
@@ -126,7 +109,9 @@ func (ui *Ui) guiEventLoop() {
 			case mpvplayer.EventStopped:
 				ui.logger.Print("mpvEvent: stopped")
 				ui.app.QueueUpdateDraw(func() {
-					ui.startStopStatus.SetText("[red::b]Stopped[::-]")
+					ui.status.State = remote.StateStopped
+					ui.status.QueueItem = mpvplayer.QueueItem{}
+					ui.status.Position = 0
 					if ui.queuePage.lyrics != nil {
 						ui.queuePage.lyrics.SetText("")
 					}
@@ -135,49 +120,21 @@ func (ui *Ui) guiEventLoop() {
 
 			case mpvplayer.EventPlaying:
 				ui.logger.Print("mpvEvent: playing")
-				statusText := "[green::b]Playing[::-]"
 
 				var currentSong mpvplayer.QueueItem
 				if mpvEvent.Data != nil {
 					// TODO (E) is mpvEvent.Data thread safe? maybe we need a copy
 					currentSong = mpvEvent.Data.(mpvplayer.QueueItem)
-					statusText += formatSongForStatusBar(&currentSong)
 
-					// Update MprisPlayer with new track info
-					if ui.mprisPlayer != nil {
-						ui.mprisPlayer.OnSongChange(currentSong)
-					}
 					lyrics := ui.queuePage.lyricsCache.Get(currentSong.Id)
 					if len(lyrics) > 0 {
 						ui.queuePage.currentLyrics = lyrics[0]
 					}
-
-					if ui.connection.Scrobble {
-						// scrobble "now playing" event (delegate to background event loop)
-						ui.eventLoop.scrobbleNowPlaying <- currentSong.Id
-
-						// scrobble "submission" after song has been playing a bit
-						// see: https://www.last.fm/api/scrobbling
-						// A track should only be scrobbled when the following conditions have been met:
-						// The track must be longer than 30 seconds. And the track has been played for
-						// at least half its duration, or for 4 minutes (whichever occurs earlier.)
-						if currentSong.Duration > 30 {
-							scrobbleDelay := currentSong.Duration / 2
-							if scrobbleDelay > 240 {
-								scrobbleDelay = 240
-							}
-							scrobbleDuration := time.Duration(scrobbleDelay) * time.Second
-
-							ui.eventLoop.scrobbleSubmissionTimer.Reset(scrobbleDuration)
-							ui.logger.Printf("scrobbler: timer started, %v", scrobbleDuration)
-						} else {
-							ui.logger.Printf("scrobbler: track too short")
-						}
-					}
 				}
 
 				ui.app.QueueUpdateDraw(func() {
-					ui.startStopStatus.SetText(statusText)
+					ui.status.State = remote.StatePlaying
+					ui.status.QueueItem = currentSong
 					ui.queuePage.updateQueue()
 					if ui.queuePage.lyrics != nil {
 						if len(ui.queuePage.currentLyrics.Lines) == 0 {
@@ -190,32 +147,32 @@ func (ui *Ui) guiEventLoop() {
 
 			case mpvplayer.EventPaused:
 				ui.logger.Print("mpvEvent: paused")
-				statusText := "[yellow::b]Paused[::-]"
 
 				var currentSong mpvplayer.QueueItem
 				if mpvEvent.Data != nil {
 					// TODO mpvEvent.Data thread safe? maybe we need a copy
 					currentSong = mpvEvent.Data.(mpvplayer.QueueItem)
-					statusText += formatSongForStatusBar(&currentSong)
 				}
 
 				ui.app.QueueUpdateDraw(func() {
-					ui.startStopStatus.SetText(statusText)
+					ui.status.State = remote.StatePaused
+					ui.status.QueueItem = currentSong
+					ui.updateStatusBar()
 				})
 
 			case mpvplayer.EventUnpaused:
 				ui.logger.Print("mpvEvent: unpaused")
-				statusText := "[green::b]Playing[::-]"
 
 				var currentSong mpvplayer.QueueItem
 				if mpvEvent.Data != nil {
 					// TODO is mpvEvent.Data thread safe? maybe we need a copy
 					currentSong = mpvEvent.Data.(mpvplayer.QueueItem)
-					statusText += formatSongForStatusBar(&currentSong)
 				}
 
 				ui.app.QueueUpdateDraw(func() {
-					ui.startStopStatus.SetText(statusText)
+					ui.status.State = remote.StatePlaying
+					ui.status.QueueItem = currentSong
+					ui.updateStatusBar()
 				})
 
 			default:
@@ -225,32 +182,6 @@ func (ui *Ui) guiEventLoop() {
 	}
 }
 
-// loop for blocking background tasks that would otherwise block the ui
-func (ui *Ui) backgroundEventLoop() {
-	for {
-		select {
-		case songId := <-ui.eventLoop.scrobbleNowPlaying:
-			// scrobble now playing
-			if _, err := ui.connection.ScrobbleSubmission(songId, false); err != nil {
-				ui.logger.PrintError("scrobble nowplaying", err)
-			}
-
-		case <-ui.eventLoop.scrobbleSubmissionTimer.C:
-			// scrobble submission delay elapsed
-			if currentSong, err := ui.player.GetPlayingTrack(); err != nil {
-				// user paused/stopped
-				ui.logger.Printf("not scrobbling: %v", err)
-			} else {
-				// it's still playing
-				ui.logger.Printf("scrobbling: %s", currentSong.Id)
-				if _, err := ui.connection.ScrobbleSubmission(currentSong.Id, true); err != nil {
-					ui.logger.PrintError("scrobble submission", err)
-				}
-			}
-		}
-	}
-}
-
 func (ui *Ui) addStarredToList() {
 	starred, err := ui.connection.GetStarred()
 	if err != nil {
@@ -4,13 +4,12 @@
 package main
 
 import (
-	"fmt"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 	"github.com/spezifisch/stmps/logger"
 	"github.com/spezifisch/stmps/mpvplayer"
-	"github.com/spezifisch/stmps/remote"
 	"github.com/spezifisch/stmps/subsonic"
 )
 
@@ -22,12 +21,26 @@ type Ui struct {
 	pages *tview.Pages
 
 	// top bar
+	topBar          *tview.Flex
 	startStopStatus *tview.TextView
 	playerStatus    *tview.TextView
 	scanning        bool
+	autoDJ          bool
+	// when the sleep timer stops playback, if it's set to some minutes
+	sleepDeadline time.Time
+	// the sleep timer setting the sleepTimer command chose last, see
+	// sleepSteps; -1 if the timer is off
+	sleepStep int
+	// stops refreshing the status bar for the sleep timer
+	stopSleepTicker chan struct{}
+	// what the status bar shows, see updateStatusBar
+	status    templateData
+	templates *uiTemplates
 
 	// bottom bar
-	menuWidget *MenuWidget
+	bottomBar   *tview.Pages
+	menuWidget  *MenuWidget
+	commandLine *CommandLineWidget
 
 	// browser page
 	browserPage *BrowserPage
@@ -44,6 +57,12 @@ type Ui struct {
 	// log page
 	logPage *LogPage
 
+	// stats page
+	statsPage *StatsPage
+
+	// albums page
+	albumsPage *AlbumsPage
+
 	// modals
 	addToPlaylistList    *tview.List
 	messageBox           *tview.Modal
@@ -51,15 +70,30 @@ type Ui struct {
 	helpWidget           *HelpWidget
 	selectPlaylistModal  tview.Primitive
 	selectPlaylistWidget *PlaylistSelectionWidget
+	randomSongsModal     tview.Primitive
+	randomSongsWidget    *RandomSongsWidget
+
+	// what the add to playlist modal adds, and where it returns to
+	addToPlaylist      func(playlist *subsonic.Playlist)
+	addToPlaylistPage  string
+	addToPlaylistFocus tview.Primitive
+
+	keybindings *Keybindings
+	theme       *Theme
+
+	// the server's genres, see genreNames()
+	genres []string
+	// the server's music folders, see musicFolders()
+	folders []subsonic.MusicFolder
+
+	randomPresets []randomPreset
 
 	starIdList map[string]struct{}
 
-	eventLoop   *eventLoop
-	mpvEvents   chan mpvplayer.UiEvent
-	mprisPlayer *remote.MprisPlayer
+	mpvEvents chan mpvplayer.UiEvent
 
 	connection *subsonic.Connection
-	player     *mpvplayer.Player
+	playback   Playback
 	logger     *logger.Logger
 }
 
@@ -70,6 +104,8 @@ const (
 	PagePlaylists = "playlists"
 	PageSearch    = "search"
 	PageLog       = "log"
+	PageStats     = "stats"
+	PageAlbums    = "albums"
 
 	PageDeletePlaylist = "deletePlaylist"
 	PageNewPlaylist    = "newPlaylist"
@@ -77,35 +113,39 @@ const (
 	PageMessageBox     = "messageBox"
 	PageHelpBox        = "helpBox"
 	PageSelectPlaylist = "selectPlaylist"
+	PageRandomSongs    = "randomSongs"
 )
 
-func InitGui(artists []subsonic.Artist,
-	connection *subsonic.Connection,
-	player *mpvplayer.Player,
-	logger *logger.Logger,
-	mprisPlayer *remote.MprisPlayer) (ui *Ui) {
-	// The artists list we get is sparse, containing little more than ID and name.
-	// Details need to be fetched when accessed
+func InitGui(connection *subsonic.Connection,
+	playback Playback,
+	keybindings *Keybindings,
+	randomPresets []randomPreset,
+	theme *Theme,
+	logger *logger.Logger) (ui *Ui) {
 	ui = &Ui{
 		starIdList: map[string]struct{}{},
+		sleepStep:  -1,
 
-		eventLoop: nil, // initialized by initEventLoops()
 		mpvEvents: make(chan mpvplayer.UiEvent, 5),
 
-		connection:  connection,
-		player:      player,
-		logger:      logger,
-		mprisPlayer: mprisPlayer,
+		connection:    connection,
+		playback:      playback,
+		keybindings:   keybindings,
+		randomPresets: randomPresets,
+		theme:         theme,
+		logger:        logger,
 	}
+	ui.registerGlobalCommands()
 
-	ui.initEventLoops()
+	// before any widget is created, they take their colors from tview.Styles
+	theme.apply()
+	ui.templates = loadTemplates(theme, logger)
 
 	ui.app = tview.NewApplication()
 	ui.pages = tview.NewPages()
 
 	// status text at the top
-	statusLeft := fmt.Sprintf("[::b]%s[::-] v%s", Name, Version)
-	ui.startStopStatus = tview.NewTextView().SetText(statusLeft).
+	ui.startStopStatus = tview.NewTextView().
 		SetTextAlign(tview.AlignLeft).
 		SetDynamicColors(true).
 		SetScrollable(false)
@@ -120,30 +160,37 @@ func InitGui(artists []subsonic.Artist,
 		}
 		ui.scanning = scanning.Scanning
 	}
-	statusRight := formatPlayerStatus(ui.scanning, 0, 0, 0)
-	ui.playerStatus = tview.NewTextView().SetText(statusRight).
+	ui.playerStatus = tview.NewTextView().
 		SetTextAlign(tview.AlignRight).
 		SetDynamicColors(true).
 		SetScrollable(false)
 
 	ui.menuWidget = ui.createMenuWidget()
+	ui.commandLine = ui.createCommandLineWidget()
+	ui.bottomBar = tview.NewPages().
+		AddPage(bottomBarMenu, ui.menuWidget.Root, true, true).
+		AddPage(bottomBarCommandLine, ui.commandLine.Root, true, false)
 	ui.helpWidget = ui.createHelpWidget()
 	ui.selectPlaylistWidget = ui.createPlaylistSelectionWidget()
+	ui.randomSongsWidget = ui.createRandomSongsWidget()
 
 	// same as 'playlistList' except for the addToPlaylistModal
 	// - we need a specific version of this because we need different keybinds
 	ui.addToPlaylistList = tview.NewList().ShowSecondaryText(false)
+	ui.theme.styleList(ui.addToPlaylistList)
 
 	// message box for small notes
 	ui.messageBox = tview.NewModal().
 		SetText("hi there").
-		SetBackgroundColor(tcell.ColorBlack)
+		SetBackgroundColor(ui.theme.Style(StyleDialog).Background()).
+		SetTextColor(ui.theme.Style(StyleDialog).Foreground())
 	ui.messageBox.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		ui.pages.HidePage(PageMessageBox)
 		return event
 	})
 
 	ui.selectPlaylistModal = makeModal(ui.selectPlaylistWidget.Root, 80, 5)
+	ui.randomSongsModal = makeModal(ui.randomSongsWidget.Root, 50, 17)
 
 	// help box modal
 	ui.helpModal = makeModal(ui.helpWidget.Root, 80, 30)
@@ -159,12 +206,12 @@ func InitGui(artists []subsonic.Artist,
 	})
 
 	// top bar: status text
-	topBarFlex := tview.NewFlex().SetDirection(tview.FlexColumn).
+	ui.topBar = tview.NewFlex().SetDirection(tview.FlexColumn).
 		AddItem(ui.startStopStatus, 0, 1, false).
-		AddItem(ui.playerStatus, 24, 0, false)
+		AddItem(ui.playerStatus, statusRightMinWidth, 0, false)
 
 	// browser page
-	ui.browserPage = ui.createBrowserPage(artists)
+	ui.browserPage = ui.createBrowserPage()
 
 	// queue page
 	ui.queuePage = ui.createQueuePage()
@@ -178,6 +225,12 @@ func InitGui(artists []subsonic.Artist,
 	// log page
 	ui.logPage = ui.createLogPage()
 
+	// stats page
+	ui.statsPage = ui.createStatsPage()
+
+	// albums page
+	ui.albumsPage = ui.createAlbumsPage()
+
 	ui.pages.AddPage(PageBrowser, ui.browserPage.Root, true, true).
 		AddPage(PageQueue, ui.queuePage.Root, true, false).
 		AddPage(PagePlaylists, ui.playlistPage.Root, true, false).
@@ -186,19 +239,41 @@ func InitGui(artists []subsonic.Artist,
 		AddPage(PageNewPlaylist, ui.playlistPage.NewPlaylistModal, true, false).
 		AddPage(PageAddToPlaylist, ui.browserPage.AddToPlaylistModal, true, false).
 		AddPage(PageSelectPlaylist, ui.selectPlaylistModal, true, false).
+		AddPage(PageRandomSongs, ui.randomSongsModal, true, false).
 		AddPage(PageMessageBox, ui.messageBox, true, false).
 		AddPage(PageHelpBox, ui.helpModal, true, false).
-		AddPage(PageLog, ui.logPage.Root, true, false)
+		AddPage(PageLog, ui.logPage.Root, true, false).
+		AddPage(PageStats, ui.statsPage.Root, true, false).
+		AddPage(PageAlbums, ui.albumsPage.Root, true, false)
 
 	rootFlex := tview.NewFlex().
 		SetDirection(tview.FlexRow).
-		AddItem(topBarFlex, 1, 0, false).
+		AddItem(ui.topBar, 1, 0, false).
 		AddItem(ui.pages, 0, 1, true).
-		AddItem(ui.menuWidget.Root, 1, 0, false)
+		AddItem(ui.bottomBar, 1, 0, false)
 
 	// add main input handler
 	rootFlex.SetInputCapture(ui.handlePageInput)
 
+	status := playback.Status()
+	ui.autoDJ = status.AutoDJ
+	ui.setSleepTimer(status.Sleep)
+	ui.updateStatusBar()
+
+	// receive events from mpv wrapper
+	playback.RegisterEventConsumer(ui)
+
+	// queue changes made through remote control interfaces
+	playback.OnQueueChanged(func() {
+		// the auto-DJ and sleep timer may have been changed remotely
+		status := playback.Status()
+		ui.app.QueueUpdateDraw(func() {
+			ui.autoDJ = status.AutoDJ
+			ui.setSleepTimer(status.Sleep)
+			ui.queuePage.UpdateQueue()
+		})
+	})
+
 	ui.app.SetRoot(rootFlex, true).
 		SetFocus(rootFlex).
 		EnableMouse(true)
@@ -207,14 +282,14 @@ func InitGui(artists []subsonic.Artist,
 }
 
 func (ui *Ui) Run() error {
-	// receive events from mpv wrapper
-	ui.player.RegisterEventConsumer(ui)
-
 	// run gui/background event handler
 	ui.runEventLoops()
 
-	// run mpv event handler
-	go ui.player.EventLoop()
+	// e.g. a remote client told us to quit
+	go func() {
+		<-ui.playback.Done()
+		ui.app.Stop()
+	}()
 
 	// gui main loop (blocking)
 	return ui.app.Run()
@@ -247,6 +322,29 @@ func (ui *Ui) CloseSelectPlaylist() {
 	ui.selectPlaylistWidget.visible = false
 }
 
+// showAddToPlaylist lets the user pick a playlist to add to, calls add with
+// it, and then returns to the page and focus
+func (ui *Ui) showAddToPlaylist(page string, focus tview.Primitive, add func(playlist *subsonic.Playlist)) {
+	// only makes sense to add to a playlist if there are playlists
+	if ui.playlistPage.GetCount() == 0 {
+		ui.showMessageBox("No playlists available. Create one first.")
+		return
+	}
+	ui.addToPlaylist = add
+	ui.addToPlaylistPage = page
+	ui.addToPlaylistFocus = focus
+	ui.browserPage.updatePlaylists()
+	ui.pages.ShowPage(PageAddToPlaylist)
+	ui.pages.SendToFront(PageAddToPlaylist)
+	ui.app.SetFocus(ui.addToPlaylistList)
+}
+
+func (ui *Ui) closeAddToPlaylist() {
+	ui.pages.HidePage(PageAddToPlaylist)
+	ui.pages.SwitchToPage(ui.addToPlaylistPage)
+	ui.app.SetFocus(ui.addToPlaylistFocus)
+}
+
 func (ui *Ui) showMessageBox(text string) {
 	ui.pages.ShowPage(PageMessageBox)
 	ui.messageBox.SetText(text)
@@ -0,0 +1,335 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spezifisch/stmps/cmdline"
+	"github.com/spezifisch/stmps/remote"
+	"github.com/spezifisch/stmps/subsonic"
+	"github.com/spf13/viper"
+)
+
+// how many names the completion drop-down shows
+const maxCompletions = 20
+
+// commandSpecs returns the commands of the ":" prompt: its own, followed by
+// the named keybinding commands of the Global context and the given one
+func (ui *Ui) commandSpecs(context string) []cmdline.Spec {
+	specs := ui.commandLineSpecs()
+	contexts := []string{ContextGlobal}
+	if context != ContextGlobal {
+		contexts = append(contexts, context)
+	}
+	for _, context := range contexts {
+		for _, command := range ui.keybindings.Commands(context) {
+			specs = append(specs, cmdline.Spec{Name: command.name, Help: command.help})
+		}
+	}
+	return specs
+}
+
+// commandLineSpecs are the commands that only the ":" prompt has
+func (ui *Ui) commandLineSpecs() []cmdline.Spec {
+	return []cmdline.Spec{
+		{
+			Name:  "add",
+			Usage: "artist|album|song <name>",
+			Help:  "add the best search match to the queue",
+			Args: func(args []string) ([]string, string) {
+				if len(args) == 0 {
+					return []string{"artist", "album", "song"}, ""
+				}
+				return nil, args[0]
+			},
+		},
+		{Name: "seek", Usage: "[+|-]<time>", Help: "go to a position, e.g. 1:30, or +10 seconds"},
+		{Name: "vol", Usage: "[+|-]<percent>", Help: "set the volume, or change it"},
+		{
+			Name:  "save",
+			Usage: "<name>",
+			Help:  "save the queue as a playlist; save! replaces an existing one",
+			Args: func(args []string) ([]string, string) {
+				return nil, "playlist"
+			},
+		},
+		{Name: "filter", Usage: "[<condition>...]", Help: "show only the matching albums or songs in the browser, e.g. year>2000"},
+		{
+			Name:  "random",
+			Usage: "[<preset>] [<n>] [genre=<g>] [year=<y>[-<y>]]",
+			Help:  "add random songs to the queue",
+			Args: func(args []string) ([]string, string) {
+				choices := []string{"year=", "from=", "to=", "folder="}
+				if len(args) == 0 {
+					for _, preset := range ui.randomPresets {
+						choices = append(choices, preset.Name)
+					}
+				}
+				for _, genre := range ui.genreNames() {
+					choices = append(choices, "genre="+genre)
+				}
+				return choices, ""
+			},
+		},
+		{
+			Name:  "sleep",
+			Usage: "<minutes>|track|album|off [fade]",
+			Help:  "stop playing after a time, the current song, or album",
+			Args: func(args []string) ([]string, string) {
+				if len(args) == 0 {
+					return []string{"track", "album", "off"}, "minutes"
+				}
+				return []string{"fade"}, ""
+			},
+		},
+	}
+}
+
+// runCommand runs a command line of the ":" prompt. Named keybinding commands
+// of the context are tried before the Global ones.
+func (ui *Ui) runCommand(line, context string) error {
+	command, err := cmdline.Parse(line)
+	if err != nil {
+		return err
+	}
+
+	switch command.Name {
+	case "add":
+		if len(command.Args) < 2 {
+			return errors.New("usage: add artist|album|song <name>")
+		}
+		return ui.addByName(command.Args[0], command.Rest(1))
+
+	case "seek":
+		if len(command.Args) != 1 {
+			return errors.New("usage: seek [+|-]<time>")
+		}
+		seconds, relative, err := cmdline.ParseTime(command.Args[0])
+		if err != nil {
+			return err
+		}
+		if relative {
+			return ui.playback.Seek(seconds)
+		}
+		return ui.playback.SeekAbsolute(seconds)
+
+	case "vol", "volume":
+		if len(command.Args) != 1 {
+			return errors.New("usage: vol [+|-]<percent>")
+		}
+		percent, relative, err := cmdline.ParseVolume(command.Args[0])
+		if err != nil {
+			return err
+		}
+		if relative {
+			return ui.playback.AdjustVolume(percent)
+		}
+		return ui.playback.SetVolume(percent)
+
+	case "save":
+		name := command.Rest(0)
+		if name == "" {
+			return errors.New("usage: save[!] <name>")
+		}
+		for _, playlist := range ui.playlistPage.playlists {
+			if playlist.Name == name && !command.Bang {
+				return fmt.Errorf("playlist %q exists; use :save! to replace it", name)
+			}
+		}
+		ui.queuePage.saveQueue(name)
+		return nil
+
+	case "filter":
+		if err := ui.browserPage.setEntityFilter(cmdline.Join(command.Args)); err != nil {
+			return err
+		}
+		ui.ShowPage(PageBrowser)
+		return nil
+
+	case "random":
+		// a preset, which the other options change
+		var filter subsonic.RandomSongsFilter
+		args := command.Args
+		if len(args) > 0 {
+			if preset := findRandomPreset(ui.randomPresets, args[0]); preset != nil {
+				filter = preset.Filter
+				args = args[1:]
+			}
+		}
+		options, err := cmdline.ParseRandom(args)
+		if err != nil {
+			return err
+		}
+		if options.Size != 0 {
+			filter.Size = options.Size
+		}
+		if options.Genre != "" {
+			filter.Genre = options.Genre
+		}
+		if options.FromYear != 0 {
+			filter.FromYear = options.FromYear
+		}
+		if options.ToYear != 0 {
+			filter.ToYear = options.ToYear
+		}
+		if options.MusicFolderId != "" {
+			filter.MusicFolderId = options.MusicFolderId
+		}
+		return ui.addFilteredRandomSongs(filter)
+
+	case "sleep":
+		options, err := cmdline.ParseSleep(command.Args)
+		if err != nil {
+			return fmt.Errorf("usage: sleep <minutes>|track|album|off [fade]: %w", err)
+		}
+		// the sleepTimer command starts over from the shortest time
+		ui.sleepStep = -1
+		return ui.playback.SetSleepTimer(remote.SleepParams{
+			Mode:    options.Mode,
+			Minutes: options.Minutes,
+			Fade:    options.Fade || viper.GetBool("sleep.fade"),
+		})
+	}
+
+	// named keybinding commands don't take arguments
+	if len(command.Args) == 0 {
+		if ui.keybindings.Run(context, command.Name) || ui.keybindings.Run(ContextGlobal, command.Name) {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown command %q; see the help for a list", command.Name)
+}
+
+// addByName adds the artist, album, or song that best matches the name to
+// the queue
+func (ui *Ui) addByName(what, name string) error {
+	results, err := ui.connection.Search(name, 0, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	var songs []subsonic.Entity
+	switch what {
+	case "artist":
+		artist, ok := bestMatch(results.Artists, name, func(a subsonic.Artist) string { return a.Name })
+		if !ok {
+			return fmt.Errorf("no artist matches %q", name)
+		}
+		if artist, err = ui.connection.GetArtist(artist.Id); err != nil {
+			return err
+		}
+		for _, album := range artist.Albums {
+			songs = append(songs, ui.albumSongs(album)...)
+		}
+	case "album":
+		album, ok := bestMatch(results.Albums, name, func(a subsonic.Album) string { return a.Name })
+		if !ok {
+			return fmt.Errorf("no album matches %q", name)
+		}
+		songs = ui.albumSongs(album)
+	case "song":
+		song, ok := bestMatch(results.Songs, name, func(s subsonic.Entity) string { return s.Title })
+		if !ok {
+			return fmt.Errorf("no song matches %q", name)
+		}
+		songs = []subsonic.Entity{song}
+	default:
+		return fmt.Errorf("can't add %q; add an artist, album, or song", what)
+	}
+
+	ui.queueSongs(songs...)
+	return nil
+}
+
+// bestMatch returns the item whose name is the given one, ignoring case, or
+// else the first one, which the server thinks matches best
+func bestMatch[T any](items []T, name string, nameOf func(T) string) (T, bool) {
+	for _, item := range items {
+		if strings.EqualFold(nameOf(item), name) {
+			return item, true
+		}
+	}
+	if len(items) > 0 {
+		return items[0], true
+	}
+	var none T
+	return none, false
+}
+
+// completeNames returns the names of a kind that start with, or contain, the
+// prefix, for completing the ":" prompt. They're taken from what was loaded
+// already, since this runs on every key press: the artists, the open artist
+// and album, the search results, and the albums page.
+func (ui *Ui) completeNames(kind, prefix string) []string {
+	var names []string
+	switch kind {
+	case "artist":
+		for _, artist := range ui.browserPage.artistObjectList {
+			names = append(names, artist.Name)
+		}
+
+	case "album":
+		albums := [][]subsonic.Album{
+			ui.browserPage.currentArtist.Albums,
+			ui.searchPage.albums,
+			ui.albumsPage.albums,
+		}
+		for _, list := range albums {
+			for _, album := range list {
+				names = append(names, album.Name)
+			}
+		}
+
+	case "song":
+		songs := [][]subsonic.Entity{
+			ui.browserPage.currentAlbum.Songs,
+			ui.searchPage.songs,
+		}
+		for _, list := range songs {
+			for _, song := range list {
+				names = append(names, song.Title)
+			}
+		}
+
+	case "playlist":
+		for _, playlist := range ui.playlistPage.playlists {
+			names = append(names, playlist.Name)
+		}
+	}
+	return cmdline.MatchNames(names, prefix, maxCompletions)
+}
+
+// genreNames returns the server's genres, which are fetched once
+func (ui *Ui) genreNames() []string {
+	if ui.genres == nil {
+		genres, err := ui.connection.GetGenres()
+		if err != nil {
+			ui.logger.PrintError("GetGenres", err)
+			return nil
+		}
+		ui.genres = make([]string, 0, len(genres))
+		for _, genre := range genres {
+			ui.genres = append(ui.genres, genre.Name)
+		}
+		sort.Strings(ui.genres)
+	}
+	return ui.genres
+}
+
+// musicFolders returns the server's music folders, which are fetched once
+func (ui *Ui) musicFolders() []subsonic.MusicFolder {
+	if ui.folders == nil {
+		folders, err := ui.connection.GetMusicFolders()
+		if err != nil {
+			ui.logger.PrintError("GetMusicFolders", err)
+			return nil
+		}
+		ui.folders = folders
+	}
+	return ui.folders
+}
@@ -4,143 +4,142 @@
 package main
 
 import (
-	"log"
+	"slices"
+	"sort"
 	"time"
 
 	"github.com/gdamore/tcell/v2"
-	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spezifisch/stmps/remote"
 	"github.com/spezifisch/stmps/subsonic"
+	"github.com/spf13/viper"
 )
 
 func (ui *Ui) handlePageInput(event *tcell.EventKey) *tcell.EventKey {
 	// we don't want any of these firing if we're trying to add a new playlist
 	focused := ui.app.GetFocus()
-	if ui.playlistPage.IsNewPlaylistInputFocused(focused) || ui.browserPage.IsSearchFocused(focused) || focused == ui.searchPage.searchField || ui.selectPlaylistWidget.visible {
+	if ui.playlistPage.IsNewPlaylistInputFocused(focused) || ui.browserPage.IsSearchFocused(focused) || focused == ui.searchPage.searchField || ui.selectPlaylistWidget.visible || ui.randomSongsWidget.visible || ui.commandLine.visible {
 		return event
 	}
 
-	switch event.Rune() {
-	case '1':
-		ui.ShowPage(PageBrowser)
-
-	case '2':
-		ui.ShowPage(PageQueue)
-
-	case '3':
-		ui.ShowPage(PagePlaylists)
-
-	case '4':
-		ui.ShowPage(PageSearch)
-
-	case '5':
-		ui.ShowPage(PageLog)
-
-	case '?':
-		ui.ShowHelp()
-
-	case 'Q':
-		ui.Quit()
+	if ui.keybindings.Dispatch(ContextGlobal, event) {
+		return nil
+	}
+	return event
+}
 
-	case 'r':
-		// add random songs to queue
+// registerGlobalCommands sets up the commands of the Global context
+func (ui *Ui) registerGlobalCommands() {
+	k := ui.keybindings
+
+	k.Handle(ContextGlobal, "showBrowser", func() { ui.ShowPage(PageBrowser) })
+	k.Handle(ContextGlobal, "showQueue", func() { ui.ShowPage(PageQueue) })
+	k.Handle(ContextGlobal, "showPlaylists", func() { ui.ShowPage(PagePlaylists) })
+	k.Handle(ContextGlobal, "showSearch", func() { ui.ShowPage(PageSearch) })
+	k.Handle(ContextGlobal, "showLog", func() { ui.ShowPage(PageLog) })
+	k.Handle(ContextGlobal, "showStats", func() { ui.ShowPage(PageStats) })
+	k.Handle(ContextGlobal, "showAlbums", func() { ui.ShowPage(PageAlbums) })
+	k.Handle(ContextGlobal, "commandLine", func() { ui.commandLine.Open() })
+	k.Handle(ContextGlobal, "help", ui.ShowHelp)
+	k.Handle(ContextGlobal, "quit", ui.Quit)
+
+	k.Handle(ContextGlobal, "addRandomSongs", func() {
 		ui.handleAddRandomSongs("")
-
-	case 'D':
+	})
+	k.Handle(ContextGlobal, "randomSongs", func() { ui.randomSongsWidget.Show() })
+	for _, preset := range ui.randomPresets {
+		filter := preset.Filter
+		k.Handle(ContextGlobal, randomPresetCommand(preset.Name), func() {
+			if err := ui.addFilteredRandomSongs(filter); err != nil {
+				ui.logger.PrintError("random preset", err)
+			}
+		})
+	}
+	k.Handle(ContextGlobal, "toggleAutoDJ", func() {
+		if err := ui.playback.SetAutoDJ(!ui.autoDJ); err != nil {
+			ui.logger.PrintError("toggleAutoDJ", err)
+			return
+		}
+		ui.autoDJ = !ui.autoDJ
+		ui.updateStatusBar()
+	})
+	k.Handle(ContextGlobal, "sleepTimer", ui.nextSleepStep)
+	k.Handle(ContextGlobal, "clearQueue", func() {
 		// clear queue and stop playing
-		ui.player.ClearQueue()
+		if err := ui.playback.ClearQueue(); err != nil {
+			ui.logger.PrintError("handlePageInput: ClearQueue", err)
+		}
 		ui.queuePage.UpdateQueue()
-
-	case 'p':
-		// toggle playing/pause
-		err := ui.player.Pause()
-		if err != nil {
+	})
+	k.Handle(ContextGlobal, "togglePause", func() {
+		if err := ui.playback.TogglePause(); err != nil {
 			ui.logger.PrintError("handlePageInput: Pause", err)
 		}
-
-	case 'P':
+	})
+	k.Handle(ContextGlobal, "stop", func() {
 		// stop playing without changes to queue
 		ui.logger.Print("key stop")
-		err := ui.player.Stop()
-		if err != nil {
+		if err := ui.playback.Stop(); err != nil {
 			ui.logger.PrintError("handlePageInput: Stop", err)
 		}
-
-	case 'X':
-		// debug stuff
-		ui.logger.Print("test")
-		//ui.player.Test()
-		ui.showMessageBox("foo bar")
-
-	case '-':
-		// volume-
-		if err := ui.player.AdjustVolume(-5); err != nil {
+	})
+	k.Handle(ContextGlobal, "volumeDown", func() {
+		if err := ui.playback.AdjustVolume(-5); err != nil {
 			ui.logger.PrintError("handlePageInput: AdjustVolume-", err)
 		}
-
-	case '+', '=':
-		// volume+
-		if err := ui.player.AdjustVolume(5); err != nil {
+	})
+	k.Handle(ContextGlobal, "volumeUp", func() {
+		if err := ui.playback.AdjustVolume(5); err != nil {
 			ui.logger.PrintError("handlePageInput: AdjustVolume+", err)
 		}
-
-	case '.':
-		// <<
-		if err := ui.player.Seek(10); err != nil {
+	})
+	k.Handle(ContextGlobal, "seekForward", func() {
+		if err := ui.playback.Seek(10); err != nil {
 			ui.logger.PrintError("handlePageInput: Seek+", err)
 		}
-
-	case ',':
-		// >>
-		if err := ui.player.Seek(-10); err != nil {
+	})
+	k.Handle(ContextGlobal, "seekBackward", func() {
+		if err := ui.playback.Seek(-10); err != nil {
 			ui.logger.PrintError("handlePageInput: Seek-", err)
 		}
-
-	case '>':
-		// skip to next track
-		if err := ui.player.PlayNextTrack(); err != nil {
+	})
+	k.Handle(ContextGlobal, "nextTrack", func() {
+		if err := ui.playback.NextTrack(); err != nil {
 			ui.logger.PrintError("handlePageInput: Next", err)
 		}
 		ui.queuePage.UpdateQueue()
+	})
+	k.Handle(ContextGlobal, "startScan", ui.startScan)
+}
 
-	case 'c':
-		ui.logger.Printf("info: starting server scan")
-		ui.scanning = true
-		if err := ui.connection.StartScan(); err != nil {
-			ui.logger.PrintError("startScan:", err)
-			return event
-		}
-		go func() {
-			for {
-				if pl, err := ui.player.IsPlaying(); err != nil || pl {
-					return
-				}
-				if ss, err := ui.connection.ScanStatus(); err != nil {
-					return
-				} else {
-					ui.scanning = ss.Scanning
-				}
-				item, err := ui.player.GetPlayingTrack()
-				if err != nil {
-					item = mpvplayer.QueueItem{}
-				}
-				ui.app.QueueUpdateDraw(func() {
-					txt := formatPlayerStatus(ui.scanning, ui.player.GetVolume(), int64(ui.player.GetTimePos()), int64(item.Duration))
-					ui.playerStatus.SetText(txt)
-				})
-				// If we're not scanning, this poller is not needed
-				if !ui.scanning {
-					return
-				}
-				// We could do this with a timer channel, but this is simpler
-				time.Sleep(1 * time.Second)
-			}
-		}()
-
-	default:
-		return event
+// startScan starts a library scan on the server, and shows that it's
+// scanning until it's done
+func (ui *Ui) startScan() {
+	ui.logger.Printf("info: starting server scan")
+	ui.scanning = true
+	if err := ui.connection.StartScan(); err != nil {
+		ui.logger.PrintError("startScan:", err)
+		return
 	}
-
-	return nil
+	go func() {
+		for {
+			status := ui.playback.Status()
+			if status.State == remote.StatePlaying {
+				return
+			}
+			if ss, err := ui.connection.ScanStatus(); err != nil {
+				return
+			} else {
+				ui.scanning = ss.Scanning
+			}
+			ui.app.QueueUpdateDraw(ui.updateStatusBar)
+			// If we're not scanning, this poller is not needed
+			if !ui.scanning {
+				return
+			}
+			// We could do this with a timer channel, but this is simpler
+			time.Sleep(1 * time.Second)
+		}
+	}()
 }
 
 func (ui *Ui) ShowPage(name string) {
@@ -151,28 +150,80 @@ func (ui *Ui) ShowPage(name string) {
 	if name == PageSearch {
 		ui.searchPage.aproposFocus()
 	}
+	if name == PageStats {
+		ui.statsPage.Refresh()
+	}
+	if name == PageAlbums {
+		ui.albumsPage.Show()
+	}
 }
 
+// Quit stops the UI. Shutting down playback is up to the caller of Run().
 func (ui *Ui) Quit() {
-	if len(ui.queuePage.queueData.playerQueue) > 0 {
-		ids := make([]string, len(ui.queuePage.queueData.playerQueue))
-		for i, it := range ui.queuePage.queueData.playerQueue {
-			ids[i] = it.Id
-		}
-		// stmps always only ever plays the first song in the queue
-		pos := ui.player.GetTimePos()
-		if err := ui.connection.SavePlayQueue(ids, ids[0], int(pos)); err != nil {
-			log.Printf("error stashing play queue: %s", err)
-		}
-	} else {
-		// The only way to purge a saved play queue is to force an error by providing
-		// bad data. Therefore, we ignore errors.
-		_ = ui.connection.SavePlayQueue([]string{"XXX"}, "XXX", 0)
-	}
-	ui.player.Quit()
 	ui.app.Stop()
 }
 
+// sleepSteps are the settings the sleepTimer command goes through
+var sleepSteps = []remote.SleepParams{
+	{Mode: remote.SleepMinutes, Minutes: 15},
+	{Mode: remote.SleepMinutes, Minutes: 30},
+	{Mode: remote.SleepMinutes, Minutes: 60},
+	{Mode: remote.SleepMinutes, Minutes: 90},
+	{Mode: remote.SleepTrack},
+	{Mode: remote.SleepAlbum},
+	{Mode: remote.SleepOff},
+}
+
+// nextSleepStep sets the sleep timer to the next of sleepSteps
+func (ui *Ui) nextSleepStep() {
+	step := (ui.sleepStep + 1) % len(sleepSteps)
+	params := sleepSteps[step]
+	params.Fade = viper.GetBool("sleep.fade")
+	if err := ui.playback.SetSleepTimer(params); err != nil {
+		ui.logger.PrintError("sleepTimer", err)
+		return
+	}
+	ui.sleepStep = step
+	if params.Mode == remote.SleepOff {
+		ui.sleepStep = -1
+	}
+}
+
+// setSleepTimer shows the state of the sleep timer; call it in the UI
+// goroutine
+func (ui *Ui) setSleepTimer(sleep *remote.SleepTimer) {
+	if ui.stopSleepTicker != nil {
+		close(ui.stopSleepTicker)
+		ui.stopSleepTicker = nil
+	}
+	ui.sleepDeadline = time.Time{}
+	if sleep == nil {
+		ui.sleepStep = -1
+		return
+	}
+	if sleep.Mode != remote.SleepMinutes {
+		// the queue shows where it stops
+		return
+	}
+
+	ui.sleepDeadline = time.Now().Add(time.Duration(sleep.Remaining) * time.Second)
+	// the status bar counts down even when nothing is playing
+	stop := make(chan struct{})
+	ui.stopSleepTicker = stop
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				ui.app.QueueUpdateDraw(ui.updateStatusBar)
+			}
+		}
+	}()
+}
+
 func (ui *Ui) handleAddRandomSongs(id string) {
 	ui.addRandomSongsToQueue(id)
 	ui.queuePage.UpdateQueue()
@@ -183,59 +234,42 @@ func (ui *Ui) addRandomSongsToQueue(id string) {
 	if err != nil {
 		ui.logger.Printf("addRandomSongsToQueue %s", err.Error())
 	}
-	for _, e := range entities {
-		ui.addSongToQueue(e)
-	}
+	ui.playback.AddSongs(entities...)
 }
 
-// make sure to call ui.QueuePage.UpdateQueue() after this
-func (ui *Ui) addSongToQueue(entity subsonic.Entity) {
-	uri := ui.connection.GetPlayUrl(entity)
-
-	album, err := ui.connection.GetAlbum(entity.Parent)
-	albumName := ""
-	if err != nil {
-		ui.logger.PrintError("addSongToQueue", err)
-	} else {
-		switch {
-		case album.Name != "":
-			albumName = album.Name
-		case album.Title != "":
-			albumName = album.Title
-		case album.Album != "":
-			albumName = album.Album
-		}
-	}
+// queueSongs appends songs to the queue, as one edit. Handlers that add what's
+// selected take it, or queueSongsNext, as the function to add the songs with.
+func (ui *Ui) queueSongs(songs ...subsonic.Entity) {
+	ui.playback.AddSongs(songs...)
+	ui.queuePage.UpdateQueue()
+}
 
-	// Populate the genre, by hook or crook
-	genre := entity.Genre
-	if genre == "" {
-		genre = album.Genre
-	}
-	if genre == "" && len(album.Genres) > 0 {
-		genre = album.Genres[0].Name
-	}
+// queueSongsNext inserts songs, in their order, right after the song that's
+// playing, as one edit, to play them next
+func (ui *Ui) queueSongsNext(songs ...subsonic.Entity) {
+	ui.playback.AddSongsNext(songs...)
+	ui.queuePage.UpdateQueue()
+}
 
-	queueItem := &mpvplayer.QueueItem{
-		Id:          entity.Id,
-		Uri:         uri,
-		Title:       entity.GetSongTitle(),
-		Artist:      entity.Artist,
-		Duration:    entity.Duration,
-		Album:       albumName,
-		TrackNumber: entity.Track,
-		CoverArtId:  entity.CoverArtId,
-		DiscNumber:  entity.DiscNumber,
-		Year:        entity.Year,
-		Genre:       genre,
+// albumSongs returns the songs of an album in disc and track order. They are
+// fetched if the album is sparse; the cached songs are left as they are.
+func (ui *Ui) albumSongs(album subsonic.Album) []subsonic.Entity {
+	if len(album.Songs) == 0 {
+		var err error
+		album, err = ui.connection.GetAlbum(album.Id)
+		if err != nil {
+			ui.logger.Printf("albumSongs: GetAlbum %s -- %s", album.Id, err.Error())
+			return nil
+		}
 	}
-	ui.player.AddToQueue(queueItem)
+	songs := slices.Clone(album.Songs)
+	sort.Sort(songs)
+	return songs
 }
 
 func (ui *Ui) makeSongHandler(entity subsonic.Entity) func() {
 	return func() {
-		uri := ui.connection.GetPlayUrl(entity)
-		if err := ui.player.PlayUri(uri, entity.CoverArtId, entity); err != nil {
+		if err := ui.playback.PlaySong(entity); err != nil {
 			ui.logger.PrintError("SongHandler Play", err)
 			return
 		}
@@ -0,0 +1,270 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/rivo/tview"
+	"github.com/spezifisch/stmps/logger"
+	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spezifisch/stmps/remote"
+	"github.com/spf13/viper"
+)
+
+// the templates of the UI, by their name in the config
+const (
+	templateStatusLeft  = "status-left"
+	templateStatusRight = "status-right"
+	templateSongInfo    = "song-info"
+)
+
+var defaultTemplates = map[string]string{
+	templateStatusLeft: `
+		{{- if eq .State "playing"}}{{style "playing"}}Playing{{reset}}
+		{{- else if eq .State "paused"}}{{style "paused"}}Paused{{reset}}
+		{{- else if eq .State "stopped"}}{{style "stopped"}}Stopped{{reset}}
+		{{- else}}[::b]{{.App}}[::-] v{{.Version}}{{end}}
+		{{- if and (ne .State "stopped") .Title}} {{style "text"}}{{escape .Title}}{{reset}}{{end}}
+		{{- if and (ne .State "stopped") .Artist}} {{style "dim"}}by{{reset}} {{style "text"}}{{escape .Artist}}{{reset}}{{end}}`,
+
+	templateStatusRight: `
+		{{- if .Scanning}}{{style "scanning"}}(S){{reset}}{{else}}( ){{end -}}
+		{{- if .AutoDJ}}[DJ]{{end -}}
+		{{- if .Sleeping}}[Zz {{duration .StopIn}}]{{end -}}
+		[{{.Volume}}%][::b][{{duration .Position}}/{{duration .Duration}}]`,
+
+	templateSongInfo: `
+		{{- style "infoLabel"}}Title:{{reset}} {{style "infoTitle"}}{{escape .Title}}{{reset}} {{style "infoDuration"}}({{duration .Duration}}){{reset}}
+{{style "infoLabel"}}Artist:{{reset}} {{style "infoValue"}}{{escape .Artist}}{{reset}}
+{{style "infoLabel"}}Album:{{reset}} {{style "infoValue"}}{{escape .Album}}{{reset}}
+{{style "infoLabel"}}Disc:{{reset}} {{style "infoValue"}}{{.DiscNumber}}{{reset}}  {{style "infoLabel"}}Track:{{reset}} {{style "infoValue"}}{{.TrackNumber}}{{reset}}
+{{style "infoLabel"}}Year:{{reset}} {{style "infoValue"}}{{.Year}}{{reset}}  {{style "infoLabel"}}Genre:{{reset}} {{style "infoValue"}}{{escape .Genre}}{{reset}}
+`,
+}
+
+// templateData is what the status bar and song info templates see. The song
+// is the one that's playing in the status bar, and the selected one in the
+// song info panel.
+type templateData struct {
+	mpvplayer.QueueItem
+
+	// State is "playing", "paused", or "stopped", or empty until something
+	// was played
+	State string
+	// Position and Duration of the song, in seconds
+	Position int64
+	Duration int64
+	// Volume in percent
+	Volume int64
+	// Scanning is whether the server is scanning the library
+	Scanning bool
+	// AutoDJ is whether the auto-DJ keeps the queue filled
+	AutoDJ bool
+	// Sleeping is whether playback stops by itself: at a song marked to stop
+	// after, or when the sleep timer is up
+	Sleeping bool
+	// StopIn is how many seconds are left until then
+	StopIn int64
+	// QueueLength is the number of songs in the queue
+	QueueLength int
+	// QueueRemaining is how many seconds of the queue are left to play,
+	// including the rest of the current song
+	QueueRemaining int64
+	// App and Version are the name and version of stmps
+	App     string
+	Version string
+}
+
+// templateFuncs are the helpers templates can use, besides Go's
+func templateFuncs(theme *Theme) template.FuncMap {
+	return template.FuncMap{
+		// duration formats seconds as mm:ss, or h:mm:ss
+		"duration": func(seconds any) string {
+			return formatClock(toSeconds(seconds))
+		},
+		// truncate shortens text to a width, with an ellipsis
+		"truncate": func(width int, text string) string {
+			return runewidth.Truncate(text, width, "…")
+		},
+		// escape keeps text from being taken for colors; use it on all song
+		// metadata
+		"escape": tview.Escape,
+		// style starts a style of the theme, color only its text color
+		"style": theme.Tag,
+		"color": func(name string) string {
+			return theme.Style(name).ColorTag()
+		},
+		// reset ends a style or color
+		"reset": func() string {
+			return themeReset
+		},
+	}
+}
+
+// toSeconds converts the integers of templateData
+func toSeconds(seconds any) int64 {
+	switch s := seconds.(type) {
+	case int:
+		return int64(s)
+	case int64:
+		return s
+	}
+	return 0
+}
+
+// formatClock formats seconds as mm:ss, or h:mm:ss if it's an hour or more
+func formatClock(seconds int64) string {
+	if seconds < 0 {
+		seconds = 0
+	}
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
+
+// uiTemplates are the templates of the UI by name, which the user can
+// replace
+type uiTemplates struct {
+	theme     *Theme
+	logger    logger.LoggerInterface
+	templates map[string]*template.Template
+}
+
+// loadTemplates loads the templates: from the config, e.g.
+//
+//	[templates]
+//	status-left = "{{.Artist}} - {{.Title}}"
+//
+// or from a file in the config dir, e.g. templates/status-left.tmpl, or else
+// the defaults. A template that doesn't parse is logged and replaced with the
+// default.
+func loadTemplates(theme *Theme, logger logger.LoggerInterface) *uiTemplates {
+	t := &uiTemplates{
+		theme:     theme,
+		logger:    logger,
+		templates: make(map[string]*template.Template, len(defaultTemplates)),
+	}
+	for name := range defaultTemplates {
+		text, err := templateSource(name)
+		if err == nil && text != "" {
+			t.templates[name], err = t.parse(name, text)
+		}
+		if err != nil {
+			logger.PrintError("templates."+name, err)
+		}
+		if t.templates[name] == nil {
+			t.templates[name] = t.defaultTemplate(name)
+		}
+	}
+	return t
+}
+
+// templateSource returns the user's template, or "" if there is none
+func templateSource(name string) (string, error) {
+	if text := viper.GetString("templates." + name); text != "" {
+		return text, nil
+	}
+	dir := configDir()
+	if dir == "" {
+		return "", nil
+	}
+	text, err := os.ReadFile(filepath.Join(dir, "templates", name+".tmpl"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	// a file ends with a newline that isn't meant to be shown
+	return strings.TrimSuffix(string(text), "\n"), err
+}
+
+func (t *uiTemplates) parse(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs(t.theme)).Parse(text)
+}
+
+func (t *uiTemplates) defaultTemplate(name string) *template.Template {
+	tmpl, err := t.parse(name, defaultTemplates[name])
+	if err != nil {
+		panic(err)
+	}
+	return tmpl
+}
+
+// render runs a template. If it fails, it's logged and replaced with the
+// default.
+func (t *uiTemplates) render(name string, data templateData) string {
+	// the Uri has the credentials
+	data.Uri = ""
+
+	var b strings.Builder
+	err := t.templates[name].Execute(&b, data)
+	if err != nil {
+		t.logger.PrintError("templates."+name, err)
+		t.templates[name] = t.defaultTemplate(name)
+		b.Reset()
+		_ = t.templates[name].Execute(&b, data)
+	}
+	return b.String()
+}
+
+// statusData returns the data for templates: the status of the player and
+// the queue
+func (ui *Ui) statusData() templateData {
+	data := ui.status
+	data.App = Name
+	data.Version = Version
+	data.Scanning = ui.scanning
+	data.AutoDJ = ui.autoDJ
+	if ui.queuePage == nil {
+		return data
+	}
+
+	queue := ui.queuePage.queueData.playerQueue
+	data.QueueLength = len(queue)
+	playing := data.State == remote.StatePlaying || data.State == remote.StatePaused
+	var position int64
+	if playing {
+		position = data.Position
+	}
+	data.StopIn, data.Sleeping = timeToStop(queue, position)
+	if !ui.sleepDeadline.IsZero() {
+		left := max(int64(time.Until(ui.sleepDeadline).Round(time.Second)/time.Second), 0)
+		if !data.Sleeping || left < data.StopIn {
+			data.StopIn = left
+		}
+		data.Sleeping = true
+	}
+	if playing {
+		if len(queue) > 0 {
+			queue = queue[1:]
+		}
+		data.QueueRemaining = max(data.Duration-data.Position, 0)
+	}
+	for _, song := range queue {
+		data.QueueRemaining += int64(song.Duration)
+	}
+	return data
+}
+
+// updateStatusBar renders the status bar; call it in the UI goroutine
+func (ui *Ui) updateStatusBar() {
+	data := ui.statusData()
+	ui.startStopStatus.SetText(ui.templates.render(templateStatusLeft, data))
+
+	right := ui.templates.render(templateStatusRight, data)
+	ui.playerStatus.SetText(right)
+	ui.topBar.ResizeItem(ui.playerStatus, max(tview.TaggedStringWidth(right), statusRightMinWidth), 0)
+}
+
+// how wide the right side of the status bar is at least, so that it doesn't
+// move around while playing
+const statusRightMinWidth = 24
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// errorLogger remembers the sources of the errors it's given
+type errorLogger struct {
+	quietLogger
+	sources []string
+}
+
+func (l *errorLogger) PrintError(source string, err error) {
+	l.sources = append(l.sources, source)
+}
+
+func TestDefaultTemplates(t *testing.T) {
+	defer viper.Reset()
+	viper.SetConfigFile(filepath.Join(t.TempDir(), "stmp.toml"))
+	theme := builtinThemes["mono"]
+	templates := loadTemplates(theme, &errorLogger{})
+
+	data := templateData{App: "stmps", Version: "1.0"}
+	assert.Equal(t, "[::b]stmps[::-] v1.0", templates.render(templateStatusLeft, data))
+
+	data.State = "paused"
+	data.QueueItem = mpvplayer.QueueItem{Title: "Song [live]", Artist: "Band", Duration: 4000}
+	assert.Equal(t, "[::bi]Paused[-:-:-] [-:-]Song [live[][-:-:-] [::d]by[-:-:-] [-:-]Band[-:-:-]", templates.render(templateStatusLeft, data))
+
+	data.State = "stopped"
+	assert.Equal(t, "[::d]Stopped[-:-:-]", templates.render(templateStatusLeft, data))
+
+	data.Scanning = true
+	data.Volume = 80
+	data.Position = 65
+	data.Duration = 4000
+	assert.Equal(t, "[::b](S)[-:-:-][80%][::b][01:05/1:06:40]", templates.render(templateStatusRight, data))
+
+	info := templates.render(templateSongInfo, data)
+	assert.Contains(t, info, "Song [live[]")
+	assert.Contains(t, info, "(1:06:40)")
+}
+
+func TestUserTemplates(t *testing.T) {
+	defer viper.Reset()
+	dir := t.TempDir()
+	viper.SetConfigFile(filepath.Join(dir, "stmp.toml"))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "templates"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "templates", templateSongInfo+".tmpl"),
+		[]byte("{{.Album}} by {{.AlbumArtist}}\n"), 0600))
+	viper.Set("templates."+templateStatusLeft, `{{truncate 8 .Title}} {{.QueueLength}} songs, {{duration .QueueRemaining}} left`)
+	viper.Set("templates."+templateStatusRight, `{{.Broken`)
+
+	logger := &errorLogger{}
+	templates := loadTemplates(builtinThemes["default"], logger)
+	assert.Equal(t, []string{"templates." + templateStatusRight}, logger.sources)
+
+	data := templateData{QueueItem: mpvplayer.QueueItem{Title: "A long title", Album: "Album", AlbumArtist: "Various"}, QueueLength: 3, QueueRemaining: 600}
+	assert.Equal(t, "A long … 3 songs, 10:00 left", templates.render(templateStatusLeft, data))
+	assert.Equal(t, "Album by Various", templates.render(templateSongInfo, data))
+	// the default
+	assert.Equal(t, "( )[0%][::b][00:00/00:00]", templates.render(templateStatusRight, data))
+
+	// errors while running it
+	viper.Set("templates."+templateStatusLeft, `{{.NoSuchField}}`)
+	viper.Set("templates."+templateStatusRight, "")
+	logger = &errorLogger{}
+	templates = loadTemplates(builtinThemes["default"], logger)
+	assert.Empty(t, logger.sources)
+	assert.Contains(t, templates.render(templateStatusLeft, templateData{App: "stmps"}), "stmps")
+	assert.Equal(t, []string{"templates." + templateStatusLeft}, logger.sources)
+}
+
+func TestStatusData(t *testing.T) {
+	ui := &Ui{queuePage: &QueuePage{}}
+	ui.queuePage.queueData.playerQueue = mpvplayer.PlayerQueue{{Duration: 100}, {Duration: 200}, {Duration: 300}}
+
+	data := ui.statusData()
+	assert.Equal(t, 3, data.QueueLength)
+	assert.EqualValues(t, 600, data.QueueRemaining)
+
+	ui.status.State = "playing"
+	ui.status.Position = 40
+	ui.status.Duration = 100
+	data = ui.statusData()
+	assert.EqualValues(t, 560, data.QueueRemaining)
+}
@@ -0,0 +1,97 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+// Package history keeps a local record of the songs played, as a file of JSON
+// lines that plays are only ever appended to.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Play is one play of a song, recorded when it ended
+type Play struct {
+	// when the song started playing
+	Time     time.Time `json:"time"`
+	SongId   string    `json:"id"`
+	Title    string    `json:"title"`
+	Artist   string    `json:"artist"`
+	ArtistId string    `json:"artistId,omitempty"`
+	Album    string    `json:"album"`
+	AlbumId  string    `json:"albumId,omitempty"`
+	// length of the song, in seconds
+	Duration int `json:"duration"`
+	// how long the song was actually played, in seconds
+	Played int `json:"played"`
+	// whether it was left before it was played long enough to count as
+	// listened to
+	Skipped bool `json:"skipped"`
+}
+
+// Log appends plays to a history file
+type Log struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+// Open opens the history file for appending, creating it if needed
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{file: file}, nil
+}
+
+// Record appends a play
+func (l *Log) Record(play Play) error {
+	line, err := json.Marshal(play)
+	if err != nil {
+		return err
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	// one write per line, so that readers never see half a play, except
+	// after a crash
+	_, err = l.file.Write(append(line, '\n'))
+	return err
+}
+
+func (l *Log) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.file.Close()
+}
+
+// Load reads all plays from a history file, oldest first. A missing file is
+// an empty history; lines that can't be read, like one cut off by a crash,
+// are skipped.
+func Load(path string) ([]Play, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var plays []Play
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var play Play
+		if err := json.Unmarshal(scanner.Bytes(), &play); err != nil {
+			continue
+		}
+		plays = append(plays, play)
+	}
+	return plays, scanner.Err()
+}
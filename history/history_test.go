@@ -0,0 +1,129 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stmps", "history.jsonl")
+
+	plays, err := Load(path)
+	if err != nil || len(plays) != 0 {
+		t.Fatalf("missing file: %v, %v", plays, err)
+	}
+
+	log, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	want := []Play{
+		{Time: started, SongId: "1", Title: "One", Artist: "A", Album: "X", Duration: 200, Played: 200},
+		{Time: started.Add(time.Hour), SongId: "2", Title: "Two", Artist: "A", Duration: 100, Played: 10, Skipped: true},
+	}
+	for _, play := range want {
+		if err := log.Record(play); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a line cut off by a crash
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"time":"2024-05-01T14:00:00Z","id":"3","tit`)
+	f.Close()
+
+	plays, err = Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plays) != len(want) {
+		t.Fatalf("loaded %d plays, want %d", len(plays), len(want))
+	}
+	for i := range want {
+		if !plays[i].Time.Equal(want[i].Time) || plays[i].SongId != want[i].SongId || plays[i].Skipped != want[i].Skipped {
+			t.Errorf("play %d: got %+v, want %+v", i, plays[i], want[i])
+		}
+	}
+}
+
+func TestPeriodRange(t *testing.T) {
+	// a Wednesday
+	now := time.Date(2024, 1, 3, 15, 4, 5, 0, time.UTC)
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		period   Period
+		offset   int
+		from, to time.Time
+	}{
+		{Week, 0, day(2024, 1, 1), day(2024, 1, 8)},
+		{Week, -1, day(2023, 12, 25), day(2024, 1, 1)},
+		{Month, 0, day(2024, 1, 1), day(2024, 2, 1)},
+		{Month, -1, day(2023, 12, 1), day(2024, 1, 1)},
+		{Year, 0, day(2024, 1, 1), day(2025, 1, 1)},
+		{Year, -2, day(2022, 1, 1), day(2023, 1, 1)},
+	}
+	for _, tt := range tests {
+		from, to := tt.period.Range(now, tt.offset)
+		if !from.Equal(tt.from) || !to.Equal(tt.to) {
+			t.Errorf("%s %+d: got %s - %s, want %s - %s", tt.period, tt.offset, from, to, tt.from, tt.to)
+		}
+	}
+
+	// Sunday is the end of the week
+	from, _ := Week.Range(day(2024, 1, 7), 0)
+	if !from.Equal(day(2024, 1, 1)) {
+		t.Errorf("week of a Sunday starts %s", from)
+	}
+
+	if from, to := AllTime.Range(now, 0); !from.IsZero() || !to.IsZero() {
+		t.Errorf("all time is %s - %s", from, to)
+	}
+}
+
+func TestCompute(t *testing.T) {
+	at := func(d int) time.Time { return time.Date(2024, 3, d, 20, 0, 0, 0, time.UTC) }
+	plays := []Play{
+		{Time: at(1), SongId: "s1", Title: "Hit", Artist: "Band", ArtistId: "a1", Album: "LP", AlbumId: "l1", Played: 180},
+		{Time: at(2), SongId: "s1", Title: "Hit", Artist: "Band", ArtistId: "a1", Album: "LP", AlbumId: "l1", Played: 180},
+		{Time: at(2), SongId: "s2", Title: "Filler", Artist: "Band", ArtistId: "a1", Album: "LP", AlbumId: "l1", Played: 5, Skipped: true},
+		{Time: at(3), SongId: "s3", Title: "Other", Artist: "Solo", ArtistId: "a2", Album: "EP", AlbumId: "l2", Played: 200},
+		// outside the range
+		{Time: at(10), SongId: "s3", Title: "Other", Artist: "Solo", ArtistId: "a2", Album: "EP", AlbumId: "l2", Played: 200},
+	}
+
+	stats := Compute(plays, at(1), at(10))
+	if stats.Plays != 4 || stats.Skips != 1 || stats.Played != 565*time.Second {
+		t.Errorf("totals: %d plays, %d skips, %v", stats.Plays, stats.Skips, stats.Played)
+	}
+	if stats.SkipRate() != 0.25 {
+		t.Errorf("skip rate %v", stats.SkipRate())
+	}
+
+	if len(stats.Artists) != 2 || stats.Artists[0].Id != "a1" || stats.Artists[0].Plays != 3 || stats.Artists[0].Skips != 1 {
+		t.Errorf("artists: %+v", stats.Artists)
+	}
+	if len(stats.Albums) != 2 || stats.Albums[0].Id != "l1" || stats.Albums[0].Artist != "Band" {
+		t.Errorf("albums: %+v", stats.Albums)
+	}
+	if len(stats.Tracks) != 3 || stats.Tracks[0].Id != "s1" || stats.Tracks[0].Plays != 2 {
+		t.Errorf("tracks: %+v", stats.Tracks)
+	}
+	// listened to once beats skipped once
+	if stats.Tracks[1].Id != "s3" || stats.Tracks[2].Id != "s2" || stats.Tracks[2].SkipRate() != 1 {
+		t.Errorf("track order: %+v", stats.Tracks)
+	}
+
+	if all := Compute(plays, time.Time{}, time.Time{}); all.Plays != 5 {
+		t.Errorf("all time: %d plays", all.Plays)
+	}
+}
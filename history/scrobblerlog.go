@@ -0,0 +1,206 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package history
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A .scrobbler.log is the play log that Rockbox and other portable players
+// write for later submission, in the AUDIOSCROBBLER/1.1 format: a few header
+// lines starting with #, then a line per play with the tab-separated fields
+//
+//	artist, album, title, track number, length, rating, timestamp, MusicBrainz ID
+//
+// where the rating is L (listened) or S (skipped), and the timestamp is in
+// seconds since the epoch. With #TZ/UNKNOWN, the timestamp is the device's
+// local time taken as if it were UTC.
+const (
+	scrobblerLogHeader = "#AUDIOSCROBBLER/1.1"
+	scrobblerLogTZUTC  = "#TZ/UTC"
+	scrobblerLogTZ     = "#TZ/"
+	scrobblerLogClient = "#CLIENT/"
+)
+
+// ScrobblerLogEntry is one play in a .scrobbler.log
+type ScrobblerLogEntry struct {
+	Artist      string
+	Album       string
+	Title       string
+	TrackNumber int
+	// length of the song, in seconds
+	Duration int
+	// L in the log; false is S, skipped
+	Listened bool
+	// when the song started playing
+	Time          time.Time
+	MusicBrainzId string
+}
+
+// ScrobblerLog appends plays to a .scrobbler.log
+type ScrobblerLog struct {
+	lock sync.Mutex
+	file *os.File
+}
+
+// OpenScrobblerLog opens a .scrobbler.log for appending, creating it if
+// needed. A new log gets the header, with client as the #CLIENT; the
+// timestamps written are UTC.
+func OpenScrobblerLog(path, client string) (*ScrobblerLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.Size() == 0 {
+		header := scrobblerLogHeader + "\n" + scrobblerLogTZUTC + "\n" + scrobblerLogClient + scrobblerLogField(client) + "\n"
+		if _, err := file.WriteString(header); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return &ScrobblerLog{file: file}, nil
+}
+
+// Record appends a play
+func (l *ScrobblerLog) Record(entry ScrobblerLogEntry) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	_, err := l.file.WriteString(entry.String() + "\n")
+	return err
+}
+
+func (l *ScrobblerLog) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.file.Close()
+}
+
+// String formats the entry as a line of a log with #TZ/UTC, without the
+// newline
+func (e ScrobblerLogEntry) String() string {
+	track := ""
+	if e.TrackNumber > 0 {
+		track = strconv.Itoa(e.TrackNumber)
+	}
+	rating := "S"
+	if e.Listened {
+		rating = "L"
+	}
+	return strings.Join([]string{
+		scrobblerLogField(e.Artist),
+		scrobblerLogField(e.Album),
+		scrobblerLogField(e.Title),
+		track,
+		strconv.Itoa(e.Duration),
+		rating,
+		strconv.FormatInt(e.Time.Unix(), 10),
+		scrobblerLogField(e.MusicBrainzId),
+	}, "\t")
+}
+
+// scrobblerLogField keeps a value from breaking the line up
+func scrobblerLogField(s string) string {
+	return strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(s)
+}
+
+// ReadScrobblerLog reads the plays of a .scrobbler.log. Timestamps of a log
+// with an unknown time zone are taken as local time. Lines that aren't plays
+// are an error, so that a file that isn't a .scrobbler.log isn't taken for an
+// empty one.
+func ReadScrobblerLog(r io.Reader) ([]ScrobblerLogEntry, error) {
+	var entries []ScrobblerLogEntry
+	sawHeader := false
+	utc := false
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if lineNumber == 1 {
+			// some devices write a byte order mark
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			switch {
+			case strings.HasPrefix(line, "#AUDIOSCROBBLER/"):
+				sawHeader = true
+			case strings.HasPrefix(line, scrobblerLogTZ):
+				utc = line == scrobblerLogTZUTC
+			}
+			continue
+		}
+		if !sawHeader {
+			return nil, errors.New("not a .scrobbler.log: missing the #AUDIOSCROBBLER header")
+		}
+
+		entry, err := parseScrobblerLogLine(line, utc)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+func parseScrobblerLogLine(line string, utc bool) (ScrobblerLogEntry, error) {
+	fields := strings.Split(line, "\t")
+	// the MusicBrainz ID is missing in logs of AUDIOSCROBBLER/1.0
+	if len(fields) == 7 {
+		fields = append(fields, "")
+	}
+	if len(fields) != 8 {
+		return ScrobblerLogEntry{}, fmt.Errorf("expected 8 fields, got %d", len(fields))
+	}
+
+	entry := ScrobblerLogEntry{
+		Artist:        fields[0],
+		Album:         fields[1],
+		Title:         fields[2],
+		MusicBrainzId: fields[7],
+	}
+	if fields[3] != "" {
+		// it's free-form on some devices, e.g. 3/12; it's only informational
+		// anyway
+		entry.TrackNumber, _ = strconv.Atoi(strings.SplitN(fields[3], "/", 2)[0])
+	}
+	var err error
+	if entry.Duration, err = strconv.Atoi(fields[4]); err != nil {
+		return entry, fmt.Errorf("invalid length %q", fields[4])
+	}
+	switch fields[5] {
+	case "L":
+		entry.Listened = true
+	case "S":
+	default:
+		return entry, fmt.Errorf("invalid rating %q", fields[5])
+	}
+	timestamp, err := strconv.ParseInt(fields[6], 10, 64)
+	if err != nil {
+		return entry, fmt.Errorf("invalid timestamp %q", fields[6])
+	}
+	entry.Time = time.Unix(timestamp, 0)
+	if !utc {
+		t := entry.Time.UTC()
+		entry.Time = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local)
+	}
+	return entry, nil
+}
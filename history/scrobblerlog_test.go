@@ -0,0 +1,93 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScrobblerLogRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stmps", ".scrobbler.log")
+	started := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	want := []ScrobblerLogEntry{
+		{Artist: "A", Album: "X", Title: "One", TrackNumber: 1, Duration: 200, Listened: true, Time: started, MusicBrainzId: "mbid-1"},
+		{Artist: "A", Title: "Two\tparts", Duration: 100, Time: started.Add(time.Hour)},
+	}
+
+	// records are appended, and the header is only written once
+	for _, entry := range want {
+		log, err := OpenScrobblerLog(path, "stmps test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := log.Record(entry); err != nil {
+			t.Fatal(err)
+		}
+		if err := log.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "#AUDIOSCROBBLER/1.1\n#TZ/UTC\n#CLIENT/stmps test\n") {
+		t.Errorf("header: %q", data)
+	}
+	if n := strings.Count(string(data), "#AUDIOSCROBBLER"); n != 1 {
+		t.Errorf("%d headers", n)
+	}
+
+	entries, err := ReadScrobblerLog(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("read %d entries, want 2", len(entries))
+	}
+	if e := entries[0]; e.Artist != "A" || e.Album != "X" || e.Title != "One" || e.TrackNumber != 1 ||
+		e.Duration != 200 || !e.Listened || !e.Time.Equal(started) || e.MusicBrainzId != "mbid-1" {
+		t.Errorf("entry 0: %+v", e)
+	}
+	if e := entries[1]; e.Title != "Two parts" || e.Listened || e.TrackNumber != 0 || !e.Time.Equal(started.Add(time.Hour)) {
+		t.Errorf("entry 1: %+v", e)
+	}
+}
+
+func TestReadScrobblerLog(t *testing.T) {
+	// as written by a device that doesn't know its time zone, with CRLF
+	// line endings and without MusicBrainz IDs
+	log := "#AUDIOSCROBBLER/1.0\r\n#TZ/UNKNOWN\r\n#CLIENT/Rockbox h3xx $Revision$\r\n" +
+		"Band\tLP\tHit\t3/12\t181\tL\t1714564800\r\n" +
+		"Band\tLP\tFiller\t\t95\tS\t1714565000\r\n"
+	entries, err := ReadScrobblerLog(strings.NewReader(log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("read %d entries, want 2", len(entries))
+	}
+	// 1714564800 is 2024-05-01 12:00:00 UTC, which the device meant as its
+	// local time
+	want := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+	if e := entries[0]; e.Title != "Hit" || e.TrackNumber != 3 || !e.Listened || !e.Time.Equal(want) {
+		t.Errorf("entry 0: %+v", e)
+	}
+	if entries[1].Listened {
+		t.Errorf("entry 1 isn't skipped")
+	}
+
+	for _, bad := range []string{
+		"Band\tLP\tHit\t1\t181\tL\t1714564800\n",
+		"#AUDIOSCROBBLER/1.1\nBand\tLP\tHit\t1\t181\tX\t1714564800\n",
+		"#AUDIOSCROBBLER/1.1\nBand\tLP\tHit\t1\t181\tL\n",
+		"#AUDIOSCROBBLER/1.1\nBand\tLP\tHit\t1\t181\tL\tyesterday\n",
+	} {
+		if _, err := ReadScrobblerLog(strings.NewReader(bad)); err == nil {
+			t.Errorf("no error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package history
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Period is a calendar period that statistics are computed for
+type Period int
+
+const (
+	Week Period = iota
+	Month
+	Year
+	AllTime
+)
+
+func (p Period) String() string {
+	switch p {
+	case Week:
+		return "week"
+	case Month:
+		return "month"
+	case Year:
+		return "year"
+	}
+	return "all time"
+}
+
+// Range returns the period that contains t, or with offset, the one offset
+// periods before (negative) or after it. Weeks start on Monday. For AllTime,
+// from and to are zero, which Compute takes as unbounded.
+func (p Period) Range(t time.Time, offset int) (from, to time.Time) {
+	year, month, day := t.Date()
+	switch p {
+	case Week:
+		// days since Monday
+		weekday := (int(t.Weekday()) + 6) % 7
+		from = time.Date(year, month, day-weekday+7*offset, 0, 0, 0, 0, t.Location())
+		to = from.AddDate(0, 0, 7)
+	case Month:
+		from = time.Date(year, month+time.Month(offset), 1, 0, 0, 0, 0, t.Location())
+		to = from.AddDate(0, 1, 0)
+	case Year:
+		from = time.Date(year+offset, 1, 1, 0, 0, 0, 0, t.Location())
+		to = from.AddDate(1, 0, 0)
+	}
+	return
+}
+
+// Entry is an artist, album, or track in the statistics
+type Entry struct {
+	// the artist, album, or song ID; it may be empty for plays recorded
+	// without one
+	Id   string
+	Name string
+	// the artist of an album or track
+	Artist string
+
+	Plays  int
+	Skips  int
+	Played time.Duration
+}
+
+// SkipRate is the share of plays that were skipped, from 0 to 1
+func (e Entry) SkipRate() float64 {
+	if e.Plays == 0 {
+		return 0
+	}
+	return float64(e.Skips) / float64(e.Plays)
+}
+
+// Stats summarizes the plays in a time range
+type Stats struct {
+	From, To time.Time
+
+	Plays  int
+	Skips  int
+	Played time.Duration
+
+	// most listened to first
+	Artists []Entry
+	Albums  []Entry
+	Tracks  []Entry
+}
+
+// SkipRate is the share of plays that were skipped, from 0 to 1
+func (s Stats) SkipRate() float64 {
+	return Entry{Plays: s.Plays, Skips: s.Skips}.SkipRate()
+}
+
+// Compute computes the statistics of the plays that started in [from, to).
+// A zero from or to leaves that end open.
+func Compute(plays []Play, from, to time.Time) Stats {
+	stats := Stats{From: from, To: to}
+	artists := make(map[string]*Entry)
+	albums := make(map[string]*Entry)
+	tracks := make(map[string]*Entry)
+
+	count := func(entries map[string]*Entry, key string, entry Entry, play Play) {
+		e, ok := entries[key]
+		if !ok {
+			e = &entry
+			entries[key] = e
+		}
+		e.Plays++
+		if play.Skipped {
+			e.Skips++
+		}
+		e.Played += time.Duration(play.Played) * time.Second
+	}
+
+	for _, play := range plays {
+		if (!from.IsZero() && play.Time.Before(from)) || (!to.IsZero() && !play.Time.Before(to)) {
+			continue
+		}
+		stats.Plays++
+		if play.Skipped {
+			stats.Skips++
+		}
+		stats.Played += time.Duration(play.Played) * time.Second
+
+		// plays recorded without IDs are told apart by name
+		artistKey := play.ArtistId
+		if artistKey == "" {
+			artistKey = "\x00" + strings.ToLower(play.Artist)
+		}
+		count(artists, artistKey, Entry{Id: play.ArtistId, Name: play.Artist}, play)
+
+		if play.Album != "" || play.AlbumId != "" {
+			albumKey := play.AlbumId
+			if albumKey == "" {
+				albumKey = "\x00" + strings.ToLower(play.Artist+"\x00"+play.Album)
+			}
+			count(albums, albumKey, Entry{Id: play.AlbumId, Name: play.Album, Artist: play.Artist}, play)
+		}
+
+		trackKey := play.SongId
+		if trackKey == "" {
+			trackKey = "\x00" + strings.ToLower(play.Artist+"\x00"+play.Title)
+		}
+		count(tracks, trackKey, Entry{Id: play.SongId, Name: play.Title, Artist: play.Artist}, play)
+	}
+
+	stats.Artists = ranked(artists)
+	stats.Albums = ranked(albums)
+	stats.Tracks = ranked(tracks)
+	return stats
+}
+
+// ranked sorts entries by how often they were listened to (played and not
+// skipped), then by how long they were played
+func ranked(entries map[string]*Entry) []Entry {
+	list := make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, *e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Plays-a.Skips != b.Plays-b.Skips {
+			return a.Plays-a.Skips > b.Plays-b.Skips
+		}
+		if a.Played != b.Played {
+			return a.Played > b.Played
+		}
+		return a.Name < b.Name
+	})
+	return list
+}
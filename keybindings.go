@@ -0,0 +1,539 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell/v2"
+	tviewcommand "github.com/spezifisch/tview-command"
+)
+
+// Contexts that keys are bound in. Global bindings apply everywhere except in
+// text fields and dialogs; the others where their list has the focus.
+const (
+	ContextGlobal          = "Global"
+	ContextBrowserArtists  = "BrowserArtists"
+	ContextBrowserEntities = "BrowserEntities"
+	ContextQueue           = "Queue"
+	ContextPlaylists       = "Playlists"
+	ContextPlaylistSongs   = "PlaylistSongs"
+	ContextSearch          = "Search"
+	ContextStats           = "Stats"
+	ContextAlbums          = "Albums"
+)
+
+// keyUnbound as the command removes a default binding
+const keyUnbound = "none"
+
+// keybindingsFileName is looked for next to the config file
+const keybindingsFileName = "keybindings.toml"
+
+// keyCommand is a command that keys can be bound to
+type keyCommand struct {
+	name string
+	help string
+	// the default bindings
+	keys []string
+}
+
+// keyContext is a context and the commands that can be bound in it
+type keyContext struct {
+	name string
+	// the section title in the help
+	title    string
+	commands []keyCommand
+}
+
+// keyContexts lists all commands, in the order the help shows them
+var keyContexts = []keyContext{
+	{ContextGlobal, "Global", []keyCommand{
+		{"togglePause", "play/pause", []string{"p"}},
+		{"stop", "stop", []string{"P"}},
+		{"nextTrack", "next song", []string{">"}},
+		{"volumeDown", "volume down", []string{"-"}},
+		{"volumeUp", "volume up", []string{"=", "+"}},
+		{"seekBackward", "seek -10 seconds", []string{","}},
+		{"seekForward", "seek +10 seconds", []string{"."}},
+		{"addRandomSongs", "add random songs to queue", []string{"r"}},
+		{"randomSongs", "add random songs of a genre or years", []string{"Alt-r"}},
+		{"toggleAutoDJ", "toggle auto-DJ, which keeps the queue filled", []string{"Ctrl-D"}},
+		{"sleepTimer", "sleep timer: 15, 30, 60, 90 min, song, album, off", []string{"Z"}},
+		{"clearQueue", "remove all songs from queue", []string{"D"}},
+		{"startScan", "start server library sCan", []string{"c"}},
+		{"showBrowser", "browser", []string{"1"}},
+		{"showQueue", "queue", []string{"2"}},
+		{"showPlaylists", "playlists", []string{"3"}},
+		{"showSearch", "search", []string{"4"}},
+		{"showLog", "log", []string{"5"}},
+		{"showStats", "stats", []string{"6"}},
+		{"showAlbums", "albums", []string{"7"}},
+		{"commandLine", "command line, e.g. :seek 1:30", []string{":"}},
+		{"help", "this help", []string{"?"}},
+		{"quit", "quit", []string{"Q"}},
+	}},
+	{ContextBrowserArtists, "Browser: artists", []keyCommand{
+		{"focusNext", "go to the songs", []string{"Right"}},
+		{"addToQueue", "add all artist songs to queue", []string{"a"}},
+		{"playNext", "play all artist songs next", []string{"e"}},
+		{"addSimilarSongs", "add similar songs to queue", []string{"S"}},
+		{"search", "search artists", []string{"/"}},
+		{"searchNext", "continue search forward", []string{"n"}},
+		{"searchPrevious", "continue search backwards", []string{"N"}},
+		{"closeSearch", "close search", []string{"Esc"}},
+		{"refresh", "refresh the list", []string{"R"}},
+		{"toggleDirectories", "switch between artists and directories", []string{"f"}},
+	}},
+	{ContextBrowserEntities, "Browser: songs", []keyCommand{
+		{"focusPrevious", "go to the artists", []string{"Left"}},
+		{"addToQueue", "add album or song to queue", []string{"a"}},
+		{"playNext", "play album or song next", []string{"e"}},
+		{"addToPlaylist", "add song to playlist", []string{"A"}},
+		{"addSimilarSongs", "add similar songs to queue", []string{"S"}},
+		{"toggleStar", "toggle star on song/album", []string{"y"}},
+		{"search", "filter albums/songs by name or year", []string{"/"}},
+		{"searchNext", "go to the next filter match", []string{"n"}},
+		{"searchPrevious", "go to the previous filter match", []string{"N"}},
+		{"closeSearch", "show all albums/songs again", []string{"Esc"}},
+		{"sortAlbums", "sort albums by name, year, newest", []string{"o"}},
+		{"refresh", "refresh the list", []string{"R"}},
+		{"toggleDirectories", "switch between artists and directories", []string{"f"}},
+	}},
+	{ContextQueue, "Queue", []keyCommand{
+		{"playSelected", "play song under cursor", []string{"Enter"}},
+		{"deleteSelectedTrack", "remove selected songs", []string{"d", "Delete"}},
+		{"toggleStar", "toggle star on selected songs", []string{"y"}},
+		{"toggleInfo", "toggle song info panel", []string{"i"}},
+		{"moveUp", "move selected songs up", []string{"k"}},
+		{"moveDown", "move selected songs down", []string{"j"}},
+		{"toggleMark", "mark/unmark song", []string{"Space"}},
+		{"toggleVisual", "start/end selecting a range", []string{"v"}},
+		{"clearMarks", "unmark all songs", []string{"Esc"}},
+		{"playNext", "move selected songs to play next", []string{"n"}},
+		{"toggleStopAfter", "stop/don't stop after selected songs", []string{"z"}},
+		{"addToPlaylist", "add selected songs to playlist", []string{"A"}},
+		{"undo", "undo the last edit of the queue", []string{"u"}},
+		{"redo", "redo the last undone edit", []string{"Ctrl-R"}},
+		{"savePlaylist", "save queue as a playlist", []string{"s"}},
+		{"shuffle", "shuffle the queue", []string{"S"}},
+		{"loadQueue", "load last queue from server", []string{"l"}},
+	}},
+	{ContextPlaylists, "Playlists", []keyCommand{
+		{"focusNext", "go to the songs", []string{"Right"}},
+		{"addToQueue", "add playlist to queue", []string{"a"}},
+		{"playNext", "play playlist next", []string{"e"}},
+		{"newPlaylist", "new playlist", []string{"n"}},
+		{"deletePlaylist", "delete playlist", []string{"d"}},
+		{"refresh", "refresh playlists", []string{"R"}},
+	}},
+	{ContextPlaylistSongs, "Playlist songs", []keyCommand{
+		{"focusPrevious", "go to the playlists", []string{"Left"}},
+		{"addToQueue", "add song to queue", []string{"a"}},
+		{"playNext", "play song next", []string{"e"}},
+	}},
+	{ContextSearch, "Search", []keyCommand{
+		{"focusPrevious", "previous column", []string{"Left"}},
+		{"focusNext", "next column", []string{"Right"}},
+		{"select", "add item to queue; on a genre, show its songs", []string{"Enter"}},
+		{"addToQueue", "add item to queue and go to the next", []string{"a"}},
+		{"playNext", "play item next and go to the next", []string{"e"}},
+		{"toggleGenres", "toggle genre search", []string{"g"}},
+		{"search", "start search", []string{"/"}},
+	}},
+	{ContextStats, "Stats", []keyCommand{
+		{"week", "this week", []string{"w"}},
+		{"month", "this month", []string{"m"}},
+		{"year", "this year", []string{"y"}},
+		{"allTime", "all time", []string{"A"}},
+		{"previousPeriod", "previous period", []string{"["}},
+		{"nextPeriod", "next period", []string{"]"}},
+		{"focusNext", "next list", []string{"Tab", "Right"}},
+		{"focusPrevious", "previous list", []string{"Backtab", "Left"}},
+		{"addToQueue", "add artist, album, or song to queue", []string{"Enter", "a"}},
+		{"refresh", "reload the history", []string{"R"}},
+	}},
+	{ContextAlbums, "Albums", []keyCommand{
+		{"addToQueue", "add album to queue", []string{"Enter", "a"}},
+		{"playNext", "play album next", []string{"e"}},
+		{"nextList", "show newest, recent, most played, random, ... albums", []string{"o"}},
+		{"refresh", "reload the albums", []string{"R"}},
+	}},
+}
+
+func findKeyContext(name string) *keyContext {
+	for i := range keyContexts {
+		if keyContexts[i].name == name {
+			return &keyContexts[i]
+		}
+	}
+	return nil
+}
+
+func (c *keyContext) findCommand(name string) *keyCommand {
+	for i := range c.commands {
+		if c.commands[i].name == name {
+			return &c.commands[i]
+		}
+	}
+	return nil
+}
+
+// specialKeys maps the lower-case names of keys that aren't characters to
+// their canonical name, which is tcell's
+var specialKeys = func() map[string]string {
+	keys := map[string]string{"space": "Space"}
+	for _, name := range tcell.KeyNames {
+		keys[strings.ToLower(name)] = name
+	}
+	return keys
+}()
+
+// canonicalKey returns the name that a key is bound with, e.g. "a", "Enter",
+// "Ctrl-R", or "Alt-x", or false if it's not a valid key name. Characters
+// are case-sensitive, special key names aren't.
+func canonicalKey(name string) (string, bool) {
+	prefix := ""
+	if len(name) > 4 && strings.EqualFold(name[:4], "Alt-") {
+		prefix, name = "Alt-", name[4:]
+	}
+	if utf8.RuneCountInString(name) == 1 {
+		if name == " " {
+			return prefix + "Space", true
+		}
+		return prefix + name, true
+	}
+	if canonical, ok := specialKeys[strings.ToLower(name)]; ok {
+		return prefix + canonical, true
+	}
+	return "", false
+}
+
+// keyName returns the name of the key pressed, as canonicalKey names it
+func keyName(event *tcell.EventKey) string {
+	var name string
+	switch {
+	case event.Key() == tcell.KeyRune && event.Rune() == ' ':
+		name = "Space"
+	case event.Key() == tcell.KeyRune:
+		name = string(event.Rune())
+	default:
+		var ok bool
+		if name, ok = tcell.KeyNames[event.Key()]; !ok {
+			return ""
+		}
+	}
+	if event.Modifiers()&tcell.ModAlt != 0 {
+		name = "Alt-" + name
+	}
+	return name
+}
+
+// Keybindings maps keys to named commands, per context. The commands are
+// implemented by the UI, which registers a handler for each.
+type Keybindings struct {
+	// context -> key -> command
+	bindings map[string]map[string]string
+	// context -> command -> handler
+	handlers map[string]map[string]func()
+}
+
+// defaultKeybindings returns the default bindings of all contexts
+func defaultKeybindings() *Keybindings {
+	k := &Keybindings{
+		bindings: make(map[string]map[string]string),
+		handlers: make(map[string]map[string]func()),
+	}
+	for _, context := range keyContexts {
+		bindings := make(map[string]string)
+		for _, command := range context.commands {
+			for _, key := range command.keys {
+				bindings[key] = command.name
+			}
+		}
+		k.bindings[context.name] = bindings
+	}
+	return k
+}
+
+// keybindingsFile returns where the user's keybindings are: next to the
+// config file
+func keybindingsFile() string {
+	dir := configDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, keybindingsFileName)
+}
+
+// loadKeybindings applies the user's keybindings in path, if it exists, to
+// the defaults. The file has a table per context:
+//
+//	[Queue.bindings]
+//	x = "deleteSelectedTrack"
+//	d = "none"
+func loadKeybindings(path string) (*Keybindings, error) {
+	if path == "" {
+		return defaultKeybindings(), nil
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return defaultKeybindings(), nil
+	}
+	config, err := tviewcommand.LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return newKeybindings(*config)
+}
+
+// newKeybindings applies user bindings to the defaults. It returns all
+// problems at once: unknown contexts and commands, invalid key names, and
+// keys that are bound twice, so that one binding could never be used.
+func newKeybindings(config tviewcommand.Config) (*Keybindings, error) {
+	k := defaultKeybindings()
+	var problems []error
+	// context -> the keys the user bound
+	userKeys := make(map[string]map[string]bool)
+
+	contextNames := make([]string, 0, len(config))
+	for name := range config {
+		contextNames = append(contextNames, name)
+	}
+	sort.Strings(contextNames)
+
+	for _, contextName := range contextNames {
+		context := findKeyContext(contextName)
+		if context == nil {
+			problems = append(problems, fmt.Errorf("unknown context %q", contextName))
+			continue
+		}
+
+		keys := make([]string, 0, len(config[contextName].Bindings))
+		for key := range config[contextName].Bindings {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		// which user key a canonical key came from, to find keys that are
+		// the same when written differently
+		seen := make(map[string]string)
+		for _, key := range keys {
+			command := config[contextName].Bindings[key]
+			canonical, ok := canonicalKey(key)
+			if !ok {
+				problems = append(problems, fmt.Errorf("%s: invalid key %q", contextName, key))
+				continue
+			}
+			if other, ok := seen[canonical]; ok {
+				problems = append(problems, fmt.Errorf("%s: %q and %q are the same key", contextName, other, key))
+				continue
+			}
+			seen[canonical] = key
+			if userKeys[contextName] == nil {
+				userKeys[contextName] = make(map[string]bool)
+			}
+			userKeys[contextName][canonical] = true
+
+			if command == keyUnbound {
+				delete(k.bindings[contextName], canonical)
+				continue
+			}
+			if context.findCommand(command) == nil {
+				problems = append(problems, fmt.Errorf("%s: unknown command %q for key %q", contextName, command, key))
+				continue
+			}
+			k.bindings[contextName][canonical] = command
+		}
+	}
+
+	// global keys are handled first, so the same key in a page would never
+	// get there. A default binding of the page just gives way to the user's
+	// global one.
+	for _, context := range keyContexts {
+		if context.name == ContextGlobal {
+			continue
+		}
+		for _, key := range sortedKeys(k.bindings[context.name]) {
+			if global, ok := k.bindings[ContextGlobal][key]; ok {
+				if !userKeys[context.name][key] {
+					delete(k.bindings[context.name], key)
+					continue
+				}
+				problems = append(problems, fmt.Errorf("%s: %q is bound to %s, but Global binds it to %s; unbind one of them with %q",
+					context.name, key, k.bindings[context.name][key], global, keyUnbound))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, errors.Join(problems...)
+	}
+	return k, nil
+}
+
+// bindRandomPresets binds the keys of the random presets in the Global
+// context, to their randomPresetCommand. Like a user's global binding, a key
+// takes the place of a page's default binding, but it's a problem if the key
+// is already bound globally, or by the user in a page.
+func (k *Keybindings) bindRandomPresets(presets []randomPreset) error {
+	defaults := defaultKeybindings()
+	var problems []error
+	for _, preset := range presets {
+		if preset.Key == "" {
+			continue
+		}
+		key, ok := canonicalKey(preset.Key)
+		if !ok {
+			problems = append(problems, fmt.Errorf("random preset %q: invalid key %q", preset.Name, preset.Key))
+			continue
+		}
+		if command, ok := k.bindings[ContextGlobal][key]; ok {
+			problems = append(problems, fmt.Errorf("random preset %q: %q is bound to %s in Global", preset.Name, key, command))
+			continue
+		}
+		for _, context := range keyContexts {
+			command, ok := k.bindings[context.name][key]
+			if !ok || context.name == ContextGlobal {
+				continue
+			}
+			if defaults.bindings[context.name][key] != command {
+				problems = append(problems, fmt.Errorf("random preset %q: %q is bound to %s in %s; unbind it with %q",
+					preset.Name, key, command, context.name, keyUnbound))
+				continue
+			}
+			delete(k.bindings[context.name], key)
+		}
+		k.bindings[ContextGlobal][key] = randomPresetCommand(preset.Name)
+	}
+	return errors.Join(problems...)
+}
+
+func sortedKeys(bindings map[string]string) []string {
+	keys := make([]string, 0, len(bindings))
+	for key := range bindings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Handle sets the function that runs a command in a context
+func (k *Keybindings) Handle(context, command string, handler func()) {
+	if k.handlers[context] == nil {
+		k.handlers[context] = make(map[string]func())
+	}
+	k.handlers[context][command] = handler
+}
+
+// Dispatch runs the command that the key is bound to in the context, and
+// returns whether there was one
+func (k *Keybindings) Dispatch(context string, event *tcell.EventKey) bool {
+	command, ok := k.bindings[context][keyName(event)]
+	if !ok {
+		return false
+	}
+	handler, ok := k.handlers[context][command]
+	if !ok {
+		return false
+	}
+	handler()
+	return true
+}
+
+// Run runs a command of the context by name, whether or not a key is bound to
+// it, and returns whether it has a handler
+func (k *Keybindings) Run(context, command string) bool {
+	handler, ok := k.handlers[context][command]
+	if !ok {
+		return false
+	}
+	handler()
+	return true
+}
+
+// Commands returns the commands of a context that can be run, in the order
+// of the help
+func (k *Keybindings) Commands(contextName string) []keyCommand {
+	context := findKeyContext(contextName)
+	if context == nil {
+		return nil
+	}
+	var commands []keyCommand
+	for _, command := range context.commands {
+		if _, ok := k.handlers[contextName][command.name]; ok {
+			commands = append(commands, command)
+		}
+	}
+	return commands
+}
+
+// Capture returns an input capture function that runs the commands bound in
+// the context, and passes on all other keys
+func (k *Keybindings) Capture(context string) func(event *tcell.EventKey) *tcell.EventKey {
+	return func(event *tcell.EventKey) *tcell.EventKey {
+		if k.Dispatch(context, event) {
+			return nil
+		}
+		return event
+	}
+}
+
+// Keys returns the keys bound to a command: the default ones first, in
+// order, then the others
+func (k *Keybindings) Keys(contextName, command string) []string {
+	var keys []string
+	bound := func(key string) bool {
+		for _, have := range keys {
+			if have == key {
+				return true
+			}
+		}
+		return false
+	}
+	if context := findKeyContext(contextName); context != nil {
+		if c := context.findCommand(command); c != nil {
+			for _, key := range c.keys {
+				if k.bindings[contextName][key] == command {
+					keys = append(keys, key)
+				}
+			}
+		}
+	}
+	for _, key := range sortedKeys(k.bindings[contextName]) {
+		if k.bindings[contextName][key] == command && !bound(key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Key returns the first key bound to a command, or "" if there's none
+func (k *Keybindings) Key(context, command string) string {
+	if keys := k.Keys(context, command); len(keys) > 0 {
+		return keys[0]
+	}
+	return ""
+}
+
+// HelpText lists the bound commands of a context, with their keys
+func (k *Keybindings) HelpText(contextName string) string {
+	context := findKeyContext(contextName)
+	if context == nil {
+		return ""
+	}
+	var lines []string
+	for _, command := range context.commands {
+		keys := k.Keys(contextName, command.name)
+		if len(keys) == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%-7s %s", strings.Join(keys, "/"), command.help))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	tviewcommand "github.com/spezifisch/tview-command"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultKeybindingsDontConflict(t *testing.T) {
+	k, err := newKeybindings(tviewcommand.Config{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"=", "+"}, k.Keys(ContextGlobal, "volumeUp"))
+	assert.Equal(t, []string{"d", "Delete"}, k.Keys(ContextQueue, "deleteSelectedTrack"))
+}
+
+func TestUserKeybindings(t *testing.T) {
+	k, err := newKeybindings(tviewcommand.Config{
+		ContextQueue: {Bindings: map[string]string{
+			"x":      "deleteSelectedTrack",
+			"delete": "none",
+			"J":      "moveDown",
+		}},
+		ContextGlobal: {Bindings: map[string]string{
+			"ctrl-n": "nextTrack",
+			"space":  "togglePause",
+		}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"d", "x"}, k.Keys(ContextQueue, "deleteSelectedTrack"))
+	assert.Equal(t, []string{"j", "J"}, k.Keys(ContextQueue, "moveDown"))
+	assert.Equal(t, []string{">", "Ctrl-N"}, k.Keys(ContextGlobal, "nextTrack"))
+
+	var ran []string
+	k.Handle(ContextQueue, "deleteSelectedTrack", func() { ran = append(ran, "delete") })
+	k.Handle(ContextGlobal, "togglePause", func() { ran = append(ran, "pause") })
+	k.Handle(ContextGlobal, "nextTrack", func() { ran = append(ran, "next") })
+
+	capture := k.Capture(ContextQueue)
+	assert.Nil(t, capture(tcell.NewEventKey(tcell.KeyRune, 'x', tcell.ModNone)))
+	assert.NotNil(t, capture(tcell.NewEventKey(tcell.KeyDelete, 0, tcell.ModNone)), "unbound")
+	// bound, but no handler
+	assert.NotNil(t, capture(tcell.NewEventKey(tcell.KeyRune, 'j', tcell.ModNone)))
+	assert.True(t, k.Dispatch(ContextGlobal, tcell.NewEventKey(tcell.KeyRune, ' ', tcell.ModNone)))
+	assert.True(t, k.Dispatch(ContextGlobal, tcell.NewEventKey(tcell.KeyCtrlN, 0, tcell.ModCtrl)))
+	assert.Equal(t, []string{"delete", "pause", "next"}, ran)
+
+	assert.Contains(t, k.HelpText(ContextQueue), "d/x     remove selected song")
+	// the default binding of Space in the queue gives way
+	assert.Empty(t, k.Keys(ContextQueue, "toggleMark"))
+}
+
+func TestKeybindingProblems(t *testing.T) {
+	_, err := newKeybindings(tviewcommand.Config{
+		"Nowhere": {Bindings: map[string]string{"a": "addToQueue"}},
+		ContextQueue: {Bindings: map[string]string{
+			"Hyper-Q": "shuffle",
+			"z":       "fly",
+			// already bound globally
+			"p": "shuffle",
+		}},
+		ContextStats: {Bindings: map[string]string{
+			"enter": "refresh",
+			"Enter": "refresh",
+		}},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown context "Nowhere"`)
+	assert.Contains(t, err.Error(), `Queue: invalid key "Hyper-Q"`)
+	assert.Contains(t, err.Error(), `Queue: unknown command "fly"`)
+	assert.Contains(t, err.Error(), `Queue: "p" is bound to shuffle, but Global binds it to togglePause`)
+	assert.Contains(t, err.Error(), `Stats: "Enter" and "enter" are the same key`)
+}
+
+func TestLoadKeybindings(t *testing.T) {
+	dir := t.TempDir()
+
+	// no file is the defaults
+	k, err := loadKeybindings(filepath.Join(dir, "keybindings.toml"))
+	require.NoError(t, err)
+	assert.Equal(t, "p", k.Key(ContextGlobal, "togglePause"))
+
+	path := filepath.Join(dir, "keybindings.toml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+[Global.bindings]
+p = "none"
+"Space" = "togglePause"
+`), 0600))
+	k, err = loadKeybindings(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Space"}, k.Keys(ContextGlobal, "togglePause"))
+}
+
+func TestCanonicalKey(t *testing.T) {
+	for name, want := range map[string]string{
+		"a": "a", "A": "A", "+": "+", " ": "Space", "SPACE": "Space",
+		"enter": "Enter", "pgdn": "PgDn", "ctrl-r": "Ctrl-R", "alt-x": "Alt-x", "Alt-Left": "Alt-Left",
+	} {
+		got, ok := canonicalKey(name)
+		assert.True(t, ok, name)
+		assert.Equal(t, want, got, name)
+	}
+	for _, name := range []string{"", "ab", "Alt-", "Hyper-a"} {
+		_, ok := canonicalKey(name)
+		assert.False(t, ok, name)
+	}
+
+	assert.Equal(t, "Alt-x", keyName(tcell.NewEventKey(tcell.KeyRune, 'x', tcell.ModAlt)))
+	assert.Equal(t, "Enter", keyName(tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone)))
+}
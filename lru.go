@@ -33,28 +33,35 @@ func NewLRU(size int) LRU {
 // Updates access for an item, and returns any item that
 // gets pushed off the end of the LRU
 func (l *LRU) Touch(key string) string {
-	if n, ok := l.lookup[key]; !ok {
-		newNode := &node{value: key, next: l.head}
-		if l.head != nil {
-			l.head.prev = newNode
-		}
-		l.head = newNode
+	n, ok := l.lookup[key]
+	if !ok {
+		n = &node{value: key}
+		l.lookup[key] = n
+	} else if n == l.head {
+		return ""
 	} else {
-		if n.prev != nil {
-			n.prev.next = n.next
-		}
+		// unlink it
+		n.prev.next = n.next
 		if n.next != nil {
 			n.next.prev = n.prev
+		} else {
+			l.tail = n.prev
 		}
-		l.head.prev = n
-		n.next = l.head
 		n.prev = nil
-		l.head = n
 	}
+	n.next = l.head
+	if l.head != nil {
+		l.head.prev = n
+	}
+	l.head = n
+	if l.tail == nil {
+		l.tail = n
+	}
+
 	if len(l.lookup) > l.size {
 		remove := l.tail
-		l.tail.prev.next = nil
-		l.tail = l.tail.prev
+		l.tail = remove.prev
+		l.tail.next = nil
 		delete(l.lookup, remove.value)
 		return remove.value
 	}
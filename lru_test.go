@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU(t *testing.T) {
+	lru := NewLRU(2)
+	assert.Equal(t, "", lru.Touch("a"))
+	assert.Equal(t, "", lru.Touch("b"))
+	assert.Equal(t, "", lru.Touch("a"))
+	// b is the least recently used
+	assert.Equal(t, "b", lru.Touch("c"))
+	assert.Equal(t, "", lru.Touch("c"))
+	assert.Equal(t, "a", lru.Touch("b"))
+	assert.Len(t, lru.lookup, 2)
+
+	lru = NewLRU(1)
+	assert.Equal(t, "", lru.Touch("a"))
+	assert.Equal(t, "a", lru.Touch("b"))
+	assert.Equal(t, "b", lru.Touch("a"))
+}
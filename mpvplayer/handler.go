@@ -46,41 +46,38 @@ func (p *Player) EventLoop() {
 			}
 			p.remoteState.timePos = float64(statusData.Position)
 			p.sendGuiDataEvent(EventStatus, statusData)
-		} else if evt.Event_Id == mpv.EVENT_END_FILE && !p.replaceInProgress {
+		} else if evt.Event_Id == mpv.EVENT_END_FILE && !p.replaceInProgress.Load() {
 			// we don't want to update anything if we're in the process of replacing the current track
 
-			if p.stopped {
+			if p.stopped.Load() {
 				// this is feedback for a user-requested stop
 				// don't delete the first track so it gets started from the beginning when pressing play
 				p.logger.Print("mpv.EventLoop: mpv stopped")
-				p.stopped = true
+				p.stopped.Store(true)
 				p.sendGuiEvent(EventStopped)
 			} else {
 				// advance queue and play next track
-				if len(p.queue) > 0 {
-					p.queue = p.queue[1:]
-				}
-
-				if len(p.queue) > 0 {
-					if err := p.instance.Command([]string{"loadfile", p.queue[0].Uri}); err != nil {
+				if next, stopAfter := p.advanceQueue(); stopAfter {
+					// the next song is played when playing again
+					p.logger.Print("mpv.EventLoop: stopping (stop after)")
+					p.stopped.Store(true)
+					p.sendGuiEvent(EventStopped)
+				} else if next != nil {
+					if err := p.instance.Command([]string{"loadfile", next.Uri}); err != nil {
 						p.logger.PrintError("mpv.EventLoop: load next", err)
 					}
 				} else {
 					// no remaining tracks
 					p.logger.Print("mpv.EventLoop: stopping (auto)")
-					p.stopped = true
+					p.stopped.Store(true)
 					p.sendGuiEvent(EventStopped)
 				}
 			}
 		} else if evt.Event_Id == mpv.EVENT_START_FILE {
-			p.replaceInProgress = false
-			p.stopped = false
-
-			currentSong := QueueItem{}
-			if len(p.queue) > 0 {
-				currentSong = p.queue[0]
-			}
+			p.replaceInProgress.Store(false)
+			p.stopped.Store(false)
 
+			currentSong, _ := p.currentSong()
 			if paused, err := p.IsPaused(); err != nil {
 				p.logger.PrintError("mpv.EventLoop: IsPaused", err)
 			} else if !paused {
@@ -97,9 +94,27 @@ func (p *Player) EventLoop() {
 	}
 }
 
+// advanceQueue drops the song that has ended from the top of the queue. It
+// returns the song to play next, if any, and whether the ended song was
+// marked to stop after it.
+func (p *Player) advanceQueue() (next *QueueItem, stopAfter bool) {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+	if len(p.queue) > 0 {
+		stopAfter = p.queue[0].StopAfter
+		p.history.advance(p.queue[0])
+		p.queue = p.queue[1:]
+	}
+	if len(p.queue) > 0 {
+		song := p.queue[0]
+		next = &song
+	}
+	return
+}
+
 func (p *Player) sendGuiEvent(typ UiEventType) {
-	if p.eventConsumer != nil {
-		p.eventConsumer.SendEvent(UiEvent{
+	for _, consumer := range p.eventConsumers {
+		consumer.SendEvent(UiEvent{
 			Type: typ,
 			Data: nil,
 		})
@@ -109,8 +124,8 @@ func (p *Player) sendGuiEvent(typ UiEventType) {
 }
 
 func (p *Player) sendGuiDataEvent(typ UiEventType, data interface{}) {
-	if p.eventConsumer != nil {
-		p.eventConsumer.SendEvent(UiEvent{
+	for _, consumer := range p.eventConsumers {
+		consumer.SendEvent(UiEvent{
 			Type: typ,
 			Data: data,
 		})
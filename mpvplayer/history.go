@@ -0,0 +1,83 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package mpvplayer
+
+import (
+	"errors"
+)
+
+var (
+	ErrNothingToUndo = errors.New("nothing to undo")
+	ErrNothingToRedo = errors.New("nothing to redo")
+)
+
+// how many queue edits can be undone
+const maxQueueHistory = 100
+
+// queueHistory keeps the queue from before each edit, to undo it, and from
+// before each undo, to redo it
+type queueHistory struct {
+	undo []PlayerQueue
+	redo []PlayerQueue
+}
+
+func newQueueHistory() *queueHistory {
+	return &queueHistory{}
+}
+
+// record saves the queue before an edit. Redoing what was undone isn't
+// possible anymore afterwards.
+func (h *queueHistory) record(queue PlayerQueue) {
+	h.push(&h.undo, queue)
+	h.redo = nil
+}
+
+// undoEdit returns the queue before the last edit, and saves the current one
+// to redo it
+func (h *queueHistory) undoEdit(current PlayerQueue) (PlayerQueue, error) {
+	if len(h.undo) == 0 {
+		return nil, ErrNothingToUndo
+	}
+	queue := h.pop(&h.undo)
+	h.push(&h.redo, current)
+	return queue, nil
+}
+
+// redoEdit returns the queue after the last undone edit, and saves the
+// current one to undo it again
+func (h *queueHistory) redoEdit(current PlayerQueue) (PlayerQueue, error) {
+	if len(h.redo) == 0 {
+		return nil, ErrNothingToRedo
+	}
+	queue := h.pop(&h.redo)
+	h.push(&h.undo, current)
+	return queue, nil
+}
+
+// advance drops the song that was played from the top of the saved queues,
+// so that undoing doesn't bring it back
+func (h *queueHistory) advance(played QueueItem) {
+	for _, stack := range [][]PlayerQueue{h.undo, h.redo} {
+		for i, queue := range stack {
+			if len(queue) > 0 && queue[0].Id == played.Id {
+				stack[i] = queue[1:]
+			}
+		}
+	}
+}
+
+func (h *queueHistory) push(stack *[]PlayerQueue, queue PlayerQueue) {
+	saved := make(PlayerQueue, len(queue))
+	copy(saved, queue)
+	*stack = append(*stack, saved)
+	if len(*stack) > maxQueueHistory {
+		*stack = (*stack)[1:]
+	}
+}
+
+func (h *queueHistory) pop(stack *[]PlayerQueue) PlayerQueue {
+	queue := (*stack)[len(*stack)-1]
+	*stack = (*stack)[:len(*stack)-1]
+	return queue
+}
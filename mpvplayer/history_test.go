@@ -0,0 +1,83 @@
+package mpvplayer
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestQueueHistory(t *testing.T) {
+	h := newQueueHistory()
+	queue := testQueue("a", "b")
+
+	if _, err := h.undoEdit(queue); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("undo without edits: %v", err)
+	}
+
+	// shuffle, then clear
+	h.record(queue)
+	queue = testQueue("b", "a")
+	h.record(queue)
+	queue = nil
+
+	queue, err := h.undoEdit(queue)
+	if err != nil || !slices.Equal(queueIds(queue), []string{"b", "a"}) {
+		t.Fatalf("undo clear: %v %v", queueIds(queue), err)
+	}
+	queue, err = h.undoEdit(queue)
+	if err != nil || !slices.Equal(queueIds(queue), []string{"a", "b"}) {
+		t.Fatalf("undo shuffle: %v %v", queueIds(queue), err)
+	}
+	queue, err = h.redoEdit(queue)
+	if err != nil || !slices.Equal(queueIds(queue), []string{"b", "a"}) {
+		t.Fatalf("redo shuffle: %v %v", queueIds(queue), err)
+	}
+
+	// a new edit ends redoing
+	h.record(queue)
+	if _, err := h.redoEdit(queue); !errors.Is(err, ErrNothingToRedo) {
+		t.Errorf("redo after an edit: %v", err)
+	}
+}
+
+func TestAppendToQueueIsOneEdit(t *testing.T) {
+	p := &Player{queue: testQueue("playing"), history: newQueueHistory()}
+
+	// an album, then another one, then nothing
+	p.AppendToQueue(testQueue("a1", "a2"))
+	p.AppendToQueue(testQueue("b1", "b2"))
+	p.AppendToQueue(nil)
+
+	if err := p.UndoQueue(); err != nil || !slices.Equal(queueIds(p.queue), []string{"playing", "a1", "a2"}) {
+		t.Errorf("undo the second album: %v %v", queueIds(p.queue), err)
+	}
+	if err := p.UndoQueue(); err != nil || !slices.Equal(queueIds(p.queue), []string{"playing"}) {
+		t.Errorf("undo the first album: %v %v", queueIds(p.queue), err)
+	}
+}
+
+func TestQueueHistoryAdvance(t *testing.T) {
+	h := newQueueHistory()
+	queue := testQueue("a", "b", "c")
+	h.record(queue)
+	queue = testQueue("a", "b")
+
+	// a finished playing
+	h.advance(queue[0])
+	queue = queue[1:]
+
+	queue, _ = h.undoEdit(queue)
+	if !slices.Equal(queueIds(queue), []string{"b", "c"}) {
+		t.Errorf("undo after playing a song: %v", queueIds(queue))
+	}
+}
+
+func TestQueueHistoryLimit(t *testing.T) {
+	h := newQueueHistory()
+	for i := 0; i < maxQueueHistory+10; i++ {
+		h.record(nil)
+	}
+	if len(h.undo) != maxQueueHistory {
+		t.Errorf("%d edits kept", len(h.undo))
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"errors"
 	"math/rand"
 	"strconv"
+	"sync"
+	"sync/atomic"
 
 	"github.com/spezifisch/stmps/logger"
 	"github.com/spezifisch/stmps/remote"
@@ -16,14 +18,22 @@ import (
 type PlayerQueue []QueueItem
 
 type Player struct {
-	instance      *mpv.Mpv
-	mpvEvents     chan *mpv.Event
-	eventConsumer EventConsumer
-	queue         PlayerQueue
-	logger        logger.LoggerInterface
-
-	replaceInProgress bool
-	stopped           bool
+	instance       *mpv.Mpv
+	mpvEvents      chan *mpv.Event
+	eventConsumers []EventConsumer
+	logger         logger.LoggerInterface
+
+	// queueLock guards queue and history, which the UI, the event loop and
+	// remote control change concurrently. Events aren't sent while it's held,
+	// since their consumers read the queue.
+	queueLock sync.Mutex
+	queue     PlayerQueue
+	history   *queueHistory
+
+	// replaceInProgress and stopped are set by the UI and remote control,
+	// and read by the event loop
+	replaceInProgress atomic.Bool
+	stopped           atomic.Bool
 
 	// player state
 	remoteState struct {
@@ -65,14 +75,14 @@ func NewPlayer(logger logger.LoggerInterface) (player *Player, err error) {
 	}
 
 	player = &Player{
-		instance:          m,
-		mpvEvents:         make(chan *mpv.Event),
-		eventConsumer:     nil, // must be set by calling RegisterEventConsumer()
-		queue:             make([]QueueItem, 0),
-		logger:            logger,
-		replaceInProgress: false,
-		stopped:           true,
+		instance:       m,
+		mpvEvents:      make(chan *mpv.Event),
+		eventConsumers: nil, // added by calling RegisterEventConsumer()
+		queue:          make([]QueueItem, 0),
+		history:        newQueueHistory(),
+		logger:         logger,
 	}
+	player.stopped.Store(true)
 
 	go player.mpvEngineEventHandler(m)
 	return
@@ -90,11 +100,24 @@ func (p *Player) Quit() {
 	p.instance.TerminateDestroy()
 }
 
+// RegisterEventConsumer adds a consumer that receives all player events. The
+// UI is one consumer; remote control interfaces can be others.
 func (p *Player) RegisterEventConsumer(consumer EventConsumer) {
-	p.eventConsumer = consumer
+	p.eventConsumers = append(p.eventConsumers, consumer)
 }
 
+// PlayNextTrack skips to the next song in the queue
 func (p *Player) PlayNextTrack() error {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+	if len(p.queue) > 0 {
+		p.history.advance(p.queue[0])
+	}
+	return p.playNextTrack()
+}
+
+// playNextTrack is PlayNextTrack with queueLock held
+func (p *Player) playNextTrack() error {
 	if len(p.queue) >= 1 {
 		// advance queue if any tracks left
 		p.queue = p.queue[1:]
@@ -104,7 +127,7 @@ func (p *Player) PlayNextTrack() error {
 			if loaded, err := p.IsSongLoaded(); err != nil {
 				p.logger.PrintError("PlayNextTrack", err)
 			} else if loaded {
-				p.replaceInProgress = true
+				p.replaceInProgress.Store(true)
 				if err := p.temporaryStop(); err != nil {
 					p.logger.PrintError("temporaryStop", err)
 				}
@@ -126,6 +149,8 @@ func (p *Player) PlayNextTrack() error {
 }
 
 func (p *Player) PlayUri(uri, coverArtId string, song remote.TrackInterface) error {
+	p.queueLock.Lock()
+	p.history.record(p.queue)
 	p.queue = []QueueItem{{
 		Id:          song.GetId(),
 		Uri:         uri,
@@ -138,7 +163,9 @@ func (p *Player) PlayUri(uri, coverArtId string, song remote.TrackInterface) err
 		DiscNumber:  song.GetDiscNumber(),
 		Genre:       song.GetGenre(),
 	}}
-	p.replaceInProgress = true
+	p.queueLock.Unlock()
+
+	p.replaceInProgress.Store(true)
 	if ip, e := p.IsPaused(); ip && e == nil {
 		if err := p.Pause(); err != nil {
 			p.logger.PrintError("Pause", err)
@@ -147,9 +174,50 @@ func (p *Player) PlayUri(uri, coverArtId string, song remote.TrackInterface) err
 	return p.instance.Command([]string{"loadfile", uri})
 }
 
+// Load replaces the queue, e.g. with one saved before a restart, and loads
+// its top song, paused or playing. Unlike the other queue edits, this can't
+// be undone.
+func (p *Player) Load(queue PlayerQueue, paused bool) error {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+	return p.load(queue, paused)
+}
+
+// load is Load with queueLock held
+func (p *Player) load(queue PlayerQueue, paused bool) error {
+	p.queue = queue
+	if len(p.queue) == 0 {
+		return nil
+	}
+	if err := p.instance.SetProperty("pause", mpv.FORMAT_FLAG, paused); err != nil {
+		return err
+	}
+	p.replaceInProgress.Store(true)
+	p.stopped.Store(false)
+	return p.instance.Command([]string{"loadfile", p.queue[0].Uri})
+}
+
+// PlayQueueItem skips to the song at index, which moves to the top of the
+// queue and plays. The songs that were before it stay queued right after it;
+// the one that was playing is dropped, as when skipping it.
+func (p *Player) PlayQueueItem(index int) error {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+	if err := p.queue.checkIndexes(index); err != nil {
+		return err
+	}
+	queue := p.queue
+	if index > 0 {
+		p.history.advance(p.queue[0])
+		p.history.record(p.queue[1:])
+		queue = p.queue[1:].withMoved([]int{index - 1}, 0)
+	}
+	return p.load(queue, false)
+}
+
 func (p *Player) Stop() error {
 	p.logger.Printf("stopping (user)")
-	p.stopped = true
+	p.stopped.Store(true)
 	return p.instance.Command([]string{"stop"})
 }
 
@@ -200,7 +268,7 @@ func (p *Player) Pause() (err error) {
 		return
 	}
 
-	if loaded && !p.stopped {
+	if loaded && !p.stopped.Load() {
 		// toggle pause if not stopped
 		err = p.instance.Command([]string{"cycle", "pause"})
 		if err != nil {
@@ -209,27 +277,22 @@ func (p *Player) Pause() (err error) {
 		}
 		paused = !paused
 
-		currentSong := QueueItem{}
-		if len(p.queue) > 0 {
-			currentSong = p.queue[0]
-		}
-
+		currentSong, _ := p.currentSong()
 		if paused {
 			p.sendGuiDataEvent(EventPaused, currentSong)
 		} else {
 			p.sendGuiDataEvent(EventUnpaused, currentSong)
 		}
 	} else {
-		if len(p.queue) > 0 {
-			currentSong := p.queue[0]
+		if currentSong, ok := p.currentSong(); ok {
 			err = p.instance.Command([]string{"loadfile", currentSong.Uri})
 			if err != nil {
 				p.logger.PrintError("loadfile", err)
 				return
 			}
 
-			if p.stopped {
-				p.stopped = false
+			if p.stopped.Load() {
+				p.stopped.Store(false)
 				if err = p.instance.SetProperty("pause", mpv.FORMAT_FLAG, false); err != nil {
 					p.logger.PrintError("setprop pause", err)
 				}
@@ -240,7 +303,7 @@ func (p *Player) Pause() (err error) {
 				p.sendGuiDataEvent(EventUnpaused, currentSong)
 			}
 		} else {
-			p.stopped = true
+			p.stopped.Store(true)
 			p.sendGuiEvent(EventStopped)
 		}
 	}
@@ -273,35 +336,134 @@ func (p *Player) Seek(increment int) error {
 
 // accessed from gui context
 func (p *Player) ClearQueue() {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+	p.history.record(p.queue)
+	p.clearQueue()
+}
+
+// clearQueue stops and empties the queue, with queueLock held
+func (p *Player) clearQueue() {
 	if err := p.Stop(); err != nil {
 		p.logger.PrintError("Stop", err)
 	}
-	// TODO (D) make p.queue access thread-safe mutex queue access
 	p.queue = make([]QueueItem, 0)
 }
 
 func (p *Player) DeleteQueueItem(index int) {
-	// TODO (D) make p.queue access thread-safe mutex queue access
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
 	if index >= len(p.queue) {
 		p.logger.Printf("DeleteQueueItem bad index %d (len %d)", index, len(p.queue))
-	} else if len(p.queue) > 1 {
+		return
+	}
+	p.history.record(p.queue)
+	if len(p.queue) > 1 {
 		if index == 0 {
-			if err := p.PlayNextTrack(); err != nil {
+			if err := p.playNextTrack(); err != nil {
 				p.logger.PrintError("PlayNextTrack", err)
 			}
 		} else {
 			p.queue = append(p.queue[:index], p.queue[index+1:]...)
 		}
 	} else {
-		p.ClearQueue()
+		p.clearQueue()
 	}
 }
 
-func (p *Player) AddToQueue(item *QueueItem) {
-	p.queue = append(p.queue, *item)
+// DeleteQueueItems removes the songs at the indexes from the queue at once.
+// If the playing song is one of them, the next song that's left is played.
+func (p *Player) DeleteQueueItems(indexes []int) error {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+	if err := p.queue.checkIndexes(indexes...); err != nil {
+		return err
+	}
+	indexes = p.queue.validIndexes(indexes)
+	if len(indexes) == 0 {
+		return nil
+	}
+	p.history.record(p.queue)
+	if len(indexes) == len(p.queue) {
+		p.clearQueue()
+		return nil
+	}
+	if indexes[0] != 0 {
+		p.queue = p.queue.without(indexes)
+		return nil
+	}
+
+	// keep the playing song at the top for PlayNextTrack to skip
+	p.queue = p.queue.without(indexes[1:])
+	if err := p.playNextTrack(); err != nil {
+		p.logger.PrintError("PlayNextTrack", err)
+	}
+	return nil
+}
+
+// MoveQueueItems moves the songs at the indexes as a block, in their order,
+// so that the first of them ends up at index to. Moving songs to or from the
+// top of the queue stops playback, since the top song is the one playing.
+func (p *Player) MoveQueueItems(indexes []int, to int) error {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+	if err := p.queue.checkIndexes(to); err != nil {
+		return err
+	}
+	if err := p.queue.checkIndexes(indexes...); err != nil {
+		return err
+	}
+	indexes = p.queue.validIndexes(indexes)
+	if len(indexes) == 0 {
+		return nil
+	}
+	if (indexes[0] == 0) != (to == 0) {
+		// An error here won't affect re-arranging the queue.
+		_ = p.Stop()
+	}
+	p.history.record(p.queue)
+	p.queue = p.queue.withMoved(indexes, to)
+	return nil
+}
+
+// InsertIntoQueue inserts songs into the queue at index, e.g. at 1 to play
+// them next, or appends them if index is out of range
+func (p *Player) InsertIntoQueue(items []QueueItem, index int) {
+	if len(items) == 0 {
+		return
+	}
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+	p.history.record(p.queue)
+	p.queue = p.queue.withInserted(items, index)
+}
+
+// SetStopAfter marks the song at index to stop playback when it has ended,
+// or removes the mark
+func (p *Player) SetStopAfter(index int, stop bool) error {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+	if err := p.queue.checkIndexes(index); err != nil {
+		return err
+	}
+	p.queue[index].StopAfter = stop
+	return nil
+}
+
+// AppendToQueue adds songs to the end of the queue, as one edit
+func (p *Player) AppendToQueue(items []QueueItem) {
+	if len(items) == 0 {
+		return
+	}
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+	p.history.record(p.queue)
+	p.queue = append(p.queue, items...)
 }
 
 func (p *Player) MoveSongUp(index int) {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
 	if index < 1 {
 		p.logger.Printf("MoveSongUp(%d) can't move top item", index)
 		return
@@ -310,10 +472,13 @@ func (p *Player) MoveSongUp(index int) {
 		p.logger.Printf("MoveSongUp(%d) not that many songs in queue", index)
 		return
 	}
+	p.history.record(p.queue)
 	p.queue[index-1], p.queue[index] = p.queue[index], p.queue[index-1]
 }
 
 func (p *Player) MoveSongDown(index int) {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
 	if index < 0 {
 		p.logger.Printf("MoveSongUp(%d) invalid index", index)
 		return
@@ -322,10 +487,14 @@ func (p *Player) MoveSongDown(index int) {
 		p.logger.Printf("MoveSongUp(%d) can't move last song down", index)
 		return
 	}
+	p.history.record(p.queue)
 	p.queue[index], p.queue[index+1] = p.queue[index+1], p.queue[index]
 }
 
 func (p *Player) Shuffle() {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+	p.history.record(p.queue)
 	max := len(p.queue)
 	for range max / 2 {
 		ra := rand.Intn(max)
@@ -334,7 +503,45 @@ func (p *Player) Shuffle() {
 	}
 }
 
+// UndoQueue brings back the queue from before the last edit. If that changes
+// the song at the top, which is the one playing, playback stops.
+func (p *Player) UndoQueue() error {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+	queue, err := p.history.undoEdit(p.queue)
+	if err != nil {
+		return err
+	}
+	p.restoreQueue(queue)
+	return nil
+}
+
+// RedoQueue makes the last edit that was undone again
+func (p *Player) RedoQueue() error {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+	queue, err := p.history.redoEdit(p.queue)
+	if err != nil {
+		return err
+	}
+	p.restoreQueue(queue)
+	return nil
+}
+
+// restoreQueue replaces the queue when undoing or redoing, with queueLock
+// held
+func (p *Player) restoreQueue(queue PlayerQueue) {
+	if len(p.queue) > 0 && (len(queue) == 0 || queue[0].Id != p.queue[0].Id) {
+		if err := p.Stop(); err != nil {
+			p.logger.PrintError("Stop", err)
+		}
+	}
+	p.queue = queue
+}
+
 func (p *Player) GetQueueItem(index int) (QueueItem, error) {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
 	if index < 0 || index >= len(p.queue) {
 		return QueueItem{}, errors.New("invalid queue entry")
 	}
@@ -342,6 +549,8 @@ func (p *Player) GetQueueItem(index int) (QueueItem, error) {
 }
 
 func (p *Player) GetQueueCopy() PlayerQueue {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
 	cpy := make(PlayerQueue, len(p.queue))
 	copy(cpy, p.queue)
 	return cpy
@@ -357,14 +566,24 @@ func (p *Player) GetPlayingTrack() (QueueItem, error) {
 		return QueueItem{}, errors.New("not playing")
 	}
 
-	// TODO (D) make p.queue access thread-safe mutex queue access
-	if len(p.queue) == 0 {
+	currentSong, ok := p.currentSong()
+	if !ok {
 		return QueueItem{}, errors.New("queue empty")
 	}
-	currentSong := p.queue[0]
 	return currentSong, nil
 }
 
+// currentSong returns the song at the top of the queue, which is the one
+// playing, or false if the queue is empty
+func (p *Player) currentSong() (QueueItem, bool) {
+	p.queueLock.Lock()
+	defer p.queueLock.Unlock()
+	if len(p.queue) == 0 {
+		return QueueItem{}, false
+	}
+	return p.queue[0], true
+}
+
 // remote.ControlledPlayer callbacks
 func (p *Player) OnPaused(cb func()) {
 	p.cbOnPaused = append(p.cbOnPaused, cb)
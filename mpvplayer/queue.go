@@ -0,0 +1,73 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package mpvplayer
+
+import (
+	"fmt"
+	"slices"
+)
+
+// checkIndexes returns an error for the first of the indexes that isn't in
+// the queue
+func (q PlayerQueue) checkIndexes(indexes ...int) error {
+	for _, index := range indexes {
+		if index < 0 || index >= len(q) {
+			return fmt.Errorf("invalid queue index %d (queue length %d)", index, len(q))
+		}
+	}
+	return nil
+}
+
+// validIndexes returns the indexes that are in the queue, sorted and without
+// duplicates
+func (q PlayerQueue) validIndexes(indexes []int) []int {
+	valid := make([]int, 0, len(indexes))
+	for _, index := range indexes {
+		if index >= 0 && index < len(q) {
+			valid = append(valid, index)
+		}
+	}
+	slices.Sort(valid)
+	return slices.Compact(valid)
+}
+
+// without returns a copy of the queue without the songs at the indexes, which
+// must be valid
+func (q PlayerQueue) without(indexes []int) PlayerQueue {
+	rest := make(PlayerQueue, 0, len(q)-len(indexes))
+	for i, song := range q {
+		if _, found := slices.BinarySearch(indexes, i); !found {
+			rest = append(rest, song)
+		}
+	}
+	return rest
+}
+
+// withMoved returns a copy of the queue with the songs at the indexes, which
+// must be valid, moved as a block that starts at index to. The songs keep
+// their order, and the block is moved as far as it can go if to is out of
+// range.
+func (q PlayerQueue) withMoved(indexes []int, to int) PlayerQueue {
+	block := make(PlayerQueue, len(indexes))
+	for i, index := range indexes {
+		block[i] = q[index]
+	}
+	rest := q.without(indexes)
+	to = min(max(to, 0), len(rest))
+
+	moved := make(PlayerQueue, 0, len(q))
+	moved = append(moved, rest[:to]...)
+	moved = append(moved, block...)
+	return append(moved, rest[to:]...)
+}
+
+// withInserted returns a copy of the queue with the songs inserted at index
+// at, or at the end if at is out of range
+func (q PlayerQueue) withInserted(songs []QueueItem, at int) PlayerQueue {
+	at = min(max(at, 0), len(q))
+	inserted := make(PlayerQueue, 0, len(q)+len(songs))
+	inserted = append(inserted, q[:at]...)
+	inserted = append(inserted, songs...)
+	return append(inserted, q[at:]...)
+}
@@ -12,6 +12,8 @@ type QueueItem struct {
 	Uri         string
 	Title       string
 	Artist      string
+	ArtistId    string
+	AlbumId     string
 	Duration    int
 	Album       string
 	TrackNumber int
@@ -19,11 +21,31 @@ type QueueItem struct {
 	DiscNumber  int
 	Year        int
 	Genre       string
+	AlbumArtist string
+	// BitRate is in kbps
+	BitRate int
+	// Suffix is the file type, e.g. "flac"
+	Suffix    string
+	PlayCount int
+	// Rating is 1 to 5 stars, 0 if not rated
+	Rating int
+
+	// MusicBrainz IDs, if the server knows them
+	MusicBrainzId        string
+	AlbumMusicBrainzId   string
+	ArtistMusicBrainzIds []string
+
+	// StopAfter is whether playback stops when the song has ended, instead
+	// of going on with the next one
+	StopAfter bool
 }
 
 var _ remote.TrackInterface = (*QueueItem)(nil)
 
 func (q QueueItem) GetAlbumArtist() string {
+	if q.AlbumArtist != "" {
+		return q.AlbumArtist
+	}
 	return q.Artist
 }
 
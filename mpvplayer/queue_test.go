@@ -0,0 +1,119 @@
+package mpvplayer
+
+import (
+	"slices"
+	"testing"
+)
+
+func testQueue(ids ...string) PlayerQueue {
+	q := make(PlayerQueue, len(ids))
+	for i, id := range ids {
+		q[i].Id = id
+	}
+	return q
+}
+
+func queueIds(q PlayerQueue) []string {
+	ids := make([]string, len(q))
+	for i, song := range q {
+		ids[i] = song.Id
+	}
+	return ids
+}
+
+func TestValidIndexes(t *testing.T) {
+	q := testQueue("a", "b", "c")
+	if got := q.validIndexes([]int{2, -1, 0, 2, 3}); !slices.Equal(got, []int{0, 2}) {
+		t.Errorf("validIndexes = %v", got)
+	}
+	if got := q.validIndexes(nil); len(got) != 0 {
+		t.Errorf("validIndexes(nil) = %v", got)
+	}
+}
+
+func TestBulkEditsCheckIndexes(t *testing.T) {
+	p := &Player{queue: testQueue("a", "b", "c", "d"), history: newQueueHistory()}
+	if err := p.DeleteQueueItems([]int{1, 4}); err == nil {
+		t.Error("DeleteQueueItems with an index past the end didn't fail")
+	}
+	if err := p.MoveQueueItems([]int{-1}, 2); err == nil {
+		t.Error("MoveQueueItems with a negative index didn't fail")
+	}
+	if err := p.MoveQueueItems([]int{1}, 4); err == nil {
+		t.Error("MoveQueueItems to past the end didn't fail")
+	}
+	if err := p.SetStopAfter(4, true); err == nil {
+		t.Error("SetStopAfter past the end didn't fail")
+	}
+	if got := queueIds(p.queue); !slices.Equal(got, []string{"a", "b", "c", "d"}) {
+		t.Errorf("the queue was changed: %v", got)
+	}
+
+	if err := p.DeleteQueueItems([]int{3, 1, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.MoveQueueItems([]int{1}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := queueIds(p.queue); !slices.Equal(got, []string{"a", "c"}) {
+		t.Errorf("queue = %v", got)
+	}
+}
+
+func TestWithout(t *testing.T) {
+	q := testQueue("a", "b", "c", "d")
+	if got := queueIds(q.without([]int{0, 2})); !slices.Equal(got, []string{"b", "d"}) {
+		t.Errorf("without = %v", got)
+	}
+	if got := queueIds(q); !slices.Equal(got, []string{"a", "b", "c", "d"}) {
+		t.Errorf("the queue was changed: %v", got)
+	}
+}
+
+func TestWithMoved(t *testing.T) {
+	q := testQueue("a", "b", "c", "d", "e")
+	for _, test := range []struct {
+		indexes []int
+		to      int
+		want    []string
+	}{
+		// one song, like MoveSongUp and MoveSongDown
+		{[]int{2}, 1, []string{"a", "c", "b", "d", "e"}},
+		{[]int{2}, 3, []string{"a", "b", "d", "c", "e"}},
+		// a range, up and down
+		{[]int{2, 3}, 1, []string{"a", "c", "d", "b", "e"}},
+		{[]int{1, 2}, 2, []string{"a", "d", "b", "c", "e"}},
+		// songs that are apart are moved together
+		{[]int{1, 4}, 1, []string{"a", "b", "e", "c", "d"}},
+		{[]int{0, 3}, 0, []string{"a", "d", "b", "c", "e"}},
+		// as far as they go
+		{[]int{3, 4}, 10, []string{"a", "b", "c", "d", "e"}},
+		{[]int{3, 4}, -1, []string{"d", "e", "a", "b", "c"}},
+	} {
+		got := queueIds(q.withMoved(test.indexes, test.to))
+		if !slices.Equal(got, test.want) {
+			t.Errorf("withMoved(%v, %d) = %v, want %v", test.indexes, test.to, got, test.want)
+		}
+	}
+}
+
+func TestWithInserted(t *testing.T) {
+	q := testQueue("a", "b", "c")
+	songs := testQueue("x", "y")
+	for _, test := range []struct {
+		at   int
+		want []string
+	}{
+		{1, []string{"a", "x", "y", "b", "c"}},
+		{0, []string{"x", "y", "a", "b", "c"}},
+		{10, []string{"a", "b", "c", "x", "y"}},
+	} {
+		got := queueIds(q.withInserted(songs, test.at))
+		if !slices.Equal(got, test.want) {
+			t.Errorf("withInserted(%d) = %v, want %v", test.at, got, test.want)
+		}
+	}
+	if got := queueIds(PlayerQueue(nil).withInserted(songs, 1)); !slices.Equal(got, []string{"x", "y"}) {
+		t.Errorf("withInserted into an empty queue = %v", got)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"image"
+	"sync"
+	"time"
+
+	"github.com/spezifisch/stmps/logger"
+	"github.com/spezifisch/stmps/remote"
+	"github.com/spf13/viper"
+)
+
+// songNotifications shows a desktop notification whenever a song starts
+// ([notifications] in the config). Its "next" button skips the song, and its
+// "star" button stars or unstars it on the server.
+type songNotifications struct {
+	core     *Core
+	notifier *remote.Notifier
+	logger   logger.LoggerInterface
+	coverArt bool
+
+	lock sync.Mutex
+	// starred song IDs, for the label of the star button
+	starred map[string]struct{}
+	// the song that's shown; seq tells a notification that's being prepared
+	// whether a newer song came in meanwhile
+	seq   int
+	track remote.Track
+	art   image.Image
+
+	unsubscribe func()
+}
+
+// startNotifications starts desktop notifications if they're enabled;
+// otherwise, or if there is no notification server, it returns nil
+func startNotifications(core *Core, logger logger.LoggerInterface) *songNotifications {
+	if !viper.GetBool("notifications.enable") {
+		return nil
+	}
+
+	s := &songNotifications{
+		core:     core,
+		logger:   logger,
+		coverArt: viper.GetBool("notifications.cover-art"),
+		starred:  make(map[string]struct{}),
+	}
+	options := remote.NotifierOptions{
+		Timeout: time.Duration(viper.GetFloat64("notifications.timeout") * float64(time.Second)),
+		Actions: viper.GetBool("notifications.actions"),
+		Icon:    "audio-x-generic",
+	}
+	notifier, err := remote.RegisterNotifier(options, s.onAction, logger)
+	if err != nil {
+		logger.PrintError("notifications", err)
+		return nil
+	}
+	s.notifier = notifier
+
+	if options.Actions {
+		go s.loadStarred()
+	}
+	s.unsubscribe = core.Subscribe(func(e remote.Event) {
+		if e.Event == remote.EventPlaying && e.Track != nil {
+			// this is called with the core's subscriber lock held, and
+			// fetching the cover art takes a while
+			go s.songStarted(*e.Track)
+		}
+	})
+	return s
+}
+
+func (s *songNotifications) loadStarred() {
+	starred, err := s.core.connection.GetStarred()
+	if err != nil {
+		s.logger.PrintError("notifications GetStarred", err)
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, e := range starred.Songs {
+		s.starred[e.Id] = struct{}{}
+	}
+}
+
+func (s *songNotifications) songStarted(track remote.Track) {
+	s.lock.Lock()
+	s.seq++
+	seq := s.seq
+	s.lock.Unlock()
+
+	var art image.Image
+	if s.coverArt && track.CoverArtId != "" {
+		var err error
+		if art, err = s.core.CoverArt(track.CoverArtId); err != nil {
+			s.logger.PrintError("notifications cover art", err)
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if seq != s.seq {
+		// the next song started while the cover art was loading
+		return
+	}
+	s.track, s.art = track, art
+	s.show()
+}
+
+// show shows the current song. The lock must be held.
+func (s *songNotifications) show() {
+	_, starred := s.starred[s.track.Id]
+	if err := s.notifier.Notify(s.track, s.art, starred); err != nil {
+		s.logger.PrintError("notifications Notify", err)
+	}
+}
+
+func (s *songNotifications) onAction(action, songId string) {
+	switch action {
+	case remote.NotificationActionNext:
+		if err := s.core.NextTrack(); err != nil {
+			s.logger.PrintError("notifications next", err)
+		}
+
+	case remote.NotificationActionStar:
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		_, remove := s.starred[songId]
+		if _, err := s.core.connection.ToggleStar(songId, s.starred); err != nil {
+			s.logger.PrintError("notifications ToggleStar", err)
+			return
+		}
+		if remove {
+			delete(s.starred, songId)
+		} else {
+			s.starred[songId] = struct{}{}
+		}
+		// update the button's label
+		if s.track.Id == songId {
+			s.show()
+		}
+	}
+}
+
+func (s *songNotifications) Close() {
+	s.unsubscribe()
+	s.notifier.Close()
+}
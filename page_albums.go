@@ -0,0 +1,221 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"slices"
+
+	"github.com/rivo/tview"
+	"github.com/spezifisch/stmps/logger"
+	"github.com/spezifisch/stmps/subsonic"
+	"github.com/spf13/viper"
+)
+
+// albumListTypes are the album lists of the server the albums page goes
+// through, see GetAlbumList2
+var albumListTypes = []string{"newest", "recent", "frequent", "highest", "random", "alphabeticalByName", "alphabeticalByArtist", "starred"}
+
+// albumListTitles are what the title of the albums page says about the list
+var albumListTitles = map[string]string{
+	"newest":               "recently added",
+	"recent":               "recently played",
+	"frequent":             "most played",
+	"highest":              "top rated",
+	"random":               "random",
+	"alphabeticalByName":   "by name",
+	"alphabeticalByArtist": "by artist",
+	"starred":              "starred",
+}
+
+const (
+	// albumPageSize is how many albums are fetched at a time
+	albumPageSize = 100
+	// albumThumbnailSize is the size, in pixels, the server scales cover art
+	// to for the grid
+	albumThumbnailSize = 120
+)
+
+// AlbumsPage shows the albums of one of the server's album lists as a grid
+// of cover art
+type AlbumsPage struct {
+	Root *tview.Flex
+
+	grid *AlbumGrid
+
+	listType string
+	albums   []subsonic.Album
+	// loading is whether albums are being fetched, and complete whether all
+	// albums of the list are there
+	loading  bool
+	complete bool
+	// reload is whether the list was refreshed, or another one picked, while
+	// loading; it's fetched again when that's done
+	reload bool
+
+	coverArtCache Cache[image.Image]
+
+	// external refs
+	ui     *Ui
+	logger logger.LoggerInterface
+}
+
+func (ui *Ui) createAlbumsPage() *AlbumsPage {
+	albumsPage := AlbumsPage{
+		ui:     ui,
+		logger: ui.logger,
+	}
+	albumsPage.listType = albumsPage.loadListType()
+
+	albumsPage.grid = newAlbumGrid(ui.theme, " albums ",
+		func() int { return len(albumsPage.albums) },
+		func(i int) subsonic.Album { return albumsPage.albums[i] },
+		albumsPage.coverArt).
+		SetChangedFunc(func(index int) {
+			// fetch the next albums before they're reached
+			if len(albumsPage.albums)-index < albumPageSize/2 {
+				albumsPage.load(true)
+			}
+		})
+
+	albumsPage.Root = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(albumsPage.grid, 0, 1, true)
+
+	k := ui.keybindings
+	k.Handle(ContextAlbums, "addToQueue", func() {
+		albumsPage.addSelectedTo(ui.queueSongs)
+	})
+	k.Handle(ContextAlbums, "playNext", func() {
+		albumsPage.addSelectedTo(ui.queueSongsNext)
+	})
+	k.Handle(ContextAlbums, "nextList", albumsPage.nextListType)
+	k.Handle(ContextAlbums, "refresh", func() { albumsPage.load(false) })
+	albumsPage.grid.SetInputCapture(k.Capture(ContextAlbums))
+
+	coverArtLru := NewLRU(max(viper.GetInt("albums.cache-size"), 1))
+	albumsPage.coverArtCache = NewCache(
+		// zero value
+		STMPS_LOGO,
+		// function that loads assets; can be slow
+		func(id string) (image.Image, error) {
+			art, err := ui.connection.GetCoverArtSize(id, albumThumbnailSize)
+			if err != nil {
+				// keep the logo, rather than fetching it again on every draw
+				ui.logger.PrintError("AlbumsPage GetCoverArt", err)
+				return STMPS_LOGO, nil
+			}
+			return art, nil
+		},
+		// function that gets called when the actual asset is loaded
+		func(string, image.Image) {
+			ui.app.QueueUpdateDraw(func() {})
+		},
+		coverArtLru.Touch,
+		ui.logger,
+	)
+
+	return &albumsPage
+}
+
+// Show fetches the albums when the page is first shown
+func (p *AlbumsPage) Show() {
+	if p.albums == nil {
+		p.load(false)
+	}
+}
+
+// loadListType returns the album list of the config, or the newest albums if
+// it isn't valid
+func (p *AlbumsPage) loadListType() string {
+	listType := viper.GetString("albums.list")
+	if !slices.Contains(albumListTypes, listType) {
+		p.logger.Printf("error: albums.list: unknown list %q", listType)
+		return albumListTypes[0]
+	}
+	return listType
+}
+
+// nextListType shows the next of albumListTypes
+func (p *AlbumsPage) nextListType() {
+	i := slices.Index(albumListTypes, p.listType)
+	p.listType = albumListTypes[(i+1)%len(albumListTypes)]
+	p.load(false)
+}
+
+// coverArt returns the thumbnail of an album, or the logo while it's being
+// fetched
+func (p *AlbumsPage) coverArt(album subsonic.Album) image.Image {
+	if album.CoverArtId == "" {
+		return STMPS_LOGO
+	}
+	return p.coverArtCache.Get(album.CoverArtId)
+}
+
+// load fetches the albums of the list in the background, or with more the
+// next ones
+func (p *AlbumsPage) load(more bool) {
+	if p.loading {
+		if !more {
+			p.reload = true
+		}
+		return
+	}
+	if more && p.complete {
+		return
+	}
+	p.loading = true
+	p.updateTitle()
+
+	listType, offset := p.listType, 0
+	if more {
+		offset = len(p.albums)
+	}
+	go func() {
+		albums, err := p.ui.connection.GetAlbumList2(listType, albumPageSize, offset)
+		p.ui.app.QueueUpdateDraw(func() {
+			p.loading = false
+			if p.reload {
+				// refreshed, or another list picked, meanwhile
+				p.reload = false
+				p.load(false)
+				return
+			}
+			if err != nil {
+				p.logger.PrintError("AlbumsPage GetAlbumList2", err)
+				p.updateTitle()
+				return
+			}
+			if more {
+				p.albums = append(p.albums, albums...)
+			} else {
+				p.albums = albums
+				p.grid.Reset()
+			}
+			p.complete = len(albums) < albumPageSize
+			p.updateTitle()
+		})
+	}()
+}
+
+func (p *AlbumsPage) updateTitle() {
+	title := fmt.Sprintf(" albums %s ", albumListTitles[p.listType])
+	if p.loading {
+		title += "(loading…) "
+	} else {
+		title += fmt.Sprintf("(%d) ", len(p.albums))
+	}
+	p.grid.SetTitle(title)
+}
+
+// addSelectedTo calls add with the songs of the selected album, and selects
+// the next one
+func (p *AlbumsPage) addSelectedTo(add func(songs ...subsonic.Entity)) {
+	if len(p.albums) == 0 {
+		return
+	}
+	index := p.grid.GetCurrentItem()
+	add(p.ui.albumSongs(p.albums[index])...)
+	p.grid.SetCurrentItem(index + 1)
+}
@@ -5,9 +5,12 @@ package main
 
 import (
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
+	"github.com/spezifisch/stmps/cmdline"
 	"github.com/spezifisch/stmps/logger"
 	"github.com/spezifisch/stmps/subsonic"
 )
@@ -18,60 +21,82 @@ type BrowserPage struct {
 
 	artistFlex *tview.Flex
 
-	artistList  *tview.List
-	entityList  *tview.List
+	artistList  *ListWidget
+	entityList  *ListWidget
 	searchField *tview.InputField
+	filterField *tview.InputField
+	breadcrumbs *tview.TextView
+	// searchVisible and filterVisible are whether the artist search and
+	// the entity filter fields are shown
+	searchVisible bool
+	filterVisible bool
 
 	currentArtist subsonic.Artist
 	currentAlbum  subsonic.Album
 
 	artistObjectList []subsonic.Artist
+	// artistsLoading is whether the artists are being fetched, see
+	// loadArtists
+	artistsLoading bool
+
+	// entityFilter hides the albums or songs it doesn't match, see :filter
+	entityFilter cmdline.Filter
+	// quickFilter hides the albums or songs it doesn't match while typing
+	// in the filter field, see matchesQuickFilter
+	quickFilter string
+	// albumSort is the order of the albums, one of albumSorts
+	albumSort string
+	// shownEntities are the indexes in currentArtist.Albums,
+	// currentAlbum.Songs, or the open directory's Entities of the entityList
+	// items, not counting [..]
+	shownEntities []int
+
+	// directoryMode is whether the browser shows the server's directories
+	// instead of artists and albums
+	directoryMode bool
+	// directoryIndex are the top directories, as getIndexes lists them
+	directoryIndex []subsonic.Artist
+	// directoryPath are the open directories, from the one selected in the
+	// artist list down to the one shown in the entity list
+	directoryPath []subsonic.Directory
 
 	// external refs
 	ui     *Ui
 	logger logger.LoggerInterface
 }
 
-func (ui *Ui) createBrowserPage(artists []subsonic.Artist) *BrowserPage {
+// createBrowserPage creates the browser, and starts fetching the artists
+func (ui *Ui) createBrowserPage() *BrowserPage {
 	browserPage := BrowserPage{
 		ui:     ui,
 		logger: ui.logger,
 
-		currentArtist: subsonic.Artist{},
-		// artistObjectList is initially sparse artist info: name & id (and artist image & album count)
-		artistObjectList: artists,
+		currentArtist:  subsonic.Artist{},
+		artistsLoading: true,
 	}
 
 	// artist list
 	// TODO (E) Subsonic can provide artist images. Find a place to display them in the browser
-	browserPage.artistList = tview.NewList().
-		ShowSecondaryText(false)
-	browserPage.artistList.Box.
-		SetTitle(" artist ").
-		SetTitleAlign(tview.AlignLeft).
-		SetBorder(true)
-
-	for _, artist := range artists {
-		browserPage.artistList.AddItem(tview.Escape(artist.Name), "", 0, nil)
-	}
-	browserPage.artistObjectList = artists
+	browserPage.artistList = newListWidget(ui.theme, " artist (loading…) ",
+		browserPage.artistCount, browserPage.artistText)
 
 	// album list
-	// TODO (C) add filter/search to entity list (albums/songs)
-	browserPage.entityList = tview.NewList().
-		ShowSecondaryText(false).
-		SetSelectedFocusOnly(true)
-	browserPage.entityList.Box.
-		SetTitle(" album ").
-		SetTitleAlign(tview.AlignLeft).
-		SetBorder(true)
+	browserPage.entityList = newListWidget(ui.theme, " album ",
+		func() int {
+			if browserPage.hasParentItem() {
+				return len(browserPage.shownEntities) + 1
+			}
+			return len(browserPage.shownEntities)
+		},
+		browserPage.entityText).
+		SetSelectedFocusOnly(true).
+		SetSelectedFunc(browserPage.handleEntitySelected)
 
 	// search bar
 	browserPage.searchField = tview.NewInputField().
 		SetLabel("search:").
-		SetFieldBackgroundColor(tcell.ColorBlack).
 		SetChangedFunc(func(s string) {
-			idxs := browserPage.artistList.FindItems(s, "", false, true)
+			idxs := browserPage.findArtists(s)
 			if len(idxs) == 0 {
 				return
 			}
@@ -81,6 +106,28 @@ func (ui *Ui) createBrowserPage(artists []subsonic.Artist) *BrowserPage {
 			ui.app.SetFocus(browserPage.artistList)
 		})
 
+	// filter of the album or song list
+	browserPage.filterField = tview.NewInputField().
+		SetLabel("filter:").
+		SetChangedFunc(browserPage.setQuickFilter).
+		SetDoneFunc(func(key tcell.Key) {
+			if key == tcell.KeyEscape {
+				browserPage.closeFilter()
+				return
+			}
+			ui.app.SetFocus(browserPage.entityList)
+		})
+	browserPage.albumSort = browserPage.loadAlbumSort()
+
+	// path of the open directory, in directory mode
+	browserPage.breadcrumbs = tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(false).
+		SetWrap(false)
+
+	ui.theme.styleField(browserPage.searchField)
+	ui.theme.styleField(browserPage.filterField)
+
 	browserPage.artistFlex = tview.NewFlex().SetDirection(tview.FlexColumn).
 		AddItem(browserPage.artistList, 0, 1, true).
 		AddItem(browserPage.entityList, 0, 1, false)
@@ -88,84 +135,42 @@ func (ui *Ui) createBrowserPage(artists []subsonic.Artist) *BrowserPage {
 	browserPage.Root = tview.NewFlex().SetDirection(tview.FlexRow)
 	browserPage.showSearchField(false) // add artist/search items
 
-	// TODO (A) Add a toggle to switch the browser to a directory browser
-
-	// going right from the artist list should focus the album/song list
-	browserPage.artistList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if event.Key() == tcell.KeyRight {
-			ui.app.SetFocus(browserPage.entityList)
-			return nil
-		}
-		if event.Key() == tcell.KeyEscape {
-			browserPage.showSearchField(false)
-			ui.app.SetFocus(browserPage.artistList)
-			return nil
-		}
-		// TODO (D) Enter on an artist should... what? Add & play? Switch to the Entity list?
-
-		switch event.Rune() {
-		case 'a':
-			browserPage.handleAddArtistToQueue()
-			return nil
-		case '/':
-			browserPage.showSearchField(true)
-			browserPage.search()
-			return nil
-		case 'n':
-			browserPage.showSearchField(true)
-			browserPage.searchNext()
-			return nil
-		case 'N':
-			browserPage.showSearchField(true)
-			browserPage.searchPrev()
-			return nil
-		case 'S':
-			browserPage.handleAddRandomSongs("similar")
-			return nil
-		case 'R':
-			goBackTo := browserPage.artistList.GetCurrentItem()
-
-			// REFRESH artists
-			artistsIndex, err := ui.connection.GetArtists()
-			if err != nil {
-				ui.logger.Printf("Error fetching artists from server: %s\n", err)
-				return event
-			}
-			artists := make([]subsonic.Artist, 0)
-			for _, ind := range artistsIndex.Index {
-				artists = append(artists, ind.Artists...)
-			}
-			sort.Slice(artists, func(i, j int) bool {
-				return artists[i].Name < artists[j].Name
-			})
-
-			browserPage.artistList.Clear()
-			ui.connection.ClearCache()
-
-			for _, artist := range artists {
-				browserPage.artistList.AddItem(tview.Escape(artist.Name), "", 0, nil)
-			}
-			browserPage.artistObjectList = artists
-			ui.logger.Printf("added %d items to artistList and artistObjectList", len(artists))
-
-			// Try to put the user to about where they were
-			if goBackTo < browserPage.artistList.GetItemCount() {
-				browserPage.artistList.SetCurrentItem(goBackTo)
-			}
-			return nil
-		}
-		return event
+	k := ui.keybindings
+	k.Handle(ContextBrowserArtists, "toggleDirectories", browserPage.toggleDirectoryMode)
+	k.Handle(ContextBrowserEntities, "toggleDirectories", browserPage.toggleDirectoryMode)
+	k.Handle(ContextBrowserArtists, "focusNext", func() {
+		ui.app.SetFocus(browserPage.entityList)
 	})
-
-	browserPage.artistList.SetChangedFunc(func(index int, _ string, _ string, _ rune) {
-		it, _ := browserPage.artistList.GetItemText(index)
-		ui.logger.Printf("debug: artistList changed, index %d (%d, %d): %q, %q", index, browserPage.artistList.GetItemCount(), len(browserPage.artistObjectList), it, browserPage.artistObjectList[index].Name)
-		if index < len(browserPage.artistObjectList) {
-			browserPage.handleArtistSelected(index, browserPage.artistObjectList[index])
-		} else {
-			ui.logger.Printf("error: unexpected selected artist index %d > %d size of artist queue", index, len(browserPage.artistObjectList))
-		}
+	k.Handle(ContextBrowserArtists, "closeSearch", func() {
+		browserPage.showSearchField(false)
+		ui.app.SetFocus(browserPage.artistList)
+	})
+	// TODO (D) Enter on an artist should... what? Add & play? Switch to the Entity list?
+	k.Handle(ContextBrowserArtists, "addToQueue", func() {
+		browserPage.addSelectedArtistTo(ui.queueSongs)
+	})
+	k.Handle(ContextBrowserArtists, "playNext", func() {
+		browserPage.addSelectedArtistTo(ui.queueSongsNext)
 	})
+	k.Handle(ContextBrowserArtists, "search", func() {
+		browserPage.showSearchField(true)
+		browserPage.search()
+	})
+	k.Handle(ContextBrowserArtists, "searchNext", func() {
+		browserPage.showSearchField(true)
+		browserPage.searchNext()
+	})
+	k.Handle(ContextBrowserArtists, "searchPrevious", func() {
+		browserPage.showSearchField(true)
+		browserPage.searchPrev()
+	})
+	k.Handle(ContextBrowserArtists, "addSimilarSongs", func() {
+		browserPage.handleAddRandomSongs("similar")
+	})
+	k.Handle(ContextBrowserArtists, "refresh", browserPage.refreshArtists)
+	browserPage.artistList.SetInputCapture(k.Capture(ContextBrowserArtists))
+
+	browserPage.artistList.SetChangedFunc(browserPage.handleArtistListChanged)
 
 	ui.addToPlaylistList.SetBorder(true).
 		SetTitle("Add to Playlist")
@@ -178,132 +183,340 @@ func (ui *Ui) createBrowserPage(artists []subsonic.Artist) *BrowserPage {
 
 	ui.addToPlaylistList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		if event.Key() == tcell.KeyEscape {
-			ui.pages.HidePage(PageAddToPlaylist)
-			ui.pages.SwitchToPage(PageBrowser)
-			ui.app.SetFocus(browserPage.entityList)
+			ui.closeAddToPlaylist()
 			return nil
 		} else if event.Key() == tcell.KeyEnter {
 			playlist := ui.playlistPage.playlists[ui.addToPlaylistList.GetCurrentItem()]
-			browserPage.handleAddEntityToPlaylist(&playlist)
+			ui.addToPlaylist(&playlist)
 
-			ui.pages.HidePage(PageAddToPlaylist)
-			ui.pages.SwitchToPage(PageBrowser)
-			ui.app.SetFocus(browserPage.entityList)
+			ui.closeAddToPlaylist()
 			return nil
 		}
 
 		return event
 	})
 
-	browserPage.entityList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if event.Key() == tcell.KeyLeft {
-			ui.app.SetFocus(browserPage.artistList)
-			return nil
+	k.Handle(ContextBrowserEntities, "focusPrevious", func() {
+		ui.app.SetFocus(browserPage.artistList)
+	})
+	k.Handle(ContextBrowserEntities, "addToQueue", func() {
+		browserPage.addSelectedEntityTo(ui.queueSongs)
+	})
+	k.Handle(ContextBrowserEntities, "playNext", func() {
+		browserPage.addSelectedEntityTo(ui.queueSongsNext)
+	})
+	k.Handle(ContextBrowserEntities, "toggleStar", browserPage.handleToggleEntityStar)
+	k.Handle(ContextBrowserEntities, "addToPlaylist", func() {
+		ui.showAddToPlaylist(PageBrowser, browserPage.entityList, browserPage.handleAddEntityToPlaylist)
+	})
+	k.Handle(ContextBrowserEntities, "refresh", func() {
+		if browserPage.directoryMode {
+			browserPage.refreshDirectory()
+			return
 		}
-		switch event.Rune() {
-		case 'a':
-			browserPage.handleAddEntityToQueue()
-			return nil
-		case 'y':
-			// FIXME (C) When browsing a Various Artists album that appears under an artist, and the songs are filtered by artist, the indexing is based on the whole album and not the filter. 'y' may favorite the wrong item.
-			browserPage.handleToggleEntityStar()
-			return nil
-		case 'A':
-			// only makes sense to add to a playlist if there are playlists
-			if ui.playlistPage.GetCount() > 0 {
-				browserPage.updatePlaylists()
-				ui.pages.ShowPage(PageAddToPlaylist)
-				ui.app.SetFocus(ui.addToPlaylistList)
-			} else {
-				ui.showMessageBox("No playlists available. Create one first.")
+		// FIXME (A) Sometimes when browsing, we completely lose all of the albums. Refresh doesn't work. Artists can still be added with 'a', but nothing is shown in the entity list. This is hard to reproduce.
+		// REFRESH only the artist albums
+		artistIdx := browserPage.artistList.GetCurrentItem()
+		if browserPage.artistsLoading || artistIdx < 0 || artistIdx >= len(browserPage.artistObjectList) {
+			return
+		}
+		entity := browserPage.artistObjectList[artistIdx]
+		ui.connection.RemoveArtistCacheEntry(entity.Id)
+		browserPage.handleArtistSelected(artistIdx, entity)
+	})
+	k.Handle(ContextBrowserEntities, "addSimilarSongs", func() {
+		browserPage.handleAddRandomSongs("similar")
+	})
+	k.Handle(ContextBrowserEntities, "search", browserPage.openFilter)
+	k.Handle(ContextBrowserEntities, "searchNext", func() {
+		browserPage.showFilterField(true)
+		browserPage.filterNext(false)
+	})
+	k.Handle(ContextBrowserEntities, "searchPrevious", func() {
+		browserPage.showFilterField(true)
+		browserPage.filterNext(true)
+	})
+	k.Handle(ContextBrowserEntities, "closeSearch", browserPage.closeFilter)
+	k.Handle(ContextBrowserEntities, "sortAlbums", browserPage.nextAlbumSort)
+	browserPage.entityList.SetInputCapture(k.Capture(ContextBrowserEntities))
+
+	// a large library takes a while; the UI can be used meanwhile
+	go browserPage.loadArtists(0)
+
+	return &browserPage
+}
+
+// artistsOf returns the artists of the indexes of getArtists. They're sparse,
+// containing little more than ID and name; details need to be fetched when
+// accessed.
+func artistsOf(indexes subsonic.Indexes) []subsonic.Artist {
+	artists := make([]subsonic.Artist, 0)
+	for _, index := range indexes.Index {
+		artists = append(artists, index.Artists...)
+	}
+	return artists
+}
+
+// sortedArtistsOf is artistsOf, sorted by name, as the artist list shows them
+func sortedArtistsOf(indexes subsonic.Indexes) []subsonic.Artist {
+	artists := artistsOf(indexes)
+	sort.Slice(artists, func(i, j int) bool {
+		return artists[i].Name < artists[j].Name
+	})
+	return artists
+}
+
+// loadArtists fetches the artists from the server, and shows them when
+// they're there, with the one at goBackTo selected
+func (b *BrowserPage) loadArtists(goBackTo int) {
+	indexes, err := b.ui.connection.GetArtists()
+	if err == nil {
+		// what's cached may be gone or changed, too
+		b.ui.connection.ClearCache()
+	}
+	b.ui.app.QueueUpdateDraw(func() {
+		b.artistsLoading = false
+		if err != nil {
+			b.logger.Printf("Error fetching artists from server: %s\n", err)
+			if !b.directoryMode {
+				if len(b.artistObjectList) == 0 {
+					b.artistList.SetTitle(" artist (loading failed) ")
+				} else {
+					b.artistList.SetTitle(" artist ")
+				}
+			}
+			b.ui.showMessageBox("Fetching artists failed: " + err.Error())
+			return
+		}
+		b.artistObjectList = sortedArtistsOf(indexes)
+		b.logger.Printf("added %d items to artistObjectList", len(b.artistObjectList))
+		if !b.directoryMode {
+			b.fillArtistList()
+			if goBackTo < b.artistList.GetItemCount() {
+				b.artistList.SetCurrentItem(goBackTo)
 			}
-			return nil
-		case 'R':
-			// FIXME (A) Sometimes when browsing, we completely lose all of the albums. Refresh doesn't work. Artists can still be added with 'a', but nothing is shown in the entity list. This is hard to reproduce.
-			// REFRESH only the artist albums
-			artistIdx := browserPage.artistList.GetCurrentItem()
-			entity := browserPage.artistObjectList[artistIdx]
-			ui.connection.RemoveArtistCacheEntry(entity.Id)
-			browserPage.handleArtistSelected(artistIdx, entity)
-			return nil
-		case 'S':
-			browserPage.handleAddRandomSongs("similar")
-			return nil
 		}
-		return event
 	})
+}
 
-	// open first artist by default so we don't get stuck when there's only one artist
-	if len(browserPage.artistObjectList) > 0 {
-		browserPage.handleArtistSelected(0, browserPage.artistObjectList[0])
+// refreshArtists reloads the artist list from the server in the background,
+// and tries to put the user to about where they were
+func (b *BrowserPage) refreshArtists() {
+	if b.directoryMode {
+		b.refreshDirectoryIndex()
+		return
+	}
+	if b.artistsLoading {
+		return
 	}
+	b.artistsLoading = true
+	b.artistList.SetTitle(" artist (loading…) ")
+	go b.loadArtists(b.artistList.GetCurrentItem())
+}
 
-	return &browserPage
+// artistCount is the number of items of the artist list: artists, or in
+// directory mode the top directories
+func (b *BrowserPage) artistCount() int {
+	if b.directoryMode {
+		return len(b.directoryIndex)
+	}
+	return len(b.artistObjectList)
+}
+
+func (b *BrowserPage) artistText(index int) string {
+	if b.directoryMode {
+		return tview.Escape(b.directoryIndex[index].Name)
+	}
+	return tview.Escape(b.artistObjectList[index].Name)
+}
+
+// findArtists returns the indexes of the artist list items whose names
+// contain the text, ignoring case
+func (b *BrowserPage) findArtists(text string) []int {
+	artists := b.artistObjectList
+	if b.directoryMode {
+		artists = b.directoryIndex
+	}
+	text = strings.ToLower(text)
+	var indexes []int
+	for i, artist := range artists {
+		if strings.Contains(strings.ToLower(artist.Name), text) {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// handleArtistListChanged opens the artist, or directory, the artist list
+// selected
+func (b *BrowserPage) handleArtistListChanged(index int) {
+	if b.directoryMode {
+		b.handleTopDirectorySelected(index)
+		return
+	}
+	if index < len(b.artistObjectList) {
+		b.logger.Printf("debug: artistList changed, index %d (%d): %q", index, len(b.artistObjectList), b.artistObjectList[index].Name)
+		b.handleArtistSelected(index, b.artistObjectList[index])
+	} else {
+		b.logger.Printf("error: unexpected selected artist index %d > %d size of artist queue", index, len(b.artistObjectList))
+	}
 }
 
 func (b *BrowserPage) showSearchField(visible bool) {
+	b.searchVisible = visible
+	b.layout()
+}
+
+func (b *BrowserPage) showFilterField(visible bool) {
+	b.filterVisible = visible
+	b.layout()
+}
+
+// layout puts the lists, and the breadcrumbs and fields that are shown, in
+// the page
+func (b *BrowserPage) layout() {
 	b.Root.Clear()
+	if b.directoryMode {
+		b.Root.AddItem(b.breadcrumbs, 1, 0, false)
+	}
 	b.Root.AddItem(b.artistFlex, 0, 1, true)
 
-	if visible {
+	if b.searchVisible {
 		b.Root.AddItem(b.searchField, 1, 0, false)
 	}
+	if b.filterVisible {
+		b.Root.AddItem(b.filterField, 1, 0, false)
+	}
 }
 
 func (b *BrowserPage) IsSearchFocused(focused tview.Primitive) bool {
-	return focused == b.searchField
+	return focused == b.searchField || focused == b.filterField
 }
 
-func (b *BrowserPage) UpdateStars() {
-	// reload album/song list if one is open
-	if b.currentArtist.Id != "" {
-		if b.currentAlbum.Id != "" {
-			b.handleAlbumSelected(b.currentAlbum.Id)
-		} else {
-			idx := b.artistList.GetCurrentItem()
-			b.handleArtistSelected(idx, b.currentArtist)
-		}
-	}
-}
-
-func (b *BrowserPage) handleAddArtistToQueue() {
+// addSelectedArtistTo calls add once with all songs of the selected artist,
+// and selects the next one
+func (b *BrowserPage) addSelectedArtistTo(add func(songs ...subsonic.Entity)) {
 	currentIndex := b.artistList.GetCurrentItem()
 
-	for _, album := range b.currentArtist.Albums {
-		b.addAlbumToQueue(album)
+	var songs []subsonic.Entity
+	if b.directoryMode {
+		if currentIndex < len(b.directoryIndex) {
+			songs = b.directorySongs(&subsonic.Entity{
+				EntityBase: subsonic.EntityBase{Id: b.directoryIndex[currentIndex].Id},
+			})
+		}
+	} else {
+		for _, album := range b.currentArtist.Albums {
+			songs = append(songs, b.ui.albumSongs(album)...)
+		}
 	}
 
 	if currentIndex+1 < b.artistList.GetItemCount() {
 		b.artistList.SetCurrentItem(currentIndex + 1)
 	}
 
-	b.ui.queuePage.UpdateQueue()
+	add(songs...)
 }
 
 func (b *BrowserPage) handleAddRandomSongs(randomType string) {
 	defer b.ui.queuePage.UpdateQueue()
-	if randomType == "random" || b.currentAlbum.Id == "" {
+	if randomType == "random" {
 		b.ui.addRandomSongsToQueue("")
 		return
 	}
 
-	currentIndex := b.entityList.GetCurrentItem()
-	// account for [..] entry that we show, see handleEntitySelected()
-	currentIndex--
-	if currentIndex < 0 {
+	if b.directoryMode {
+		// similar to the selected song, if it is one
+		songId := ""
+		if currentIndex := b.selectedEntity(); currentIndex >= 0 {
+			if entity := b.currentDirectory().Entities[currentIndex]; !entity.IsDirectory {
+				songId = entity.Id
+			}
+		}
+		b.ui.addRandomSongsToQueue(songId)
+		return
+	}
+	if b.currentAlbum.Id == "" {
+		b.ui.addRandomSongsToQueue("")
 		return
 	}
-	if currentIndex > len(b.currentAlbum.Songs) {
-		b.logger.Printf("error: handleAddRandomSongs invalid state, index %d > %d number of songs", currentIndex, len(b.currentAlbum.Songs))
+
+	currentIndex := b.selectedEntity()
+	if currentIndex < 0 {
 		return
 	}
 
 	b.ui.addRandomSongsToQueue(b.currentAlbum.Songs[currentIndex].Id)
 }
 
+// selectedEntity returns the index in currentAlbum.Songs, or if no album is
+// open, in currentArtist.Albums, of the selected entityList item; in
+// directory mode, the index in the open directory's Entities. It's -1 for
+// [..] or if nothing is selected.
+func (b *BrowserPage) selectedEntity() int {
+	return b.entityIndex(b.entityList.GetCurrentItem())
+}
+
+// entityIndex returns the index in currentAlbum.Songs, currentArtist.Albums,
+// or the open directory of an entityList item, or -1 for [..]
+func (b *BrowserPage) entityIndex(item int) int {
+	if b.hasParentItem() {
+		// account for [..] entry that we show, see handleAlbumSelected()
+		item--
+	}
+	if item < 0 || item >= len(b.shownEntities) {
+		return -1
+	}
+	return b.shownEntities[item]
+}
+
+// entityText is the text of an entityList item
+func (b *BrowserPage) entityText(item int) string {
+	index := b.entityIndex(item)
+	if index < 0 {
+		return tview.Escape("[..]")
+	}
+	theme, stars := b.ui.theme, b.ui.starIdList
+	switch {
+	case b.directoryMode:
+		entity := b.currentDirectory().Entities[index]
+		return entityListTextFormat(theme, entity.Id, entity.Title, entity.IsDirectory, stars)
+	case b.currentAlbum.Id != "":
+		song := b.currentAlbum.Songs[index]
+		return entityListTextFormat(theme, song.Id, song.Title, false, stars)
+	}
+	album := b.currentArtist.Albums[index]
+	return entityListTextFormat(theme, album.Id, album.Name, true, stars)
+}
+
+// handleEntitySelected opens the album or directory of an entityList item,
+// plays its song, or goes back with [..]
+func (b *BrowserPage) handleEntitySelected(item int) {
+	index := b.entityIndex(item)
+	switch {
+	case index < 0 && b.directoryMode:
+		b.closeDirectory()
+	case index < 0:
+		album := b.currentAlbum.Id
+		b.handleArtistSelected(b.artistList.GetCurrentItem(), b.currentArtist)
+		b.selectEntityId(album)
+	case b.directoryMode:
+		entity := b.currentDirectory().Entities[index]
+		if entity.IsDirectory {
+			b.openDirectory(entity.Id)
+		} else {
+			b.ui.makeSongHandler(entity)()
+		}
+	case b.currentAlbum.Id != "":
+		b.ui.makeSongHandler(b.currentAlbum.Songs[index])()
+	default:
+		b.handleAlbumSelected(b.currentArtist.Albums[index].Id)
+	}
+}
+
 // handleArtistSelected takes an artist ID and sets up the contents of the
-// entityList, including setting up selection handlers for each item in the
-// list. It also refreshes the artist from the server if it has a sparse copy.
+// entityList with the artist's albums. It also refreshes the artist from the
+// server if it has a sparse copy.
 func (b *BrowserPage) handleArtistSelected(idx int, artist subsonic.Artist) {
 	// Refresh the artist and update the object list
 	artist, err := b.ui.connection.GetArtist(artist.Id)
@@ -316,20 +529,86 @@ func (b *BrowserPage) handleArtistSelected(idx int, artist subsonic.Artist) {
 		return
 	}
 	b.logger.Printf("debug handleArtistSelected: setting artist object list %d to %q", idx, artist.Name)
+	artist.Albums = sortAlbums(artist.Albums, b.albumSort)
 	b.currentArtist, b.artistObjectList[idx] = artist, artist
 
-	b.entityList.Clear()
 	b.currentAlbum = subsonic.Album{}
+	b.shownEntities = b.shownEntities[:0]
 
-	b.entityList.Box.SetTitle(" album ")
+	what := "album"
+	if b.albumSort != "" {
+		what += " " + albumSortTitles[b.albumSort]
+	}
+	b.entityList.Box.SetTitle(b.entityListTitle(what))
 
 	b.logger.Printf("debug handleArtistSelected: adding %d albums to album list", len(artist.Albums))
-	for _, album := range artist.Albums {
-		title := entityListTextFormat(album.Id, album.Name, true, b.ui.starIdList)
-		b.entityList.AddItem(title, "", 0, func() { b.handleAlbumSelected(album.Id) })
+	for i, album := range artist.Albums {
+		if b.showsEntity(albumFields(album)) {
+			b.shownEntities = append(b.shownEntities, i)
+		}
+	}
+	b.entityList.Reset()
+}
+
+// entityFilterFields are the fields that :filter can use in the browser
+var entityFilterFields = []string{cmdline.FieldName, "artist", "album", "year", "genre", "track", "duration"}
+
+func albumFields(album subsonic.Album) cmdline.Fields {
+	genre := album.Genre
+	if genre == "" && len(album.Genres) > 0 {
+		genres := make([]string, len(album.Genres))
+		for i, g := range album.Genres {
+			genres[i] = g.Name
+		}
+		genre = strings.Join(genres, ", ")
+	}
+	return cmdline.Fields{
+		cmdline.FieldName: album.Name,
+		"artist":          album.Artist,
+		"album":           album.Name,
+		"year":            strconv.Itoa(album.Year),
+		"genre":           genre,
+		"duration":        strconv.Itoa(album.Duration),
+	}
+}
+
+func songFields(song subsonic.Entity) cmdline.Fields {
+	return cmdline.Fields{
+		cmdline.FieldName: song.Title,
+		"artist":          song.Artist,
+		"album":           song.Album,
+		"year":            strconv.Itoa(song.Year),
+		"genre":           song.Genre,
+		"track":           strconv.Itoa(song.Track),
+		"duration":        strconv.Itoa(song.Duration),
 	}
 }
 
+// entityListTitle is the title of the entity list, with the filters if
+// there are any
+func (b *BrowserPage) entityListTitle(what string) string {
+	title := " " + what
+	if len(b.entityFilter) > 0 {
+		title += ": " + tview.Escape(b.entityFilter.String())
+	}
+	if b.quickFilter != "" {
+		title += " /" + tview.Escape(b.quickFilter)
+	}
+	return title + " "
+}
+
+// setEntityFilter filters the albums or songs of the entity list. An empty
+// expression shows all of them again.
+func (b *BrowserPage) setEntityFilter(expr string) error {
+	filter, err := cmdline.ParseFilter(expr, entityFilterFields)
+	if err != nil {
+		return err
+	}
+	b.entityFilter = filter
+	b.showEntities()
+	return nil
+}
+
 const VARIOUS_ARTISTS = "Various Artists"
 
 // hasArtist tests whether artist is the artist, or is in either
@@ -391,54 +670,24 @@ func (b *BrowserPage) handleAlbumSelected(id string) {
 		return
 	}
 	b.currentAlbum = album
-	// Browsing an album
-	b.entityList.Clear()
-	b.entityList.Box.SetTitle(" song ")
-	b.entityList.AddItem(
-		tview.Escape("[..]"), "", 0,
-		func() {
-			idx := b.artistList.GetCurrentItem()
-			b.handleArtistSelected(idx, b.currentArtist)
-		})
-	for _, song := range album.Songs {
+	b.shownEntities = b.shownEntities[:0]
+	// Browsing an album, after the [..] entry to go back
+	b.entityList.Box.SetTitle(b.entityListTitle("song"))
+	for i, song := range album.Songs {
 		// Only show songs that belong to the artist being viewed, in the case of collection albums
-		if hasArtist(song, b.currentArtist) {
-			title := entityListTextFormat(song.Id, song.Title, false, b.ui.starIdList)
-			b.entityList.AddItem(title, "", 0, b.ui.makeSongHandler(song))
+		if hasArtist(song, b.currentArtist) && b.showsEntity(songFields(song)) {
+			b.shownEntities = append(b.shownEntities, i)
 		}
 	}
+	b.entityList.Reset()
 }
 
 func (b *BrowserPage) handleToggleEntityStar() {
-	currentIndex := b.entityList.GetCurrentItem()
-	// Keep the original so we can update the label later
-	originalIndex := currentIndex
-	var idToStar, title string
-	var isAlbum bool
-	if b.currentAlbum.Id != "" {
-		// We're in an album; remove 1 for the [..]
-		currentIndex--
-		if currentIndex < 0 {
-			return
-		}
-		if currentIndex >= len(b.currentAlbum.Songs) {
-			b.logger.Printf("error: handleToggleEntityStar bad state; index %d > %d number of songs", currentIndex, len(b.currentAlbum.Songs))
-			return
-		}
-		song := b.currentAlbum.Songs[currentIndex]
-		idToStar = song.Id
-		title = song.Title
-	} else {
-		// We're in a list of albums
-		if currentIndex >= len(b.currentArtist.Albums) {
-			b.logger.Printf("error: handleToggleEntityStar bad state; index %d > %d number of albums", currentIndex, len(b.currentArtist.Albums))
-			return
-		}
-		album := b.currentArtist.Albums[currentIndex]
-		idToStar = album.Id
-		title = album.Name
-		isAlbum = true
+	currentIndex := b.selectedEntity()
+	if currentIndex < 0 {
+		return
 	}
+	idToStar := b.entityId(currentIndex)
 
 	// If the song is already in the star list, remove it
 	_, remove := b.ui.starIdList[idToStar]
@@ -454,53 +703,44 @@ func (b *BrowserPage) handleToggleEntityStar() {
 		b.ui.starIdList[idToStar] = struct{}{}
 	}
 
-	// update entity list entry
-	text := entityListTextFormat(idToStar, title, isAlbum, b.ui.starIdList)
-	b.entityList.SetItemText(originalIndex, text, "")
-
+	// the entity list shows the star when it's drawn
 	b.ui.queuePage.UpdateQueue()
 }
 
-func entityListTextFormat(id, title string, dir bool, starredItems map[string]struct{}) string {
+func entityListTextFormat(theme *Theme, id, title string, dir bool, starredItems map[string]struct{}) string {
 	if dir {
 		title = "[" + title + "]"
 	}
 
 	star := ""
 	if _, hasStar := starredItems[id]; hasStar {
-		star = " [red]♥"
+		star = " " + theme.Style(StyleStar).ColorTag() + "♥"
 	}
 	return tview.Escape(title) + star
 }
 
-func (b *BrowserPage) addAlbumToQueue(album subsonic.Album) {
-	var err error
-	if len(album.Songs) == 0 {
-		album, err = b.ui.connection.GetAlbum(album.Id)
-	}
-	if err != nil {
-		b.logger.Printf("addAlbumToQueue: GetAlbum %s -- %s", album.Id, err.Error())
-		return
-	}
-
-	for _, s := range album.Songs {
-		b.ui.addSongToQueue(s)
-	}
+// directorySongs returns the songs of a directory and all directories in it
+func (b *BrowserPage) directorySongs(entity *subsonic.Entity) (songs []subsonic.Entity) {
+	b.addDirectoryTo(entity, func(song subsonic.Entity) {
+		songs = append(songs, song)
+	})
+	return
 }
 
-//nolint:golint,unused
-func (b *BrowserPage) addDirectoryToQueue(entity *subsonic.Entity) {
+// addDirectoryTo calls add with the songs of a directory and all directories
+// in it
+func (b *BrowserPage) addDirectoryTo(entity *subsonic.Entity, add func(song subsonic.Entity)) {
 	directory, err := b.ui.connection.GetMusicDirectory(entity.Id)
 	if err != nil {
-		b.logger.Printf("addDirectoryToQueue: GetMusicDirectory %s -- %s", entity.Id, err.Error())
+		b.logger.Printf("addDirectoryTo: GetMusicDirectory %s -- %s", entity.Id, err.Error())
 		return
 	}
 
 	for _, e := range directory.Entities {
 		if e.IsDirectory {
-			b.addDirectoryToQueue(&e)
+			b.addDirectoryTo(&e, add)
 		} else {
-			b.ui.addSongToQueue(e)
+			add(e)
 		}
 	}
 }
@@ -516,7 +756,7 @@ func (b *BrowserPage) search() {
 
 func (b *BrowserPage) searchNext() {
 	str := b.searchField.GetText()
-	idxs := b.artistList.FindItems(str, "", false, true)
+	idxs := b.findArtists(str)
 	if len(idxs) == 0 {
 		return
 	}
@@ -533,7 +773,7 @@ func (b *BrowserPage) searchNext() {
 
 func (b *BrowserPage) searchPrev() {
 	str := b.searchField.GetText()
-	idxs := b.artistList.FindItems(str, "", false, true)
+	idxs := b.findArtists(str)
 	if len(idxs) == 0 {
 		return
 	}
@@ -549,29 +789,23 @@ func (b *BrowserPage) searchPrev() {
 }
 
 func (b *BrowserPage) handleAddEntityToX(add func(song subsonic.Entity), update func()) {
-	currentIndex := b.entityList.GetCurrentItem()
+	oldIndex := b.entityList.GetCurrentItem()
+	currentIndex := b.selectedEntity()
 	if currentIndex < 0 {
 		return
 	}
-	oldIndex := currentIndex
 
-	if b.currentAlbum.Id != "" {
-		// account for [..] entry that we show, see handleEntitySelected()
-		currentIndex--
-		if currentIndex < 0 {
-			return
-		}
-		if currentIndex >= b.currentAlbum.Songs.Len() {
-			b.logger.Printf("error: handleAddEntityToX invalid state, index %d > %d number of songs", currentIndex, len(b.currentAlbum.Songs))
-			return
+	if b.directoryMode {
+		entity := b.currentDirectory().Entities[currentIndex]
+		if entity.IsDirectory {
+			b.addDirectoryTo(&entity, add)
+		} else {
+			add(entity)
 		}
+	} else if b.currentAlbum.Id != "" {
 		add(b.currentAlbum.Songs[currentIndex])
 	} else {
 		// We're viewing the artist's albums, so find the album the user wants to add
-		if currentIndex >= len(b.currentArtist.Albums) {
-			b.logger.Printf("error: handleAddEntityToX invalid state, index %d > %d number of albums", currentIndex, len(b.currentArtist.Albums))
-			return
-		}
 		album := b.currentArtist.Albums[currentIndex]
 		// The album may be sparse; if so, populate it
 		if len(album.Songs) == 0 {
@@ -598,8 +832,15 @@ func (b *BrowserPage) handleAddEntityToX(add func(song subsonic.Entity), update
 	}
 }
 
-func (b *BrowserPage) handleAddEntityToQueue() {
-	b.handleAddEntityToX(b.ui.addSongToQueue, b.ui.queuePage.UpdateQueue)
+// addSelectedEntityTo calls add once with the songs of the selected entity,
+// and selects the next one
+func (b *BrowserPage) addSelectedEntityTo(add func(songs ...subsonic.Entity)) {
+	var songs []subsonic.Entity
+	b.handleAddEntityToX(func(song subsonic.Entity) {
+		songs = append(songs, song)
+	}, func() {
+		add(songs...)
+	})
 }
 
 func (b *BrowserPage) handleAddEntityToPlaylist(playlist *subsonic.Playlist) {
@@ -0,0 +1,184 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"strings"
+
+	"github.com/spezifisch/stmps/subsonic"
+)
+
+// toggleDirectoryMode switches the browser between artists and albums, and
+// the server's directories. The directories are fetched when first shown.
+func (b *BrowserPage) toggleDirectoryMode() {
+	if !b.directoryMode && b.directoryIndex == nil {
+		if err := b.loadDirectoryIndex(); err != nil {
+			b.logger.PrintError("toggleDirectoryMode", err)
+			b.ui.showMessageBox("Fetching directories failed")
+			return
+		}
+	}
+
+	b.directoryMode = !b.directoryMode
+	b.layout()
+	b.fillArtistList()
+	b.ui.app.SetFocus(b.artistList)
+}
+
+// loadDirectoryIndex fetches the top directories from the server
+func (b *BrowserPage) loadDirectoryIndex() error {
+	indexes, err := b.ui.connection.GetIndexes()
+	if err != nil {
+		return err
+	}
+	b.directoryIndex = artistsOf(indexes)
+	return nil
+}
+
+// refreshDirectoryIndex reloads the top directories from the server
+func (b *BrowserPage) refreshDirectoryIndex() {
+	goBackTo := b.artistList.GetCurrentItem()
+	if err := b.loadDirectoryIndex(); err != nil {
+		b.logger.Printf("Error fetching directories from server: %s\n", err)
+		return
+	}
+	b.ui.connection.ClearCache()
+	b.fillArtistList()
+	if goBackTo < b.artistList.GetItemCount() {
+		b.artistList.SetCurrentItem(goBackTo)
+	}
+}
+
+// fillArtistList shows the artists, or in directory mode the top
+// directories, in the artist list, and opens the first one
+func (b *BrowserPage) fillArtistList() {
+	switch {
+	case b.directoryMode:
+		b.artistList.Box.SetTitle(" directory ")
+	case b.artistsLoading:
+		b.artistList.Box.SetTitle(" artist (loading…) ")
+	default:
+		b.artistList.Box.SetTitle(" artist ")
+	}
+
+	b.directoryPath = nil
+	b.currentArtist = subsonic.Artist{}
+	b.currentAlbum = subsonic.Album{}
+	b.breadcrumbs.Clear()
+	b.shownEntities = b.shownEntities[:0]
+	b.entityList.Reset()
+
+	// open the first one so we don't get stuck when there's only one
+	b.artistList.Reset()
+	if b.artistList.GetItemCount() > 0 {
+		b.handleArtistListChanged(0)
+	}
+}
+
+// handleTopDirectorySelected opens a directory of the artist list
+func (b *BrowserPage) handleTopDirectorySelected(idx int) {
+	if idx < 0 || idx >= len(b.directoryIndex) {
+		b.logger.Printf("error: unexpected selected directory index %d > %d size of directory index", idx, len(b.directoryIndex))
+		return
+	}
+	directory, err := b.ui.connection.GetMusicDirectory(b.directoryIndex[idx].Id)
+	if err != nil {
+		b.logger.PrintError("handleTopDirectorySelected", err)
+		return
+	}
+	b.directoryPath = []subsonic.Directory{directory}
+	b.showDirectory()
+}
+
+// currentDirectory returns the directory shown in the entity list
+func (b *BrowserPage) currentDirectory() subsonic.Directory {
+	if len(b.directoryPath) == 0 {
+		return subsonic.Directory{}
+	}
+	return b.directoryPath[len(b.directoryPath)-1]
+}
+
+// hasParentItem returns whether the entity list starts with [..], which goes
+// back to the artist's albums or the parent directory
+func (b *BrowserPage) hasParentItem() bool {
+	if b.directoryMode {
+		return len(b.directoryPath) > 1
+	}
+	return b.currentAlbum.Id != ""
+}
+
+// showDirectory fills the entity list with the directories and songs of the
+// current directory
+func (b *BrowserPage) showDirectory() {
+	directory := b.currentDirectory()
+	b.entityList.Box.SetTitle(b.entityListTitle("files"))
+	b.shownEntities = b.shownEntities[:0]
+	b.updateBreadcrumbs()
+
+	// after [..], if there's a parent; see entityText
+	for i, entity := range directory.Entities {
+		if b.showsEntity(songFields(entity)) {
+			b.shownEntities = append(b.shownEntities, i)
+		}
+	}
+	b.entityList.Reset()
+}
+
+// openDirectory descends into a directory of the current one
+func (b *BrowserPage) openDirectory(id string) {
+	directory, err := b.ui.connection.GetMusicDirectory(id)
+	if err != nil {
+		b.logger.PrintError("openDirectory", err)
+		return
+	}
+	b.directoryPath = append(b.directoryPath, directory)
+	b.showDirectory()
+}
+
+// closeDirectory goes back to the parent directory, with the one that was
+// open selected
+func (b *BrowserPage) closeDirectory() {
+	if len(b.directoryPath) < 2 {
+		return
+	}
+	closed := b.currentDirectory()
+	b.directoryPath = b.directoryPath[:len(b.directoryPath)-1]
+	b.showDirectory()
+	b.selectEntityId(closed.Id)
+}
+
+// refreshDirectory reloads the current directory from the server
+func (b *BrowserPage) refreshDirectory() {
+	if len(b.directoryPath) == 0 {
+		return
+	}
+	last := len(b.directoryPath) - 1
+	b.ui.connection.RemoveDirectoryCacheEntry(b.directoryPath[last].Id)
+	directory, err := b.ui.connection.GetMusicDirectory(b.directoryPath[last].Id)
+	if err != nil {
+		b.logger.PrintError("refreshDirectory", err)
+		return
+	}
+	current := b.entityList.GetCurrentItem()
+	b.directoryPath[last] = directory
+	b.showDirectory()
+	b.entityList.SetCurrentItem(current)
+}
+
+// updateBreadcrumbs shows the path of the current directory
+func (b *BrowserPage) updateBreadcrumbs() {
+	theme := b.ui.theme
+	var text strings.Builder
+	for i, directory := range b.directoryPath {
+		if i > 0 {
+			text.WriteString(theme.Styled(StyleDim, " / "))
+		}
+		if i == len(b.directoryPath)-1 {
+			text.WriteString(theme.Styled(StyleTitle, directory.Name))
+		} else {
+			text.WriteString(theme.Styled(StyleText, directory.Name))
+		}
+	}
+	b.breadcrumbs.SetText(text.String())
+}
@@ -0,0 +1,214 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/spezifisch/stmps/cmdline"
+	"github.com/spezifisch/stmps/subsonic"
+	"github.com/spf13/viper"
+)
+
+// the orders the browser can sort albums in
+const (
+	albumSortName   = "name"
+	albumSortYear   = "year"
+	albumSortNewest = "newest"
+)
+
+// albumSorts are the orders the sortAlbums command goes through; "" is the
+// order the server sends
+var albumSorts = []string{"", albumSortName, albumSortYear, albumSortNewest}
+
+// albumSortTitles are what the title of the album list says about the order
+var albumSortTitles = map[string]string{
+	albumSortName:   "by name",
+	albumSortYear:   "by year",
+	albumSortNewest: "newest first",
+}
+
+// sortAlbums returns the albums sorted by name, year, or the newest added to
+// the library first. Without an order, they're returned as they are.
+func sortAlbums(albums []subsonic.Album, by string) []subsonic.Album {
+	if by == "" {
+		return albums
+	}
+	name := func(album subsonic.Album) string {
+		if album.SortName != "" {
+			return strings.ToLower(album.SortName)
+		}
+		return strings.ToLower(album.Name)
+	}
+
+	sorted := slices.Clone(albums)
+	slices.SortStableFunc(sorted, func(a, b subsonic.Album) int {
+		switch by {
+		case albumSortYear:
+			return cmp.Or(cmp.Compare(a.Year, b.Year), strings.Compare(name(a), name(b)))
+		case albumSortNewest:
+			// the dates are ISO 8601
+			return cmp.Or(strings.Compare(b.Created, a.Created), strings.Compare(name(a), name(b)))
+		}
+		return strings.Compare(name(a), name(b))
+	})
+	return sorted
+}
+
+// loadAlbumSort returns the album order of the config, or the server's if it
+// isn't valid
+func (b *BrowserPage) loadAlbumSort() string {
+	sort := viper.GetString("browser.album-sort")
+	if !slices.Contains(albumSorts, sort) {
+		b.logger.Printf("error: browser.album-sort: unknown order %q; use name, year, or newest", sort)
+		return ""
+	}
+	return sort
+}
+
+// nextAlbumSort sorts the albums in the next of albumSorts
+func (b *BrowserPage) nextAlbumSort() {
+	i := slices.Index(albumSorts, b.albumSort)
+	b.albumSort = albumSorts[(i+1)%len(albumSorts)]
+	b.showEntities()
+}
+
+// matchesQuickFilter returns whether an album's or song's name contains the
+// text, ignoring case, or its year starts with it
+func matchesQuickFilter(fields cmdline.Fields, text string) bool {
+	if text == "" {
+		return true
+	}
+	text = strings.ToLower(text)
+	if strings.Contains(strings.ToLower(fields[cmdline.FieldName]), text) {
+		return true
+	}
+	year := fields["year"]
+	return year != "0" && strings.HasPrefix(year, text)
+}
+
+// showsEntity returns whether the entity list shows an album, song, or
+// directory, i.e. whether both :filter and the quick filter match it
+func (b *BrowserPage) showsEntity(fields cmdline.Fields) bool {
+	return b.entityFilter.Match(fields) && matchesQuickFilter(fields, b.quickFilter)
+}
+
+// entityFields returns the fields of an entity of the list, by its index in
+// currentArtist.Albums, currentAlbum.Songs, or the open directory
+func (b *BrowserPage) entityFields(index int) cmdline.Fields {
+	switch {
+	case b.directoryMode:
+		return songFields(b.currentDirectory().Entities[index])
+	case b.currentAlbum.Id != "":
+		return songFields(b.currentAlbum.Songs[index])
+	}
+	return albumFields(b.currentArtist.Albums[index])
+}
+
+// entityId returns the ID of an entity of the list, by its index like
+// entityFields
+func (b *BrowserPage) entityId(index int) string {
+	switch {
+	case b.directoryMode:
+		return b.currentDirectory().Entities[index].Id
+	case b.currentAlbum.Id != "":
+		return b.currentAlbum.Songs[index].Id
+	}
+	return b.currentArtist.Albums[index].Id
+}
+
+// selectEntityId selects the entity with the ID in the list, if it's shown
+func (b *BrowserPage) selectEntityId(id string) {
+	for item, index := range b.shownEntities {
+		if b.entityId(index) == id {
+			if b.hasParentItem() {
+				item++
+			}
+			b.entityList.SetCurrentItem(item)
+			return
+		}
+	}
+}
+
+// showEntities fills the entity list again, e.g. after a filter changed,
+// with the entity that was selected still selected if it's shown
+func (b *BrowserPage) showEntities() {
+	selected := ""
+	if index := b.selectedEntity(); index >= 0 {
+		selected = b.entityId(index)
+	}
+
+	if b.directoryMode {
+		if len(b.directoryPath) == 0 {
+			return
+		}
+		b.showDirectory()
+	} else if b.currentAlbum.Id != "" {
+		b.handleAlbumSelected(b.currentAlbum.Id)
+	} else if b.currentArtist.Id != "" {
+		b.handleArtistSelected(b.artistList.GetCurrentItem(), b.currentArtist)
+	}
+
+	if selected != "" {
+		b.selectEntityId(selected)
+	}
+}
+
+// setQuickFilter shows only the albums or songs whose name contains the
+// text, or whose year starts with it
+func (b *BrowserPage) setQuickFilter(text string) {
+	if text == b.quickFilter {
+		return
+	}
+	b.quickFilter = text
+	b.showEntities()
+}
+
+// openFilter starts typing a quick filter for the entity list
+func (b *BrowserPage) openFilter() {
+	name, _ := b.ui.pages.GetFrontPage()
+	if name != PageBrowser {
+		return
+	}
+	b.showFilterField(true)
+	b.filterField.SetText("")
+	b.ui.app.SetFocus(b.filterField)
+}
+
+// closeFilter shows all albums or songs again. The filter text stays, for
+// jumping between its matches.
+func (b *BrowserPage) closeFilter() {
+	b.showFilterField(false)
+	b.setQuickFilter("")
+	b.ui.app.SetFocus(b.entityList)
+}
+
+// filterNext selects the next album or song the filter text matches, or
+// with backward the previous one, wrapping around
+func (b *BrowserPage) filterNext(backward bool) {
+	text := b.filterField.GetText()
+	count := len(b.shownEntities)
+	if text == "" || count == 0 {
+		return
+	}
+
+	first := 0
+	if b.hasParentItem() {
+		first = 1
+	}
+	current := b.entityList.GetCurrentItem() - first
+	step := 1
+	if backward {
+		step = -1
+	}
+	for i := 1; i <= count; i++ {
+		item := ((current+step*i)%count + count) % count
+		if matchesQuickFilter(b.entityFields(b.shownEntities[item]), text) {
+			b.entityList.SetCurrentItem(item + first)
+			return
+		}
+	}
+}
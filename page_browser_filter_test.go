@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spezifisch/stmps/cmdline"
+	"github.com/spezifisch/stmps/subsonic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSortAlbums(t *testing.T) {
+	album := func(name string, year int, created string) subsonic.Album {
+		return subsonic.Album{
+			EntityBase: subsonic.EntityBase{Id: name, Year: year, Created: created},
+			Name:       name,
+		}
+	}
+	albums := []subsonic.Album{
+		album("OK Computer", 1997, "2021-03-01T10:00:00Z"),
+		album("amnesiac", 2001, "2023-06-01T10:00:00Z"),
+		album("Kid A", 2000, "2021-03-01T10:00:00Z"),
+		album("Airbag", 1997, "2022-01-01T10:00:00Z"),
+	}
+	ids := func(albums []subsonic.Album) []string {
+		var ids []string
+		for _, album := range albums {
+			ids = append(ids, album.Id)
+		}
+		return ids
+	}
+
+	assert.Equal(t, ids(albums), ids(sortAlbums(albums, "")))
+	assert.Equal(t, []string{"Airbag", "amnesiac", "Kid A", "OK Computer"}, ids(sortAlbums(albums, albumSortName)))
+	assert.Equal(t, []string{"Airbag", "OK Computer", "Kid A", "amnesiac"}, ids(sortAlbums(albums, albumSortYear)))
+	assert.Equal(t, []string{"amnesiac", "Airbag", "Kid A", "OK Computer"}, ids(sortAlbums(albums, albumSortNewest)))
+	// the server's order stays as it was
+	assert.Equal(t, "OK Computer", albums[0].Id)
+}
+
+func TestMatchesQuickFilter(t *testing.T) {
+	fields := cmdline.Fields{cmdline.FieldName: "Live at Wembley", "year": "1986"}
+	assert.True(t, matchesQuickFilter(fields, ""))
+	assert.True(t, matchesQuickFilter(fields, "wemb"))
+	assert.True(t, matchesQuickFilter(fields, "198"))
+	assert.False(t, matchesQuickFilter(fields, "1996"))
+	assert.False(t, matchesQuickFilter(fields, "studio"))
+	assert.False(t, matchesQuickFilter(cmdline.Fields{cmdline.FieldName: "Demo", "year": "0"}, "0"))
+}
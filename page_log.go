@@ -4,6 +4,7 @@
 package main
 
 import (
+	"strings"
 	"time"
 
 	"github.com/rivo/tview"
@@ -24,6 +25,7 @@ func (ui *Ui) createLogPage() *LogPage {
 	}
 
 	logPage.logList = tview.NewList().ShowSecondaryText(false)
+	ui.theme.styleList(logPage.logList)
 
 	logPage.Root = tview.NewFlex().
 		SetDirection(tview.FlexRow).
@@ -34,7 +36,7 @@ func (ui *Ui) createLogPage() *LogPage {
 
 func (l *LogPage) Print(line string) {
 	l.ui.app.QueueUpdateDraw(func() {
-		line := time.Now().Local().Format("(15:04:05) ") + line
+		line := time.Now().Local().Format("(15:04:05) ") + l.ui.theme.Styled(logLevelStyle(line), line)
 		l.logList.InsertItem(0, line, "", 0, nil)
 
 		// Make sure the log list doesn't grow infinitely
@@ -44,3 +46,18 @@ func (l *LogPage) Print(line string) {
 		}
 	})
 }
+
+// logLevelStyle returns the style of a log line, by how it starts, e.g.
+// "error: ..." or "Error(source) -> ..." from PrintError
+func logLevelStyle(line string) string {
+	line = strings.ToLower(line)
+	switch {
+	case strings.HasPrefix(line, "error"):
+		return StyleLogError
+	case strings.HasPrefix(line, "warn"):
+		return StyleLogWarning
+	case strings.HasPrefix(line, "debug"):
+		return StyleLogDebug
+	}
+	return ""
+}
@@ -16,10 +16,12 @@ type PlaylistPage struct {
 	NewPlaylistModal    tview.Primitive
 	DeletePlaylistModal tview.Primitive
 
-	playlistList     *tview.List
+	playlistList     *ListWidget
 	newPlaylistInput *tview.InputField
-	selectedPlaylist *tview.List
+	selectedPlaylist *ListWidget
 	playlists        []subsonic.Playlist
+	// songs are the entries of the playlist shown in selectedPlaylist
+	songs []subsonic.Entity
 
 	// external refs
 	ui     *Ui
@@ -34,23 +36,19 @@ func (ui *Ui) createPlaylistPage() *PlaylistPage {
 	}
 
 	// left half: playlists
-	playlistPage.playlistList = tview.NewList().
-		ShowSecondaryText(false).
+	playlistPage.playlistList = newListWidget(ui.theme, " playlist ",
+		func() int { return len(playlistPage.playlists) },
+		func(i int) string { return tview.Escape(playlistPage.playlists[i].Name) }).
 		SetSelectedFocusOnly(true)
-	playlistPage.playlistList.Box.
-		SetTitle(" playlist ").
-		SetTitleAlign(tview.AlignLeft).
-		SetBorder(true)
-
-	playlistPage.UpdatePlaylists()
 
 	// right half: songs of selected playlist
-	playlistPage.selectedPlaylist = tview.NewList().
-		ShowSecondaryText(false)
-	playlistPage.selectedPlaylist.Box.
-		SetTitle(" songs ").
-		SetTitleAlign(tview.AlignLeft).
-		SetBorder(true)
+	playlistPage.selectedPlaylist = newListWidget(ui.theme, " songs ",
+		func() int { return len(playlistPage.songs) },
+		func(i int) string { return formatSongForPlaylistEntry(ui.theme, playlistPage.songs[i]) }).
+		SetSelectedFocusOnly(true).
+		SetSelectedFunc(func(i int) { ui.makeSongHandler(playlistPage.songs[i])() })
+
+	playlistPage.UpdatePlaylists()
 
 	// flex wrapper
 	playlistColFlex := tview.NewFlex().SetDirection(tview.FlexColumn).
@@ -65,6 +63,7 @@ func (ui *Ui) createPlaylistPage() *PlaylistPage {
 	playlistPage.newPlaylistInput = tview.NewInputField().
 		SetLabel("Name: ").
 		SetFieldWidth(50)
+	ui.theme.styleField(playlistPage.newPlaylistInput)
 	playlistPage.newPlaylistInput.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		if event.Key() == tcell.KeyEnter {
 			playlistPage.newPlaylist(playlistPage.newPlaylistInput.GetText())
@@ -91,44 +90,38 @@ func (ui *Ui) createPlaylistPage() *PlaylistPage {
 
 	playlistPage.NewPlaylistModal = makeModal(newPlaylistFlex, 58, 3)
 
-	// main list input handler
-	playlistPage.playlistList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		playlistPage.logger.Printf("debug: playlistPage inputcapture with %q", event.Rune())
-		if event.Key() == tcell.KeyRight {
-			ui.app.SetFocus(playlistPage.selectedPlaylist)
-			return nil
-		}
-		switch event.Rune() {
-		case 'a':
-			playlistPage.handleAddPlaylistToQueue()
-			return nil
-		case 'n':
-			ui.pages.ShowPage(PageNewPlaylist)
-			ui.app.SetFocus(ui.playlistPage.newPlaylistInput)
-			return nil
-		case 'd':
-			ui.pages.ShowPage(PageDeletePlaylist)
-			return nil
-		case 'R':
-			playlistPage.UpdatePlaylists()
-			return nil
-		}
-
-		return event
+	// main list commands
+	k := ui.keybindings
+	k.Handle(ContextPlaylists, "focusNext", func() {
+		ui.app.SetFocus(playlistPage.selectedPlaylist)
+	})
+	k.Handle(ContextPlaylists, "addToQueue", func() {
+		playlistPage.addSelectedPlaylistTo(ui.queueSongs)
 	})
+	k.Handle(ContextPlaylists, "playNext", func() {
+		playlistPage.addSelectedPlaylistTo(ui.queueSongsNext)
+	})
+	k.Handle(ContextPlaylists, "newPlaylist", func() {
+		ui.pages.ShowPage(PageNewPlaylist)
+		ui.app.SetFocus(ui.playlistPage.newPlaylistInput)
+	})
+	k.Handle(ContextPlaylists, "deletePlaylist", func() {
+		ui.pages.ShowPage(PageDeletePlaylist)
+	})
+	k.Handle(ContextPlaylists, "refresh", playlistPage.UpdatePlaylists)
+	playlistPage.playlistList.SetInputCapture(k.Capture(ContextPlaylists))
 
 	// TODO (C) Add filter/search to playlist coluumn
-	playlistPage.selectedPlaylist.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if event.Key() == tcell.KeyLeft {
-			ui.app.SetFocus(playlistPage.playlistList)
-			return nil
-		}
-		if event.Rune() == 'a' {
-			playlistPage.handleAddPlaylistSongToQueue()
-			return nil
-		}
-		return event
+	k.Handle(ContextPlaylistSongs, "focusPrevious", func() {
+		ui.app.SetFocus(playlistPage.playlistList)
+	})
+	k.Handle(ContextPlaylistSongs, "addToQueue", func() {
+		playlistPage.addSelectedSongTo(ui.queueSongs)
+	})
+	k.Handle(ContextPlaylistSongs, "playNext", func() {
+		playlistPage.addSelectedSongTo(ui.queueSongsNext)
 	})
+	playlistPage.selectedPlaylist.SetInputCapture(k.Capture(ContextPlaylistSongs))
 
 	// delete playlist modal
 	deletePlaylistList := tview.NewList().
@@ -138,6 +131,7 @@ func (ui *Ui) createPlaylistPage() *PlaylistPage {
 		SetTitle("Confirm deletion")
 
 	deletePlaylistList.AddItem("Confirm", "", 0, nil)
+	ui.theme.styleList(deletePlaylistList)
 
 	deletePlaylistFlex := tview.NewFlex().
 		SetDirection(tview.FlexColumn).
@@ -160,18 +154,13 @@ func (ui *Ui) createPlaylistPage() *PlaylistPage {
 
 	playlistPage.DeletePlaylistModal = makeModal(deletePlaylistFlex, 20, 3)
 
-	playlistPage.playlistList.SetChangedFunc(func(index int, _ string, _ string, _ rune) {
+	playlistPage.playlistList.SetChangedFunc(func(index int) {
 		if index < 0 || index >= len(playlistPage.playlists) {
 			return
 		}
 		playlistPage.playlists[index] = playlistPage.handlePlaylistSelected(playlistPage.playlists[index])
 	})
 
-	// open first playlist by default so we don't get stuck when there's only one playlist
-	if len(playlistPage.playlists) > 0 {
-		playlistPage.playlists[0] = playlistPage.handlePlaylistSelected(playlistPage.playlists[0])
-	}
-
 	return &playlistPage
 }
 
@@ -189,10 +178,14 @@ func (p *PlaylistPage) UpdatePlaylists() {
 		p.logger.PrintError("GetPlaylists", err)
 		return
 	}
-	p.playlistList.Clear()
 	p.playlists = playlists.Playlists
-	for _, pl := range playlists.Playlists {
-		p.playlistList.AddItem(tview.Escape(pl.Name), "", 0, nil)
+	p.playlistList.Reset()
+
+	// open first playlist by default so we don't get stuck when there's only one playlist
+	p.songs = nil
+	p.selectedPlaylist.Reset()
+	if len(p.playlists) > 0 {
+		p.playlists[0] = p.handlePlaylistSelected(p.playlists[0])
 	}
 }
 
@@ -200,16 +193,15 @@ func (p *PlaylistPage) addPlaylist(playlist subsonic.Playlist) {
 	// Rather than getting the current selected, let's use the features of closures.
 }
 
-func (p *PlaylistPage) handleAddPlaylistSongToQueue() {
+// addSelectedSongTo calls add with the selected song of the playlist, and
+// selects the next one
+func (p *PlaylistPage) addSelectedSongTo(add func(songs ...subsonic.Entity)) {
 	playlistIndex := p.playlistList.GetCurrentItem()
 	entityIndex := p.selectedPlaylist.GetCurrentItem()
 	if playlistIndex < 0 || playlistIndex >= p.playlistList.GetItemCount() {
 		return
 	}
-	if entityIndex < 0 || entityIndex >= p.selectedPlaylist.GetItemCount() {
-		return
-	}
-	if playlistIndex >= len(p.playlists) || entityIndex >= len(p.playlists[playlistIndex].Entries) {
+	if entityIndex < 0 || entityIndex >= len(p.songs) {
 		return
 	}
 
@@ -218,33 +210,28 @@ func (p *PlaylistPage) handleAddPlaylistSongToQueue() {
 		p.selectedPlaylist.SetCurrentItem(entityIndex + 1)
 	}
 
-	entity := p.playlists[playlistIndex].Entries[entityIndex]
-	p.ui.addSongToQueue(entity)
-
-	p.ui.queuePage.UpdateQueue()
+	add(p.songs[entityIndex])
 }
 
-func (p *PlaylistPage) handleAddPlaylistToQueue() {
+// addSelectedPlaylistTo calls add once with the songs of the selected
+// playlist, and selects the next one
+func (p *PlaylistPage) addSelectedPlaylistTo(add func(songs ...subsonic.Entity)) {
 	currentIndex := p.playlistList.GetCurrentItem()
-	p.logger.Printf("debug: handleAddPlaylistToQueue currentIndex %d, item count %d, playlists %d", currentIndex, p.playlistList.GetItemCount(), len(p.playlists))
+	p.logger.Printf("debug: addSelectedPlaylistTo currentIndex %d, item count %d, playlists %d", currentIndex, p.playlistList.GetItemCount(), len(p.playlists))
 	if currentIndex < 0 || currentIndex >= p.playlistList.GetItemCount() || currentIndex >= len(p.playlists) {
-		p.logger.Printf("error: handleAddPlaylistToQueue bad index %d, returning")
+		p.logger.Printf("error: addSelectedPlaylistTo bad index %d, returning")
 		return
 	}
 
 	// focus next entry
 	if currentIndex+1 < p.playlistList.GetItemCount() {
-		p.logger.Printf("debug: handleAddPlaylistToQueue focusing next")
+		p.logger.Printf("debug: addSelectedPlaylistTo focusing next")
 		p.playlistList.SetCurrentItem(currentIndex + 1)
 	}
 
 	playlist := p.playlists[currentIndex]
-	p.logger.Printf("debug: handleAddPlaylistToQueue adding %d entries", len(playlist.Entries))
-	for _, entity := range playlist.Entries {
-		p.ui.addSongToQueue(entity)
-	}
-
-	p.ui.queuePage.UpdateQueue()
+	p.logger.Printf("debug: addSelectedPlaylistTo adding %d entries", len(playlist.Entries))
+	add(playlist.Entries...)
 }
 
 func (p *PlaylistPage) handlePlaylistSelected(playlist subsonic.Playlist) subsonic.Playlist {
@@ -255,14 +242,8 @@ func (p *PlaylistPage) handlePlaylistSelected(playlist subsonic.Playlist) subson
 		return playlist
 	}
 
-	p.selectedPlaylist.Clear()
-	p.selectedPlaylist.SetSelectedFocusOnly(true)
-
-	for _, entity := range playlist.Entries {
-		handler := p.ui.makeSongHandler(entity)
-		line := formatSongForPlaylistEntry(entity)
-		p.selectedPlaylist.AddItem(line, "", 0, handler)
-	}
+	p.songs = playlist.Entries
+	p.selectedPlaylist.Reset()
 	return playlist
 }
 
@@ -274,8 +255,6 @@ func (p *PlaylistPage) newPlaylist(name string) {
 	}
 
 	p.playlists = append(p.playlists, playlist)
-
-	p.playlistList.AddItem(tview.Escape(playlist.Name), "", 0, nil)
 	p.ui.addToPlaylistList.AddItem(tview.Escape(playlist.Name), "", 0, nil)
 }
 
@@ -286,14 +265,19 @@ func (p *PlaylistPage) deletePlaylist(index int) {
 
 	playlist := p.playlists[index]
 
-	if index == 0 {
-		p.playlistList.SetCurrentItem(1)
-	}
-
 	// Removes item with specified index
 	p.playlists = append(p.playlists[:index], p.playlists[index+1:]...)
 
-	p.playlistList.RemoveItem(index)
+	// open the playlist that took its place, or else the one before it
+	switch {
+	case index < len(p.playlists):
+		p.playlists[index] = p.handlePlaylistSelected(p.playlists[index])
+	case index > 0:
+		p.playlistList.SetCurrentItem(index - 1)
+	default:
+		p.songs = nil
+		p.selectedPlaylist.Reset()
+	}
 	p.ui.addToPlaylistList.RemoveItem(index)
 	if err := p.ui.connection.DeletePlaylist(string(playlist.Id)); err != nil {
 		p.logger.PrintError("deletePlaylist", err)
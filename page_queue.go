@@ -11,7 +11,7 @@ import (
 	"image"
 	"image/png"
 	"os"
-	"text/template"
+	"slices"
 	"time"
 
 	"github.com/gdamore/tcell/v2"
@@ -19,10 +19,9 @@ import (
 	"github.com/spezifisch/stmps/logger"
 	"github.com/spezifisch/stmps/mpvplayer"
 	"github.com/spezifisch/stmps/subsonic"
+	"github.com/spf13/viper"
 )
 
-// columns: star, title, artist, duration
-const queueDataColumns = 4
 const starIcon = "♥"
 
 // data for rendering queue table
@@ -33,6 +32,12 @@ type queueData struct {
 	playerQueue mpvplayer.PlayerQueue
 	// we also need to know which elements are starred
 	starIdList map[string]struct{}
+	// for the star marker
+	theme *Theme
+	// the columns that are shown, see queue.columns in the config
+	columns []queueColumn
+	// whether a row is marked, see QueuePage.isMarked
+	isMarked func(row int) bool
 }
 
 var _ tview.TableContent = (*queueData)(nil)
@@ -50,12 +55,16 @@ type QueuePage struct {
 
 	currentLyrics subsonic.StructuredLyrics
 
+	// the marked songs by index, with their IDs, so that marks can be dropped
+	// when the songs move away under them
+	marked map[int]string
+	// the row where selecting a range started, or -1 if we're not
+	visualStart int
+
 	// external refs
 	ui     *Ui
 	logger logger.LoggerInterface
 
-	songInfoTemplate *template.Template
-
 	coverArtCache Cache[image.Image]
 	lyricsCache   Cache[[]subsonic.StructuredLyrics]
 }
@@ -73,91 +82,62 @@ func init() {
 }
 
 func (ui *Ui) createQueuePage() *QueuePage {
-	tmpl := template.New("song info").Funcs(template.FuncMap{
-		"formatTime": func(i int) string {
-			return (time.Duration(i) * time.Second).String()
-		},
-	})
-	songInfoTemplate, err := tmpl.Parse(songInfoTemplateString)
-	if err != nil {
-		ui.logger.PrintError("createQueuePage", err)
-	}
 	queuePage := QueuePage{
-		ui:               ui,
-		logger:           ui.logger,
-		songInfoTemplate: songInfoTemplate,
+		ui:          ui,
+		logger:      ui.logger,
+		marked:      make(map[int]string),
+		visualStart: -1,
 	}
 
 	// main table
 	queuePage.queueList = tview.NewTable().
-		SetSelectable(true, false). // rows selectable
-		SetSelectedStyle(tcell.StyleDefault.Background(tcell.ColorLightGray).Foreground(tcell.ColorBlack))
+		SetSelectable(true, false) // rows selectable
+	ui.theme.styleTable(queuePage.queueList)
 	queuePage.queueList.Box.
 		SetTitle(" queue ").
 		SetTitleAlign(tview.AlignLeft).
 		SetBorder(true)
-	queuePage.queueList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if event.Key() == tcell.KeyDelete || event.Rune() == 'd' {
-			queuePage.handleDeleteFromQueue()
+	k := ui.keybindings
+	k.Handle(ContextQueue, "deleteSelectedTrack", queuePage.handleDeleteFromQueue)
+	k.Handle(ContextQueue, "toggleStar", queuePage.handleToggleStar)
+	k.Handle(ContextQueue, "moveDown", queuePage.moveSongDown)
+	k.Handle(ContextQueue, "moveUp", queuePage.moveSongUp)
+	k.Handle(ContextQueue, "toggleMark", queuePage.toggleMark)
+	k.Handle(ContextQueue, "toggleVisual", queuePage.toggleVisual)
+	k.Handle(ContextQueue, "clearMarks", func() {
+		queuePage.clearMarks()
+		queuePage.updateQueue()
+	})
+	k.Handle(ContextQueue, "playSelected", queuePage.playSelected)
+	k.Handle(ContextQueue, "playNext", queuePage.playNext)
+	k.Handle(ContextQueue, "toggleStopAfter", queuePage.toggleStopAfter)
+	k.Handle(ContextQueue, "addToPlaylist", func() {
+		ui.showAddToPlaylist(PageQueue, queuePage.queueList, queuePage.addToPlaylist)
+	})
+	k.Handle(ContextQueue, "savePlaylist", func() {
+		// FIXME (B) verify saving works -- it doesn't look like it's working properly. Gonic: "subsonic error code 50: you aren't allowed update that user's playlist"
+		if len(queuePage.queueData.playerQueue) == 0 {
+			queuePage.logger.Print("no items in queue to save")
+			return
+		}
+		queuePage.ui.ShowSelectPlaylist()
+	})
+	k.Handle(ContextQueue, "shuffle", queuePage.shuffle)
+	k.Handle(ContextQueue, "undo", func() {
+		queuePage.undoRedo("undo", ui.playback.UndoQueue)
+	})
+	k.Handle(ContextQueue, "redo", func() {
+		queuePage.undoRedo("redo", ui.playback.RedoQueue)
+	})
+	k.Handle(ContextQueue, "loadQueue", queuePage.loadPlayQueue)
+	k.Handle(ContextQueue, "toggleInfo", func() {
+		if queuePage.Root.GetItemCount() == 2 {
+			queuePage.Root.RemoveItem(queuePage.infoFlex)
 		} else {
-			switch event.Rune() {
-			case 'y':
-				queuePage.handleToggleStar()
-			case 'j':
-				queuePage.moveSongDown()
-			case 'k':
-				queuePage.moveSongUp()
-			case 's':
-				// FIXME (B) verify saving works -- it doesn't look like it's working properly. Gonic: "subsonic error code 50: you aren't allowed update that user's playlist"
-				if len(queuePage.queueData.playerQueue) == 0 {
-					queuePage.logger.Print("no items in queue to save")
-					return nil
-				}
-				queuePage.ui.ShowSelectPlaylist()
-			case 'S':
-				queuePage.shuffle()
-			case 'l':
-				go func() {
-					playQueue, err := queuePage.ui.connection.LoadPlayQueue()
-					if err != nil {
-						queuePage.logger.Printf("unable to load play queue from server: %s", err)
-						return
-					}
-					queuePage.queueList.Clear()
-					queuePage.queueData.Clear()
-					if playQueue.Entries != nil {
-						for _, ent := range playQueue.Entries {
-							ui.addSongToQueue(ent)
-						}
-						ui.queuePage.UpdateQueue()
-						if err := ui.player.Play(); err != nil {
-							queuePage.logger.Printf("error playing: %s", err)
-						}
-						_ = ui.player.Pause()
-						for {
-							if seekable, err := ui.player.IsSeekable(); err == nil && seekable {
-								break
-							}
-							time.Sleep(100 * time.Millisecond)
-						}
-						if err = ui.player.Seek(playQueue.Position); err != nil {
-							queuePage.logger.Printf("unable to seek to position %s: %s", time.Duration(playQueue.Position)*time.Second, err)
-						}
-					}
-				}()
-			case 'i':
-				if queuePage.Root.GetItemCount() == 2 {
-					queuePage.Root.RemoveItem(queuePage.infoFlex)
-				} else {
-					queuePage.Root.AddItem(queuePage.infoFlex, 0, 1, false)
-				}
-			default:
-				return event
-			}
+			queuePage.Root.AddItem(queuePage.infoFlex, 0, 1, false)
 		}
-
-		return nil
 	})
+	queuePage.queueList.SetInputCapture(k.Capture(ContextQueue))
 
 	// Song info
 	queuePage.songInfo = tview.NewTextView()
@@ -179,7 +159,12 @@ func (ui *Ui) createQueuePage() *QueuePage {
 		queuePage.lyrics.SetBorderPadding(1, 1, 1, 1)
 	}
 
-	queuePage.queueList.SetSelectionChangedFunc(queuePage.changeSelection)
+	queuePage.queueList.SetSelectionChangedFunc(func(row, column int) {
+		queuePage.changeSelection(row, column)
+		if queuePage.visualStart >= 0 {
+			queuePage.updateTitle()
+		}
+	})
 
 	queuePage.coverArt = tview.NewImage()
 	queuePage.coverArt.SetImage(STMPS_LOGO)
@@ -199,8 +184,17 @@ func (ui *Ui) createQueuePage() *QueuePage {
 		AddItem(queuePage.infoFlex, 0, 1, false)
 
 	// private data
+	columns, err := parseQueueColumns(viper.GetStringSlice("queue.columns"))
+	if err != nil {
+		ui.logger.PrintError("queue.columns", err)
+		// only the columns that are fine were parsed; fall back to all defaults
+		columns, _ = parseQueueColumns(nil)
+	}
 	queuePage.queueData = queueData{
 		starIdList: ui.starIdList,
+		theme:      ui.theme,
+		columns:    columns,
+		isMarked:   queuePage.isMarked,
 	}
 
 	coverArtLru := NewLRU(100)
@@ -290,7 +284,11 @@ func (q *QueuePage) changeSelection(row, column int) {
 	if len(lyrics) > 0 {
 		q.currentLyrics = lyrics[0]
 	}
-	_ = q.songInfoTemplate.Execute(q.songInfo, currentSong)
+	data := q.ui.statusData()
+	data.QueueItem = currentSong
+	data.Position = 0
+	data.Duration = int64(currentSong.Duration)
+	q.songInfo.SetText(q.ui.templates.render(templateSongInfo, data))
 }
 
 func (q *QueuePage) UpdateQueue() {
@@ -306,50 +304,171 @@ func (q *QueuePage) getSelectedItem() (index int, err error) {
 	return
 }
 
+// isMarked returns whether the song at row is marked, or in the range that's
+// being selected
+func (q *QueuePage) isMarked(row int) bool {
+	if _, marked := q.marked[row]; marked {
+		return true
+	}
+	if q.visualStart < 0 {
+		return false
+	}
+	current, _ := q.queueList.GetSelection()
+	return row >= min(q.visualStart, current) && row <= max(q.visualStart, current)
+}
+
+// hasMarks returns whether songs are marked, or a range is being selected
+func (q *QueuePage) hasMarks() bool {
+	return len(q.marked) > 0 || q.visualStart >= 0
+}
+
+// selection returns the sorted indexes of the songs that queue actions apply
+// to: the marked ones, or else the selected one
+func (q *QueuePage) selection() (indexes []int) {
+	if q.hasMarks() {
+		for row := range q.queueData.playerQueue {
+			if q.isMarked(row) {
+				indexes = append(indexes, row)
+			}
+		}
+		return
+	}
+	if index, err := q.getSelectedItem(); err == nil && index < len(q.queueData.playerQueue) {
+		indexes = []int{index}
+	}
+	return
+}
+
+func (q *QueuePage) clearMarks() {
+	clear(q.marked)
+	q.visualStart = -1
+}
+
+// markRange marks the songs from index first to last
+func (q *QueuePage) markRange(first, last int) {
+	for row := first; row <= last && row < len(q.queueData.playerQueue); row++ {
+		q.marked[row] = q.queueData.playerQueue[row].Id
+	}
+}
+
+// toggleMark marks or unmarks the selected song, and goes to the next one
+func (q *QueuePage) toggleMark() {
+	index, err := q.getSelectedItem()
+	if err != nil || index >= len(q.queueData.playerQueue) {
+		return
+	}
+	if _, marked := q.marked[index]; marked {
+		delete(q.marked, index)
+	} else {
+		q.markRange(index, index)
+	}
+	if index+1 < len(q.queueData.playerQueue) {
+		q.queueList.Select(index+1, 0)
+	}
+	q.updateTitle()
+}
+
+// toggleVisual starts selecting a range at the selected song, or ends it and
+// keeps the range marked
+func (q *QueuePage) toggleVisual() {
+	index, err := q.getSelectedItem()
+	if err != nil || index >= len(q.queueData.playerQueue) {
+		return
+	}
+	if q.visualStart < 0 {
+		q.visualStart = index
+	} else {
+		q.markRange(min(q.visualStart, index), max(q.visualStart, index))
+		q.visualStart = -1
+	}
+	q.updateTitle()
+}
+
+func (q *QueuePage) updateTitle() {
+	if q.hasMarks() {
+		q.queueList.Box.SetTitle(fmt.Sprintf(" queue (%d, %d selected) ", q.queueList.GetRowCount(), len(q.selection())))
+	} else {
+		q.queueList.Box.SetTitle(fmt.Sprintf(" queue (%d) ", q.queueList.GetRowCount()))
+	}
+}
+
 // button handler
 func (q *QueuePage) handleDeleteFromQueue() {
-	currentIndex, err := q.getSelectedItem()
-	if err != nil {
+	indexes := q.selection()
+	if len(indexes) == 0 {
 		return
 	}
 
-	// remove the item from the queue
-	q.ui.player.DeleteQueueItem(currentIndex)
+	// remove the items from the queue
+	if err := q.ui.playback.DeleteQueueItems(indexes); err != nil {
+		q.logger.PrintError("handleDeleteFromQueue", err)
+	}
+	q.clearMarks()
 	q.updateQueue()
 }
 
-// button handler
+// button handler; marks the selected songs to stop playback after them, or
+// unmarks them if they all are marked
+func (q *QueuePage) toggleStopAfter() {
+	indexes := q.selection()
+	if len(indexes) == 0 {
+		return
+	}
+	stop := false
+	for _, index := range indexes {
+		if !q.queueData.playerQueue[index].StopAfter {
+			stop = true
+		}
+	}
+	for _, index := range indexes {
+		if err := q.ui.playback.SetStopAfter(index, stop); err != nil {
+			q.logger.PrintError("toggleStopAfter", err)
+			return
+		}
+	}
+	q.updateQueue()
+}
+
+// button handler; stars the selected songs, or unstars them if they all are
+// starred
 func (q *QueuePage) handleToggleStar() {
 	starIdList := q.queueData.starIdList
 
-	currentIndex, err := q.getSelectedItem()
-	if err != nil {
-		q.logger.PrintError("handleToggleStar", err)
+	indexes := q.selection()
+	if len(indexes) == 0 {
+		q.logger.PrintError("handleToggleStar", errors.New("invalid queue entry"))
 		return
 	}
 
-	entity, err := q.ui.player.GetQueueItem(currentIndex)
-	if err != nil {
-		q.logger.PrintError("handleToggleStar", err)
-		return
+	var ids []string
+	unstar := true
+	for _, index := range indexes {
+		id := q.queueData.playerQueue[index].Id
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+		if _, starred := starIdList[id]; !starred {
+			unstar = false
+		}
 	}
 
-	// If the song is already in the star list, remove it
-	_, remove := starIdList[entity.Id]
+	for _, id := range ids {
+		if _, starred := starIdList[id]; starred != unstar {
+			continue
+		}
 
-	// update on server
-	if _, err = q.ui.connection.ToggleStar(entity.Id, starIdList); err != nil {
-		q.ui.showMessageBox("ToggleStar failed")
-		return // fail, assume not toggled
-	}
+		// update on server
+		if _, err := q.ui.connection.ToggleStar(id, starIdList); err != nil {
+			q.ui.showMessageBox("ToggleStar failed")
+			break // fail, assume not toggled
+		}
 
-	if remove {
-		delete(starIdList, entity.Id)
-	} else {
-		starIdList[entity.Id] = struct{}{}
+		if unstar {
+			delete(starIdList, id)
+		} else {
+			starIdList[id] = struct{}{}
+		}
 	}
-
-	q.ui.browserPage.UpdateStars()
 }
 
 // re-read queue data from mpvplayer which is the authoritative source for the queue
@@ -357,77 +476,128 @@ func (q *QueuePage) updateQueue() {
 	queueWasEmpty := len(q.queueData.playerQueue) == 0
 
 	// tell tview table to update its data
-	q.queueData.playerQueue = q.ui.player.GetQueueCopy()
+	q.queueData.playerQueue = q.ui.playback.GetQueueCopy()
 	q.queueList.SetContent(&q.queueData)
 
+	// drop the marks of songs that aren't where they were anymore
+	for index, id := range q.marked {
+		if index >= len(q.queueData.playerQueue) || q.queueData.playerQueue[index].Id != id {
+			delete(q.marked, index)
+		}
+	}
+	if q.visualStart >= len(q.queueData.playerQueue) {
+		q.visualStart = -1
+	}
+
 	// by default we're scrolled down after initially adding rows, fix this
 	if queueWasEmpty {
 		q.queueList.ScrollToBeginning()
 	}
 
-	q.queueList.Box.SetTitle(fmt.Sprintf(" queue (%d) ", q.queueList.GetRowCount()))
+	q.updateTitle()
 	r, c := q.queueList.GetSelection()
 	q.changeSelection(r, c)
+	q.ui.updateStatusBar()
 }
 
-// moveSongUp moves the currently selected song up in the queue
-// If the selected song isn't the third or higher, this is a NOP
-// and no error is reported.
+// moveSongUp moves the selected songs up in the queue, as a block. If the
+// first of them is at the top already, this is a NOP and no error is reported.
 func (q *QueuePage) moveSongUp() {
-	if len(q.queueData.playerQueue) == 0 {
+	indexes := q.selection()
+	if len(indexes) == 0 || indexes[0] == 0 {
 		return
 	}
+	q.moveSelection(indexes, indexes[0]-1, -1)
+}
 
-	currentIndex, column := q.queueList.GetSelection()
-	if currentIndex < 0 || column < 0 {
-		q.logger.Printf("moveSongUp: invalid selection (%d, %d)", currentIndex, column)
+// moveSongDown moves the selected songs down in the queue, as a block. If
+// the last of them is at the bottom already, this is a NOP, and no error is
+// reported.
+func (q *QueuePage) moveSongDown() {
+	indexes := q.selection()
+	if len(indexes) == 0 {
 		return
 	}
-
-	if currentIndex == 0 {
+	if indexes[len(indexes)-1] >= len(q.queueData.playerQueue)-1 {
+		q.logger.Printf("moveSongDown: can't move last song")
 		return
 	}
+	q.moveSelection(indexes, indexes[0]+1, 1)
+}
 
-	if currentIndex == 1 {
-		// An error here won't affect re-arranging the queue.
-		_ = q.ui.player.Stop()
+// moveSelection moves the songs at the indexes to index to, and the cursor by
+// offset. Marked songs stay marked.
+func (q *QueuePage) moveSelection(indexes []int, to, offset int) {
+	row, column := q.queueList.GetSelection()
+	if row < 0 || column < 0 {
+		q.logger.Printf("moveSelection: invalid selection (%d, %d)", row, column)
+		return
 	}
+	wasMarked := q.hasMarks()
 
-	// remove the item from the queue
-	q.ui.player.MoveSongUp(currentIndex)
-	q.queueList.Select(currentIndex-1, column)
+	if err := q.ui.playback.MoveQueueItems(indexes, to); err != nil {
+		q.logger.PrintError("moveSelection", err)
+		return
+	}
+	q.clearMarks()
+	q.queueList.Select(min(max(row+offset, 0), len(q.queueData.playerQueue)-1), column)
 	q.updateQueue()
+	if wasMarked {
+		q.markRange(to, to+len(indexes)-1)
+		q.updateTitle()
+	}
 }
 
-// moveSongUp moves the currently selected song up in the queue
-// If the selected song is not the second-to-the-last or lower, this is a NOP,
-// and no error is reported
-func (q *QueuePage) moveSongDown() {
-	queueLen := len(q.queueData.playerQueue)
-	if queueLen == 0 {
+// playSelected skips to the song under the cursor; the songs above it stay
+// queued after it
+func (q *QueuePage) playSelected() {
+	row, _ := q.queueList.GetSelection()
+	if row < 0 || row >= len(q.queueData.playerQueue) {
 		return
 	}
+	if err := q.ui.playback.PlayQueueItem(row); err != nil {
+		q.logger.PrintError("playSelected", err)
+	}
+	q.clearMarks()
+	q.updateQueue()
+	q.queueList.Select(0, 0)
+}
 
-	currentIndex, column := q.queueList.GetSelection()
-	if currentIndex < 0 || column < 0 {
-		q.logger.Printf("moveSongDown: invalid selection (%d, %d)", currentIndex, column)
+// playNext moves the selected songs right after the one that's playing
+func (q *QueuePage) playNext() {
+	indexes := q.selection()
+	if len(indexes) > 0 && indexes[0] == 0 {
+		// that's the one playing
+		indexes = indexes[1:]
+	}
+	if len(indexes) == 0 {
 		return
 	}
 
-	if currentIndex == 0 {
-		// An error here won't affect re-arranging the queue.
-		_ = q.ui.player.Stop()
+	if err := q.ui.playback.MoveQueueItems(indexes, 1); err != nil {
+		q.logger.PrintError("playNext", err)
 	}
+	q.clearMarks()
+	q.updateQueue()
+}
 
-	if currentIndex > queueLen-2 {
-		q.logger.Printf("moveSongDown: can't move last song")
+// addToPlaylist adds the selected songs to a playlist
+func (q *QueuePage) addToPlaylist(playlist *subsonic.Playlist) {
+	indexes := q.selection()
+	if len(indexes) == 0 {
 		return
 	}
+	songIds := make([]string, len(indexes))
+	for i, index := range indexes {
+		songIds[i] = q.queueData.playerQueue[index].Id
+	}
 
-	// remove the item from the queue
-	q.ui.player.MoveSongDown(currentIndex)
-	q.queueList.Select(currentIndex+1, column)
-	q.updateQueue()
+	if err := q.ui.connection.AddSongsToPlaylist(string(playlist.Id), songIds); err != nil {
+		q.logger.PrintError("AddSongsToPlaylist", err)
+	}
+	q.ui.playlistPage.UpdatePlaylists()
+	q.clearMarks()
+	q.updateTitle()
 }
 
 // saveQueue persists the current queue as a playlist. It presents the user
@@ -490,6 +660,38 @@ func (q *QueuePage) saveQueue(playlistName string) {
 	}
 }
 
+// loadPlayQueue replaces the queue with the one saved on the server, and
+// continues playing where it was saved
+func (q *QueuePage) loadPlayQueue() {
+	ui := q.ui
+	go func() {
+		playQueue, err := ui.connection.LoadPlayQueue()
+		if err != nil {
+			q.logger.Printf("unable to load play queue from server: %s", err)
+			return
+		}
+		q.queueList.Clear()
+		q.queueData.Clear()
+		if playQueue.Entries != nil {
+			ui.playback.AddSongs(playQueue.Entries...)
+			ui.queuePage.UpdateQueue()
+			if err := ui.playback.Play(); err != nil {
+				q.logger.Printf("error playing: %s", err)
+			}
+			_ = ui.playback.TogglePause()
+			for {
+				if seekable, err := ui.playback.IsSeekable(); err == nil && seekable {
+					break
+				}
+				time.Sleep(100 * time.Millisecond)
+			}
+			if err = ui.playback.Seek(playQueue.Position); err != nil {
+				q.logger.Printf("unable to seek to position %s: %s", time.Duration(playQueue.Position)*time.Second, err)
+			}
+		}
+	}()
+}
+
 // shuffle randomly shuffles entries in the queue, updates it, and moves
 // the selected-item to the new first entry.
 func (q *QueuePage) shuffle() {
@@ -497,61 +699,60 @@ func (q *QueuePage) shuffle() {
 		return
 	}
 
-	// An error here won't affect re-arranging the queue.
-	_ = q.ui.player.Stop()
-	q.ui.player.Shuffle()
+	if err := q.ui.playback.ShuffleQueue(); err != nil {
+		q.logger.PrintError("shuffle", err)
+	}
 
+	q.clearMarks()
 	q.queueList.Select(0, 0)
 	q.updateQueue()
 }
 
+// undoRedo undoes or redoes an edit of the queue
+func (q *QueuePage) undoRedo(what string, undoRedo func() error) {
+	if err := undoRedo(); err != nil {
+		q.logger.PrintError(what, err)
+		return
+	}
+	q.clearMarks()
+	q.updateQueue()
+}
+
 // queueData methods, used by tview to lazily render the table
 func (q *queueData) GetCell(row, column int) *tview.TableCell {
-	if row >= len(q.playerQueue) || column >= queueDataColumns || row < 0 || column < 0 {
+	if row >= len(q.playerQueue) || column >= len(q.columns) || row < 0 || column < 0 {
 		return nil
 	}
-	song := q.playerQueue[row]
+	song := &q.playerQueue[row]
+	cell := q.columns[column].cell(song)
 
-	switch column {
-	case 0: // star
-		text := " "
-		color := tcell.ColorDefault
+	if q.columns[column].name == "star" {
 		if _, starred := q.starIdList[song.Id]; starred {
-			text = starIcon
-			color = tcell.ColorRed
-		}
-		return &tview.TableCell{
-			Text:        text,
-			Color:       color,
-			Expansion:   0,
-			MaxWidth:    1,
-			Transparent: true,
-		}
-	case 1: // title
-		return &tview.TableCell{
-			Text:        tview.Escape(song.Title),
-			Expansion:   1,
-			Transparent: true,
+			cell.Text = starIcon
+			cell.Color = q.theme.Style(StyleStar).Foreground()
+		} else {
+			cell.Text = " "
 		}
-	case 2: // artist
-		return &tview.TableCell{
-			Text:        tview.Escape(song.Artist),
-			Expansion:   1,
-			Transparent: true,
+	}
+	if song.StopAfter {
+		stopAfter := q.theme.Style(StyleStopAfter)
+		if fg := stopAfter.Foreground(); fg != tcell.ColorDefault {
+			cell.Color = fg
 		}
-	case 3: // duration
-		min, sec := iSecondsToMinAndSec(song.Duration)
-		text := fmt.Sprintf("%3d:%02d", min, sec)
-		return &tview.TableCell{
-			Text:        text,
-			Align:       tview.AlignRight,
-			Expansion:   0,
-			MaxWidth:    6,
-			Transparent: true,
+		_, _, attrs := stopAfter.Tcell().Decompose()
+		cell.Attributes |= attrs
+	}
+	if q.isMarked != nil && q.isMarked(row) {
+		marked := q.theme.Style(StyleMarked)
+		cell.Transparent = false
+		cell.BackgroundColor = marked.Background()
+		if cell.Color == tcell.ColorDefault {
+			cell.Color = marked.Foreground()
 		}
+		_, _, attrs := marked.Tcell().Decompose()
+		cell.Attributes |= attrs
 	}
-
-	return nil
+	return cell
 }
 
 // Return the total number of rows in the table.
@@ -561,15 +762,8 @@ func (q *queueData) GetRowCount() int {
 
 // Return the total number of columns in the table.
 func (q *queueData) GetColumnCount() int {
-	return queueDataColumns
+	return len(q.columns)
 }
 
-var songInfoTemplateString = `[blue::b]Title:[-:-:-:-] [green::i]{{.Title}}[-:-:-:-] [yellow::i]({{formatTime .Duration}})[-:-:-:-]
-[blue::b]Artist:[-:-:-:-] [::i]{{.Artist}}[-:-:-:-]
-[blue::b]Album:[-:-:-:-] [::i]{{.GetAlbum}}[-:-:-:-]
-[blue::b]Disc:[-:-:-:-] [::i]{{.GetDiscNumber}}[-:-:-:-]  [blue::b]Track:[-:-:-:-] [::i]{{.GetTrackNumber}}[-:-:-:-]
-[blue::b]Year:[-:-:-:-] [::i]{{.GetYear}}[-:-:-:-]  [blue::b]Genre[-:-:-] [::i]{{.GetGenre}}[-:-:-:-]
-`
-
 //go:embed docs/stmps_logo.png
 var _stmps_logo []byte
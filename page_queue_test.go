@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestQueuePage(ids ...string) *QueuePage {
+	q := &QueuePage{
+		queueList:   tview.NewTable().SetSelectable(true, false),
+		marked:      make(map[int]string),
+		visualStart: -1,
+	}
+	columns, _ := parseQueueColumns([]string{"star", "title"})
+	q.queueData = queueData{
+		starIdList: map[string]struct{}{},
+		theme:      builtinThemes["default"],
+		columns:    columns,
+		isMarked:   q.isMarked,
+	}
+	for _, id := range ids {
+		q.queueData.playerQueue = append(q.queueData.playerQueue, mpvplayer.QueueItem{Id: id, Title: "song " + id})
+	}
+	q.queueList.SetContent(&q.queueData)
+	return q
+}
+
+func TestQueueSelection(t *testing.T) {
+	q := newTestQueuePage("a", "b", "c", "d", "e")
+	assert.Equal(t, []int{0}, q.selection())
+
+	// marking goes to the next song
+	q.toggleMark()
+	q.toggleMark()
+	row, _ := q.queueList.GetSelection()
+	assert.Equal(t, 2, row)
+	assert.Equal(t, []int{0, 1}, q.selection())
+
+	// unmark b
+	q.queueList.Select(1, 0)
+	q.toggleMark()
+	assert.Equal(t, []int{0}, q.selection())
+
+	// select a range from d up to b
+	q.queueList.Select(3, 0)
+	q.toggleVisual()
+	q.queueList.Select(1, 0)
+	assert.Equal(t, []int{0, 1, 2, 3}, q.selection())
+	q.toggleVisual()
+	assert.Equal(t, -1, q.visualStart)
+	assert.Equal(t, map[int]string{0: "a", 1: "b", 2: "c", 3: "d"}, q.marked)
+	q.updateTitle()
+	assert.Equal(t, " queue (5, 4 selected) ", q.queueList.GetTitle())
+
+	q.clearMarks()
+	assert.Equal(t, []int{1}, q.selection())
+	q.updateTitle()
+	assert.Equal(t, " queue (5) ", q.queueList.GetTitle())
+}
+
+func TestQueueMarkedCells(t *testing.T) {
+	q := newTestQueuePage("a", "b")
+	q.queueData.starIdList["b"] = struct{}{}
+	q.marked[1] = "b"
+
+	marked := builtinThemes["default"].Style(StyleMarked)
+	cell := q.queueData.GetCell(0, 1)
+	assert.True(t, cell.Transparent)
+	cell = q.queueData.GetCell(1, 1)
+	assert.False(t, cell.Transparent)
+	assert.Equal(t, marked.Background(), cell.BackgroundColor)
+	assert.Equal(t, marked.Foreground(), cell.Color)
+	// the star keeps its color
+	cell = q.queueData.GetCell(1, 0)
+	assert.Equal(t, builtinThemes["default"].Style(StyleStar).Foreground(), cell.Color)
+	assert.NotEqual(t, tcell.ColorDefault, cell.BackgroundColor)
+}
@@ -21,15 +21,17 @@ type SearchPage struct {
 
 	columnsFlex *tview.Flex
 
-	artistList  *tview.List
-	albumList   *tview.List
-	songList    *tview.List
+	artistList  *ListWidget
+	albumList   *ListWidget
+	songList    *ListWidget
 	searchField *tview.InputField
 	queryGenre  bool
 
 	artists []subsonic.Artist
 	albums  []subsonic.Album
 	songs   []subsonic.Entity
+	// genres are shown in the album list while browsing genres
+	genres []string
 
 	// external refs
 	ui     *Ui
@@ -43,37 +45,39 @@ func (ui *Ui) createSearchPage() *SearchPage {
 	}
 
 	// artist list
-	searchPage.artistList = tview.NewList().
-		ShowSecondaryText(false)
-	searchPage.artistList.Box.
-		SetTitle(" artist matches ").
-		SetTitleAlign(tview.AlignLeft).
-		SetBorder(true)
-
-	// album list
-	searchPage.albumList = tview.NewList().
-		ShowSecondaryText(false)
-	searchPage.albumList.Box.
-		SetTitle(" album matches ").
-		SetTitleAlign(tview.AlignLeft).
-		SetBorder(true)
+	searchPage.artistList = newListWidget(ui.theme, " artist matches ",
+		func() int { return len(searchPage.artists) },
+		func(i int) string { return tview.Escape(searchPage.artists[i].Name) })
+
+	// album list, or genre list
+	searchPage.albumList = newListWidget(ui.theme, " album matches ",
+		func() int {
+			if searchPage.queryGenre {
+				return len(searchPage.genres)
+			}
+			return len(searchPage.albums)
+		},
+		func(i int) string {
+			if searchPage.queryGenre {
+				return tview.Escape(searchPage.genres[i])
+			}
+			return tview.Escape(searchPage.albums[i].Name)
+		})
 
 	// song list
-	searchPage.songList = tview.NewList().
-		ShowSecondaryText(false)
-	searchPage.songList.Box.
-		SetTitle(" song matches ").
-		SetTitleAlign(tview.AlignLeft).
-		SetBorder(true)
+	searchPage.songList = newListWidget(ui.theme, " song matches ",
+		func() int { return len(searchPage.songs) },
+		func(i int) string { return tview.Escape(searchPage.songs[i].Title) })
 
 	// search bar
 	searchPage.searchField = tview.NewInputField().
 		SetLabel("search:").
-		SetFieldBackgroundColor(tcell.ColorBlack).
 		SetDoneFunc(func(key tcell.Key) {
 			searchPage.aproposFocus()
 		})
 
+	ui.theme.styleField(searchPage.searchField)
+
 	searchPage.columnsFlex = tview.NewFlex().SetDirection(tview.FlexColumn).
 		AddItem(searchPage.artistList, 0, 1, true).
 		AddItem(searchPage.albumList, 0, 1, false).
@@ -83,209 +87,62 @@ func (ui *Ui) createSearchPage() *SearchPage {
 		AddItem(searchPage.columnsFlex, 0, 1, true).
 		AddItem(searchPage.searchField, 1, 1, false)
 
-	// TODO (C) add filter/search to all of the results columns
-	// TODO (D) browsing genres should autoload the genres, rather than waiting for Enter
-	searchPage.artistList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		switch event.Key() {
-		case tcell.KeyLeft:
-			ui.app.SetFocus(searchPage.songList)
-			return nil
-		case tcell.KeyRight:
-			ui.app.SetFocus(searchPage.albumList)
-			return nil
-		case tcell.KeyEnter:
-			if len(searchPage.artists) != 0 {
-				idx := searchPage.artistList.GetCurrentItem()
-				searchPage.addArtistToQueue(searchPage.artists[idx])
-				return nil
-			}
-			return event
-		}
-
-		switch event.Rune() {
-		case 'a':
+	search := make(chan string, 5)
+	k := ui.keybindings
+	k.Handle(ContextSearch, "focusPrevious", func() { searchPage.focusColumn(-1) })
+	k.Handle(ContextSearch, "focusNext", func() { searchPage.focusColumn(1) })
+	k.Handle(ContextSearch, "select", func() {
+		switch ui.app.GetFocus() {
+		case searchPage.artistList:
 			idx := searchPage.artistList.GetCurrentItem()
-			if idx >= 0 && searchPage.artistList.GetItemCount() > 0 {
-				if idx < len(searchPage.artists) {
-					searchPage.addArtistToQueue(searchPage.artists[idx])
-					idx++
-					if idx < searchPage.artistList.GetItemCount() {
-						searchPage.artistList.SetCurrentItem(idx)
-					}
-					return nil
-				}
-				searchPage.logger.Printf("error: searchPage.artistList event selected index %d > %d artists, which shouldn't be possible", idx, len(searchPage.artists))
+			if idx >= 0 && idx < len(searchPage.artists) {
+				ui.queueSongs(searchPage.artistSongs(searchPage.artists[idx])...)
 			}
-			return event
-		case '/':
-			searchPage.searchField.SetLabel("search:")
-			searchPage.ui.app.SetFocus(searchPage.searchField)
-			return nil
-		case 'g':
-			searchPage.albumList.Clear()
-			searchPage.artistList.Clear()
-			searchPage.songList.Clear()
-			if searchPage.queryGenre {
-				searchPage.albumList.SetTitle(" album matches ")
-			} else {
-				searchPage.populateGenres()
-				searchPage.albumList.SetTitle(fmt.Sprintf(" genres (%d) ", searchPage.albumList.GetItemCount()))
-				searchPage.ui.app.SetFocus(searchPage.albumList)
-			}
-			searchPage.queryGenre = !searchPage.queryGenre
-			return nil
-		}
-
-		return event
-	})
-	search := make(chan string, 5)
-	searchPage.albumList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		switch event.Key() {
-		case tcell.KeyLeft:
-			ui.app.SetFocus(searchPage.artistList)
-			return nil
-		case tcell.KeyRight:
-			ui.app.SetFocus(searchPage.songList)
-			return nil
-		case tcell.KeyEnter:
+		case searchPage.albumList:
 			if !searchPage.queryGenre {
 				idx := searchPage.albumList.GetCurrentItem()
 				if idx >= 0 && idx < len(searchPage.albums) {
-					searchPage.addAlbumToQueue(searchPage.albums[idx])
-					return nil
+					ui.queueSongs(ui.albumSongs(searchPage.albums[idx])...)
 				}
-				return event
-			} else {
-				search <- ""
-				searchPage.artistList.Clear()
-				searchPage.artists = make([]subsonic.Artist, 0)
-				searchPage.songList.Clear()
-				searchPage.songs = make([]subsonic.Entity, 0)
-
-				idx := searchPage.albumList.GetCurrentItem()
-				// searchPage.logger.Printf("current item index = %d; albumList len = %d", idx, searchPage.albumList.GetItemCount())
-				queryStr, _ := searchPage.albumList.GetItemText(idx)
-				search <- queryStr
-				return nil
+				return
 			}
-		}
-
-		switch event.Rune() {
-		case 'a':
 			idx := searchPage.albumList.GetCurrentItem()
-			if idx < 0 || searchPage.albumList.GetItemCount() == 0 {
-				return event
-			}
-
-			if searchPage.queryGenre {
-				// Handle the search-by-genre case
-				if idx >= searchPage.albumList.GetItemCount() {
-					searchPage.logger.Printf("error: searchPage.albumList event selected index %d > %d genres, which shouldn't be possible", idx, searchPage.albumList.GetItemCount())
-					return event
-				}
-				genre, _ := searchPage.albumList.GetItemText(idx)
-				searchPage.addGenreToQueue(genre)
-			} else {
-				// Handle the search-by-match case
-				if idx >= len(searchPage.albums) {
-					searchPage.logger.Printf("error: searchPage.albumList event selected index %d > %d albums, which shouldn't be possible", idx, len(searchPage.albums))
-					return event
-				}
-				searchPage.addAlbumToQueue(searchPage.albums[idx])
-			}
-
-			idx++
-			if idx < searchPage.albumList.GetItemCount() {
-				searchPage.albumList.SetCurrentItem(idx)
-			}
-			return nil
-		case '/':
-			searchPage.ui.app.SetFocus(searchPage.searchField)
-			return nil
-		case 'g':
-			searchPage.albumList.Clear()
-			searchPage.artistList.Clear()
-			searchPage.songList.Clear()
-			if searchPage.queryGenre {
-				searchPage.albumList.SetTitle(" album matches ")
-			} else {
-				searchPage.populateGenres()
-				searchPage.albumList.SetTitle(fmt.Sprintf(" genres (%d) ", searchPage.albumList.GetItemCount()))
-				searchPage.ui.app.SetFocus(searchPage.albumList)
-			}
-			searchPage.queryGenre = !searchPage.queryGenre
-			return nil
-		}
-
-		return event
-	})
-	searchPage.songList.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		switch event.Key() {
-		case tcell.KeyLeft:
-			ui.app.SetFocus(searchPage.albumList)
-			return nil
-		case tcell.KeyRight:
-			ui.app.SetFocus(searchPage.artistList)
-			return nil
-		case tcell.KeyEnter:
-			if len(searchPage.artists) != 0 {
-				idx := searchPage.songList.GetCurrentItem()
-				ui.addSongToQueue(searchPage.songs[idx])
-				ui.queuePage.UpdateQueue()
-				return nil
+			if idx >= len(searchPage.genres) {
+				return
 			}
-			return event
-		}
-
-		switch event.Rune() {
-		case 'a':
+			search <- ""
+			searchPage.clearResults(false)
+			search <- searchPage.genres[idx]
+		case searchPage.songList:
 			idx := searchPage.songList.GetCurrentItem()
-			if idx >= 0 && searchPage.songList.GetItemCount() > 0 {
-				if idx < len(searchPage.songs) {
-					ui.addSongToQueue(searchPage.songs[idx])
-					idx++
-					if idx < searchPage.songList.GetItemCount() {
-						searchPage.songList.SetCurrentItem(idx)
-					}
-					ui.queuePage.updateQueue()
-					return nil
-				}
-				searchPage.logger.Printf("error: searchPage.songList event selected index %d > %d songs, which shouldn't be possible", idx, len(searchPage.songs))
+			if idx >= 0 && idx < len(searchPage.songs) {
+				ui.queueSongs(searchPage.songs[idx])
 			}
-			return event
-		case '/':
-			searchPage.ui.app.SetFocus(searchPage.searchField)
-			return nil
-		case 'g':
-			searchPage.albumList.Clear()
-			searchPage.artistList.Clear()
-			searchPage.songList.Clear()
-			if searchPage.queryGenre {
-				searchPage.albumList.SetTitle(" album matches ")
-			} else {
-				searchPage.populateGenres()
-				searchPage.albumList.SetTitle(fmt.Sprintf(" genres (%d) ", searchPage.albumList.GetItemCount()))
-				searchPage.ui.app.SetFocus(searchPage.albumList)
-			}
-			searchPage.queryGenre = !searchPage.queryGenre
-			return nil
 		}
-
-		return event
 	})
+	k.Handle(ContextSearch, "addToQueue", func() {
+		searchPage.addSelectedTo(ui.queueSongs)
+	})
+	k.Handle(ContextSearch, "playNext", func() {
+		searchPage.addSelectedTo(ui.queueSongsNext)
+	})
+	k.Handle(ContextSearch, "toggleGenres", searchPage.toggleGenres)
+	k.Handle(ContextSearch, "search", func() {
+		searchPage.searchField.SetLabel("search:")
+		ui.app.SetFocus(searchPage.searchField)
+	})
+	// TODO (C) add filter/search to all of the results columns
+	// TODO (D) browsing genres should autoload the genres, rather than waiting for Enter
+	searchPage.artistList.SetInputCapture(k.Capture(ContextSearch))
+	searchPage.albumList.SetInputCapture(k.Capture(ContextSearch))
+	searchPage.songList.SetInputCapture(k.Capture(ContextSearch))
 	searchPage.searchField.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		switch event.Key() {
 		case tcell.KeyUp, tcell.KeyESC:
 			searchPage.aproposFocus()
 		case tcell.KeyEnter:
 			search <- ""
-			searchPage.artistList.Clear()
-			if !searchPage.queryGenre {
-				searchPage.albumList.Clear()
-				searchPage.albums = make([]subsonic.Album, 0)
-			}
-			searchPage.songList.Clear()
-			searchPage.songs = make([]subsonic.Entity, 0)
+			searchPage.clearResults(!searchPage.queryGenre)
 
 			queryStr := searchPage.searchField.GetText()
 			search <- queryStr
@@ -300,6 +157,86 @@ func (ui *Ui) createSearchPage() *SearchPage {
 	return &searchPage
 }
 
+// clearResults empties the artist and song lists, and with albums the album
+// list
+func (s *SearchPage) clearResults(albums bool) {
+	s.artists = s.artists[:0]
+	s.artistList.Reset()
+	if albums {
+		s.albums = s.albums[:0]
+		s.albumList.Reset()
+	}
+	s.songs = s.songs[:0]
+	s.songList.Reset()
+}
+
+// focusColumn moves the focus to the next (1) or previous (-1) column
+func (s *SearchPage) focusColumn(direction int) {
+	columns := []*ListWidget{s.artistList, s.albumList, s.songList}
+	for i, column := range columns {
+		if column.HasFocus() {
+			s.ui.app.SetFocus(columns[(i+direction+len(columns))%len(columns)])
+			return
+		}
+	}
+}
+
+// addSelectedTo calls add once with the songs of the selected artist, album,
+// genre, or song, and selects the next one
+func (s *SearchPage) addSelectedTo(add func(songs ...subsonic.Entity)) {
+	var list *ListWidget
+	switch s.ui.app.GetFocus() {
+	case s.artistList:
+		list = s.artistList
+		idx := list.GetCurrentItem()
+		if idx < 0 || idx >= len(s.artists) {
+			return
+		}
+		add(s.artistSongs(s.artists[idx])...)
+	case s.albumList:
+		list = s.albumList
+		idx := list.GetCurrentItem()
+		if s.queryGenre {
+			if idx < 0 || idx >= len(s.genres) {
+				return
+			}
+			add(s.genreSongs(s.genres[idx])...)
+		} else {
+			if idx < 0 || idx >= len(s.albums) {
+				return
+			}
+			add(s.ui.albumSongs(s.albums[idx])...)
+		}
+	case s.songList:
+		list = s.songList
+		idx := list.GetCurrentItem()
+		if idx < 0 || idx >= len(s.songs) {
+			return
+		}
+		add(s.songs[idx])
+	default:
+		return
+	}
+
+	if idx := list.GetCurrentItem() + 1; idx < list.GetItemCount() {
+		list.SetCurrentItem(idx)
+	}
+}
+
+// toggleGenres switches between searching by name and browsing genres
+func (s *SearchPage) toggleGenres() {
+	s.clearResults(true)
+	s.genres = nil
+	s.queryGenre = !s.queryGenre
+	if !s.queryGenre {
+		s.albumList.SetTitle(" album matches ")
+	} else {
+		s.populateGenres()
+		s.albumList.SetTitle(fmt.Sprintf(" genres (%d) ", len(s.genres)))
+		s.ui.app.SetFocus(s.albumList)
+	}
+}
+
 func (s *SearchPage) search(search chan string) {
 	var query string
 	var artOff, albOff, songOff int
@@ -334,10 +271,7 @@ func (s *SearchPage) search(search chan string) {
 				if songOff == 0 {
 					s.artistList.Box.SetTitle(" artist matches ")
 				}
-				for _, song := range songs {
-					s.songList.AddItem(tview.Escape(song.Title), "", 0, nil)
-					s.songs = append(s.songs, song)
-				}
+				s.songs = append(s.songs, songs...)
 				s.songList.Box.SetTitle(fmt.Sprintf(" genre song matches (%d) ", len(s.songs)))
 				songOff += len(songs)
 				more <- struct{}{}
@@ -360,21 +294,18 @@ func (s *SearchPage) search(search chan string) {
 				query = strings.ToLower(query)
 				for _, artist := range results.Artists {
 					if strings.Contains(strings.ToLower(artist.Name), query) {
-						s.artistList.AddItem(tview.Escape(artist.Name), "", 0, nil)
 						s.artists = append(s.artists, artist)
 					}
 				}
 				s.artistList.Box.SetTitle(fmt.Sprintf(" artist matches (%d) ", len(s.artists)))
 				for _, album := range results.Albums {
 					if strings.Contains(strings.ToLower(album.Name), query) {
-						s.albumList.AddItem(tview.Escape(album.Name), "", 0, nil)
 						s.albums = append(s.albums, album)
 					}
 				}
 				s.albumList.Box.SetTitle(fmt.Sprintf(" album matches (%d) ", len(s.albums)))
 				for _, song := range results.Songs {
 					if strings.Contains(strings.ToLower(song.Title), query) {
-						s.songList.AddItem(tview.Escape(song.Title), "", 0, nil)
 						s.songs = append(s.songs, song)
 					}
 				}
@@ -393,32 +324,29 @@ func (s *SearchPage) search(search chan string) {
 	}
 }
 
-// addGenreToQueue adds all songs tagged with the genre, by genre name, to the queue.
+// genreSongs returns all songs tagged with the genre, by genre name.
 // The genre name is e.g. "Rock", "folk", "acid rock", etc.
-func (s *SearchPage) addGenreToQueue(query string) {
-	var songOff int
+func (s *SearchPage) genreSongs(query string) (genreSongs []subsonic.Entity) {
 	for {
-		songs, err := s.ui.connection.GetSongsByGenre(query, songOff, "")
+		songs, err := s.ui.connection.GetSongsByGenre(query, len(genreSongs), "")
 		if err != nil {
-			s.logger.PrintError("SearchPage.addGenreToQueue", err)
+			s.logger.PrintError("SearchPage.genreSongs", err)
 			return
 		}
 		if len(songs) == 0 {
 			break
 		}
-		for _, song := range songs {
-			s.ui.addSongToQueue(song)
-		}
-		songOff += len(songs)
+		genreSongs = append(genreSongs, songs...)
 	}
-	s.logger.Printf("added a total of %d songs to the queue for %q", songOff, query)
-	s.ui.queuePage.UpdateQueue()
+	s.logger.Printf("found a total of %d songs for %q", len(genreSongs), query)
+	return
 }
 
-func (s *SearchPage) addArtistToQueue(entity subsonic.Ider) {
+// artistSongs returns the songs of an artist, from all of their albums
+func (s *SearchPage) artistSongs(entity subsonic.Ider) (artistSongs []subsonic.Entity) {
 	artist, err := s.ui.connection.GetArtist(entity.ID())
 	if err != nil {
-		s.logger.Printf("addArtistToQueue: GetArtist %s -- %s", entity.ID(), err.Error())
+		s.logger.Printf("artistSongs: GetArtist %s -- %s", entity.ID(), err.Error())
 		return
 	}
 
@@ -440,32 +368,18 @@ func (s *SearchPage) addArtistToQueue(entity subsonic.Ider) {
 			// respond with a list of artists. If either the Artist field matches,
 			// or the artist name is in a list of artists, then we add the song.
 			if e.ArtistId == artistId {
-				s.ui.addSongToQueue(e)
+				artistSongs = append(artistSongs, e)
 				continue
 			}
 			for _, art := range e.Artists {
 				if art.Id == artistId {
-					s.ui.addSongToQueue(e)
+					artistSongs = append(artistSongs, e)
 					break
 				}
 			}
 		}
 	}
-
-	s.ui.queuePage.UpdateQueue()
-}
-
-func (s *SearchPage) addAlbumToQueue(entity subsonic.Ider) {
-	response, err := s.ui.connection.GetAlbum(entity.ID())
-	if err != nil {
-		s.logger.Printf("addToQueue: GetMusicDirectory %s -- %s", entity.ID(), err.Error())
-		return
-	}
-	sort.Sort(response.Songs)
-	for _, e := range response.Songs {
-		s.ui.addSongToQueue(e)
-	}
-	s.ui.queuePage.UpdateQueue()
+	return
 }
 
 func (s *SearchPage) aproposFocus() {
@@ -494,6 +408,6 @@ func (s *SearchPage) populateGenres() {
 		return strings.Compare(a.Name, b.Name)
 	})
 	for _, entry := range genres {
-		s.albumList.AddItem(tview.Escape(entry.Name), "", 0, nil)
+		s.genres = append(s.genres, entry.Name)
 	}
 }
@@ -0,0 +1,251 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rivo/tview"
+	"github.com/spezifisch/stmps/history"
+	"github.com/spezifisch/stmps/logger"
+	"github.com/spezifisch/stmps/subsonic"
+	"github.com/spf13/viper"
+)
+
+// statsTopCount is how many entries the top lists show
+const statsTopCount = 100
+
+// StatsPage shows statistics of the local listening history
+type StatsPage struct {
+	Root *tview.Flex
+
+	summary     *tview.TextView
+	artistTable *tview.Table
+	albumTable  *tview.Table
+	trackTable  *tview.Table
+	tables      []*tview.Table
+
+	// what's shown: the period of the given kind that's offset periods before
+	// the current one
+	period history.Period
+	offset int
+
+	plays []history.Play
+	stats history.Stats
+
+	// external refs
+	ui     *Ui
+	logger logger.LoggerInterface
+}
+
+func (ui *Ui) createStatsPage() *StatsPage {
+	statsPage := StatsPage{
+		ui:     ui,
+		logger: ui.logger,
+		period: history.Week,
+	}
+
+	statsPage.summary = tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(false)
+
+	newTable := func(title string) *tview.Table {
+		table := tview.NewTable().
+			SetSelectable(true, false)
+		ui.theme.styleTable(table)
+		table.Box.
+			SetTitle(title).
+			SetTitleAlign(tview.AlignLeft).
+			SetBorder(true)
+		return table
+	}
+	statsPage.artistTable = newTable(" top artists ")
+	statsPage.albumTable = newTable(" top albums ")
+	statsPage.trackTable = newTable(" top tracks ")
+	statsPage.tables = []*tview.Table{statsPage.artistTable, statsPage.albumTable, statsPage.trackTable}
+
+	tablesFlex := tview.NewFlex().SetDirection(tview.FlexColumn).
+		AddItem(statsPage.artistTable, 0, 1, true).
+		AddItem(statsPage.albumTable, 0, 1, false).
+		AddItem(statsPage.trackTable, 0, 1, false)
+
+	statsPage.Root = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(statsPage.summary, 2, 0, false).
+		AddItem(tablesFlex, 0, 1, true)
+
+	k := ui.keybindings
+	k.Handle(ContextStats, "focusNext", func() { statsPage.focusNext(1) })
+	k.Handle(ContextStats, "focusPrevious", func() { statsPage.focusNext(-1) })
+	k.Handle(ContextStats, "addToQueue", statsPage.addSelectedToQueue)
+	k.Handle(ContextStats, "week", func() { statsPage.setPeriod(history.Week) })
+	k.Handle(ContextStats, "month", func() { statsPage.setPeriod(history.Month) })
+	k.Handle(ContextStats, "year", func() { statsPage.setPeriod(history.Year) })
+	k.Handle(ContextStats, "allTime", func() { statsPage.setPeriod(history.AllTime) })
+	k.Handle(ContextStats, "previousPeriod", func() {
+		if statsPage.period != history.AllTime {
+			statsPage.offset--
+			statsPage.update()
+		}
+	})
+	k.Handle(ContextStats, "nextPeriod", func() {
+		if statsPage.offset < 0 {
+			statsPage.offset++
+			statsPage.update()
+		}
+	})
+	k.Handle(ContextStats, "refresh", statsPage.Refresh)
+	statsPage.Root.SetInputCapture(k.Capture(ContextStats))
+
+	return &statsPage
+}
+
+// Refresh reloads the history. The history is read from the file every time,
+// because with --attach, it's written by the daemon.
+func (s *StatsPage) Refresh() {
+	if !viper.GetBool("history.enable") {
+		s.summary.SetText("The listening history is disabled (history.enable).")
+		return
+	}
+	path, err := historyFile()
+	if err != nil {
+		s.logger.PrintError("StatsPage", err)
+		return
+	}
+	go func() {
+		plays, err := history.Load(path)
+		if err != nil {
+			s.logger.PrintError("StatsPage", err)
+		}
+		s.ui.app.QueueUpdateDraw(func() {
+			s.plays = plays
+			s.update()
+		})
+	}()
+}
+
+func (s *StatsPage) setPeriod(period history.Period) {
+	s.period = period
+	s.offset = 0
+	s.update()
+}
+
+func (s *StatsPage) focusNext(direction int) {
+	for i, table := range s.tables {
+		if table.HasFocus() {
+			next := (i + direction + len(s.tables)) % len(s.tables)
+			s.ui.app.SetFocus(s.tables[next])
+			return
+		}
+	}
+	s.ui.app.SetFocus(s.tables[0])
+}
+
+func (s *StatsPage) update() {
+	from, to := s.period.Range(time.Now(), s.offset)
+	s.stats = history.Compute(s.plays, from, to)
+
+	key := func(command string) string {
+		return tview.Escape(s.ui.keybindings.Key(ContextStats, command))
+	}
+	s.summary.SetText(fmt.Sprintf("[::b]%s[::-]: %d plays, %s listened, %.0f%% skipped\n"+
+		"%s%s/%s/%s/%s week/month/year/all time  %s %s previous/next  %s next list  %s add to queue",
+		statsPeriodTitle(s.period, s.offset, from, to),
+		s.stats.Plays, formatListeningTime(s.stats.Played), 100*s.stats.SkipRate(),
+		s.ui.theme.Style(StyleDim).ColorTag(), key("week"), key("month"), key("year"), key("allTime"), key("previousPeriod"), key("nextPeriod"),
+		key("focusNext"), key("addToQueue")))
+
+	fill := func(table *tview.Table, entries []history.Entry, withArtist bool) {
+		table.Clear()
+		for row, e := range entries {
+			if row == statsTopCount {
+				break
+			}
+			name := e.Name
+			if name == "" {
+				name = "(unknown)"
+			}
+			if withArtist && e.Artist != "" {
+				name += " " + s.ui.theme.Style(StyleDim).ColorTag() + "· " + tview.Escape(e.Artist)
+			}
+			table.SetCell(row, 0, tview.NewTableCell(fmt.Sprintf("%d.", row+1)).SetAlign(tview.AlignRight))
+			table.SetCell(row, 1, tview.NewTableCell(name).SetExpansion(1).SetMaxWidth(0))
+			table.SetCell(row, 2, tview.NewTableCell(fmt.Sprintf("%d", e.Plays)).SetAlign(tview.AlignRight))
+			table.SetCell(row, 3, tview.NewTableCell(fmt.Sprintf("%3.0f%%", 100*e.SkipRate())).SetAlign(tview.AlignRight))
+		}
+		table.Select(0, 0)
+		table.ScrollToBeginning()
+	}
+	fill(s.artistTable, s.stats.Artists, false)
+	fill(s.albumTable, s.stats.Albums, true)
+	fill(s.trackTable, s.stats.Tracks, true)
+}
+
+func statsPeriodTitle(period history.Period, offset int, from, to time.Time) string {
+	switch period {
+	case history.Week:
+		if offset == 0 {
+			return "This week"
+		}
+		return fmt.Sprintf("Week of %s", from.Format("2006-01-02"))
+	case history.Month:
+		if offset == 0 {
+			return "This month"
+		}
+		return from.Format("January 2006")
+	case history.Year:
+		if offset == 0 {
+			return "This year"
+		}
+		return from.Format("2006")
+	}
+	return "All time"
+}
+
+// formatListeningTime formats a duration as days, hours, and minutes
+func formatListeningTime(d time.Duration) string {
+	minutes := int(d.Minutes())
+	days, hours := minutes/(24*60), minutes/60%24
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh %dm", days, hours, minutes%60)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes%60)
+	}
+	return fmt.Sprintf("%dm", minutes)
+}
+
+// addSelectedToQueue adds the selected artist, album, or track to the queue
+func (s *StatsPage) addSelectedToQueue() {
+	for i, table := range s.tables {
+		if !table.HasFocus() {
+			continue
+		}
+		row, _ := table.GetSelection()
+		entries := [][]history.Entry{s.stats.Artists, s.stats.Albums, s.stats.Tracks}[i]
+		if row < 0 || row >= len(entries) {
+			return
+		}
+		entry := entries[row]
+		if entry.Id == "" {
+			s.logger.Printf("%q was recorded without an ID and can't be queued", entry.Name)
+			return
+		}
+
+		switch table {
+		case s.artistTable:
+			s.ui.queueSongs(s.ui.searchPage.artistSongs(subsonic.Artist{Id: entry.Id})...)
+		case s.albumTable:
+			s.ui.queueSongs(s.ui.albumSongs(subsonic.Album{EntityBase: subsonic.EntityBase{Id: entry.Id}})...)
+		case s.trackTable:
+			song, err := s.ui.connection.GetSong(entry.Id)
+			if err != nil {
+				s.logger.PrintError("StatsPage GetSong", err)
+				return
+			}
+			s.ui.queueSongs(song)
+		}
+		return
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/spezifisch/stmps/history"
+	"github.com/spezifisch/stmps/logger"
+	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spf13/viper"
+)
+
+// historyFile returns where the listening history is kept
+func historyFile() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.jsonl"), nil
+}
+
+// scrobblerLogFile returns where the .scrobbler.log is written
+// (scrobble.log.file)
+func scrobblerLogFile() (string, error) {
+	if path := viper.GetString("scrobble.log.file"); path != "" {
+		return path, nil
+	}
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, ".scrobbler.log"), nil
+}
+
+// playHistory records every play in the local listening history, and in the
+// .scrobbler.log, when it ends, i.e. when the next song starts, playback
+// stops, or stmps quits. Like the scrobbler, it's driven from the player's
+// event loop.
+type playHistory struct {
+	// either may be nil, if it's disabled
+	log          *history.Log
+	scrobblerLog *history.ScrobblerLog
+	logger       logger.LoggerInterface
+
+	// the event loop may still be running while closing
+	lock      sync.Mutex
+	closed    bool
+	song      mpvplayer.QueueItem
+	startedAt time.Time
+	clock     playClock
+}
+
+// newPlayHistory opens the history (history.enable) and the .scrobbler.log
+// (scrobble.log.enable). If neither is enabled, or can be opened, it returns
+// nil.
+func newPlayHistory(logger logger.LoggerInterface) *playHistory {
+	h := playHistory{logger: logger}
+	if viper.GetBool("history.enable") {
+		path, err := historyFile()
+		if err == nil {
+			h.log, err = history.Open(path)
+		}
+		if err != nil {
+			logger.PrintError("history", err)
+		}
+	}
+	if viper.GetBool("scrobble.log.enable") {
+		path, err := scrobblerLogFile()
+		if err == nil {
+			h.scrobblerLog, err = history.OpenScrobblerLog(path, Name+" "+Version)
+		}
+		if err != nil {
+			logger.PrintError("scrobbler log", err)
+		}
+	}
+	if h.log == nil && h.scrobblerLog == nil {
+		return nil
+	}
+	return &h
+}
+
+func (h *playHistory) songStarted(song mpvplayer.QueueItem) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.recordSong()
+	h.song = song
+	h.startedAt = time.Now()
+	h.clock = playClock{}
+}
+
+func (h *playHistory) progress(status mpvplayer.StatusData) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.song.Id != "" {
+		h.clock.update(status.Position)
+	}
+}
+
+// songEnded is called when playback stops
+func (h *playHistory) songEnded() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.recordSong()
+}
+
+// recordSong records the current play, if there is one. The lock must be held.
+func (h *playHistory) recordSong() {
+	song := h.song
+	h.song = mpvplayer.QueueItem{}
+	// closed, or not even started
+	if h.closed || song.Id == "" || h.clock.played == 0 {
+		return
+	}
+
+	skipped := h.clock.played < listenThreshold(song.Duration)
+	if h.log != nil {
+		play := history.Play{
+			Time:     h.startedAt,
+			SongId:   song.Id,
+			Title:    song.Title,
+			Artist:   song.Artist,
+			ArtistId: song.ArtistId,
+			Album:    song.Album,
+			AlbumId:  song.AlbumId,
+			Duration: song.Duration,
+			Played:   int(h.clock.played),
+			Skipped:  skipped,
+		}
+		if err := h.log.Record(play); err != nil {
+			h.logger.PrintError("history", err)
+		}
+	}
+	if h.scrobblerLog != nil {
+		entry := history.ScrobblerLogEntry{
+			Artist:        song.Artist,
+			Album:         song.Album,
+			Title:         song.Title,
+			TrackNumber:   song.TrackNumber,
+			Duration:      song.Duration,
+			Listened:      !skipped,
+			Time:          h.startedAt,
+			MusicBrainzId: song.MusicBrainzId,
+		}
+		if err := h.scrobblerLog.Record(entry); err != nil {
+			h.logger.PrintError("scrobbler log", err)
+		}
+	}
+}
+
+// Close records the current play and closes the history and the
+// .scrobbler.log
+func (h *playHistory) Close() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.recordSong()
+	h.closed = true
+	if h.log != nil {
+		if err := h.log.Close(); err != nil {
+			h.logger.PrintError("history", err)
+		}
+	}
+	if h.scrobblerLog != nil {
+		if err := h.scrobblerLog.Close(); err != nil {
+			h.logger.PrintError("scrobbler log", err)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spezifisch/stmps/remote"
+	"github.com/spezifisch/stmps/subsonic"
+)
+
+// Playback is everything the UI needs to play music and manage the queue.
+// It's implemented by the local Core, and by remotePlayback, which drives the
+// Core of a daemon through its control socket (`stmps --attach`).
+type Playback interface {
+	Play() error
+	TogglePause() error
+	Stop() error
+	NextTrack() error
+	Seek(offset int) error
+	SeekAbsolute(position int) error
+	SetVolume(percentValue int) error
+	AdjustVolume(increment int) error
+	IsSeekable() (bool, error)
+	Status() remote.Status
+
+	// GetQueueCopy returns a snapshot of the queue; the first item is the one
+	// that is playing
+	GetQueueCopy() mpvplayer.PlayerQueue
+	// AddSongs appends songs to the queue
+	AddSongs(entities ...subsonic.Entity)
+	// AddSongsNext inserts songs right after the one playing
+	AddSongsNext(entities ...subsonic.Entity)
+	// PlaySong replaces the queue with the song and plays it
+	PlaySong(entity subsonic.Entity) error
+	DeleteQueueItem(index int) error
+	MoveQueueItem(from, to int) error
+	// DeleteQueueItems removes the songs at the indexes at once
+	DeleteQueueItems(indexes []int) error
+	// MoveQueueItems moves the songs at the indexes as a block, so that the
+	// first of them ends up at index to
+	MoveQueueItems(indexes []int, to int) error
+	// PlayQueueItem skips to the song at index
+	PlayQueueItem(index int) error
+	ShuffleQueue() error
+	ClearQueue() error
+	// UndoQueue and RedoQueue undo and redo edits of the queue
+	UndoQueue() error
+	RedoQueue() error
+	// SetAutoDJ turns the auto-DJ, which keeps the queue filled, on or off
+	SetAutoDJ(enable bool) error
+	// SetSleepTimer sets or cancels the sleep timer
+	SetSleepTimer(p remote.SleepParams) error
+	// SetStopAfter marks the song at index to stop playback after it, or
+	// removes the mark
+	SetStopAfter(index int, stop bool) error
+
+	// RegisterEventConsumer adds a receiver for player events
+	RegisterEventConsumer(consumer mpvplayer.EventConsumer)
+	// OnQueueChanged sets a callback for queue changes made by someone else
+	// (e.g. a remote control client)
+	OnQueueChanged(cb func())
+	// Done is closed when playback ends for good, e.g. because a remote
+	// client told stmps to quit, or the daemon we're attached to went away
+	Done() <-chan struct{}
+}
+
+// newTrack converts a queue item for remote clients, including the fields
+// that TrackInterface doesn't cover
+func newTrack(item mpvplayer.QueueItem) remote.Track {
+	track := remote.NewTrack(item)
+	track.Year = item.Year
+	track.CoverArtId = item.CoverArtId
+	track.AlbumArtist = item.AlbumArtist
+	track.BitRate = item.BitRate
+	track.Suffix = item.Suffix
+	track.PlayCount = item.PlayCount
+	track.Rating = item.Rating
+	track.StopAfter = item.StopAfter
+	return track
+}
+
+// newQueueItem is the reverse of newTrack. The Uri is left empty; only the
+// player that has the song queued needs it.
+func newQueueItem(track remote.Track) mpvplayer.QueueItem {
+	return mpvplayer.QueueItem{
+		Id:          track.Id,
+		Title:       track.Title,
+		Artist:      track.Artist,
+		Duration:    track.Duration,
+		Album:       track.Album,
+		TrackNumber: track.TrackNumber,
+		CoverArtId:  track.CoverArtId,
+		DiscNumber:  track.DiscNumber,
+		Year:        track.Year,
+		Genre:       track.Genre,
+		AlbumArtist: track.AlbumArtist,
+		BitRate:     track.BitRate,
+		Suffix:      track.Suffix,
+		PlayCount:   track.PlayCount,
+		Rating:      track.Rating,
+		StopAfter:   track.StopAfter,
+	}
+}
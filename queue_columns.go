@@ -0,0 +1,192 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rivo/tview"
+	"github.com/spezifisch/stmps/mpvplayer"
+)
+
+// the queue columns when none are configured
+var defaultQueueColumns = []string{"star", "title", "artist", "duration"}
+
+// queueColumnKind is a column that can be shown in the queue
+type queueColumnKind struct {
+	// how wide the column is and how it's aligned, unless configured
+	expansion int
+	maxWidth  int
+	align     int
+	// the text of the cell; the star column is drawn by queueData
+	text func(song *mpvplayer.QueueItem) string
+}
+
+// queueColumnKinds are the columns that can be shown in the queue, by name
+var queueColumnKinds = map[string]queueColumnKind{
+	"star": {maxWidth: 1},
+	"title": {expansion: 1, text: func(song *mpvplayer.QueueItem) string {
+		return song.Title
+	}},
+	"artist": {expansion: 1, text: func(song *mpvplayer.QueueItem) string {
+		return song.Artist
+	}},
+	"album": {expansion: 1, text: func(song *mpvplayer.QueueItem) string {
+		return song.Album
+	}},
+	"albumArtist": {expansion: 1, text: func(song *mpvplayer.QueueItem) string {
+		return song.GetAlbumArtist()
+	}},
+	"track": {align: tview.AlignRight, text: func(song *mpvplayer.QueueItem) string {
+		return formatNonZero(song.TrackNumber)
+	}},
+	"disc": {align: tview.AlignRight, text: func(song *mpvplayer.QueueItem) string {
+		return formatNonZero(song.DiscNumber)
+	}},
+	"year": {align: tview.AlignRight, text: func(song *mpvplayer.QueueItem) string {
+		return formatNonZero(song.Year)
+	}},
+	"genre": {maxWidth: 20, text: func(song *mpvplayer.QueueItem) string {
+		return song.Genre
+	}},
+	"bitrate": {align: tview.AlignRight, text: func(song *mpvplayer.QueueItem) string {
+		if song.BitRate == 0 {
+			return ""
+		}
+		return fmt.Sprintf("%dk", song.BitRate)
+	}},
+	"format": {text: func(song *mpvplayer.QueueItem) string {
+		return song.Suffix
+	}},
+	"plays": {align: tview.AlignRight, text: func(song *mpvplayer.QueueItem) string {
+		return formatNonZero(song.PlayCount)
+	}},
+	"rating": {text: func(song *mpvplayer.QueueItem) string {
+		if song.Rating <= 0 {
+			return ""
+		}
+		return strings.Repeat("★", min(song.Rating, 5))
+	}},
+	"duration": {align: tview.AlignRight, maxWidth: 6, text: func(song *mpvplayer.QueueItem) string {
+		min, sec := iSecondsToMinAndSec(song.Duration)
+		return fmt.Sprintf("%3d:%02d", min, sec)
+	}},
+}
+
+// queueColumnNames returns the names of all columns, sorted
+func queueColumnNames() []string {
+	names := make([]string, 0, len(queueColumnKinds))
+	for name := range queueColumnKinds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func formatNonZero(i int) string {
+	if i == 0 {
+		return ""
+	}
+	return strconv.Itoa(i)
+}
+
+// queueColumn is a column of the queue table, see parseQueueColumn
+type queueColumn struct {
+	name string
+	queueColumnKind
+}
+
+// cell returns the column's cell for a song
+func (c queueColumn) cell(song *mpvplayer.QueueItem) *tview.TableCell {
+	text := ""
+	if c.text != nil {
+		text = tview.Escape(c.text(song))
+	}
+	return &tview.TableCell{
+		Text:        text,
+		Align:       c.align,
+		Expansion:   c.expansion,
+		MaxWidth:    c.maxWidth,
+		Transparent: true,
+	}
+}
+
+// parseQueueColumn parses a column of the config, "name[:width[:align]]":
+// the width is at most that many cells, or "*" for a share of the free
+// space ("*2" for two shares), and align is left, center, or right. E.g.
+// "album:*2" or "year:4:right".
+func parseQueueColumn(spec string) (queueColumn, error) {
+	parts := strings.Split(strings.TrimSpace(spec), ":")
+	if len(parts) > 3 {
+		return queueColumn{}, fmt.Errorf("invalid column %q: use name[:width[:align]]", spec)
+	}
+
+	var column queueColumn
+	for name, kind := range queueColumnKinds {
+		if strings.EqualFold(name, parts[0]) {
+			column = queueColumn{name: name, queueColumnKind: kind}
+		}
+	}
+	if column.name == "" {
+		return queueColumn{}, fmt.Errorf("unknown column %q: use one of %s",
+			parts[0], strings.Join(queueColumnNames(), ", "))
+	}
+
+	if len(parts) > 1 && parts[1] != "" {
+		width := parts[1]
+		if shares, ok := strings.CutPrefix(width, "*"); ok {
+			column.expansion, column.maxWidth = 1, 0
+			if shares != "" {
+				n, err := strconv.Atoi(shares)
+				if err != nil || n < 1 {
+					return queueColumn{}, fmt.Errorf("invalid width %q of column %q", width, spec)
+				}
+				column.expansion = n
+			}
+		} else {
+			n, err := strconv.Atoi(width)
+			if err != nil || n < 1 {
+				return queueColumn{}, fmt.Errorf("invalid width %q of column %q", width, spec)
+			}
+			column.expansion, column.maxWidth = 0, n
+		}
+	}
+
+	if len(parts) > 2 && parts[2] != "" {
+		switch strings.ToLower(parts[2]) {
+		case "left":
+			column.align = tview.AlignLeft
+		case "center":
+			column.align = tview.AlignCenter
+		case "right":
+			column.align = tview.AlignRight
+		default:
+			return queueColumn{}, fmt.Errorf("invalid alignment %q of column %q: use left, center, or right", parts[2], spec)
+		}
+	}
+	return column, nil
+}
+
+// parseQueueColumns parses the columns of the config, or returns the
+// default ones if there are none
+func parseQueueColumns(specs []string) ([]queueColumn, error) {
+	if len(specs) == 0 {
+		specs = defaultQueueColumns
+	}
+	columns := make([]queueColumn, 0, len(specs))
+	var errs []error
+	for _, spec := range specs {
+		column, err := parseQueueColumn(spec)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		columns = append(columns, column)
+	}
+	return columns, errors.Join(errs...)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/rivo/tview"
+	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQueueColumns(t *testing.T) {
+	columns, err := parseQueueColumns(nil)
+	require.NoError(t, err)
+	require.Len(t, columns, len(defaultQueueColumns))
+	assert.Equal(t, "star", columns[0].name)
+
+	columns, err = parseQueueColumns([]string{"AlbumArtist", "album:*2", "year:4:center", "title:30", "bitrate::left"})
+	require.NoError(t, err)
+	require.Len(t, columns, 5)
+	assert.Equal(t, "albumArtist", columns[0].name)
+	assert.Equal(t, 1, columns[0].expansion)
+	assert.Equal(t, 2, columns[1].expansion)
+	assert.Equal(t, 4, columns[2].maxWidth)
+	assert.Equal(t, tview.AlignCenter, columns[2].align)
+	assert.Equal(t, 0, columns[3].expansion)
+	assert.Equal(t, 30, columns[3].maxWidth)
+	assert.Equal(t, tview.AlignLeft, columns[4].align)
+
+	for _, invalid := range []string{"nope", "title:0", "title:*0", "title:wide", "title:*:middle", "title:1:left:x"} {
+		_, err := parseQueueColumns([]string{invalid})
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestQueueData(t *testing.T) {
+	columns, err := parseQueueColumns([]string{"star", "title", "albumArtist", "bitrate", "rating", "plays", "duration"})
+	require.NoError(t, err)
+	q := queueData{
+		playerQueue: mpvplayer.PlayerQueue{
+			{Id: "1", Title: "[One]", Artist: "Artist", BitRate: 320, Rating: 3, Duration: 75},
+			{Id: "2", Title: "Two", Artist: "Artist", AlbumArtist: "Various"},
+		},
+		starIdList: map[string]struct{}{"1": {}},
+		theme:      builtinThemes["default"],
+		columns:    columns,
+	}
+
+	assert.Equal(t, 7, q.GetColumnCount())
+	assert.Equal(t, 2, q.GetRowCount())
+	texts := func(row int) (texts []string) {
+		for column := 0; column < q.GetColumnCount(); column++ {
+			texts = append(texts, q.GetCell(row, column).Text)
+		}
+		return
+	}
+	assert.Equal(t, []string{starIcon, "[One[]", "Artist", "320k", "★★★", "", "  1:15"}, texts(0))
+	assert.Equal(t, []string{" ", "Two", "Various", "", "", "", "  0:00"}, texts(1))
+	assert.Nil(t, q.GetCell(2, 0))
+	assert.Nil(t, q.GetCell(0, 7))
+}
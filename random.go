@@ -0,0 +1,79 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spezifisch/stmps/subsonic"
+	"github.com/spf13/viper"
+)
+
+// randomPreset is a named filter for random songs, from the config:
+//
+//	[random.presets.90s-rock]
+//	genre = "Rock"
+//	from-year = 1990
+//	to-year = 1999
+//	size = 30
+//	key = "F5"
+type randomPreset struct {
+	Name   string
+	Filter subsonic.RandomSongsFilter
+	// the Global key that adds the songs, if any
+	Key string
+}
+
+// randomPresetCommand is the name of the Global command that runs a preset,
+// which is bound to the preset's key
+func randomPresetCommand(name string) string {
+	return "random:" + name
+}
+
+// loadRandomPresets reads the presets from the config, sorted by name
+func loadRandomPresets() ([]randomPreset, error) {
+	names := make([]string, 0)
+	for name := range viper.GetStringMap("random.presets") {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	presets := make([]randomPreset, 0, len(names))
+	for _, name := range names {
+		prefix := "random.presets." + name + "."
+		preset := randomPreset{
+			Name: name,
+			Filter: subsonic.RandomSongsFilter{
+				Size:          viper.GetInt(prefix + "size"),
+				Genre:         viper.GetString(prefix + "genre"),
+				FromYear:      viper.GetInt(prefix + "from-year"),
+				ToYear:        viper.GetInt(prefix + "to-year"),
+				MusicFolderId: viper.GetString(prefix + "folder"),
+			},
+			Key: viper.GetString(prefix + "key"),
+		}
+		if preset.Filter.Size < 0 || preset.Filter.FromYear < 0 || preset.Filter.ToYear < 0 {
+			return nil, fmt.Errorf("random preset %q: negative size or year", name)
+		}
+		if preset.Filter.FromYear != 0 && preset.Filter.ToYear != 0 && preset.Filter.FromYear > preset.Filter.ToYear {
+			return nil, fmt.Errorf("random preset %q: %d is after %d", name, preset.Filter.FromYear, preset.Filter.ToYear)
+		}
+		presets = append(presets, preset)
+	}
+	return presets, nil
+}
+
+// findRandomPreset returns the preset with the name, ignoring case, or nil.
+// The config's table names are lowercased when it's read, so that's all that
+// could be told apart anyway.
+func findRandomPreset(presets []randomPreset, name string) *randomPreset {
+	for i := range presets {
+		if strings.EqualFold(presets[i].Name, name) {
+			return &presets[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spezifisch/stmps/subsonic"
+	tviewcommand "github.com/spezifisch/tview-command"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readRandomConfig(t *testing.T, config string) {
+	t.Helper()
+	viper.SetConfigType("toml")
+	require.NoError(t, viper.ReadConfig(strings.NewReader(config)))
+}
+
+func TestLoadRandomPresets(t *testing.T) {
+	defer viper.Reset()
+	readRandomConfig(t, `
+[random.presets.90s-rock]
+genre = "Rock"
+from-year = 1990
+to-year = 1999
+key = "F5"
+
+[random.presets.Jazz]
+genre = "Jazz"
+size = 20
+folder = "3"
+`)
+	presets, err := loadRandomPresets()
+	require.NoError(t, err)
+	assert.Equal(t, []randomPreset{
+		{Name: "90s-rock", Filter: subsonic.RandomSongsFilter{Genre: "Rock", FromYear: 1990, ToYear: 1999}, Key: "F5"},
+		{Name: "jazz", Filter: subsonic.RandomSongsFilter{Size: 20, Genre: "Jazz", MusicFolderId: "3"}},
+	}, presets)
+	assert.Equal(t, "jazz", findRandomPreset(presets, "jazz").Name)
+	assert.Equal(t, "jazz", findRandomPreset(presets, "JAZZ").Name, "names ignore case")
+	assert.Nil(t, findRandomPreset(presets, "pop"))
+
+	viper.Reset()
+	readRandomConfig(t, `
+[random.presets.backwards]
+from-year = 2000
+to-year = 1990
+`)
+	_, err = loadRandomPresets()
+	assert.Error(t, err)
+}
+
+func TestBindRandomPresets(t *testing.T) {
+	k, err := newKeybindings(tviewcommand.Config{})
+	require.NoError(t, err)
+	require.NoError(t, k.bindRandomPresets([]randomPreset{
+		{Name: "rock", Key: "f5"},
+		// a page's default binding gives way
+		{Name: "jazz", Key: "R"},
+		{Name: "any"},
+	}))
+	assert.Equal(t, "F5", k.Key(ContextGlobal, randomPresetCommand("rock")))
+	assert.Equal(t, "R", k.Key(ContextGlobal, randomPresetCommand("jazz")))
+	assert.Empty(t, k.Keys(ContextBrowserArtists, "refresh"))
+
+	var ran bool
+	k.Handle(ContextGlobal, randomPresetCommand("rock"), func() { ran = true })
+	assert.True(t, k.Run(ContextGlobal, randomPresetCommand("rock")))
+	assert.True(t, ran)
+
+	k, err = newKeybindings(tviewcommand.Config{
+		ContextQueue: {Bindings: map[string]string{"F6": "shuffle"}},
+	})
+	require.NoError(t, err)
+	err = k.bindRandomPresets([]randomPreset{
+		{Name: "global", Key: "r"},
+		{Name: "user", Key: "F6"},
+		{Name: "invalid", Key: "Hyper-x"},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"global": "r" is bound to addRandomSongs`)
+	assert.Contains(t, err.Error(), `"user": "F6" is bound to shuffle in Queue`)
+	assert.Contains(t, err.Error(), `invalid key "Hyper-x"`)
+}
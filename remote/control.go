@@ -0,0 +1,765 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/spezifisch/stmps/logger"
+)
+
+// The control socket speaks a line protocol of JSON objects over a Unix
+// socket. Clients send requests:
+//
+//	{"id": 1, "method": "volume", "params": {"adjust": -5}}
+//
+// and get one response per request, with the same id:
+//
+//	{"id": 1}
+//	{"id": 2, "result": {"state": "playing", ...}}
+//	{"id": 3, "error": "unknown method \"foo\""}
+//
+// After a "subscribe" request, the server additionally pushes player events,
+// which carry an "event" field instead of an "id":
+//
+//	{"event": "playing", "track": {"id": "...", "title": "...", ...}}
+
+// Control socket methods
+const (
+	MethodPlay      = "play"
+	MethodPause     = "pause"
+	MethodToggle    = "toggle"
+	MethodStop      = "stop"
+	MethodNext      = "next"
+	MethodPrevious  = "previous"
+	MethodSeek      = "seek"
+	MethodVolume    = "volume"
+	MethodStatus    = "status"
+	MethodQueue     = "queue"
+	MethodEnqueue   = "enqueue"
+	MethodPlayNow   = "playnow"
+	MethodDelete    = "delete"
+	MethodMove      = "move"
+	MethodJump      = "jump"
+	MethodShuffle   = "shuffle"
+	MethodClear     = "clear"
+	MethodUndo      = "undo"
+	MethodRedo      = "redo"
+	MethodAutoDJ    = "autodj"
+	MethodSleep     = "sleep"
+	MethodStopAfter = "stopafter"
+	MethodSubscribe = "subscribe"
+	MethodQuit      = "quit"
+)
+
+// Player states, as reported in Status
+const (
+	StatePlaying = "playing"
+	StatePaused  = "paused"
+	StateStopped = "stopped"
+)
+
+// Sleep timer modes: stop after some minutes, after the song playing, or
+// after the last song of its album that's queued after it
+const (
+	SleepOff     = "off"
+	SleepMinutes = "minutes"
+	SleepTrack   = "track"
+	SleepAlbum   = "album"
+)
+
+// Event types. These mirror the events the player sends to the UI.
+const (
+	EventStopped  = "stopped"
+	EventPlaying  = "playing"
+	EventUnpaused = "unpaused"
+	EventPaused   = "paused"
+	EventStatus   = "status"
+	// the queue was changed by a remote client
+	EventQueue = "queue"
+)
+
+// Controller is the set of operations remote control interfaces can perform
+// on a running stmps. Unlike ControlledPlayer, it also covers the queue and
+// the server connection.
+type Controller interface {
+	// Play starts or resumes playback
+	Play() error
+	// Pause pauses playback; it does nothing if nothing is playing
+	Pause() error
+	// TogglePause pauses if playing, and plays otherwise
+	TogglePause() error
+	Stop() error
+	NextTrack() error
+	PreviousTrack() error
+	// Seek seeks relative to the current position, in seconds
+	Seek(offset int) error
+	// SeekAbsolute seeks to a position in the current song, in seconds
+	SeekAbsolute(position int) error
+	SetVolume(percentValue int) error
+	AdjustVolume(increment int) error
+
+	Status() Status
+	Queue() []Track
+	// Enqueue appends songs to the queue by song ID, returning the number
+	// of songs added
+	Enqueue(ids []string) (int, error)
+	// EnqueueNext inserts songs by song ID right after the one playing,
+	// returning the number of songs added
+	EnqueueNext(ids []string) (int, error)
+	// EnqueueSearch appends the songs matching a server-side search to the
+	// queue, returning the number of songs added
+	EnqueueSearch(query string) (int, error)
+	// PlayNow replaces the queue with the songs and starts playing them
+	PlayNow(ids []string) error
+	// DeleteQueueItem removes the song at index from the queue
+	DeleteQueueItem(index int) error
+	// MoveQueueItem moves the song at index from to index to
+	MoveQueueItem(from, to int) error
+	// DeleteQueueItems removes the songs at the indexes at once
+	DeleteQueueItems(indexes []int) error
+	// MoveQueueItems moves the songs at the indexes as a block, so that the
+	// first of them ends up at index to
+	MoveQueueItems(indexes []int, to int) error
+	// PlayQueueItem skips to the song at index; the songs before it stay
+	// queued after it
+	PlayQueueItem(index int) error
+	ShuffleQueue() error
+	ClearQueue() error
+	// UndoQueue and RedoQueue undo and redo edits of the queue
+	UndoQueue() error
+	RedoQueue() error
+	// SetAutoDJ turns the auto-DJ, which keeps the queue filled, on or off
+	SetAutoDJ(enable bool) error
+	// SetSleepTimer sets or, with SleepOff, cancels the sleep timer
+	SetSleepTimer(p SleepParams) error
+	// SetStopAfter marks the song at index to stop playback after it, or
+	// removes the mark
+	SetStopAfter(index int, stop bool) error
+
+	// Quit shuts stmps down
+	Quit() error
+
+	// Subscribe registers a callback for player events. The returned function
+	// removes the subscription. Callbacks must not block.
+	Subscribe(cb func(Event)) (unsubscribe func())
+}
+
+// Track is the serializable description of a song, as sent to remote clients
+type Track struct {
+	Id          string `json:"id"`
+	Title       string `json:"title"`
+	Artist      string `json:"artist"`
+	Album       string `json:"album"`
+	Duration    int    `json:"duration"`
+	TrackNumber int    `json:"track,omitempty"`
+	DiscNumber  int    `json:"disc,omitempty"`
+	Genre       string `json:"genre,omitempty"`
+	Year        int    `json:"year,omitempty"`
+	CoverArtId  string `json:"coverArt,omitempty"`
+	AlbumArtist string `json:"albumArtist,omitempty"`
+	BitRate     int    `json:"bitRate,omitempty"`
+	Suffix      string `json:"suffix,omitempty"`
+	PlayCount   int    `json:"playCount,omitempty"`
+	Rating      int    `json:"rating,omitempty"`
+	// StopAfter is whether playback stops after the song
+	StopAfter bool `json:"stopAfter,omitempty"`
+}
+
+func NewTrack(track TrackInterface) Track {
+	return Track{
+		Id:          track.GetId(),
+		Title:       track.GetTitle(),
+		Artist:      track.GetArtist(),
+		Album:       track.GetAlbum(),
+		Duration:    track.GetDuration(),
+		TrackNumber: track.GetTrackNumber(),
+		DiscNumber:  track.GetDiscNumber(),
+		Genre:       track.GetGenre(),
+	}
+}
+
+// Status is a snapshot of the player state. Position and Duration are in seconds.
+type Status struct {
+	State       string `json:"state"`
+	Volume      int64  `json:"volume"`
+	Position    int64  `json:"position"`
+	Duration    int64  `json:"duration"`
+	QueueLength int    `json:"queueLength"`
+	Track       *Track `json:"track,omitempty"`
+	// AutoDJ is whether the auto-DJ keeps the queue filled
+	AutoDJ bool `json:"autoDJ,omitempty"`
+	// Sleep is the sleep timer, if it's set
+	Sleep *SleepTimer `json:"sleep,omitempty"`
+}
+
+// SleepTimer is the state of the sleep timer
+type SleepTimer struct {
+	Mode string `json:"mode"`
+	// Remaining is the number of seconds until playback stops. For the
+	// track and album modes, it's as much as the queue tells.
+	Remaining int64 `json:"remaining"`
+	// Fade is whether the volume fades out over the last minute
+	Fade bool `json:"fade,omitempty"`
+}
+
+// Event is a player event pushed to subscribed clients
+type Event struct {
+	Event  string  `json:"event"`
+	Track  *Track  `json:"track,omitempty"`
+	Status *Status `json:"status,omitempty"`
+}
+
+type Request struct {
+	Id     int             `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+type Response struct {
+	Id     int         `json:"id"`
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// SeekParams are the parameters of the "seek" method. Exactly one of Offset
+// (relative) or Position (absolute) must be set.
+type SeekParams struct {
+	Offset   *int `json:"offset,omitempty"`
+	Position *int `json:"position,omitempty"`
+}
+
+// VolumeParams are the parameters of the "volume" method. Exactly one of Set
+// or Adjust must be set.
+type VolumeParams struct {
+	Set    *int `json:"set,omitempty"`
+	Adjust *int `json:"adjust,omitempty"`
+}
+
+// EnqueueParams are the parameters of the "enqueue" method: either song IDs,
+// or a search query. With Next, the songs (IDs only) are inserted after the
+// one playing instead of appended.
+type EnqueueParams struct {
+	Ids   []string `json:"ids,omitempty"`
+	Query string   `json:"query,omitempty"`
+	Next  bool     `json:"next,omitempty"`
+}
+
+type EnqueueResult struct {
+	Added int `json:"added"`
+}
+
+// IndexParams are the parameters of the "delete" and "jump" methods. If
+// Indexes is set, those songs are deleted instead of the one at Index.
+type IndexParams struct {
+	Index   int   `json:"index"`
+	Indexes []int `json:"indexes,omitempty"`
+}
+
+// MoveParams are the parameters of the "move" method. If Indexes is set,
+// those songs are moved as a block to To instead of the one at From.
+type MoveParams struct {
+	From    int   `json:"from"`
+	To      int   `json:"to"`
+	Indexes []int `json:"indexes,omitempty"`
+}
+
+// AutoDJParams are the parameters of the "autodj" method
+type AutoDJParams struct {
+	Enable bool `json:"enable"`
+}
+
+// SleepParams are the parameters of the "sleep" method. Minutes is only for
+// SleepMinutes.
+type SleepParams struct {
+	Mode    string `json:"mode"`
+	Minutes int    `json:"minutes,omitempty"`
+	Fade    bool   `json:"fade,omitempty"`
+}
+
+// StopAfterParams are the parameters of the "stopafter" method
+type StopAfterParams struct {
+	Index int  `json:"index"`
+	Stop  bool `json:"stop"`
+}
+
+// ControlServer serves the control socket
+type ControlServer struct {
+	path       string
+	listener   net.Listener
+	controller Controller
+	logger     logger.LoggerInterface
+
+	lock  sync.Mutex
+	conns map[*controlConn]struct{}
+}
+
+// ListenControlSocket creates the control socket at path and starts serving
+// it. If a socket file already exists at path and another process is listening
+// on it, an error is returned; if nobody is listening, the stale file is
+// replaced.
+func ListenControlSocket(path string, controller Controller, logger logger.LoggerInterface) (*ControlServer, error) {
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("control socket %s is in use by another instance", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("removing stale control socket %s: %w", path, err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// only we get to control us
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	s := &ControlServer{
+		path:       path,
+		listener:   listener,
+		controller: controller,
+		logger:     logger,
+		conns:      make(map[*controlConn]struct{}),
+	}
+	go s.serve()
+	return s, nil
+}
+
+// Close stops accepting connections, disconnects all clients, and removes the
+// socket file.
+func (s *ControlServer) Close() error {
+	err := s.listener.Close()
+	s.lock.Lock()
+	for c := range s.conns {
+		c.close()
+	}
+	s.lock.Unlock()
+	// net.UnixListener removes the file on Close, but don't rely on it
+	if e := os.Remove(s.path); e != nil && !errors.Is(e, os.ErrNotExist) && err == nil {
+		err = e
+	}
+	return err
+}
+
+func (s *ControlServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				s.logger.PrintError("control socket accept", err)
+			}
+			return
+		}
+		c := &controlConn{
+			conn: conn,
+			out:  make(chan interface{}, 64),
+			done: make(chan struct{}),
+		}
+		s.lock.Lock()
+		s.conns[c] = struct{}{}
+		s.lock.Unlock()
+
+		go c.writeLoop()
+		go func() {
+			s.readLoop(c)
+			c.close()
+			s.lock.Lock()
+			delete(s.conns, c)
+			s.lock.Unlock()
+		}()
+	}
+}
+
+func (s *ControlServer) readLoop(c *controlConn) {
+	dec := json.NewDecoder(c.conn)
+	for {
+		var req Request
+		if err := dec.Decode(&req); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				// the decoder can't recover from this, so tell the client and hang up
+				c.send(Response{Error: fmt.Sprintf("malformed request: %s", err)}, true)
+			}
+			return
+		}
+
+		result, err := s.handle(c, req)
+		resp := Response{Id: req.Id, Result: result}
+		if err != nil {
+			resp.Error = err.Error()
+		}
+		if !c.send(resp, true) {
+			return
+		}
+	}
+}
+
+func (s *ControlServer) handle(c *controlConn, req Request) (interface{}, error) {
+	ctl := s.controller
+	switch req.Method {
+	case MethodPlay:
+		return nil, ctl.Play()
+	case MethodPause:
+		return nil, ctl.Pause()
+	case MethodToggle:
+		return nil, ctl.TogglePause()
+	case MethodStop:
+		return nil, ctl.Stop()
+	case MethodNext:
+		return nil, ctl.NextTrack()
+	case MethodPrevious:
+		return nil, ctl.PreviousTrack()
+
+	case MethodSeek:
+		var p SeekParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		switch {
+		case p.Offset != nil && p.Position == nil:
+			return nil, ctl.Seek(*p.Offset)
+		case p.Position != nil && p.Offset == nil:
+			return nil, ctl.SeekAbsolute(*p.Position)
+		}
+		return nil, errors.New("seek needs exactly one of offset or position")
+
+	case MethodVolume:
+		var p VolumeParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		switch {
+		case p.Set != nil && p.Adjust == nil:
+			return nil, ctl.SetVolume(*p.Set)
+		case p.Adjust != nil && p.Set == nil:
+			return nil, ctl.AdjustVolume(*p.Adjust)
+		}
+		return nil, errors.New("volume needs exactly one of set or adjust")
+
+	case MethodStatus:
+		return ctl.Status(), nil
+	case MethodQueue:
+		return ctl.Queue(), nil
+
+	case MethodEnqueue:
+		var p EnqueueParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		var added int
+		var err error
+		switch {
+		case len(p.Ids) > 0 && p.Query == "" && p.Next:
+			added, err = ctl.EnqueueNext(p.Ids)
+		case len(p.Ids) > 0 && p.Query == "":
+			added, err = ctl.Enqueue(p.Ids)
+		case p.Query != "" && len(p.Ids) == 0 && !p.Next:
+			added, err = ctl.EnqueueSearch(p.Query)
+		case p.Next:
+			return nil, errors.New("enqueue with next needs ids")
+		default:
+			return nil, errors.New("enqueue needs exactly one of ids or query")
+		}
+		return EnqueueResult{Added: added}, err
+
+	case MethodPlayNow:
+		var p EnqueueParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		if len(p.Ids) == 0 {
+			return nil, errors.New("playnow needs ids")
+		}
+		return nil, ctl.PlayNow(p.Ids)
+
+	case MethodDelete:
+		var p IndexParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		if len(p.Indexes) > 0 {
+			return nil, ctl.DeleteQueueItems(p.Indexes)
+		}
+		return nil, ctl.DeleteQueueItem(p.Index)
+
+	case MethodMove:
+		var p MoveParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		if len(p.Indexes) > 0 {
+			return nil, ctl.MoveQueueItems(p.Indexes, p.To)
+		}
+		return nil, ctl.MoveQueueItem(p.From, p.To)
+
+	case MethodJump:
+		var p IndexParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		return nil, ctl.PlayQueueItem(p.Index)
+
+	case MethodShuffle:
+		return nil, ctl.ShuffleQueue()
+	case MethodClear:
+		return nil, ctl.ClearQueue()
+	case MethodUndo:
+		return nil, ctl.UndoQueue()
+	case MethodRedo:
+		return nil, ctl.RedoQueue()
+	case MethodAutoDJ:
+		var p AutoDJParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		return nil, ctl.SetAutoDJ(p.Enable)
+	case MethodSleep:
+		var p SleepParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		return nil, ctl.SetSleepTimer(p)
+	case MethodStopAfter:
+		var p StopAfterParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		return nil, ctl.SetStopAfter(p.Index, p.Stop)
+	case MethodQuit:
+		return nil, ctl.Quit()
+
+	case MethodSubscribe:
+		c.subscribe(ctl)
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown method %q", req.Method)
+}
+
+func decodeParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return errors.New("missing params")
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return fmt.Errorf("invalid params: %w", err)
+	}
+	return nil
+}
+
+// controlConn is one client connection. All writes go through out, so that
+// responses and asynchronous events don't interleave.
+type controlConn struct {
+	conn net.Conn
+	out  chan interface{}
+	done chan struct{}
+
+	lock        sync.Mutex
+	closed      bool
+	unsubscribe func()
+}
+
+// send queues a message for the client. If wait is false and the client isn't
+// keeping up, the message is dropped. It returns false if the message was not
+// queued.
+func (c *controlConn) send(msg interface{}, wait bool) bool {
+	if wait {
+		select {
+		case c.out <- msg:
+			return true
+		case <-c.done:
+			return false
+		}
+	}
+	select {
+	case c.out <- msg:
+		return true
+	case <-c.done:
+	default:
+	}
+	return false
+}
+
+func (c *controlConn) writeLoop() {
+	enc := json.NewEncoder(c.conn)
+	for {
+		select {
+		case msg := <-c.out:
+			if err := enc.Encode(msg); err != nil {
+				c.close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *controlConn) subscribe(ctl Controller) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed || c.unsubscribe != nil {
+		return
+	}
+	c.unsubscribe = ctl.Subscribe(func(e Event) {
+		c.send(e, false)
+	})
+}
+
+func (c *controlConn) close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	if c.unsubscribe != nil {
+		c.unsubscribe()
+	}
+	close(c.done)
+	c.conn.Close()
+}
+
+// ControlClient talks to the control socket of a running stmps
+type ControlClient struct {
+	conn net.Conn
+
+	lock    sync.Mutex
+	enc     *json.Encoder
+	nextId  int
+	pending map[int]chan clientMessage
+	err     error
+
+	events chan Event
+}
+
+// clientMessage is anything the server sends: either a Response, or an Event
+type clientMessage struct {
+	Id     int             `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	Event
+}
+
+// DialControlSocket connects to the control socket at path
+func DialControlSocket(path string) (*ControlClient, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	c := &ControlClient{
+		conn:    conn,
+		enc:     json.NewEncoder(conn),
+		pending: make(map[int]chan clientMessage),
+		events:  make(chan Event, 64),
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+// Call invokes method with params, and decodes the result into result, which
+// may be nil if the caller isn't interested in the result.
+func (c *ControlClient) Call(method string, params interface{}, result interface{}) error {
+	req := Request{Method: method}
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		req.Params = raw
+	}
+
+	reply := make(chan clientMessage, 1)
+	c.lock.Lock()
+	if c.err != nil {
+		c.lock.Unlock()
+		return c.err
+	}
+	c.nextId++
+	req.Id = c.nextId
+	c.pending[req.Id] = reply
+	err := c.enc.Encode(req)
+	if err != nil {
+		delete(c.pending, req.Id)
+	}
+	c.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	msg, ok := <-reply
+	if !ok {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		return c.err
+	}
+	if msg.Error != "" {
+		return errors.New(msg.Error)
+	}
+	if result != nil && len(msg.Result) > 0 {
+		return json.Unmarshal(msg.Result, result)
+	}
+	return nil
+}
+
+// Subscribe asks the server to push player events, which are then delivered
+// on Events.
+func (c *ControlClient) Subscribe() error {
+	return c.Call(MethodSubscribe, nil, nil)
+}
+
+// Events returns the channel on which subscribed events are delivered. It is
+// closed when the connection ends. Subscribers must keep draining it, or calls
+// will stall.
+func (c *ControlClient) Events() <-chan Event {
+	return c.events
+}
+
+func (c *ControlClient) Close() error {
+	return c.conn.Close()
+}
+
+func (c *ControlClient) readLoop() {
+	dec := json.NewDecoder(c.conn)
+	var err error
+	for {
+		var msg clientMessage
+		if err = dec.Decode(&msg); err != nil {
+			break
+		}
+		if msg.Event.Event != "" {
+			c.events <- msg.Event
+			continue
+		}
+		c.lock.Lock()
+		reply, ok := c.pending[msg.Id]
+		delete(c.pending, msg.Id)
+		c.lock.Unlock()
+		if ok {
+			reply <- msg
+		}
+	}
+
+	c.lock.Lock()
+	c.err = fmt.Errorf("control connection closed: %w", err)
+	for id, reply := range c.pending {
+		close(reply)
+		delete(c.pending, id)
+	}
+	c.lock.Unlock()
+	close(c.events)
+}
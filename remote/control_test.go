@@ -0,0 +1,485 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testLogger struct{}
+
+func (testLogger) Print(s string)                      {}
+func (testLogger) Printf(s string, as ...interface{})  {}
+func (testLogger) PrintError(source string, err error) {}
+
+// fakeController records what was asked of it
+type fakeController struct {
+	lock        sync.Mutex
+	calls       []string
+	volume      int
+	queue       []Track
+	subscribers map[int]func(Event)
+	nextSub     int
+}
+
+var _ Controller = (*fakeController)(nil)
+
+func newFakeController() *fakeController {
+	return &fakeController{volume: 50, subscribers: make(map[int]func(Event))}
+}
+
+func (f *fakeController) record(call string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.calls = append(f.calls, call)
+	return nil
+}
+
+func (f *fakeController) Play() error          { return f.record("play") }
+func (f *fakeController) Pause() error         { return f.record("pause") }
+func (f *fakeController) TogglePause() error   { return f.record("toggle") }
+func (f *fakeController) Stop() error          { return f.record("stop") }
+func (f *fakeController) NextTrack() error     { return f.record("next") }
+func (f *fakeController) PreviousTrack() error { return errors.New("no previous track") }
+func (f *fakeController) Seek(offset int) error {
+	return f.record(fmt.Sprintf("seek %+d", offset))
+}
+func (f *fakeController) SeekAbsolute(position int) error {
+	return f.record(fmt.Sprintf("seek %d", position))
+}
+func (f *fakeController) SetVolume(v int) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.volume = v
+	return nil
+}
+func (f *fakeController) AdjustVolume(v int) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.volume += v
+	return nil
+}
+func (f *fakeController) Status() Status {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return Status{State: StateStopped, Volume: int64(f.volume), QueueLength: len(f.queue)}
+}
+func (f *fakeController) Queue() []Track {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]Track{}, f.queue...)
+}
+func (f *fakeController) Enqueue(ids []string) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, id := range ids {
+		f.queue = append(f.queue, Track{Id: id, Title: "song " + id})
+	}
+	return len(ids), nil
+}
+func (f *fakeController) EnqueueNext(ids []string) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	at := min(1, len(f.queue))
+	var songs []Track
+	for _, id := range ids {
+		songs = append(songs, Track{Id: id, Title: "song " + id})
+	}
+	f.queue = append(f.queue[:at], append(songs, f.queue[at:]...)...)
+	return len(ids), nil
+}
+func (f *fakeController) EnqueueSearch(query string) (int, error) {
+	return f.Enqueue([]string{query + "1", query + "2"})
+}
+func (f *fakeController) PlayNow(ids []string) error {
+	f.lock.Lock()
+	f.queue = nil
+	f.lock.Unlock()
+	_, err := f.Enqueue(ids)
+	return err
+}
+func (f *fakeController) DeleteQueueItem(index int) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if index < 0 || index >= len(f.queue) {
+		return errors.New("invalid index")
+	}
+	f.queue = append(f.queue[:index], f.queue[index+1:]...)
+	return nil
+}
+func (f *fakeController) MoveQueueItem(from, to int) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if from < 0 || from >= len(f.queue) || to < 0 || to >= len(f.queue) {
+		return errors.New("invalid index")
+	}
+	f.queue[from], f.queue[to] = f.queue[to], f.queue[from]
+	return nil
+}
+func (f *fakeController) DeleteQueueItems(indexes []int) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	deleted := make(map[int]bool, len(indexes))
+	for _, index := range indexes {
+		if index < 0 || index >= len(f.queue) {
+			return errors.New("invalid index")
+		}
+		deleted[index] = true
+	}
+	var rest []Track
+	for i, track := range f.queue {
+		if !deleted[i] {
+			rest = append(rest, track)
+		}
+	}
+	f.queue = rest
+	return nil
+}
+func (f *fakeController) MoveQueueItems(indexes []int, to int) error {
+	if len(indexes) != 1 {
+		return errors.New("only one song can be moved")
+	}
+	return f.MoveQueueItem(indexes[0], to)
+}
+func (f *fakeController) PlayQueueItem(index int) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if index < 0 || index >= len(f.queue) {
+		return errors.New("invalid index")
+	}
+	if index > 0 {
+		queue := []Track{f.queue[index]}
+		queue = append(queue, f.queue[1:index]...)
+		f.queue = append(queue, f.queue[index+1:]...)
+	}
+	return nil
+}
+func (f *fakeController) ShuffleQueue() error { return f.record("shuffle") }
+func (f *fakeController) UndoQueue() error    { return f.record("undo") }
+func (f *fakeController) RedoQueue() error    { return f.record("redo") }
+func (f *fakeController) Quit() error         { return f.record("quit") }
+func (f *fakeController) SetAutoDJ(enable bool) error {
+	return f.record(fmt.Sprintf("autodj %t", enable))
+}
+func (f *fakeController) SetSleepTimer(p SleepParams) error {
+	if p.Mode == SleepMinutes && p.Minutes <= 0 {
+		return errors.New("no minutes")
+	}
+	return f.record(fmt.Sprintf("sleep %s %d %t", p.Mode, p.Minutes, p.Fade))
+}
+func (f *fakeController) SetStopAfter(index int, stop bool) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if index < 0 || index >= len(f.queue) {
+		return errors.New("invalid index")
+	}
+	f.queue[index].StopAfter = stop
+	return nil
+}
+func (f *fakeController) ClearQueue() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.queue = nil
+	return nil
+}
+func (f *fakeController) Subscribe(cb func(Event)) func() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	id := f.nextSub
+	f.nextSub++
+	f.subscribers[id] = cb
+	return func() {
+		f.lock.Lock()
+		defer f.lock.Unlock()
+		delete(f.subscribers, id)
+	}
+}
+func (f *fakeController) publish(e Event) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, cb := range f.subscribers {
+		cb(e)
+	}
+}
+func (f *fakeController) subscriberCount() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.subscribers)
+}
+
+func startControlServer(t *testing.T) (*fakeController, *ControlServer, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stmps.sock")
+	ctl := newFakeController()
+	server, err := ListenControlSocket(path, ctl, testLogger{})
+	if err != nil {
+		t.Fatalf("ListenControlSocket: %s", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return ctl, server, path
+}
+
+func dialControl(t *testing.T, path string) *ControlClient {
+	t.Helper()
+	client, err := DialControlSocket(path)
+	if err != nil {
+		t.Fatalf("DialControlSocket: %s", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestControlCalls(t *testing.T) {
+	ctl, _, path := startControlServer(t)
+	client := dialControl(t, path)
+
+	for _, m := range []string{MethodPlay, MethodPause, MethodToggle, MethodStop, MethodNext, MethodUndo, MethodRedo} {
+		if err := client.Call(m, nil, nil); err != nil {
+			t.Errorf("%s: unexpected error %s", m, err)
+		}
+	}
+	offset, position := -10, 90
+	if err := client.Call(MethodSeek, SeekParams{Offset: &offset}, nil); err != nil {
+		t.Errorf("relative seek: %s", err)
+	}
+	if err := client.Call(MethodSeek, SeekParams{Position: &position}, nil); err != nil {
+		t.Errorf("absolute seek: %s", err)
+	}
+	if err := client.Call(MethodAutoDJ, AutoDJParams{Enable: true}, nil); err != nil {
+		t.Errorf("autodj: %s", err)
+	}
+	if err := client.Call(MethodSleep, SleepParams{Mode: SleepMinutes, Minutes: 30, Fade: true}, nil); err != nil {
+		t.Errorf("sleep: %s", err)
+	}
+	if err := client.Call(MethodSleep, SleepParams{Mode: SleepMinutes}, nil); err == nil {
+		t.Error("expected an error for a sleep timer without minutes")
+	}
+	expected := []string{"play", "pause", "toggle", "stop", "next", "undo", "redo", "seek -10", "seek 90", "autodj true", "sleep minutes 30 true"}
+	if fmt.Sprint(ctl.calls) != fmt.Sprint(expected) {
+		t.Errorf("expected calls %v, got %v", expected, ctl.calls)
+	}
+
+	adjust := 5
+	if err := client.Call(MethodVolume, VolumeParams{Adjust: &adjust}, nil); err != nil {
+		t.Errorf("volume: %s", err)
+	}
+	var status Status
+	if err := client.Call(MethodStatus, nil, &status); err != nil {
+		t.Fatalf("status: %s", err)
+	}
+	if status.Volume != 55 || status.State != StateStopped {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestControlErrors(t *testing.T) {
+	_, _, path := startControlServer(t)
+	client := dialControl(t, path)
+
+	if err := client.Call("frobnicate", nil, nil); err == nil {
+		t.Error("expected an error for an unknown method")
+	}
+	if err := client.Call(MethodPrevious, nil, nil); err == nil || err.Error() != "no previous track" {
+		t.Errorf("expected the controller's error, got %v", err)
+	}
+	if err := client.Call(MethodSeek, nil, nil); err == nil {
+		t.Error("expected an error for seek without params")
+	}
+	one := 1
+	if err := client.Call(MethodVolume, VolumeParams{Set: &one, Adjust: &one}, nil); err == nil {
+		t.Error("expected an error for ambiguous volume params")
+	}
+	// errors don't break the connection
+	if err := client.Call(MethodPlay, nil, nil); err != nil {
+		t.Errorf("expected the connection to survive errors, got %s", err)
+	}
+}
+
+func TestControlQueue(t *testing.T) {
+	_, _, path := startControlServer(t)
+	client := dialControl(t, path)
+
+	var added EnqueueResult
+	if err := client.Call(MethodEnqueue, EnqueueParams{Ids: []string{"a", "b"}}, &added); err != nil {
+		t.Fatalf("enqueue: %s", err)
+	}
+	if added.Added != 2 {
+		t.Errorf("expected 2 songs added, got %d", added.Added)
+	}
+	if err := client.Call(MethodEnqueue, EnqueueParams{Query: "x"}, &added); err != nil {
+		t.Fatalf("enqueue search: %s", err)
+	}
+	var queue []Track
+	if err := client.Call(MethodQueue, nil, &queue); err != nil {
+		t.Fatalf("queue: %s", err)
+	}
+	if len(queue) != 4 || queue[0].Id != "a" || queue[3].Id != "x2" {
+		t.Errorf("unexpected queue %+v", queue)
+	}
+	if err := client.Call(MethodClear, nil, nil); err != nil {
+		t.Fatalf("clear: %s", err)
+	}
+	queue = nil
+	if err := client.Call(MethodQueue, nil, &queue); err != nil {
+		t.Fatalf("queue: %s", err)
+	}
+	if len(queue) != 0 {
+		t.Errorf("expected an empty queue, got %+v", queue)
+	}
+}
+
+func TestControlQueueEdits(t *testing.T) {
+	_, _, path := startControlServer(t)
+	client := dialControl(t, path)
+
+	if err := client.Call(MethodPlayNow, EnqueueParams{Ids: []string{"a", "b", "c"}}, nil); err != nil {
+		t.Fatalf("playnow: %s", err)
+	}
+	if err := client.Call(MethodMove, MoveParams{From: 2, To: 1}, nil); err != nil {
+		t.Fatalf("move: %s", err)
+	}
+	if err := client.Call(MethodDelete, IndexParams{Index: 0}, nil); err != nil {
+		t.Fatalf("delete: %s", err)
+	}
+	if err := client.Call(MethodDelete, IndexParams{Index: 5}, nil); err == nil {
+		t.Error("expected an error deleting a nonexistent queue entry")
+	}
+	var queue []Track
+	if err := client.Call(MethodQueue, nil, &queue); err != nil {
+		t.Fatalf("queue: %s", err)
+	}
+	if len(queue) != 2 || queue[0].Id != "c" || queue[1].Id != "b" {
+		t.Errorf("unexpected queue %+v", queue)
+	}
+
+	if err := client.Call(MethodEnqueue, EnqueueParams{Ids: []string{"d", "e"}}, nil); err != nil {
+		t.Fatalf("enqueue: %s", err)
+	}
+	if err := client.Call(MethodMove, MoveParams{Indexes: []int{3}, To: 0}, nil); err != nil {
+		t.Fatalf("move indexes: %s", err)
+	}
+	if err := client.Call(MethodDelete, IndexParams{Indexes: []int{1, 3}}, nil); err != nil {
+		t.Fatalf("delete indexes: %s", err)
+	}
+	if err := client.Call(MethodDelete, IndexParams{Indexes: []int{0, 7}}, nil); err == nil {
+		t.Error("expected an error deleting nonexistent queue entries")
+	}
+	queue = nil
+	if err := client.Call(MethodQueue, nil, &queue); err != nil {
+		t.Fatalf("queue: %s", err)
+	}
+	if len(queue) != 2 || queue[0].Id != "e" || queue[1].Id != "d" {
+		t.Errorf("unexpected queue %+v", queue)
+	}
+
+	if err := client.Call(MethodEnqueue, EnqueueParams{Ids: []string{"f", "g"}, Next: true}, nil); err != nil {
+		t.Fatalf("enqueue next: %s", err)
+	}
+	if err := client.Call(MethodJump, IndexParams{Index: 2}, nil); err != nil {
+		t.Fatalf("jump: %s", err)
+	}
+	if err := client.Call(MethodJump, IndexParams{Index: 9}, nil); err == nil {
+		t.Error("expected an error jumping to a nonexistent queue entry")
+	}
+	if err := client.Call(MethodEnqueue, EnqueueParams{Query: "x", Next: true}, nil); err == nil {
+		t.Error("expected an error enqueueing a search next")
+	}
+	queue = nil
+	if err := client.Call(MethodQueue, nil, &queue); err != nil {
+		t.Fatalf("queue: %s", err)
+	}
+	if ids := trackIds(queue); ids != "g f d" {
+		t.Errorf("unexpected queue %s", ids)
+	}
+	if err := client.Call(MethodStopAfter, StopAfterParams{Index: 1, Stop: true}, nil); err != nil {
+		t.Fatalf("stopafter: %s", err)
+	}
+	if err := client.Call(MethodStopAfter, StopAfterParams{Index: 3, Stop: true}, nil); err == nil {
+		t.Error("expected an error marking a nonexistent queue entry")
+	}
+	queue = nil
+	if err := client.Call(MethodQueue, nil, &queue); err != nil {
+		t.Fatalf("queue: %s", err)
+	}
+	if queue[0].StopAfter || !queue[1].StopAfter {
+		t.Errorf("expected only the second song marked, got %+v", queue)
+	}
+	if err := client.Call(MethodPlayNow, EnqueueParams{}, nil); err == nil {
+		t.Error("expected an error for playnow without ids")
+	}
+}
+
+func TestControlSubscribe(t *testing.T) {
+	ctl, _, path := startControlServer(t)
+	client := dialControl(t, path)
+
+	if err := client.Subscribe(); err != nil {
+		t.Fatalf("subscribe: %s", err)
+	}
+	ctl.publish(Event{Event: EventPlaying, Track: &Track{Id: "1", Title: "One"}})
+	select {
+	case e := <-client.Events():
+		if e.Event != EventPlaying || e.Track == nil || e.Track.Title != "One" {
+			t.Errorf("unexpected event %+v", e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	// calls still work while subscribed
+	if err := client.Call(MethodPlay, nil, nil); err != nil {
+		t.Errorf("play while subscribed: %s", err)
+	}
+
+	client.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for ctl.subscriberCount() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := ctl.subscriberCount(); n != 0 {
+		t.Errorf("expected the subscription to end with the connection, %d left", n)
+	}
+}
+
+func TestControlSocketInUse(t *testing.T) {
+	_, server, path := startControlServer(t)
+
+	if _, err := ListenControlSocket(path, newFakeController(), testLogger{}); err == nil {
+		t.Error("expected an error when another server is listening")
+	}
+
+	server.Close()
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the socket to be removed on close, got %v", err)
+	}
+}
+
+func TestControlSocketStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stmps.sock")
+	// leave a socket file behind without anybody listening
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+
+	server, err := ListenControlSocket(path, newFakeController(), testLogger{})
+	if err != nil {
+		t.Fatalf("expected the stale socket to be replaced, got %s", err)
+	}
+	server.Close()
+}
+
+func trackIds(tracks []Track) string {
+	ids := make([]string, len(tracks))
+	for i, track := range tracks {
+		ids[i] = track.Id
+	}
+	return strings.Join(ids, " ")
+}
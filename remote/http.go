@@ -0,0 +1,460 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package remote
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spezifisch/stmps/logger"
+)
+
+// The HTTP API offers the control socket's operations as REST endpoints, for
+// clients that can't reach the socket (e.g. a phone on the LAN). All requests
+// need the configured token, either as "Authorization: Bearer <token>" or as
+// a "token" query parameter (browsers can't set headers on WebSockets or
+// images). Request and response bodies are JSON; errors are {"error": "..."}.
+//
+//	GET    /api/status              Status
+//	POST   /api/play                also pause, toggle, stop, next, previous
+//	POST   /api/seek                SeekParams
+//	POST   /api/volume              VolumeParams
+//	GET    /api/queue               []Track
+//	POST   /api/queue               EnqueueParams -> EnqueueResult
+//	DELETE /api/queue               clear the queue
+//	POST   /api/queue/shuffle
+//	GET    /api/queue/{index}       Track
+//	PATCH  /api/queue/{index}       {"to": n} moves the song to index n
+//	DELETE /api/queue/{index}
+//	GET    /api/search?q=<query>    SearchResult
+//	GET    /api/coverart/{id}       PNG image
+//	GET    /api/events              WebSocket; Events as JSON text messages
+
+// Library is the part of the music server the HTTP API exposes
+type Library interface {
+	Search(query string) (SearchResult, error)
+	CoverArt(id string) (image.Image, error)
+}
+
+type Artist struct {
+	Id         string `json:"id"`
+	Name       string `json:"name"`
+	AlbumCount int    `json:"albumCount"`
+}
+
+type Album struct {
+	Id         string `json:"id"`
+	Name       string `json:"name"`
+	Artist     string `json:"artist"`
+	Year       int    `json:"year,omitempty"`
+	CoverArtId string `json:"coverArt,omitempty"`
+}
+
+type SearchResult struct {
+	Artists []Artist `json:"artists"`
+	Albums  []Album  `json:"albums"`
+	Songs   []Track  `json:"songs"`
+}
+
+// maximum size of request bodies
+const httpMaxBody = 1 << 20
+
+// HTTPServer serves the HTTP API
+type HTTPServer struct {
+	server   *http.Server
+	listener net.Listener
+	api      *httpAPI
+}
+
+// ListenHTTP starts serving the HTTP API on address. A token is required, since
+// the API is meant to be reachable from other machines.
+func ListenHTTP(address, token string, controller Controller, library Library, logger logger.LoggerInterface) (*HTTPServer, error) {
+	if token == "" {
+		return nil, errors.New("the HTTP remote needs a token")
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	api := newHTTPAPI(controller, library, token, logger)
+	s := &HTTPServer{
+		server: &http.Server{
+			Handler:           api,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+		listener: listener,
+		api:      api,
+	}
+	go func() {
+		if err := s.server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			logger.PrintError("http remote", err)
+		}
+	}()
+	return s, nil
+}
+
+// Addr is the address the server listens on
+func (s *HTTPServer) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Close stops the server and disconnects all clients, including WebSockets
+func (s *HTTPServer) Close() error {
+	err := s.server.Close()
+	s.api.closeSockets()
+	return err
+}
+
+type httpAPI struct {
+	controller Controller
+	library    Library
+	token      string
+	logger     logger.LoggerInterface
+	mux        *http.ServeMux
+
+	lock    sync.Mutex
+	sockets map[*wsConn]struct{}
+}
+
+func newHTTPAPI(controller Controller, library Library, token string, logger logger.LoggerInterface) *httpAPI {
+	a := &httpAPI{
+		controller: controller,
+		library:    library,
+		token:      token,
+		logger:     logger,
+		mux:        http.NewServeMux(),
+		sockets:    make(map[*wsConn]struct{}),
+	}
+	ctl := controller
+
+	a.mux.HandleFunc("GET /api/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, ctl.Status())
+	})
+
+	transport := map[string]func() error{
+		MethodPlay:     ctl.Play,
+		MethodPause:    ctl.Pause,
+		MethodToggle:   ctl.TogglePause,
+		MethodStop:     ctl.Stop,
+		MethodNext:     ctl.NextTrack,
+		MethodPrevious: ctl.PreviousTrack,
+	}
+	for name, f := range transport {
+		a.mux.HandleFunc("POST /api/"+name, func(w http.ResponseWriter, r *http.Request) {
+			writeResult(w, f())
+		})
+	}
+
+	a.mux.HandleFunc("POST /api/seek", func(w http.ResponseWriter, r *http.Request) {
+		var p SeekParams
+		if !readJSON(w, r, &p) {
+			return
+		}
+		switch {
+		case p.Offset != nil && p.Position == nil:
+			writeResult(w, ctl.Seek(*p.Offset))
+		case p.Position != nil && p.Offset == nil:
+			writeResult(w, ctl.SeekAbsolute(*p.Position))
+		default:
+			writeError(w, http.StatusBadRequest, errors.New("seek needs exactly one of offset or position"))
+		}
+	})
+
+	a.mux.HandleFunc("POST /api/volume", func(w http.ResponseWriter, r *http.Request) {
+		var p VolumeParams
+		if !readJSON(w, r, &p) {
+			return
+		}
+		switch {
+		case p.Set != nil && p.Adjust == nil:
+			writeResult(w, ctl.SetVolume(*p.Set))
+		case p.Adjust != nil && p.Set == nil:
+			writeResult(w, ctl.AdjustVolume(*p.Adjust))
+		default:
+			writeError(w, http.StatusBadRequest, errors.New("volume needs exactly one of set or adjust"))
+		}
+	})
+
+	a.mux.HandleFunc("POST /api/autodj", func(w http.ResponseWriter, r *http.Request) {
+		var p AutoDJParams
+		if !readJSON(w, r, &p) {
+			return
+		}
+		writeResult(w, ctl.SetAutoDJ(p.Enable))
+	})
+
+	a.mux.HandleFunc("POST /api/sleep", func(w http.ResponseWriter, r *http.Request) {
+		var p SleepParams
+		if !readJSON(w, r, &p) {
+			return
+		}
+		writeResult(w, ctl.SetSleepTimer(p))
+	})
+
+	a.mux.HandleFunc("GET /api/queue", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, ctl.Queue())
+	})
+
+	a.mux.HandleFunc("POST /api/queue", func(w http.ResponseWriter, r *http.Request) {
+		var p EnqueueParams
+		if !readJSON(w, r, &p) {
+			return
+		}
+		var added int
+		var err error
+		switch {
+		case len(p.Ids) > 0 && p.Query == "" && p.Next:
+			added, err = ctl.EnqueueNext(p.Ids)
+		case len(p.Ids) > 0 && p.Query == "":
+			added, err = ctl.Enqueue(p.Ids)
+		case p.Query != "" && len(p.Ids) == 0 && !p.Next:
+			added, err = ctl.EnqueueSearch(p.Query)
+		case p.Next:
+			writeError(w, http.StatusBadRequest, errors.New("enqueue with next needs ids"))
+			return
+		default:
+			writeError(w, http.StatusBadRequest, errors.New("enqueue needs exactly one of ids or query"))
+			return
+		}
+		if err != nil && added == 0 {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		// partial success still reports what was added
+		writeJSON(w, http.StatusOK, EnqueueResult{Added: added})
+	})
+
+	a.mux.HandleFunc("DELETE /api/queue", func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, ctl.ClearQueue())
+	})
+
+	a.mux.HandleFunc("POST /api/queue/shuffle", func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, ctl.ShuffleQueue())
+	})
+
+	a.mux.HandleFunc("POST /api/queue/undo", func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, ctl.UndoQueue())
+	})
+
+	a.mux.HandleFunc("POST /api/queue/redo", func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, ctl.RedoQueue())
+	})
+
+	a.mux.HandleFunc("GET /api/queue/{index}", func(w http.ResponseWriter, r *http.Request) {
+		queue := ctl.Queue()
+		if index, ok := queueIndex(w, r, len(queue)); ok {
+			writeJSON(w, http.StatusOK, queue[index])
+		}
+	})
+
+	a.mux.HandleFunc("PATCH /api/queue/{index}", func(w http.ResponseWriter, r *http.Request) {
+		index, ok := queueIndex(w, r, len(ctl.Queue()))
+		if !ok {
+			return
+		}
+		var p struct {
+			To *int `json:"to"`
+		}
+		if !readJSON(w, r, &p) {
+			return
+		}
+		if p.To == nil {
+			writeError(w, http.StatusBadRequest, errors.New("missing \"to\""))
+			return
+		}
+		writeResult(w, ctl.MoveQueueItem(index, *p.To))
+	})
+
+	a.mux.HandleFunc("DELETE /api/queue/{index}", func(w http.ResponseWriter, r *http.Request) {
+		if index, ok := queueIndex(w, r, len(ctl.Queue())); ok {
+			writeResult(w, ctl.DeleteQueueItem(index))
+		}
+	})
+
+	a.mux.HandleFunc("POST /api/queue/{index}/play", func(w http.ResponseWriter, r *http.Request) {
+		if index, ok := queueIndex(w, r, len(ctl.Queue())); ok {
+			writeResult(w, ctl.PlayQueueItem(index))
+		}
+	})
+
+	a.mux.HandleFunc("POST /api/queue/{index}/stopafter", func(w http.ResponseWriter, r *http.Request) {
+		index, ok := queueIndex(w, r, len(ctl.Queue()))
+		if !ok {
+			return
+		}
+		var p struct {
+			Stop *bool `json:"stop"`
+		}
+		if !readJSON(w, r, &p) {
+			return
+		}
+		if p.Stop == nil {
+			writeError(w, http.StatusBadRequest, errors.New("missing \"stop\""))
+			return
+		}
+		writeResult(w, ctl.SetStopAfter(index, *p.Stop))
+	})
+
+	a.mux.HandleFunc("GET /api/search", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("q")
+		if query == "" {
+			writeError(w, http.StatusBadRequest, errors.New("missing query parameter q"))
+			return
+		}
+		result, err := library.Search(query)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+
+	a.mux.HandleFunc("GET /api/coverart/{id}", func(w http.ResponseWriter, r *http.Request) {
+		art, err := library.CoverArt(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "private, max-age=86400")
+		if err := png.Encode(w, art); err != nil {
+			logger.PrintError("http remote: coverart", err)
+		}
+	})
+
+	a.mux.HandleFunc("GET /api/events", a.handleEvents)
+
+	return a
+}
+
+func (a *httpAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="stmps"`)
+		writeError(w, http.StatusUnauthorized, errors.New("invalid or missing token"))
+		return
+	}
+	a.mux.ServeHTTP(w, r)
+}
+
+func (a *httpAPI) authorized(r *http.Request) bool {
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		token, _ = strings.CutPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
+
+// handleEvents streams events to a WebSocket client until it goes away. Like
+// on the control socket, events are dropped for clients that don't keep up.
+func (a *httpAPI) handleEvents(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgradeWebsocket(w, r)
+	if err != nil {
+		return
+	}
+	a.lock.Lock()
+	a.sockets[ws] = struct{}{}
+	a.lock.Unlock()
+	defer func() {
+		a.lock.Lock()
+		delete(a.sockets, ws)
+		a.lock.Unlock()
+		ws.Close()
+	}()
+
+	events := make(chan Event, 64)
+	unsubscribe := a.controller.Subscribe(func(e Event) {
+		select {
+		case events <- e:
+		default:
+		}
+	})
+	defer unsubscribe()
+
+	closed := make(chan struct{})
+	go func() {
+		_ = ws.readLoop()
+		close(closed)
+	}()
+
+	for {
+		select {
+		case e := <-events:
+			msg, err := json.Marshal(e)
+			if err != nil {
+				a.logger.PrintError("http remote: events", err)
+				continue
+			}
+			if err := ws.WriteText(msg); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+func (a *httpAPI) closeSockets() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for ws := range a.sockets {
+		ws.Close()
+	}
+}
+
+// queueIndex parses the {index} path value, sending an error if it isn't a
+// valid index into a queue of length n
+func queueIndex(w http.ResponseWriter, r *http.Request, n int) (int, bool) {
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid queue index %q", r.PathValue("index")))
+		return 0, false
+	}
+	if index < 0 || index >= n {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no queue entry %d (queue length %d)", index, n))
+		return 0, false
+	}
+	return index, true
+}
+
+// readJSON decodes the request body into v, sending an error if that fails
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, httpMaxBody)).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return false
+	}
+	return true
+}
+
+// writeResult answers a request that has no result: 204 No Content, or the
+// error
+func writeResult(w http.ResponseWriter, err error) {
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
@@ -0,0 +1,410 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testToken = "secret"
+
+type fakeLibrary struct{}
+
+func (fakeLibrary) Search(query string) (SearchResult, error) {
+	if query == "fail" {
+		return SearchResult{}, errors.New("server unreachable")
+	}
+	return SearchResult{
+		Artists: []Artist{{Id: "ar1", Name: query + " artist"}},
+		Albums:  []Album{},
+		Songs:   []Track{{Id: "s1", Title: query + " song"}},
+	}, nil
+}
+
+func (fakeLibrary) CoverArt(id string) (image.Image, error) {
+	if id == "missing" {
+		return nil, errors.New("no such cover")
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	return img, nil
+}
+
+func startHTTPAPI(t *testing.T) (*fakeController, *httptest.Server) {
+	t.Helper()
+	ctl := newFakeController()
+	server := httptest.NewServer(newHTTPAPI(ctl, fakeLibrary{}, testToken, testLogger{}))
+	t.Cleanup(server.Close)
+	return ctl, server
+}
+
+// do sends an authorized request, with body encoded as JSON unless it's nil,
+// and decodes the JSON response into result unless it's nil
+func do(t *testing.T, server *httptest.Server, method, path string, body, result interface{}) int {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequest(method, server.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %s", method, path, err)
+	}
+	defer resp.Body.Close()
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			t.Fatalf("%s %s: decoding response: %s", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestHTTPAuth(t *testing.T) {
+	_, server := startHTTPAPI(t)
+
+	resp, err := server.Client().Get(server.URL + "/api/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %d", resp.StatusCode)
+	}
+
+	resp, err = server.Client().Get(server.URL + "/api/status?token=wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 with a wrong token, got %d", resp.StatusCode)
+	}
+
+	resp, err = server.Client().Get(server.URL + "/api/status?token=" + testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200 with the token as query parameter, got %d", resp.StatusCode)
+	}
+
+	if _, err := ListenHTTP("127.0.0.1:0", "", newFakeController(), fakeLibrary{}, testLogger{}); err == nil {
+		t.Error("expected ListenHTTP to refuse running without a token")
+	}
+}
+
+func TestHTTPTransport(t *testing.T) {
+	ctl, server := startHTTPAPI(t)
+
+	for _, m := range []string{MethodPlay, MethodPause, MethodToggle, MethodStop, MethodNext} {
+		if code := do(t, server, "POST", "/api/"+m, nil, nil); code != http.StatusNoContent {
+			t.Errorf("%s: expected 204, got %d", m, code)
+		}
+	}
+	var errResp struct{ Error string }
+	if code := do(t, server, "POST", "/api/previous", nil, &errResp); code != http.StatusInternalServerError || errResp.Error != "no previous track" {
+		t.Errorf("previous: expected the controller's error, got %d %+v", code, errResp)
+	}
+	if code := do(t, server, "GET", "/api/play", nil, nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for GET /api/play, got %d", code)
+	}
+
+	offset := 30
+	if code := do(t, server, "POST", "/api/seek", SeekParams{Offset: &offset}, nil); code != http.StatusNoContent {
+		t.Errorf("seek: expected 204, got %d", code)
+	}
+	if code := do(t, server, "POST", "/api/seek", SeekParams{}, nil); code != http.StatusBadRequest {
+		t.Errorf("seek without params: expected 400, got %d", code)
+	}
+	for _, m := range []string{"undo", "redo"} {
+		if code := do(t, server, "POST", "/api/queue/"+m, nil, nil); code != http.StatusNoContent {
+			t.Errorf("%s: expected 204, got %d", m, code)
+		}
+	}
+	if code := do(t, server, "POST", "/api/autodj", AutoDJParams{Enable: false}, nil); code != http.StatusNoContent {
+		t.Errorf("autodj: expected 204, got %d", code)
+	}
+	if code := do(t, server, "POST", "/api/sleep", SleepParams{Mode: SleepTrack}, nil); code != http.StatusNoContent {
+		t.Errorf("sleep: expected 204, got %d", code)
+	}
+	expected := []string{"play", "pause", "toggle", "stop", "next", "seek +30", "undo", "redo", "autodj false", "sleep track 0 false"}
+	if fmt.Sprint(ctl.calls) != fmt.Sprint(expected) {
+		t.Errorf("expected calls %v, got %v", expected, ctl.calls)
+	}
+
+	volume := 80
+	if code := do(t, server, "POST", "/api/volume", VolumeParams{Set: &volume}, nil); code != http.StatusNoContent {
+		t.Errorf("volume: expected 204, got %d", code)
+	}
+	var status Status
+	if code := do(t, server, "GET", "/api/status", nil, &status); code != http.StatusOK || status.Volume != 80 {
+		t.Errorf("unexpected status %d %+v", code, status)
+	}
+}
+
+func TestHTTPQueue(t *testing.T) {
+	_, server := startHTTPAPI(t)
+
+	var added EnqueueResult
+	if code := do(t, server, "POST", "/api/queue", EnqueueParams{Ids: []string{"a", "b", "c"}}, &added); code != http.StatusOK || added.Added != 3 {
+		t.Fatalf("enqueue: %d %+v", code, added)
+	}
+	if code := do(t, server, "POST", "/api/queue", EnqueueParams{}, nil); code != http.StatusBadRequest {
+		t.Errorf("enqueue without songs: expected 400, got %d", code)
+	}
+
+	var track Track
+	if code := do(t, server, "GET", "/api/queue/1", nil, &track); code != http.StatusOK || track.Id != "b" {
+		t.Errorf("get queue entry: %d %+v", code, track)
+	}
+	if code := do(t, server, "GET", "/api/queue/3", nil, nil); code != http.StatusNotFound {
+		t.Errorf("expected 404 past the end of the queue, got %d", code)
+	}
+	if code := do(t, server, "GET", "/api/queue/x", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a non-numeric index, got %d", code)
+	}
+
+	if code := do(t, server, "PATCH", "/api/queue/2", map[string]int{"to": 0}, nil); code != http.StatusNoContent {
+		t.Errorf("move: expected 204, got %d", code)
+	}
+	if code := do(t, server, "PATCH", "/api/queue/2", map[string]int{}, nil); code != http.StatusBadRequest {
+		t.Errorf("move without target: expected 400, got %d", code)
+	}
+	if code := do(t, server, "DELETE", "/api/queue/1", nil, nil); code != http.StatusNoContent {
+		t.Errorf("delete: expected 204, got %d", code)
+	}
+
+	var queue []Track
+	do(t, server, "GET", "/api/queue", nil, &queue)
+	if len(queue) != 2 || queue[0].Id != "c" || queue[1].Id != "a" {
+		t.Errorf("unexpected queue %+v", queue)
+	}
+
+	if code := do(t, server, "POST", "/api/queue", EnqueueParams{Ids: []string{"d"}, Next: true}, nil); code != http.StatusOK {
+		t.Errorf("enqueue next: expected 200, got %d", code)
+	}
+	if code := do(t, server, "POST", "/api/queue/2/play", nil, nil); code != http.StatusNoContent {
+		t.Errorf("play: expected 204, got %d", code)
+	}
+	if code := do(t, server, "POST", "/api/queue/3/play", nil, nil); code != http.StatusNotFound {
+		t.Errorf("play past the end of the queue: expected 404, got %d", code)
+	}
+	queue = nil
+	do(t, server, "GET", "/api/queue", nil, &queue)
+	if ids := trackIds(queue); ids != "a d" {
+		t.Errorf("unexpected queue %s", ids)
+	}
+
+	if code := do(t, server, "POST", "/api/queue/1/stopafter", map[string]bool{"stop": true}, nil); code != http.StatusNoContent {
+		t.Errorf("stopafter: expected 204, got %d", code)
+	}
+	if code := do(t, server, "POST", "/api/queue/1/stopafter", map[string]bool{}, nil); code != http.StatusBadRequest {
+		t.Errorf("stopafter without stop: expected 400, got %d", code)
+	}
+	queue = nil
+	do(t, server, "GET", "/api/queue", nil, &queue)
+	if queue[0].StopAfter || !queue[1].StopAfter {
+		t.Errorf("expected only the second song marked, got %+v", queue)
+	}
+
+	if code := do(t, server, "DELETE", "/api/queue", nil, nil); code != http.StatusNoContent {
+		t.Errorf("clear: expected 204, got %d", code)
+	}
+	queue = nil
+	do(t, server, "GET", "/api/queue", nil, &queue)
+	if len(queue) != 0 {
+		t.Errorf("expected an empty queue, got %+v", queue)
+	}
+}
+
+func TestHTTPLibrary(t *testing.T) {
+	_, server := startHTTPAPI(t)
+
+	var result SearchResult
+	if code := do(t, server, "GET", "/api/search?q=blue", nil, &result); code != http.StatusOK {
+		t.Fatalf("search: %d", code)
+	}
+	if len(result.Songs) != 1 || result.Songs[0].Title != "blue song" || len(result.Artists) != 1 {
+		t.Errorf("unexpected search result %+v", result)
+	}
+	if code := do(t, server, "GET", "/api/search", nil, nil); code != http.StatusBadRequest {
+		t.Errorf("search without query: expected 400, got %d", code)
+	}
+	if code := do(t, server, "GET", "/api/search?q=fail", nil, nil); code != http.StatusBadGateway {
+		t.Errorf("failed search: expected 502, got %d", code)
+	}
+
+	resp, err := server.Client().Get(server.URL + "/api/coverart/al1?token=" + testToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || ct != "image/png" {
+		t.Fatalf("coverart: %d %s", resp.StatusCode, ct)
+	}
+	img, err := png.Decode(resp.Body)
+	if err != nil {
+		t.Fatalf("coverart isn't a PNG: %s", err)
+	}
+	if img.Bounds().Dx() != 2 {
+		t.Errorf("unexpected image size %v", img.Bounds())
+	}
+	if code := do(t, server, "GET", "/api/coverart/missing", nil, nil); code != http.StatusBadGateway {
+		t.Errorf("missing coverart: expected 502, got %d", code)
+	}
+}
+
+func TestWebsocketAccept(t *testing.T) {
+	// the example from RFC 6455
+	if accept := websocketAccept("dGhlIHNhbXBsZSBub25jZQ=="); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("unexpected accept key %s", accept)
+	}
+}
+
+// testWebsocket is just enough of a client to test the event stream
+type testWebsocket struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialTestWebsocket(t *testing.T, server *httptest.Server, path string) *testWebsocket {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: stmps\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: %s\r\n\r\n", path, key)
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected 101, got %d", resp.StatusCode)
+	}
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != websocketAccept(key) {
+		t.Fatalf("unexpected accept key %s", accept)
+	}
+	return &testWebsocket{conn: conn, r: r}
+}
+
+func (ws *testWebsocket) write(opcode byte, payload []byte) error {
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := ws.conn.Write(frame)
+	return err
+}
+
+func (ws *testWebsocket) read(t *testing.T) (byte, []byte) {
+	t.Helper()
+	ws.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var head [2]byte
+	if _, err := io.ReadFull(ws.r, head[:]); err != nil {
+		t.Fatalf("reading frame: %s", err)
+	}
+	length := int(head[1] & 0x7f)
+	if length == 126 {
+		var ext [2]byte
+		io.ReadFull(ws.r, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.r, payload); err != nil {
+		t.Fatalf("reading frame: %s", err)
+	}
+	return head[0] & 0x0f, payload
+}
+
+func TestHTTPEvents(t *testing.T) {
+	ctl, server := startHTTPAPI(t)
+
+	if code := do(t, server, "GET", "/api/events", nil, nil); code != http.StatusUpgradeRequired {
+		t.Errorf("expected 426 for a plain GET on the event stream, got %d", code)
+	}
+
+	ws := dialTestWebsocket(t, server, "/api/events?token="+testToken)
+	deadline := time.Now().Add(2 * time.Second)
+	for ctl.subscriberCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctl.publish(Event{Event: EventPlaying, Track: &Track{Id: "1", Title: "One"}})
+	opcode, payload := ws.read(t)
+	var e Event
+	if err := json.Unmarshal(payload, &e); opcode != wsText || err != nil {
+		t.Fatalf("expected a JSON text message, got opcode %d: %q", opcode, payload)
+	}
+	if e.Event != EventPlaying || e.Track == nil || e.Track.Title != "One" {
+		t.Errorf("unexpected event %+v", e)
+	}
+
+	if err := ws.write(wsPing, []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if opcode, payload := ws.read(t); opcode != wsPong || string(payload) != "hi" {
+		t.Errorf("expected pong, got opcode %d: %q", opcode, payload)
+	}
+
+	if err := ws.write(wsClose, []byte{0x03, 0xe8}); err != nil {
+		t.Fatal(err)
+	}
+	if opcode, _ := ws.read(t); opcode != wsClose {
+		t.Errorf("expected the close to be echoed, got opcode %d", opcode)
+	}
+	deadline = time.Now().Add(2 * time.Second)
+	for ctl.subscriberCount() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := ctl.subscriberCount(); n != 0 {
+		t.Errorf("expected the subscription to end with the connection, %d left", n)
+	}
+}
+
+func TestHTTPEventsUnauthorized(t *testing.T) {
+	_, server := startHTTPAPI(t)
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET /api/events HTTP/1.1\r\nHost: stmps\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401, got %d", resp.StatusCode)
+	}
+}
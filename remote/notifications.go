@@ -0,0 +1,279 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package remote
+
+import (
+	"image"
+	"image/draw"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/spezifisch/stmps/logger"
+)
+
+// Desktop notifications, see
+// https://specifications.freedesktop.org/notification-spec/latest/
+
+const (
+	notificationsName = "org.freedesktop.Notifications"
+	notificationsPath = dbus.ObjectPath("/org/freedesktop/Notifications")
+)
+
+// Actions offered on song notifications
+const (
+	NotificationActionNext = "next"
+	NotificationActionStar = "star"
+)
+
+// notificationImageSize is the maximum width and height of the cover art sent
+// with a notification; servers show it much smaller anyway, and the whole
+// image goes over the bus
+const notificationImageSize = 256
+
+type NotifierOptions struct {
+	// Timeout is how long notifications are shown; 0 leaves it to the server
+	Timeout time.Duration
+	// Actions enables the "next" and "star" buttons, if the server supports them
+	Actions bool
+	// Icon is shown if there is no cover art
+	Icon string
+}
+
+// Notifier shows a desktop notification for the current song. A new song
+// replaces the previous song's notification instead of stacking up.
+type Notifier struct {
+	conn    *dbus.Conn
+	ownConn bool
+	obj     dbus.BusObject
+	logger  logger.LoggerInterface
+
+	timeout int32
+	icon    string
+	actions bool
+	markup  bool
+
+	// onAction is called with the action key and the song ID when a button
+	// of the current notification is clicked
+	onAction func(action, songId string)
+	signals  chan *dbus.Signal
+
+	lock   sync.Mutex
+	lastId uint32
+	songId string
+}
+
+// notificationImage is the image-data hint, (iiibiiay)
+type notificationImage struct {
+	Width         int32
+	Height        int32
+	Rowstride     int32
+	HasAlpha      bool
+	BitsPerSample int32
+	Channels      int32
+	Data          []byte
+}
+
+// RegisterNotifier connects to the session bus and creates a Notifier on it
+func RegisterNotifier(options NotifierOptions, onAction func(action, songId string), logger logger.LoggerInterface) (*Notifier, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, err
+	}
+	n, err := NewNotifier(conn, options, onAction, logger)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	n.ownConn = true
+	return n, nil
+}
+
+// NewNotifier creates a Notifier that talks to the notification server on
+// conn. onAction may be nil if options.Actions is false.
+func NewNotifier(conn *dbus.Conn, options NotifierOptions, onAction func(action, songId string), logger logger.LoggerInterface) (*Notifier, error) {
+	n := &Notifier{
+		conn:     conn,
+		obj:      conn.Object(notificationsName, notificationsPath),
+		logger:   logger,
+		timeout:  -1,
+		icon:     options.Icon,
+		onAction: onAction,
+	}
+	if options.Timeout > 0 {
+		n.timeout = int32(options.Timeout.Milliseconds())
+	}
+
+	var capabilities []string
+	if err := n.obj.Call(notificationsName+".GetCapabilities", 0).Store(&capabilities); err != nil {
+		return nil, err
+	}
+	for _, c := range capabilities {
+		switch c {
+		case "actions":
+			n.actions = options.Actions && onAction != nil
+		case "body-markup":
+			n.markup = true
+		}
+	}
+
+	if n.actions {
+		err := conn.AddMatchSignal(
+			dbus.WithMatchInterface(notificationsName),
+			dbus.WithMatchObjectPath(notificationsPath),
+		)
+		if err != nil {
+			return nil, err
+		}
+		n.signals = make(chan *dbus.Signal, 8)
+		conn.Signal(n.signals)
+		go n.signalLoop()
+	}
+	return n, nil
+}
+
+func (n *Notifier) signalLoop() {
+	for signal := range n.signals {
+		switch signal.Name {
+		case notificationsName + ".ActionInvoked":
+			var id uint32
+			var action string
+			if err := dbus.Store(signal.Body, &id, &action); err != nil {
+				n.logger.PrintError("notification ActionInvoked", err)
+				continue
+			}
+			n.lock.Lock()
+			current, songId := id == n.lastId, n.songId
+			n.lock.Unlock()
+			// buttons on notifications of earlier songs must not act on the
+			// current one
+			if current {
+				n.onAction(action, songId)
+			}
+
+		case notificationsName + ".NotificationClosed":
+			var id, reason uint32
+			if err := dbus.Store(signal.Body, &id, &reason); err != nil {
+				continue
+			}
+			n.lock.Lock()
+			if id == n.lastId {
+				n.lastId = 0
+			}
+			n.lock.Unlock()
+		}
+	}
+}
+
+// Notify shows the notification for a song, replacing the previous one.
+// coverArt may be nil. starred selects the label of the star button.
+func (n *Notifier) Notify(track Track, coverArt image.Image, starred bool) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	var body []string
+	for _, s := range []string{track.Artist, track.Album} {
+		if s != "" {
+			body = append(body, n.escape(s))
+		}
+	}
+
+	var actions []string
+	if n.actions {
+		starLabel := "Star"
+		if starred {
+			starLabel = "Unstar"
+		}
+		actions = []string{NotificationActionNext, "Next", NotificationActionStar, starLabel}
+	}
+
+	icon := n.icon
+	hints := map[string]dbus.Variant{
+		"category": dbus.MakeVariant("x-stmps.song"),
+	}
+	if coverArt != nil {
+		icon = ""
+		hints["image-data"] = dbus.MakeVariant(newNotificationImage(coverArt))
+	}
+
+	var id uint32
+	err := n.obj.Call(notificationsName+".Notify", 0,
+		"stmps", n.lastId, icon, track.Title, strings.Join(body, "\n"),
+		actions, hints, n.timeout).Store(&id)
+	if err != nil {
+		return err
+	}
+	n.lastId = id
+	n.songId = track.Id
+	return nil
+}
+
+func (n *Notifier) escape(s string) string {
+	if !n.markup {
+		return s
+	}
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// Close removes the current notification, whose buttons would do nothing
+// anymore, and disconnects.
+func (n *Notifier) Close() {
+	n.lock.Lock()
+	if n.lastId != 0 {
+		if err := n.obj.Call(notificationsName+".CloseNotification", 0, n.lastId).Err; err != nil {
+			n.logger.PrintError("CloseNotification", err)
+		}
+		n.lastId = 0
+	}
+	n.lock.Unlock()
+
+	if n.signals != nil {
+		n.conn.RemoveSignal(n.signals)
+		close(n.signals)
+	}
+	if n.ownConn {
+		if err := n.conn.Close(); err != nil {
+			n.logger.PrintError("Notifier Close", err)
+		}
+	}
+}
+
+// newNotificationImage converts an image to (non-premultiplied) RGBA, scaled
+// down to at most notificationImageSize
+func newNotificationImage(img image.Image) notificationImage {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > notificationImageSize || height > notificationImageSize {
+		if width > height {
+			width, height = notificationImageSize, max(1, height*notificationImageSize/width)
+		} else {
+			width, height = max(1, width*notificationImageSize/height), notificationImageSize
+		}
+	}
+
+	nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+	if width == bounds.Dx() && height == bounds.Dy() {
+		draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+	} else {
+		// nearest neighbour is good enough for a thumbnail
+		for y := 0; y < height; y++ {
+			sy := bounds.Min.Y + y*bounds.Dy()/height
+			for x := 0; x < width; x++ {
+				sx := bounds.Min.X + x*bounds.Dx()/width
+				nrgba.Set(x, y, img.At(sx, sy))
+			}
+		}
+	}
+
+	return notificationImage{
+		Width:         int32(width),
+		Height:        int32(height),
+		Rowstride:     int32(nrgba.Stride),
+		HasAlpha:      true,
+		BitsPerSample: 8,
+		Channels:      4,
+		Data:          nrgba.Pix,
+	}
+}
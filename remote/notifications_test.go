@@ -0,0 +1,273 @@
+package remote
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const testBusConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:path=%s</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`
+
+// startTestBus runs a private dbus-daemon and returns its address
+func startTestBus(t *testing.T) string {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not installed")
+	}
+
+	dir := t.TempDir()
+	config := filepath.Join(dir, "bus.conf")
+	if err := os.WriteFile(config, []byte(fmt.Sprintf(testBusConfig, filepath.Join(dir, "bus"))), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(daemon, "--config-file="+config, "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading bus address: %v", err)
+	}
+	return strings.TrimSpace(address)
+}
+
+type fakeNotification struct {
+	replacesId uint32
+	icon       string
+	summary    string
+	body       string
+	actions    []string
+	hints      map[string]dbus.Variant
+}
+
+// fakeNotificationServer implements org.freedesktop.Notifications
+type fakeNotificationServer struct {
+	conn         *dbus.Conn
+	capabilities []string
+
+	lock          sync.Mutex
+	nextId        uint32
+	notifications []fakeNotification
+	closed        []uint32
+}
+
+func startFakeNotificationServer(t *testing.T, address string, capabilities ...string) *fakeNotificationServer {
+	t.Helper()
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	s := &fakeNotificationServer{conn: conn, capabilities: capabilities, nextId: 1}
+	if err := conn.Export(s, notificationsPath, notificationsName); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := conn.RequestName(notificationsName, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("RequestName: %v %v", reply, err)
+	}
+	return s
+}
+
+func (s *fakeNotificationServer) GetCapabilities() ([]string, *dbus.Error) {
+	return s.capabilities, nil
+}
+
+func (s *fakeNotificationServer) Notify(appName string, replacesId uint32, icon, summary, body string,
+	actions []string, hints map[string]dbus.Variant, timeout int32) (uint32, *dbus.Error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.notifications = append(s.notifications, fakeNotification{
+		replacesId: replacesId,
+		icon:       icon,
+		summary:    summary,
+		body:       body,
+		actions:    actions,
+		hints:      hints,
+	})
+	if replacesId != 0 {
+		return replacesId, nil
+	}
+	id := s.nextId
+	s.nextId++
+	return id, nil
+}
+
+func (s *fakeNotificationServer) CloseNotification(id uint32) *dbus.Error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.closed = append(s.closed, id)
+	return nil
+}
+
+func (s *fakeNotificationServer) invoke(t *testing.T, id uint32, action string) {
+	t.Helper()
+	if err := s.conn.Emit(notificationsPath, notificationsName+".ActionInvoked", id, action); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (s *fakeNotificationServer) last(t *testing.T) fakeNotification {
+	t.Helper()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.notifications) == 0 {
+		t.Fatal("no notification sent")
+	}
+	return s.notifications[len(s.notifications)-1]
+}
+
+func newTestNotifier(t *testing.T, address string, options NotifierOptions, onAction func(action, songId string)) *Notifier {
+	t.Helper()
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	n, err := NewNotifier(conn, options, onAction, testLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestNotifierReplaces(t *testing.T) {
+	address := startTestBus(t)
+	server := startFakeNotificationServer(t, address, "actions", "body", "body-markup")
+	n := newTestNotifier(t, address, NotifierOptions{Actions: true, Icon: "audio-x-generic", Timeout: 5 * time.Second}, func(string, string) {})
+
+	if err := n.Notify(Track{Id: "1", Title: "Song", Artist: "Me & You", Album: "<Album>"}, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	first := server.last(t)
+	if first.replacesId != 0 || first.summary != "Song" || first.body != "Me &amp; You\n&lt;Album&gt;" || first.icon != "audio-x-generic" {
+		t.Errorf("unexpected first notification %+v", first)
+	}
+	if want := []string{"next", "Next", "star", "Star"}; fmt.Sprint(first.actions) != fmt.Sprint(want) {
+		t.Errorf("actions %v, want %v", first.actions, want)
+	}
+
+	art := image.NewRGBA(image.Rect(0, 0, 512, 256))
+	art.Set(0, 0, color.RGBA{R: 255, A: 255})
+	if err := n.Notify(Track{Id: "2", Title: "Other", Artist: "Them"}, art, true); err != nil {
+		t.Fatal(err)
+	}
+	second := server.last(t)
+	if second.replacesId != 1 {
+		t.Errorf("second notification replaces %d, want 1", second.replacesId)
+	}
+	if second.actions[3] != "Unstar" {
+		t.Errorf("star label %q for a starred song", second.actions[3])
+	}
+
+	var img notificationImage
+	if err := second.hints["image-data"].Store(&img); err != nil {
+		t.Fatalf("image-data: %v", err)
+	}
+	if img.Width != 256 || img.Height != 128 || img.Channels != 4 || len(img.Data) != int(img.Rowstride*img.Height) {
+		t.Errorf("unexpected image %dx%d, %d channels, %d bytes", img.Width, img.Height, img.Channels, len(img.Data))
+	}
+	if img.Data[0] != 255 || img.Data[3] != 255 {
+		t.Errorf("first pixel %v, want opaque red", img.Data[:4])
+	}
+
+	n.Close()
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if len(server.closed) != 1 || server.closed[0] != 1 {
+		t.Errorf("closed %v, want [1]", server.closed)
+	}
+}
+
+func TestNotifierActions(t *testing.T) {
+	address := startTestBus(t)
+	server := startFakeNotificationServer(t, address, "actions")
+
+	type action struct{ action, songId string }
+	actions := make(chan action, 4)
+	n := newTestNotifier(t, address, NotifierOptions{Actions: true}, func(a, songId string) {
+		actions <- action{a, songId}
+	})
+	defer n.Close()
+
+	if err := n.Notify(Track{Id: "song-1", Title: "Song"}, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// a notification that isn't ours
+	server.invoke(t, 42, NotificationActionNext)
+	server.invoke(t, 1, NotificationActionStar)
+	select {
+	case a := <-actions:
+		if a.action != NotificationActionStar || a.songId != "song-1" {
+			t.Errorf("got action %+v", a)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no action received")
+	}
+
+	server.invoke(t, 1, NotificationActionNext)
+	select {
+	case a := <-actions:
+		if a.action != NotificationActionNext {
+			t.Errorf("got action %+v", a)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no action received")
+	}
+}
+
+func TestNotifierWithoutActions(t *testing.T) {
+	address := startTestBus(t)
+	server := startFakeNotificationServer(t, address, "body")
+
+	n := newTestNotifier(t, address, NotifierOptions{Actions: true}, func(string, string) {
+		t.Error("unexpected action")
+	})
+	defer n.Close()
+
+	if err := n.Notify(Track{Id: "1", Title: "Song", Artist: "A & B"}, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	got := server.last(t)
+	if len(got.actions) != 0 {
+		t.Errorf("actions %v sent to a server without actions", got.actions)
+	}
+	if got.body != "A & B" {
+		t.Errorf("body %q escaped without body-markup", got.body)
+	}
+}
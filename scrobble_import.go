@@ -0,0 +1,272 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spezifisch/stmps/history"
+	"github.com/spezifisch/stmps/logger"
+	"github.com/spezifisch/stmps/subsonic"
+	"github.com/spf13/viper"
+)
+
+// importedScrobblesFile returns where the keys of the scrobbles that were
+// imported from .scrobbler.logs are kept
+func importedScrobblesFile() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "imported-scrobbles"), nil
+}
+
+// scrobbleKey identifies a play across logs: devices don't know song IDs, so
+// it's when it was played, and what
+func scrobbleKey(unix int64, artist, title string) string {
+	return strconv.FormatInt(unix, 10) + "\t" + strings.ToLower(artist) + "\t" + strings.ToLower(title)
+}
+
+// loadSubmittedScrobbles returns the keys of the plays that were already
+// submitted: the ones imported before, and the ones in the listening history,
+// which stmps scrobbled while playing them
+func loadSubmittedScrobbles(importedFile string) (map[string]bool, error) {
+	submitted := make(map[string]bool)
+
+	file, err := os.Open(importedFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			submitted[scanner.Text()] = true
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if viper.GetBool("history.enable") {
+		path, err := historyFile()
+		if err != nil {
+			return nil, err
+		}
+		plays, err := history.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, play := range plays {
+			if !play.Skipped {
+				submitted[scrobbleKey(play.Time.Unix(), play.Artist, play.Title)] = true
+			}
+		}
+	}
+	return submitted, nil
+}
+
+// matchSong picks the song that a log entry is about from search results, or
+// returns false if none of them has its title and artist
+func matchSong(entry history.ScrobblerLogEntry, songs []subsonic.Entity) (subsonic.Entity, bool) {
+	var best subsonic.Entity
+	bestScore := 0
+	for _, song := range songs {
+		if song.IsDirectory || !strings.EqualFold(song.Title, entry.Title) || !songHasArtist(song, entry.Artist) {
+			continue
+		}
+		score := 1
+		if entry.MusicBrainzId != "" && song.MusicBrainzId == entry.MusicBrainzId {
+			score += 4
+		}
+		if entry.Album != "" && strings.EqualFold(song.Album, entry.Album) {
+			score += 2
+		}
+		if entry.Duration > 0 && song.Duration > 0 && abs(song.Duration-entry.Duration) <= 5 {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = song, score
+		}
+	}
+	return best, bestScore > 0
+}
+
+func songHasArtist(song subsonic.Entity, artist string) bool {
+	if strings.EqualFold(song.Artist, artist) {
+		return true
+	}
+	for _, a := range song.Artists {
+		if strings.EqualFold(a.Name, artist) {
+			return true
+		}
+	}
+	return false
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+// findSong looks up the song a log entry is about on the server
+func findSong(connection *subsonic.Connection, entry history.ScrobblerLogEntry) (subsonic.Entity, bool, error) {
+	// the title alone finds the song more reliably on servers that don't
+	// search across fields; the artist narrows it down on the ones that do
+	for _, query := range []string{entry.Title, entry.Artist + " " + entry.Title} {
+		results, err := connection.Search(query, 0, 0, 0)
+		if err != nil {
+			return subsonic.Entity{}, false, err
+		}
+		if song, ok := matchSong(entry, results.Songs); ok {
+			return song, true, nil
+		}
+	}
+	return subsonic.Entity{}, false, nil
+}
+
+// runScrobbleImport implements `stmps scrobble-import`, which submits the
+// plays in a .scrobbler.log from a portable player to the server. It returns
+// the process exit code.
+func runScrobbleImport(args []string) int {
+	flags := flag.NewFlagSet("scrobble-import", flag.ContinueOnError)
+	configFile := flags.String("config", "", "use config `file`")
+	dryRun := flags.Bool("dry-run", false, "only show what would be submitted")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "USAGE: %s scrobble-import [-config file] [-dry-run] <.scrobbler.log>\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Submits the listened plays in a .scrobbler.log to the server as scrobbles, with the\n"+
+			"time they were played. Plays that were already submitted are skipped, so a log can\n"+
+			"be imported again after more plays were added to it.\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	if err := readConfig(configFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read configuration: %s", err)
+		return 2
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	entries, err := history.ReadScrobblerLog(file)
+	file.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", flags.Arg(0), err)
+		return 1
+	}
+
+	importedFile, err := importedScrobblesFile()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	submitted, err := loadSubmittedScrobbles(importedFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to read the submitted scrobbles: %s\n", err)
+		return 1
+	}
+
+	// the connection logs to stderr
+	logger := logger.Init("")
+	go func() {
+		for msg := range logger.Prints {
+			fmt.Fprintln(os.Stderr, msg)
+		}
+	}()
+	connection := newConnection(logger)
+
+	// keys are appended as they're submitted, so that an import that's cut
+	// short doesn't submit anything twice when it's retried
+	var record *os.File
+	if !*dryRun {
+		if err := os.MkdirAll(filepath.Dir(importedFile), 0700); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		record, err = os.OpenFile(importedFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer record.Close()
+	}
+
+	var imported, duplicates, skipped, notFound, failed int
+	for _, entry := range entries {
+		if !entry.Listened {
+			skipped++
+			continue
+		}
+		key := scrobbleKey(entry.Time.Unix(), entry.Artist, entry.Title)
+		if submitted[key] {
+			duplicates++
+			continue
+		}
+		// also the same play twice in this log
+		submitted[key] = true
+
+		description := fmt.Sprintf("%s %s - %s", entry.Time.Format("2006-01-02 15:04"), entry.Artist, entry.Title)
+		song, ok, err := findSong(connection, entry)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", description, err)
+			failed++
+			continue
+		}
+		if !ok {
+			fmt.Printf("not found: %s\n", description)
+			notFound++
+			continue
+		}
+
+		if *dryRun {
+			fmt.Printf("would submit: %s\n", description)
+			imported++
+			continue
+		}
+		resp, err := connection.ScrobbleAt(song.Id, entry.Time)
+		if err == nil && resp.Status != "ok" {
+			err = errors.New(resp.Error.Message)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", description, err)
+			failed++
+			continue
+		}
+		if _, err := record.WriteString(key + "\n"); err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to record the submitted scrobble: %s\n", err)
+			return 1
+		}
+		fmt.Printf("submitted: %s\n", description)
+		imported++
+	}
+
+	verb := "submitted"
+	if *dryRun {
+		verb = "to submit"
+	}
+	fmt.Printf("%d %s, %d already submitted, %d skipped plays, %d not found, %d failed\n",
+		imported, verb, duplicates, skipped, notFound, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spezifisch/stmps/history"
+	"github.com/spezifisch/stmps/subsonic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchSong(t *testing.T) {
+	song := func(id, title, artist, album string, duration int) subsonic.Entity {
+		return subsonic.Entity{EntityBase: subsonic.EntityBase{Id: id, Title: title, Artist: artist, Album: album, Duration: duration}}
+	}
+	entry := history.ScrobblerLogEntry{Artist: "Band", Album: "LP", Title: "Hit", Duration: 181}
+
+	songs := []subsonic.Entity{
+		song("1", "Hit", "Other Band", "LP", 181),
+		song("2", "hit", "band", "Best Of", 185),
+		song("3", "Hit", "Band", "LP", 181),
+	}
+	match, ok := matchSong(entry, songs)
+	assert.True(t, ok)
+	assert.Equal(t, "3", match.Id, "the song from the same album wins")
+
+	match, ok = matchSong(entry, songs[:2])
+	assert.True(t, ok)
+	assert.Equal(t, "2", match.Id, "title and artist are enough")
+
+	featured := song("4", "Hit", "Band feat. Singer", "", 0)
+	featured.Artists = []subsonic.Artist{{Name: "Band"}, {Name: "Singer"}}
+	match, ok = matchSong(entry, []subsonic.Entity{featured})
+	assert.True(t, ok)
+	assert.Equal(t, "4", match.Id, "any of the artists")
+
+	_, ok = matchSong(entry, songs[:1])
+	assert.False(t, ok)
+}
+
+func TestScrobbleKey(t *testing.T) {
+	assert.Equal(t, scrobbleKey(1714564800, "Band", "Hit"), scrobbleKey(1714564800, "BAND", "hit"))
+	assert.NotEqual(t, scrobbleKey(1714564800, "Band", "Hit"), scrobbleKey(1714564801, "Band", "Hit"))
+}
@@ -0,0 +1,254 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spezifisch/stmps/logger"
+	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spezifisch/stmps/subsonic"
+	"github.com/spf13/viper"
+)
+
+// scrobbleSong is what sinks get to know about a song. It's also what's kept
+// of a song in the queue of pending scrobbles.
+type scrobbleSong struct {
+	Id                   string   `json:"id"`
+	Title                string   `json:"title,omitempty"`
+	Artist               string   `json:"artist,omitempty"`
+	Album                string   `json:"album,omitempty"`
+	Duration             int      `json:"duration,omitempty"`
+	TrackNumber          int      `json:"trackNumber,omitempty"`
+	MusicBrainzId        string   `json:"mbid,omitempty"`
+	AlbumMusicBrainzId   string   `json:"albumMbid,omitempty"`
+	ArtistMusicBrainzIds []string `json:"artistMbids,omitempty"`
+}
+
+func newScrobbleSong(item mpvplayer.QueueItem) scrobbleSong {
+	return scrobbleSong{
+		Id:                   item.Id,
+		Title:                item.Title,
+		Artist:               item.Artist,
+		Album:                item.Album,
+		Duration:             item.Duration,
+		TrackNumber:          item.TrackNumber,
+		MusicBrainzId:        item.MusicBrainzId,
+		AlbumMusicBrainzId:   item.AlbumMusicBrainzId,
+		ArtistMusicBrainzIds: item.ArtistMusicBrainzIds,
+	}
+}
+
+// scrobbleSink is a service that plays are reported to
+type scrobbleSink interface {
+	// Name identifies the sink in logs and in the name of its queue file
+	Name() string
+	// NowPlaying reports the song that just started
+	NowPlaying(song scrobbleSong) error
+	// Scrobble submits a play of song, which started at playedAt. If the sink
+	// will never take it, the error is a scrobbleRejectedError; other errors
+	// are retried later.
+	Scrobble(song scrobbleSong, playedAt time.Time) error
+}
+
+// scrobbleRejectedError is a submission that the sink refused, and that
+// therefore isn't retried
+type scrobbleRejectedError struct {
+	err error
+}
+
+func (e scrobbleRejectedError) Error() string {
+	return "rejected: " + e.err.Error()
+}
+
+func (e scrobbleRejectedError) Unwrap() error {
+	return e.err
+}
+
+// newScrobbleSinks returns the sinks enabled in the config: the Subsonic
+// server (server.scrobble), and ListenBrainz ([scrobble.listenbrainz])
+func newScrobbleSinks(connection *subsonic.Connection, logger logger.LoggerInterface) (sinks []scrobbleSink) {
+	if connection.Scrobble {
+		sinks = append(sinks, subsonicSink{connection})
+	}
+	if viper.GetBool("scrobble.listenbrainz.enable") {
+		token := viper.GetString("scrobble.listenbrainz.token")
+		if token == "" {
+			logger.PrintError("scrobble.listenbrainz", errors.New("no token configured"))
+		} else {
+			sinks = append(sinks, newListenBrainzSink(viper.GetString("scrobble.listenbrainz.url"), token))
+		}
+	}
+	return
+}
+
+// subsonicSink scrobbles through the Subsonic server, which forwards the
+// scrobbles to wherever it's configured to
+type subsonicSink struct {
+	connection *subsonic.Connection
+}
+
+func (subsonicSink) Name() string {
+	return "subsonic"
+}
+
+func (s subsonicSink) NowPlaying(song scrobbleSong) error {
+	_, err := s.connection.ScrobbleSubmission(song.Id, false)
+	return err
+}
+
+func (s subsonicSink) Scrobble(song scrobbleSong, playedAt time.Time) error {
+	resp, err := s.connection.ScrobbleAt(song.Id, playedAt)
+	if err != nil {
+		return err
+	}
+	if resp.Status != "failed" {
+		return nil
+	}
+	err = fmt.Errorf("Subsonic: error %d: %s", resp.Error.Code, resp.Error.Message)
+	switch resp.Error.Code {
+	case subsonicErrorMissingParameter, subsonicErrorNotFound:
+		// it's the scrobble itself that's wrong. Anything else, including
+		// failed authentication, might work later, e.g. after fixing the
+		// config.
+		return scrobbleRejectedError{err}
+	}
+	return err
+}
+
+// The Subsonic error codes of scrobbles that are wrong, see
+// https://opensubsonic.netlify.app/docs/responses/error/
+const (
+	subsonicErrorMissingParameter = 10
+	subsonicErrorNotFound         = 70
+)
+
+// defaultListenBrainzUrl is the ListenBrainz API; other services implement the
+// same API under their own URL
+const defaultListenBrainzUrl = "https://api.listenbrainz.org"
+
+// listenBrainzSink submits listens directly to ListenBrainz, see
+// https://listenbrainz.readthedocs.io/en/latest/users/api/core.html
+type listenBrainzSink struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func newListenBrainzSink(url, token string) *listenBrainzSink {
+	if url == "" {
+		url = defaultListenBrainzUrl
+	}
+	return &listenBrainzSink{
+		url:    strings.TrimSuffix(url, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type listenBrainzSubmission struct {
+	ListenType string               `json:"listen_type"`
+	Payload    []listenBrainzListen `json:"payload"`
+}
+
+type listenBrainzListen struct {
+	ListenedAt    int64                     `json:"listened_at,omitempty"`
+	TrackMetadata listenBrainzTrackMetadata `json:"track_metadata"`
+}
+
+type listenBrainzTrackMetadata struct {
+	ArtistName     string                 `json:"artist_name"`
+	TrackName      string                 `json:"track_name"`
+	ReleaseName    string                 `json:"release_name,omitempty"`
+	AdditionalInfo listenBrainzAdditional `json:"additional_info"`
+}
+
+type listenBrainzAdditional struct {
+	MediaPlayer             string   `json:"media_player"`
+	SubmissionClient        string   `json:"submission_client"`
+	SubmissionClientVersion string   `json:"submission_client_version"`
+	DurationMs              int      `json:"duration_ms,omitempty"`
+	TrackNumber             int      `json:"tracknumber,omitempty"`
+	RecordingMbid           string   `json:"recording_mbid,omitempty"`
+	ReleaseMbid             string   `json:"release_mbid,omitempty"`
+	ArtistMbids             []string `json:"artist_mbids,omitempty"`
+}
+
+func (listenBrainzSink) Name() string {
+	return "listenbrainz"
+}
+
+func (l *listenBrainzSink) NowPlaying(song scrobbleSong) error {
+	return l.submit("playing_now", listenBrainzListen{TrackMetadata: newListenBrainzTrackMetadata(song)})
+}
+
+func (l *listenBrainzSink) Scrobble(song scrobbleSong, playedAt time.Time) error {
+	return l.submit("single", listenBrainzListen{
+		ListenedAt:    playedAt.Unix(),
+		TrackMetadata: newListenBrainzTrackMetadata(song),
+	})
+}
+
+func newListenBrainzTrackMetadata(song scrobbleSong) listenBrainzTrackMetadata {
+	return listenBrainzTrackMetadata{
+		ArtistName:  song.Artist,
+		TrackName:   song.Title,
+		ReleaseName: song.Album,
+		AdditionalInfo: listenBrainzAdditional{
+			MediaPlayer:             Name,
+			SubmissionClient:        Name,
+			SubmissionClientVersion: Version,
+			DurationMs:              song.Duration * 1000,
+			TrackNumber:             song.TrackNumber,
+			RecordingMbid:           song.MusicBrainzId,
+			ReleaseMbid:             song.AlbumMusicBrainzId,
+			ArtistMbids:             song.ArtistMusicBrainzIds,
+		},
+	}
+}
+
+func (l *listenBrainzSink) submit(listenType string, listen listenBrainzListen) error {
+	if listen.TrackMetadata.ArtistName == "" || listen.TrackMetadata.TrackName == "" {
+		return scrobbleRejectedError{errors.New("artist and title are required")}
+	}
+	body, err := json.Marshal(listenBrainzSubmission{
+		ListenType: listenType,
+		Payload:    []listenBrainzListen{listen},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, l.url+"/1/submit-listens", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+l.token)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+	message, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	err = fmt.Errorf("ListenBrainz: %s: %s", res.Status, strings.TrimSpace(string(message)))
+	switch res.StatusCode {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		// it's the listen itself that's wrong. Anything else, including an
+		// invalid token, might work later, e.g. after fixing the config.
+		return scrobbleRejectedError{err}
+	}
+	return err
+}
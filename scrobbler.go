@@ -0,0 +1,345 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/spezifisch/stmps/logger"
+	"github.com/spezifisch/stmps/mpvplayer"
+)
+
+// see: https://www.last.fm/api/scrobbling
+// A track should only be scrobbled when the following conditions have been met:
+// The track must be longer than 30 seconds. And the track has been played for
+// at least half its duration, or for 4 minutes (whichever occurs earlier.)
+const (
+	scrobbleMinDuration = 30
+	scrobbleMaxPlayed   = 240
+)
+
+// scrobbleMaxStep is the largest advance of the playback position between two
+// status updates that still counts as played; anything larger is a seek
+const scrobbleMaxStep = 5
+
+// failed submissions are retried with exponential backoff between these
+const (
+	scrobbleRetryMin = 30 * time.Second
+	scrobbleRetryMax = 30 * time.Minute
+)
+
+// scrobbleQueueLimit is the maximum number of pending scrobbles; if the
+// server is unreachable for that long, the oldest ones are dropped
+const scrobbleQueueLimit = 10000
+
+// pendingScrobble is a scrobble that wasn't submitted yet
+type pendingScrobble struct {
+	scrobbleSong
+	// when the song started playing
+	Time time.Time `json:"time"`
+}
+
+// scrobbler reports plays to the configured scrobble sinks. It runs as part
+// of the Core, so it works the same with or without the TUI.
+//
+// A song is scrobbled once it was actually played long enough: only the
+// advance of the playback position counts, so pausing and seeking don't.
+// Each sink has its own queue of scrobbles that it didn't take yet, e.g.
+// while offline, so a sink that's down doesn't hold up the others.
+type scrobbler struct {
+	sinks  []*sinkQueue
+	logger logger.LoggerInterface
+
+	// the current song; only used from the player's event loop
+	song      mpvplayer.QueueItem
+	startedAt time.Time
+	clock     playClock
+	submitted bool
+}
+
+// playClock counts how long a song was actually played, from the player's
+// position updates
+type playClock struct {
+	played       int64
+	lastPosition int64
+}
+
+// update advances the clock to the current playback position
+func (c *playClock) update(position int64) {
+	step := position - c.lastPosition
+	c.lastPosition = position
+	if step <= 0 || step > scrobbleMaxStep {
+		// paused, seeked, or a late update of the previous song
+		return
+	}
+	c.played += step
+}
+
+// listenThreshold is how long a song has to be played to count as listened
+// to, in seconds
+func listenThreshold(duration int) int64 {
+	if duration/2 > scrobbleMaxPlayed {
+		return scrobbleMaxPlayed
+	}
+	return int64(duration / 2)
+}
+
+// sinkQueue submits to one sink. Scrobbles are kept in queueFile, with the
+// time the song was played, and retried until the sink takes them.
+type sinkQueue struct {
+	sink   scrobbleSink
+	logger logger.LoggerInterface
+
+	// scrobbles are handled by background loop, which wake tells about new
+	// pending ones
+	nowPlaying chan scrobbleSong
+	wake       chan struct{}
+
+	queueFile string
+	// the player's event loop adds to pending, and the background loop
+	// submits from it
+	lock    sync.Mutex
+	pending []pendingScrobble
+}
+
+// scrobbleQueueDir returns where pending scrobbles are kept
+func scrobbleQueueDir() (string, error) {
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "scrobbles"), nil
+}
+
+// newScrobbler creates a scrobbler that keeps pending scrobbles in queueDir,
+// in a file per sink. If queueDir is empty, they're only kept in memory.
+func newScrobbler(sinks []scrobbleSink, queueDir string, logger logger.LoggerInterface) *scrobbler {
+	s := &scrobbler{logger: logger}
+	for _, sink := range sinks {
+		q := &sinkQueue{
+			sink:       sink,
+			logger:     logger,
+			nowPlaying: make(chan scrobbleSong, 5),
+			wake:       make(chan struct{}, 1),
+		}
+		if queueDir != "" {
+			q.queueFile = filepath.Join(queueDir, sink.Name()+".json")
+		}
+		if err := q.loadQueue(); err != nil {
+			logger.PrintError("scrobbler: loading pending "+sink.Name()+" scrobbles", err)
+		}
+		s.sinks = append(s.sinks, q)
+	}
+	return s
+}
+
+// run starts submitting in the background
+func (s *scrobbler) run() {
+	for _, q := range s.sinks {
+		go q.run()
+	}
+}
+
+// songStarted is called when the player starts a song, including when it
+// starts the same song again
+func (s *scrobbler) songStarted(currentSong mpvplayer.QueueItem) {
+	s.song = mpvplayer.QueueItem{}
+	if len(s.sinks) == 0 {
+		return
+	}
+
+	// scrobble "now playing" event (delegate to background event loop); it's
+	// pointless once the song is over, so it's dropped if the loop is busy
+	song := newScrobbleSong(currentSong)
+	for _, q := range s.sinks {
+		select {
+		case q.nowPlaying <- song:
+		default:
+			s.logger.Printf("scrobbler: %s: dropping now playing %s", q.sink.Name(), song.Id)
+		}
+	}
+
+	if currentSong.Duration <= scrobbleMinDuration {
+		s.logger.Printf("scrobbler: track too short")
+		return
+	}
+	s.song = currentSong
+	s.startedAt = time.Now()
+	s.clock = playClock{}
+	s.submitted = false
+}
+
+// progress is called with the player's status updates, and submits the
+// scrobble once the current song was played long enough
+func (s *scrobbler) progress(status mpvplayer.StatusData) {
+	if s.song.Id == "" || s.submitted {
+		return
+	}
+
+	s.clock.update(status.Position)
+	if s.clock.played < listenThreshold(s.song.Duration) {
+		return
+	}
+
+	s.submitted = true
+	s.logger.Printf("scrobbling: %s", s.song.Id)
+	scrobble := pendingScrobble{scrobbleSong: newScrobbleSong(s.song), Time: s.startedAt}
+	for _, q := range s.sinks {
+		q.add(scrobble)
+	}
+}
+
+// add queues a scrobble for the background loop, without waiting for it
+func (q *sinkQueue) add(scrobble pendingScrobble) {
+	q.lock.Lock()
+	q.pending = append(q.pending, scrobble)
+	q.lock.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+		// already woken
+	}
+}
+
+func (q *sinkQueue) run() {
+	retry := time.NewTimer(0)
+	if !retry.Stop() {
+		<-retry.C
+	}
+	var backoff time.Duration
+
+	submit := func() {
+		if q.submitPending() {
+			backoff = 0
+			return
+		}
+		if backoff == 0 {
+			backoff = scrobbleRetryMin
+		} else if backoff *= 2; backoff > scrobbleRetryMax {
+			backoff = scrobbleRetryMax
+		}
+		q.logger.Printf("scrobbler: %s: %d scrobbles pending, retrying in %v", q.sink.Name(), q.pendingCount(), backoff)
+		retry.Reset(backoff)
+	}
+
+	if q.pendingCount() > 0 {
+		submit()
+	}
+
+	for {
+		select {
+		case song := <-q.nowPlaying:
+			// scrobble now playing
+			if err := q.sink.NowPlaying(song); err != nil {
+				q.logger.PrintError("scrobble nowplaying "+q.sink.Name(), err)
+			}
+
+		case <-q.wake:
+			q.limitQueue()
+			// while waiting for a retry, the sink is probably still
+			// unreachable, so the new scrobbles are only saved
+			if backoff == 0 {
+				submit()
+			} else {
+				q.saveQueue()
+			}
+
+		case <-retry.C:
+			submit()
+		}
+	}
+}
+
+// submitPending submits the pending scrobbles, oldest first. It returns false
+// if the sink couldn't be reached; the rest is kept for later then. The queue
+// file is saved once afterwards, rather than after each scrobble.
+func (q *sinkQueue) submitPending() bool {
+	defer q.saveQueue()
+	for {
+		q.lock.Lock()
+		if len(q.pending) == 0 {
+			q.lock.Unlock()
+			return true
+		}
+		scrobble := q.pending[0]
+		q.lock.Unlock()
+
+		err := q.sink.Scrobble(scrobble.scrobbleSong, scrobble.Time)
+		var rejected scrobbleRejectedError
+		if errors.As(err, &rejected) {
+			// it won't take it if we try again either
+			q.logger.PrintError("scrobble submission "+q.sink.Name(), err)
+		} else if err != nil {
+			q.logger.PrintError("scrobble submission "+q.sink.Name(), err)
+			return false
+		}
+
+		// only run() removes scrobbles, so the first is still the same
+		q.lock.Lock()
+		q.pending = q.pending[1:]
+		q.lock.Unlock()
+	}
+}
+
+// limitQueue drops the oldest scrobbles beyond scrobbleQueueLimit
+func (q *sinkQueue) limitQueue() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if drop := len(q.pending) - scrobbleQueueLimit; drop > 0 {
+		q.logger.Printf("scrobbler: %s: too many pending scrobbles, dropping %d", q.sink.Name(), drop)
+		q.pending = q.pending[drop:]
+	}
+}
+
+func (q *sinkQueue) pendingCount() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.pending)
+}
+
+func (q *sinkQueue) loadQueue() error {
+	if q.queueFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(q.queueFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &q.pending)
+}
+
+func (q *sinkQueue) saveQueue() {
+	if q.queueFile == "" {
+		return
+	}
+	// the file is written without holding the lock, so that adding to the
+	// queue doesn't wait for the disk
+	q.lock.Lock()
+	empty := len(q.pending) == 0
+	data, err := json.Marshal(q.pending)
+	q.lock.Unlock()
+
+	if empty {
+		if err := os.Remove(q.queueFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			q.logger.PrintError("scrobbler: saving pending scrobbles", err)
+		}
+		return
+	}
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(q.queueFile), 0700); err == nil {
+			err = writeFileAtomic(q.queueFile, data)
+		}
+	}
+	if err != nil {
+		q.logger.PrintError("scrobbler: saving pending scrobbles", err)
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spezifisch/stmps/subsonic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type quietLogger struct{}
+
+func (quietLogger) Print(s string)                      {}
+func (quietLogger) Printf(s string, as ...interface{})  {}
+func (quietLogger) PrintError(source string, err error) {}
+
+// fakeSink records scrobbles, and fails while offline
+type fakeSink struct {
+	lock      sync.Mutex
+	offline   bool
+	reject    string
+	scrobbled []pendingScrobble
+}
+
+func (*fakeSink) Name() string {
+	return "fake"
+}
+
+func (f *fakeSink) NowPlaying(song scrobbleSong) error {
+	return nil
+}
+
+func (f *fakeSink) Scrobble(song scrobbleSong, playedAt time.Time) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.offline {
+		return errors.New("offline")
+	}
+	if song.Id == f.reject {
+		return scrobbleRejectedError{errors.New("unknown song")}
+	}
+	f.scrobbled = append(f.scrobbled, pendingScrobble{scrobbleSong: song, Time: playedAt})
+	return nil
+}
+
+func TestScrobblerCountsPlayedTime(t *testing.T) {
+	s := newScrobbler([]scrobbleSink{&fakeSink{}}, "", quietLogger{})
+	q := s.sinks[0]
+	s.songStarted(mpvplayer.QueueItem{Id: "song", Duration: 100})
+
+	// half of the song is needed; pauses (no progress) and seeks don't count
+	for pos := int64(1); pos <= 30; pos++ {
+		s.progress(mpvplayer.StatusData{Position: pos})
+		s.progress(mpvplayer.StatusData{Position: pos})
+	}
+	s.progress(mpvplayer.StatusData{Position: 80})
+	for pos := int64(81); pos <= 99; pos++ {
+		s.progress(mpvplayer.StatusData{Position: pos})
+	}
+	assert.Len(t, q.pending, 0, "49 seconds played")
+
+	s.progress(mpvplayer.StatusData{Position: 100})
+	require.Len(t, q.pending, 1, "50 seconds played")
+	assert.Equal(t, "song", q.pending[0].Id)
+	assert.Len(t, q.wake, 1, "the background loop is woken")
+
+	// only once per play
+	s.progress(mpvplayer.StatusData{Position: 101})
+	assert.Len(t, q.pending, 1)
+
+	// playing it again is another play
+	s.songStarted(mpvplayer.QueueItem{Id: "song", Duration: 100})
+	for pos := int64(1); pos <= 50; pos++ {
+		s.progress(mpvplayer.StatusData{Position: pos})
+	}
+	assert.Len(t, q.pending, 2)
+	assert.Len(t, q.wake, 1, "woken once for both")
+}
+
+func TestScrobblerShortSong(t *testing.T) {
+	s := newScrobbler([]scrobbleSink{&fakeSink{}}, "", quietLogger{})
+	s.songStarted(mpvplayer.QueueItem{Id: "short", Duration: 30})
+	for pos := int64(1); pos <= 30; pos++ {
+		s.progress(mpvplayer.StatusData{Position: pos})
+	}
+	assert.Len(t, s.sinks[0].pending, 0)
+}
+
+func TestScrobblerOfflineQueue(t *testing.T) {
+	sink := &fakeSink{offline: true, reject: "rejected"}
+	queueDir := filepath.Join(t.TempDir(), "scrobbles")
+	playedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	s := newScrobbler([]scrobbleSink{sink}, queueDir, quietLogger{})
+	q := s.sinks[0]
+	q.pending = []pendingScrobble{
+		{scrobbleSong: scrobbleSong{Id: "a", Title: "A"}, Time: playedAt},
+		{scrobbleSong: scrobbleSong{Id: "rejected"}, Time: playedAt.Add(time.Minute)},
+		{scrobbleSong: scrobbleSong{Id: "b"}, Time: playedAt.Add(2 * time.Minute)},
+	}
+	assert.False(t, q.submitPending())
+	assert.FileExists(t, filepath.Join(queueDir, "fake.json"))
+
+	// after a restart, when the sink is back
+	sink.offline = false
+	s = newScrobbler([]scrobbleSink{sink}, queueDir, quietLogger{})
+	q = s.sinks[0]
+	require.Len(t, q.pending, 3)
+	assert.True(t, q.submitPending())
+
+	require.Len(t, sink.scrobbled, 2)
+	assert.Equal(t, "a", sink.scrobbled[0].Id)
+	assert.Equal(t, "A", sink.scrobbled[0].Title)
+	assert.True(t, playedAt.Equal(sink.scrobbled[0].Time))
+	assert.Equal(t, "b", sink.scrobbled[1].Id)
+	_, err := os.Stat(filepath.Join(queueDir, "fake.json"))
+	assert.True(t, os.IsNotExist(err), "queue file removed when empty")
+}
+
+func TestScrobblerMultipleSinks(t *testing.T) {
+	up, down := &fakeSink{}, &fakeSink{offline: true}
+	s := newScrobbler([]scrobbleSink{up, down}, "", quietLogger{})
+	s.songStarted(mpvplayer.QueueItem{Id: "song", Duration: 40})
+	for pos := int64(1); pos <= 20; pos++ {
+		s.progress(mpvplayer.StatusData{Position: pos})
+	}
+	for _, q := range s.sinks {
+		require.Len(t, q.pending, 1)
+	}
+
+	assert.True(t, s.sinks[0].submitPending())
+	assert.False(t, s.sinks[1].submitPending())
+	assert.Len(t, up.scrobbled, 1)
+	assert.Len(t, s.sinks[1].pending, 1, "kept for the sink that's down")
+}
+
+func TestListenBrainzSink(t *testing.T) {
+	var lock sync.Mutex
+	var submissions []listenBrainzSubmission
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		assert.Equal(t, "/1/submit-listens", r.URL.Path)
+		assert.Equal(t, "Token secret", r.Header.Get("Authorization"))
+		var submission listenBrainzSubmission
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&submission))
+		submissions = append(submissions, submission)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := newListenBrainzSink(server.URL+"/", "secret")
+	song := scrobbleSong{
+		Id:                   "1",
+		Title:                "Song",
+		Artist:               "Artist",
+		Album:                "Album",
+		Duration:             200,
+		TrackNumber:          3,
+		MusicBrainzId:        "recording",
+		AlbumMusicBrainzId:   "release",
+		ArtistMusicBrainzIds: []string{"artist"},
+	}
+	playedAt := time.Unix(1700000000, 0)
+
+	require.NoError(t, sink.NowPlaying(song))
+	require.NoError(t, sink.Scrobble(song, playedAt))
+	require.Len(t, submissions, 2)
+
+	assert.Equal(t, "playing_now", submissions[0].ListenType)
+	assert.Zero(t, submissions[0].Payload[0].ListenedAt)
+
+	assert.Equal(t, "single", submissions[1].ListenType)
+	listen := submissions[1].Payload[0]
+	assert.Equal(t, playedAt.Unix(), listen.ListenedAt)
+	assert.Equal(t, "Artist", listen.TrackMetadata.ArtistName)
+	assert.Equal(t, "Song", listen.TrackMetadata.TrackName)
+	assert.Equal(t, "Album", listen.TrackMetadata.ReleaseName)
+	info := listen.TrackMetadata.AdditionalInfo
+	assert.Equal(t, 200000, info.DurationMs)
+	assert.Equal(t, 3, info.TrackNumber)
+	assert.Equal(t, "recording", info.RecordingMbid)
+	assert.Equal(t, "release", info.ReleaseMbid)
+	assert.Equal(t, []string{"artist"}, info.ArtistMbids)
+
+	// a bad listen is rejected for good, server trouble is retried
+	var rejected scrobbleRejectedError
+	status = http.StatusBadRequest
+	assert.ErrorAs(t, sink.Scrobble(song, playedAt), &rejected)
+	status = http.StatusServiceUnavailable
+	err := sink.Scrobble(song, playedAt)
+	assert.Error(t, err)
+	assert.False(t, errors.As(err, &rejected))
+	assert.ErrorAs(t, sink.Scrobble(scrobbleSong{Id: "2"}, playedAt), &rejected, "no artist and title")
+}
+
+func TestSubsonicSink(t *testing.T) {
+	var lock sync.Mutex
+	failed, code := false, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		assert.Equal(t, "/rest/scrobble", r.URL.Path)
+		if !failed {
+			_, _ = w.Write([]byte(`{"subsonic-response": {"status": "ok"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"subsonic-response": {"status": "failed", "error": {"code": ` +
+			strconv.Itoa(code) + `, "message": "nope"}}}`))
+	}))
+	defer server.Close()
+	fail := func(c int) {
+		lock.Lock()
+		defer lock.Unlock()
+		failed, code = true, c
+	}
+
+	connection := subsonic.Init(quietLogger{})
+	connection.Host = server.URL
+	sink := subsonicSink{connection: connection}
+	song := scrobbleSong{Id: "1"}
+	playedAt := time.Unix(1700000000, 0)
+
+	require.NoError(t, sink.Scrobble(song, playedAt))
+
+	// an unknown song is rejected for good, failed logins and server trouble
+	// are retried
+	var rejected scrobbleRejectedError
+	fail(70)
+	assert.ErrorAs(t, sink.Scrobble(song, playedAt), &rejected)
+	for _, c := range []int{0, 40, 41, 50} {
+		fail(c)
+		err := sink.Scrobble(song, playedAt)
+		assert.Error(t, err)
+		assert.False(t, errors.As(err, &rejected), "code %d", c)
+	}
+}
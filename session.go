@@ -0,0 +1,104 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spezifisch/stmps/subsonic"
+	"github.com/spf13/viper"
+)
+
+// sessionFileName is the session's file in the state dir
+const sessionFileName = "session.json"
+
+// session is what stmps was doing when it quit, to carry on with after a
+// restart
+type session struct {
+	// Queue is the queue, with the song that was playing at the top. The
+	// Uris are left out, since they have the credentials.
+	Queue []mpvplayer.QueueItem `json:"queue"`
+	// Position is where the top song was, in seconds
+	Position int64 `json:"position"`
+	// Playing is whether the top song was playing, rather than paused or
+	// stopped
+	Playing bool `json:"playing"`
+	// Volume in percent
+	Volume int64 `json:"volume"`
+	// Page is the page the TUI showed, if it ran
+	Page    string    `json:"page,omitempty"`
+	SavedAt time.Time `json:"savedAt"`
+}
+
+// sessionFile returns where the session is kept, or "" if it isn't
+func sessionFile() (string, error) {
+	if !viper.GetBool("session.enable") {
+		return "", nil
+	}
+	dir, err := stateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, sessionFileName), nil
+}
+
+// loadSession reads the session in path. There is none (nil) if the file
+// doesn't exist.
+func loadSession(path string) (*session, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var s session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// save writes the session to path
+func (s *session) save(path string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// newSession takes the queue, the position in its top song and the volume
+func newSession(queue mpvplayer.PlayerQueue, position, volume int64) *session {
+	s := &session{
+		Queue:    make([]mpvplayer.QueueItem, len(queue)),
+		Position: position,
+		Volume:   volume,
+		SavedAt:  time.Now(),
+	}
+	for i, item := range queue {
+		item.Uri = ""
+		s.Queue[i] = item
+	}
+	return s
+}
+
+// queue returns the queue of the session, ready to play
+func (s *session) queue(connection *subsonic.Connection) mpvplayer.PlayerQueue {
+	items := make(mpvplayer.PlayerQueue, len(s.Queue))
+	for i, item := range s.Queue {
+		var entity subsonic.Entity
+		entity.Id = item.Id
+		item.Uri = connection.GetPlayUrl(entity)
+		items[i] = item
+	}
+	return items
+}
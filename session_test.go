@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spezifisch/stmps/subsonic"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", sessionFileName)
+
+	s, err := loadSession(path)
+	require.NoError(t, err)
+	assert.Nil(t, s, "no session before the first save")
+
+	queue := mpvplayer.PlayerQueue{
+		{Id: "1", Uri: "http://server/rest/stream?id=1&p=secret", Title: "One"},
+		{Id: "2", Uri: "http://server/rest/stream?id=2&p=secret", Title: "Two"},
+	}
+	saved := newSession(queue, 42, 70)
+	saved.Page = PageQueue
+	require.NoError(t, saved.save(path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret", "stream urls aren't saved")
+
+	s, err = loadSession(path)
+	require.NoError(t, err)
+	require.NotNil(t, s)
+	assert.Equal(t, int64(42), s.Position)
+	assert.Equal(t, int64(70), s.Volume)
+	assert.Equal(t, PageQueue, s.Page)
+
+	connection := subsonic.Init(quietLogger{})
+	connection.Host = "http://server"
+	restored := s.queue(connection)
+	require.Len(t, restored, 2)
+	assert.Equal(t, "Two", restored[1].Title)
+	assert.True(t, strings.HasPrefix(restored[1].Uri, "http://server/rest/stream?"))
+	assert.Contains(t, restored[1].Uri, "id=2")
+}
+
+func TestSessionCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), sessionFileName)
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0600))
+	_, err := loadSession(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,269 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/spezifisch/stmps/remote"
+)
+
+// how long before stopping the sleep timer fades out the volume
+const sleepFadeSeconds = 60
+
+// sleepTimer stops playback after some minutes, or after a song or album.
+// For a song or album, it marks the song to stop after in the queue, and the
+// player stops there; the timer only fades out.
+type sleepTimer struct {
+	lock sync.Mutex
+	// one of the remote.Sleep* modes, or "" when it's off
+	mode     string
+	deadline time.Time
+	fade     bool
+	// the volume before the fade-out began, to go back to after stopping;
+	// -1 if it isn't fading
+	volume int64
+	// whether runSleepTimer is running
+	running bool
+}
+
+// timeToStop returns the seconds until the first song marked to stop after
+// has ended, if the first song of the queue is at position, and false if no
+// song is marked
+func timeToStop(queue mpvplayer.PlayerQueue, position int64) (int64, bool) {
+	var remaining int64
+	for i, song := range queue {
+		remaining += int64(song.Duration)
+		if i == 0 {
+			remaining -= min(position, int64(song.Duration))
+		}
+		if song.StopAfter {
+			return remaining, true
+		}
+	}
+	return 0, false
+}
+
+// albumEnd returns the index of the last song of the first song's album, of
+// those queued right after it
+func albumEnd(queue mpvplayer.PlayerQueue) int {
+	if len(queue) == 0 || queue[0].AlbumId == "" {
+		return 0
+	}
+	end := 0
+	for end+1 < len(queue) && queue[end+1].AlbumId == queue[0].AlbumId {
+		end++
+	}
+	return end
+}
+
+// fadeVolume is the volume when fading out from volume, with remaining
+// seconds left
+func fadeVolume(volume, remaining int64) int64 {
+	if remaining >= sleepFadeSeconds {
+		return volume
+	}
+	return volume * max(remaining, 0) / sleepFadeSeconds
+}
+
+// SetSleepTimer sets the sleep timer, replacing the one that was set, or
+// cancels it
+func (c *Core) SetSleepTimer(p remote.SleepParams) error {
+	queue := c.player.GetQueueCopy()
+	switch p.Mode {
+	case remote.SleepOff, "":
+	case remote.SleepMinutes:
+		if p.Minutes <= 0 {
+			return fmt.Errorf("invalid sleep timer of %d minutes", p.Minutes)
+		}
+	case remote.SleepTrack, remote.SleepAlbum:
+		if len(queue) == 0 {
+			return errors.New("the queue is empty")
+		}
+	default:
+		return fmt.Errorf("unknown sleep timer mode %q", p.Mode)
+	}
+	defer c.notifyQueueChanged()
+
+	s := &c.sleep
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c.endSleep(true)
+
+	switch p.Mode {
+	case remote.SleepOff, "":
+		c.logger.Print("sleep timer: off")
+		return nil
+	case remote.SleepMinutes:
+		s.deadline = time.Now().Add(time.Duration(p.Minutes) * time.Minute)
+	case remote.SleepTrack:
+		if err := c.player.SetStopAfter(0, true); err != nil {
+			return err
+		}
+	case remote.SleepAlbum:
+		if err := c.player.SetStopAfter(albumEnd(queue), true); err != nil {
+			return err
+		}
+	}
+	s.mode = p.Mode
+	s.fade = p.Fade
+	s.volume = -1
+	c.logger.Printf("sleep timer: %s %d, fade %t", p.Mode, p.Minutes, p.Fade)
+	if !s.running {
+		s.running = true
+		go c.runSleepTimer()
+	}
+	return nil
+}
+
+// SetStopAfter marks the song at index to stop playback after it, or removes
+// the mark
+func (c *Core) SetStopAfter(index int, stop bool) error {
+	if err := c.player.SetStopAfter(index, stop); err != nil {
+		return err
+	}
+	c.notifyQueueChanged()
+	return nil
+}
+
+// endSleep turns the sleep timer off, and brings back the volume if it was
+// fading out. With unmark, the song a song or album timer waits for isn't
+// marked anymore. The sleep lock must be held.
+func (c *Core) endSleep(unmark bool) {
+	s := &c.sleep
+	if s.volume >= 0 {
+		if err := c.player.SetVolume(int(s.volume)); err != nil {
+			c.logger.PrintError("sleep timer: volume", err)
+		}
+		s.volume = -1
+	}
+	if unmark && (s.mode == remote.SleepTrack || s.mode == remote.SleepAlbum) {
+		for i, song := range c.player.GetQueueCopy() {
+			if song.StopAfter {
+				if err := c.player.SetStopAfter(i, false); err != nil {
+					c.logger.PrintError("sleep timer: unmark", err)
+				}
+				break
+			}
+		}
+	}
+	s.mode = ""
+	s.deadline = time.Time{}
+}
+
+// sleepRemaining returns the seconds until the sleep timer stops playback,
+// and false if it won't, e.g. because the song it waited for was removed
+// from the queue. The sleep lock must be held.
+func (c *Core) sleepRemaining(now time.Time) (int64, bool) {
+	s := &c.sleep
+	switch s.mode {
+	case "":
+		return 0, false
+	case remote.SleepMinutes:
+		return int64(s.deadline.Sub(now).Round(time.Second) / time.Second), true
+	}
+	var position int64
+	if loaded, err := c.player.IsSongLoaded(); err == nil && loaded {
+		position = int64(c.player.GetTimePos())
+	}
+	return timeToStop(c.player.GetQueueCopy(), position)
+}
+
+// sleepStopped is called when playback stopped. A song or album timer is
+// done then, and the volume goes back to what it was before fading out.
+func (c *Core) sleepStopped() {
+	s := &c.sleep
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.mode == "" {
+		return
+	}
+	if s.mode == remote.SleepMinutes {
+		// the timer goes on, e.g. after a short break
+		if s.volume >= 0 {
+			if err := c.player.SetVolume(int(s.volume)); err != nil {
+				c.logger.PrintError("sleep timer: volume", err)
+			}
+			s.volume = -1
+		}
+		return
+	}
+	c.endSleep(false)
+	go c.notifyQueueChanged()
+}
+
+// runSleepTimer fades out, and stops when the time is up, until the timer is
+// off
+func (c *Core) runSleepTimer() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closing:
+			return
+		case now := <-ticker.C:
+			if !c.sleepTick(now) {
+				return
+			}
+		}
+	}
+}
+
+// sleepTick does what the sleep timer needs to at the time, and returns
+// whether it's still on
+func (c *Core) sleepTick(now time.Time) bool {
+	s := &c.sleep
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.mode == "" {
+		s.running = false
+		return false
+	}
+
+	remaining, ok := c.sleepRemaining(now)
+	if !ok || (s.mode == remote.SleepMinutes && remaining <= 0) {
+		if ok {
+			c.logger.Print("sleep timer: stopping")
+			if err := c.player.Stop(); err != nil {
+				c.logger.PrintError("sleep timer: stop", err)
+			}
+		}
+		c.endSleep(false)
+		s.running = false
+		go c.notifyQueueChanged()
+		return false
+	}
+
+	if s.fade && remaining < sleepFadeSeconds {
+		if playing, err := c.player.IsPlaying(); err == nil && playing {
+			if s.volume < 0 {
+				s.volume = c.player.GetVolume()
+			}
+			if err := c.player.SetVolume(int(fadeVolume(s.volume, remaining))); err != nil {
+				c.logger.PrintError("sleep timer: fade", err)
+			}
+		}
+	}
+	return true
+}
+
+// sleepStatus is the state of the sleep timer for Status, or nil if it's off
+func (c *Core) sleepStatus() *remote.SleepTimer {
+	s := &c.sleep
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	remaining, ok := c.sleepRemaining(time.Now())
+	if !ok {
+		return nil
+	}
+	return &remote.SleepTimer{
+		Mode:      s.mode,
+		Remaining: max(remaining, 0),
+		Fade:      s.fade,
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spezifisch/stmps/mpvplayer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeToStop(t *testing.T) {
+	queue := mpvplayer.PlayerQueue{
+		{Id: "1", Duration: 100, AlbumId: "a"},
+		{Id: "2", Duration: 200, AlbumId: "a"},
+		{Id: "3", Duration: 300, AlbumId: "b"},
+	}
+	_, ok := timeToStop(queue, 0)
+	assert.False(t, ok)
+
+	queue[1].StopAfter = true
+	remaining, ok := timeToStop(queue, 40)
+	assert.True(t, ok)
+	assert.Equal(t, int64(260), remaining)
+
+	// a position past the end doesn't count
+	queue[0].StopAfter = true
+	remaining, _ = timeToStop(queue, 150)
+	assert.Equal(t, int64(0), remaining)
+}
+
+func TestAlbumEnd(t *testing.T) {
+	assert.Equal(t, 0, albumEnd(nil))
+	queue := mpvplayer.PlayerQueue{
+		{Id: "1", AlbumId: "a"},
+		{Id: "2", AlbumId: "a"},
+		{Id: "3", AlbumId: "b"},
+		{Id: "4", AlbumId: "a"},
+	}
+	assert.Equal(t, 1, albumEnd(queue))
+	assert.Equal(t, 0, albumEnd(queue[2:]))
+	assert.Equal(t, 0, albumEnd(mpvplayer.PlayerQueue{{Id: "1"}, {Id: "2"}}))
+}
+
+func TestFadeVolume(t *testing.T) {
+	assert.Equal(t, int64(80), fadeVolume(80, 120))
+	assert.Equal(t, int64(80), fadeVolume(80, sleepFadeSeconds))
+	assert.Equal(t, int64(40), fadeVolume(80, sleepFadeSeconds/2))
+	assert.Equal(t, int64(0), fadeVolume(80, 0))
+	assert.Equal(t, int64(0), fadeVolume(80, -5))
+}
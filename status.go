@@ -0,0 +1,326 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spezifisch/stmps/logger"
+	"github.com/spezifisch/stmps/remote"
+	"github.com/spf13/viper"
+)
+
+// defaultStatusFormat is the text shown for status.format if it isn't set
+const defaultStatusFormat = `{{if ne .State "stopped"}}{{if eq .State "paused"}}(paused) {{end}}{{.Artist}} - {{.Title}} [{{mmss .Position}}/{{mmss .Duration}}]{{end}}`
+
+// statusInfo is what status templates see: the fields of mpvplayer.QueueItem
+// (minus the Uri, which contains credentials) and mpvplayer.StatusData, and
+// the player state.
+type statusInfo struct {
+	State       string `json:"state"`
+	Id          string `json:"id,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Artist      string `json:"artist,omitempty"`
+	Album       string `json:"album,omitempty"`
+	TrackNumber int    `json:"trackNumber,omitempty"`
+	DiscNumber  int    `json:"discNumber,omitempty"`
+	Year        int    `json:"year,omitempty"`
+	Genre       string `json:"genre,omitempty"`
+	CoverArtId  string `json:"coverArtId,omitempty"`
+	Volume      int64  `json:"volume"`
+	Position    int64  `json:"position"`
+	Duration    int64  `json:"duration"`
+}
+
+// statusLine is one JSON line of status output. text and class are what
+// waybar's custom modules look for.
+type statusLine struct {
+	Text  string `json:"text"`
+	Class string `json:"class"`
+	statusInfo
+}
+
+func newStatusInfo(status remote.Status) statusInfo {
+	info := statusInfo{
+		State:    status.State,
+		Volume:   status.Volume,
+		Position: status.Position,
+		Duration: status.Duration,
+	}
+	if track := status.Track; track != nil {
+		info.Id = track.Id
+		info.Title = track.Title
+		info.Artist = track.Artist
+		info.Album = track.Album
+		info.TrackNumber = track.TrackNumber
+		info.DiscNumber = track.DiscNumber
+		info.Year = track.Year
+		info.Genre = track.Genre
+		info.CoverArtId = track.CoverArtId
+	}
+	return info
+}
+
+var statusTemplateFuncs = template.FuncMap{
+	// mmss formats seconds as m:ss
+	"mmss": func(seconds int64) string {
+		min, sec := secondsToMinAndSec(seconds)
+		return fmt.Sprintf("%d:%02d", min, sec)
+	},
+}
+
+// parseStatusFormat parses a status template; an empty format is the default
+func parseStatusFormat(format string) (*template.Template, error) {
+	if format == "" {
+		format = defaultStatusFormat
+	}
+	return template.New("status").Funcs(statusTemplateFuncs).Parse(format)
+}
+
+func renderStatus(tmpl *template.Template, info statusInfo) (string, error) {
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, info); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// statusOutput publishes the player status for status bars, to a file
+// (status.file) that is replaced with the current text on every change, and/or
+// as JSON lines to a FIFO (status.fifo).
+type statusOutput struct {
+	controller remote.Controller
+	template   *template.Template
+	logger     logger.LoggerInterface
+
+	file     string
+	lastText string
+
+	fifoPath string
+	fifo     *os.File
+	lastLine []byte
+
+	updates     chan struct{}
+	stop        chan struct{}
+	done        chan struct{}
+	unsubscribe func()
+}
+
+// startStatusOutput starts the status output if a file or FIFO is configured;
+// otherwise it returns nil
+func startStatusOutput(controller remote.Controller, logger logger.LoggerInterface) *statusOutput {
+	file := os.ExpandEnv(viper.GetString("status.file"))
+	fifo := os.ExpandEnv(viper.GetString("status.fifo"))
+	if file == "" && fifo == "" {
+		return nil
+	}
+
+	tmpl, err := parseStatusFormat(viper.GetString("status.format"))
+	if err != nil {
+		logger.PrintError("status.format", err)
+		tmpl, _ = parseStatusFormat("")
+	}
+	if fifo != "" {
+		if err := makeFifo(fifo); err != nil {
+			logger.PrintError("status.fifo", err)
+			fifo = ""
+		}
+	}
+
+	s := &statusOutput{
+		controller: controller,
+		template:   tmpl,
+		logger:     logger,
+		file:       file,
+		fifoPath:   fifo,
+		updates:    make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	s.unsubscribe = controller.Subscribe(func(e remote.Event) {
+		switch e.Event {
+		case remote.EventPlaying, remote.EventPaused, remote.EventUnpaused, remote.EventStopped, remote.EventStatus:
+			s.trigger()
+		}
+	})
+	s.trigger()
+	go s.run()
+	return s
+}
+
+// trigger schedules an update without blocking; updates that come in while
+// one is pending are merged
+func (s *statusOutput) trigger() {
+	select {
+	case s.updates <- struct{}{}:
+	default:
+	}
+}
+
+func (s *statusOutput) run() {
+	defer close(s.done)
+	for {
+		select {
+		case <-s.updates:
+			s.update(s.controller.Status())
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Close writes a final "stopped" status, so that bars don't show a song
+// forever
+func (s *statusOutput) Close() {
+	s.unsubscribe()
+	close(s.stop)
+	<-s.done
+	s.update(remote.Status{State: remote.StateStopped})
+	if s.fifo != nil {
+		s.fifo.Close()
+	}
+}
+
+func (s *statusOutput) update(status remote.Status) {
+	info := newStatusInfo(status)
+	text, err := renderStatus(s.template, info)
+	if err != nil {
+		s.logger.PrintError("status.format", err)
+		return
+	}
+
+	if s.file != "" && text != s.lastText {
+		if err := writeFileAtomic(s.file, []byte(text+"\n")); err != nil {
+			s.logger.PrintError("status.file", err)
+		} else {
+			s.lastText = text
+		}
+	}
+
+	if s.fifoPath != "" {
+		line, err := json.Marshal(statusLine{Text: text, Class: info.State, statusInfo: info})
+		if err != nil {
+			s.logger.PrintError("status.fifo", err)
+			return
+		}
+		s.writeFifo(line)
+	}
+}
+
+// writeFifo writes a line to the FIFO if somebody is reading it. A new reader
+// gets the current line right away.
+func (s *statusOutput) writeFifo(line []byte) {
+	if s.fifo == nil {
+		f, err := openFifo(s.fifoPath)
+		if err != nil {
+			// nobody is reading
+			return
+		}
+		s.fifo = f
+		s.lastLine = nil
+	}
+	if bytes.Equal(line, s.lastLine) {
+		return
+	}
+
+	// don't hang on a reader that stopped reading
+	_ = s.fifo.SetWriteDeadline(time.Now().Add(time.Second))
+	if _, err := s.fifo.Write(append(line, '\n')); err != nil {
+		// the reader went away; wait for the next one
+		s.fifo.Close()
+		s.fifo = nil
+		return
+	}
+	s.lastLine = line
+}
+
+// writeFileAtomic replaces the file's contents, without readers ever seeing a
+// partially written file
+func writeFileAtomic(path string, data []byte) error {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+name+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// runStatus implements `stmps status`, which prints the status of a running
+// stmps once. It returns the process exit code.
+func runStatus(args []string) int {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	socket := flags.String("socket", "", "control socket `path` (default from config, or $XDG_RUNTIME_DIR/stmps.sock)")
+	configFile := flags.String("config", "", "use config `file` for the socket path and status.format")
+	format := flags.String("format", "", "Go `template` for the output (default from status.format)")
+	asJson := flags.Bool("json", false, "print a JSON line, as written to status.fifo")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "USAGE: %s status [-socket path] [-config file] [-format template] [-json]\n\n", os.Args[0])
+		fmt.Fprintf(flags.Output(), "Prints what a running stmps is playing. Template fields: State, Id, Title, Artist,\n"+
+			"Album, TrackNumber, DiscNumber, Year, Genre, CoverArtId, Volume, Position, Duration;\n"+
+			"{{mmss .Position}} formats seconds as m:ss.\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	// the config is only needed for the socket path and format, so a config
+	// that isn't complete enough to run stmps is fine here
+	_ = readConfig(configFile)
+	if *format == "" {
+		*format = viper.GetString("status.format")
+	}
+	tmpl, err := parseStatusFormat(*format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid format: %s\n", err)
+		return 2
+	}
+
+	client, path, err := dialControl(*socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to connect to stmps at %s: %s\n", path, err)
+		return 1
+	}
+	defer client.Close()
+
+	var status remote.Status
+	if err := client.Call(remote.MethodStatus, nil, &status); err != nil {
+		fmt.Fprintf(os.Stderr, "status: %s\n", err)
+		return 1
+	}
+	info := newStatusInfo(status)
+	text, err := renderStatus(tmpl, info)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid format: %s\n", err)
+		return 2
+	}
+	if *asJson {
+		if err := json.NewEncoder(os.Stdout).Encode(statusLine{Text: text, Class: info.State, statusInfo: info}); err != nil {
+			return 1
+		}
+		return 0
+	}
+	fmt.Println(text)
+	return 0
+}
@@ -0,0 +1,29 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// makeFifo creates a FIFO at path, unless there already is one
+func makeFifo(path string) error {
+	if fi, err := os.Stat(path); err == nil {
+		if fi.Mode()&os.ModeNamedPipe == 0 {
+			return fmt.Errorf("%s exists and is not a FIFO", path)
+		}
+		return nil
+	}
+	return syscall.Mkfifo(path, 0600)
+}
+
+// openFifo opens a FIFO for writing without blocking. It fails if nobody is
+// reading.
+func openFifo(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+}
@@ -0,0 +1,21 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoFifo = errors.New("FIFOs are not supported on Windows")
+
+func makeFifo(path string) error {
+	return errNoFifo
+}
+
+func openFifo(path string) (*os.File, error) {
+	return nil, errNoFifo
+}
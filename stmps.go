@@ -62,6 +62,26 @@ func readConfig(configFile *string) error {
 		viper.AddConfigPath(".")
 	}
 
+	viper.SetDefault("remote.socket.enable", true)
+	viper.SetDefault("remote.http.enable", false)
+	viper.SetDefault("remote.http.address", "127.0.0.1:8387")
+	viper.SetDefault("history.enable", true)
+	viper.SetDefault("scrobble.log.enable", false)
+	viper.SetDefault("notifications.enable", false)
+	viper.SetDefault("notifications.actions", true)
+	viper.SetDefault("notifications.cover-art", true)
+	viper.SetDefault("theme.name", "default")
+	viper.SetDefault("session.enable", true)
+	viper.SetDefault("session.paused", true)
+	viper.SetDefault("session.interval", 30)
+	viper.SetDefault("session.server-sync", false)
+	viper.SetDefault("autodj.enable", false)
+	viper.SetDefault("autodj.min-queue", 5)
+	viper.SetDefault("sleep.fade", false)
+	viper.SetDefault("browser.album-sort", "")
+	viper.SetDefault("albums.list", "newest")
+	viper.SetDefault("albums.cache-size", 200)
+
 	// read it
 	err := viper.ReadInConfig()
 	if err != nil {
@@ -100,34 +120,76 @@ func parseConfig() {
 	}
 }
 
-// initCommandHandler sets up tview-command as main input handler
-func initCommandHandler(logger *logger.Logger) {
+// initKeybindings loads the keybindings, with the user's from the config
+// dir applied to the defaults
+func initKeybindings(logger *logger.Logger) (*Keybindings, error) {
 	tviewcommand.SetLogHandler(func(msg string) {
 		logger.Print(msg)
 	})
 
-	configPath := "HACK.commands.toml"
-
-	// Load the configuration file
-	config, err := tviewcommand.LoadConfig(configPath)
-	if err != nil || config == nil {
-		logger.PrintError("Failed to load command-shortcut config", err)
+	path := keybindingsFile()
+	keybindings, err := loadKeybindings(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
 	}
+	return keybindings, nil
+}
 
-	//env := keybinding.SetupEnvironment()
-	//keybinding.RegisterCommands(env)
+// newConnection sets up the connection to the server from the config
+func newConnection(logger logger.LoggerInterface) *subsonic.Connection {
+	connection := subsonic.Init(logger)
+	connection.SetClientInfo(Name, APIVersion)
+	connection.Username = viper.GetString("auth.username")
+	connection.Password = viper.GetString("auth.password")
+	connection.Host = viper.GetString("server.host")
+	connection.PlaintextAuth = viper.GetBool("auth.plaintext")
+	connection.Scrobble = viper.GetBool("server.scrobble")
+	connection.RandomSongNumber = viper.GetUint("client.random-songs")
+	return connection
+}
+
+// startHTTPRemote starts the HTTP API if it's enabled; otherwise, or if it
+// fails to start, it returns nil
+func startHTTPRemote(core *Core, logger *logger.Logger) *remote.HTTPServer {
+	if !viper.GetBool("remote.http.enable") {
+		return nil
+	}
+	server, err := remote.ListenHTTP(viper.GetString("remote.http.address"), viper.GetString("remote.http.token"), core, core, logger)
+	if err != nil {
+		logger.PrintError("http remote", err)
+		return nil
+	}
+	logger.Printf("http remote listening on %s", server.Addr())
+	return server
 }
 
 // return codes:
 // 0 - OK
 // 1 - generic errors
 // 2 - main config errors
-// 2 - keybinding config errors
+// 3 - keybinding or theme config errors
 func main() {
+	// subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "ctl":
+			osExit(runCtl(os.Args[2:]))
+			return
+		case "status":
+			osExit(runStatus(os.Args[2:]))
+			return
+		case "scrobble-import":
+			osExit(runScrobbleImport(os.Args[2:]))
+			return
+		}
+	}
+
 	// parse flags and config
 	// TODO (D) help should better explain the arguments, especially the currently undocumented server URL argument
 	help := flag.Bool("help", false, "Print usage")
 	enableMpris := flag.Bool("mpris", false, "Enable MPRIS2")
+	daemon := flag.Bool("daemon", false, "run without the TUI; control playback with `stmps ctl`, MPRIS, or --attach")
+	attach := flag.Bool("attach", false, "run the TUI on the playback of a running --daemon")
 	list := flag.Bool("list", false, "list server data")
 	pl := flag.Bool("playlists", false, "include playlist info (only used with --list; playlists can take a long time to load)")
 	cpuprofile := flag.String("cpuprofile", "", "write cpu profile to `file`")
@@ -152,6 +214,15 @@ func main() {
 		osExit(0)
 	}
 
+	// exitCode is exited with when main returns, after the deferred cleanup
+	// below has run, unlike when calling osExit right away
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			osExit(exitCode)
+		}
+	}()
+
 	// cpu/memprofile code straight from https://pkg.go.dev/runtime/pprof
 	if *cpuprofile != "" {
 		f, err := os.Create(*cpuprofile)
@@ -179,36 +250,62 @@ func main() {
 		osExit(2)
 	}
 
+	if *daemon && *attach {
+		fmt.Fprintln(os.Stderr, "--daemon and --attach are mutually exclusive")
+		osExit(1)
+	}
+
 	logger := logger.Init(*logFile)
 	defer logger.Close()
-	initCommandHandler(logger)
-
-	// init mpv engine
-	player, err := mpvplayer.NewPlayer(logger)
+	keybindings, err := initKeybindings(logger)
 	if err != nil {
-		fmt.Println("Unable to initialize mpv. Is mpv installed?")
-		osExit(1)
+		fmt.Fprintf(os.Stderr, "Invalid keybindings in %s\n", err)
+		osExit(3)
+	}
+	randomPresets, err := loadRandomPresets()
+	if err == nil {
+		err = keybindings.bindRandomPresets(randomPresets)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid random presets: %s\n", err)
+		osExit(3)
+	}
+	theme, err := loadTheme()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid theme: %s\n", err)
+		osExit(3)
 	}
 
+	// when attaching, the daemon does the playing
+	var player *mpvplayer.Player
 	var mprisPlayer *remote.MprisPlayer
-	// init mpris2 player control (linux only but fails gracefully on other systems)
-	if *enableMpris {
-		mprisPlayer, err = remote.RegisterMprisPlayer(player, logger)
+	if !*attach {
+		// init mpv engine
+		player, err = mpvplayer.NewPlayer(logger)
 		if err != nil {
-			fmt.Printf("Unable to register MPRIS with DBUS: %s\n", err)
-			fmt.Println("Try running without MPRIS")
+			fmt.Println("Unable to initialize mpv. Is mpv installed?")
 			osExit(1)
 		}
-		defer mprisPlayer.Close()
-	}
 
-	// init macos mediaplayer control
-	if runtime.GOOS == "darwin" {
-		if err = remote.RegisterMPMediaHandler(player, logger); err != nil {
-			fmt.Printf("Unable to initialize MediaPlayer bindings: %s\n", err)
-			osExit(1)
-		} else {
-			logger.Print("MacOS MediaPlayer registered")
+		// init mpris2 player control (linux only but fails gracefully on other systems)
+		if *enableMpris {
+			mprisPlayer, err = remote.RegisterMprisPlayer(player, logger)
+			if err != nil {
+				fmt.Printf("Unable to register MPRIS with DBUS: %s\n", err)
+				fmt.Println("Try running without MPRIS")
+				osExit(1)
+			}
+			defer mprisPlayer.Close()
+		}
+
+		// init macos mediaplayer control
+		if runtime.GOOS == "darwin" {
+			if err = remote.RegisterMPMediaHandler(player, logger); err != nil {
+				fmt.Printf("Unable to initialize MediaPlayer bindings: %s\n", err)
+				osExit(1)
+			} else {
+				logger.Print("MacOS MediaPlayer registered")
+			}
 		}
 	}
 
@@ -218,35 +315,37 @@ func main() {
 		return
 	}
 
-	connection := subsonic.Init(logger)
-	connection.SetClientInfo(Name, APIVersion)
-	connection.Username = viper.GetString("auth.username")
-	connection.Password = viper.GetString("auth.password")
-	connection.Host = viper.GetString("server.host")
-	connection.PlaintextAuth = viper.GetBool("auth.plaintext")
-	connection.Scrobble = viper.GetBool("server.scrobble")
-	connection.RandomSongNumber = viper.GetUint("client.random-songs")
+	connection := newConnection(logger)
 
-	artistInd, err := connection.GetArtists()
-	if err != nil {
-		fmt.Printf("Error fetching indexes from server: %s\n", err)
-		osExit(1)
+	var core *Core
+	if player != nil {
+		core = NewCore(connection, player, mprisPlayer, logger)
 	}
-	// Sparse artist information: id, name, albumCount, coverArt, artistImageUrl
-	artists := make([]subsonic.Artist, 0)
-	artistCount := 0
-	albumCount := 0
-	for _, ind := range artistInd.Index {
-		artistCount += len(ind.Artists)
-		for _, art := range ind.Artists {
-			albumCount += art.AlbumCount
-			artists = append(artists, art)
-		}
+
+	if *daemon {
+		// the session is saved by runDaemon; MPRIS and the log are closed
+		// by the deferred calls above
+		exitCode = runDaemon(core, logger)
+		return
 	}
 
 	if *list {
+		artistInd, err := connection.GetArtists()
+		if err != nil {
+			fmt.Printf("Error fetching indexes from server: %s\n", err)
+			osExit(1)
+		}
+		// Sparse artist information: id, name, albumCount, coverArt, artistImageUrl
+		artistCount := 0
+		albumCount := 0
+		for _, ind := range artistInd.Index {
+			artistCount += len(ind.Artists)
+			for _, art := range ind.Artists {
+				albumCount += art.AlbumCount
+			}
+		}
+
 		var playlists subsonic.Playlists
-		var err error
 		wg := sync.WaitGroup{}
 		wg.Add(1)
 		if *pl {
@@ -335,12 +434,55 @@ func main() {
 		return
 	}
 
-	ui := InitGui(artists, connection, player, logger, mprisPlayer)
+	var playback Playback
+	if *attach {
+		socketPath := controlSocketPath()
+		remotePlayback, err := attachPlayback(socketPath, logger)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to attach to stmps at %s: %s\n", socketPath, err)
+			osExit(1)
+		}
+		defer remotePlayback.Close()
+		playback = remotePlayback
+	} else {
+		// control socket for `stmps ctl` and scripts
+		if viper.GetBool("remote.socket.enable") {
+			socketPath := controlSocketPath()
+			if ctlServer, err := remote.ListenControlSocket(socketPath, core, logger); err != nil {
+				logger.PrintError("control socket", err)
+			} else {
+				logger.Printf("control socket listening on %s", socketPath)
+				defer ctlServer.Close()
+			}
+		}
+		if httpServer := startHTTPRemote(core, logger); httpServer != nil {
+			defer httpServer.Close()
+		}
+		if statusOutput := startStatusOutput(core, logger); statusOutput != nil {
+			defer statusOutput.Close()
+		}
+		if notifications := startNotifications(core, logger); notifications != nil {
+			defer notifications.Close()
+		}
+		playback = core
+	}
+
+	ui := InitGui(connection, playback, keybindings, randomPresets, theme, logger)
+	if core != nil {
+		core.sessionPage = ui.menuWidget.GetActivePage
+		core.Run()
+		if _, ok := ui.menuWidget.buttons[core.restoredPage]; ok {
+			ui.ShowPage(core.restoredPage)
+		}
+	}
 
 	// run main loop
 	if err := ui.Run(); err != nil {
 		panic(err)
 	}
+	if core != nil {
+		core.Close()
+	}
 
 	if *memprofile != "" {
 		f, err := os.Create(*memprofile)
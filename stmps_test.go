@@ -15,7 +15,7 @@ import (
 
 // Test initialization of the player
 func TestPlayerInitialization(t *testing.T) {
-	logger := logger.Init()
+	logger := logger.Init("")
 	player, err := mpvplayer.NewPlayer(logger)
 	assert.NoError(t, err, "Player initialization should not return an error")
 	assert.NotNil(t, player, "Player should be initialized")
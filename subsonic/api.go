@@ -43,6 +43,10 @@ type Results struct {
 	Songs   Entities `json:"song"`
 }
 
+type AlbumList struct {
+	Albums []Album `json:"album"`
+}
+
 type ScanStatus struct {
 	Scanning bool `json:"scanning"`
 	Count    int  `json:"count"`
@@ -69,7 +73,8 @@ type EntityBase struct {
 	Title string
 	// Artists is only available for Entities from gonic
 	Artists []Artist
-	// MusicBrainzId is only available for Albums from Navidrome
+	// MusicBrainzId is only available for Albums from Navidrome, and for
+	// songs (the recording ID) from OpenSubsonic servers
 	MusicBrainzId string
 }
 
@@ -79,6 +84,8 @@ type Artist struct {
 	AlbumCount     int
 	ArtistImageUrl string
 	Albums         []Album `json:"album"`
+	// MusicBrainzId is only available from OpenSubsonic servers
+	MusicBrainzId string
 }
 
 func (s Artist) ID() string {
@@ -139,6 +146,9 @@ type Entity struct {
 	DiscNumber         int
 	Type               string
 	ReplayGain         ReplayGain
+	PlayCount          int
+	// UserRating is 1 to 5 stars, 0 if not rated
+	UserRating int
 }
 
 // #####################################
@@ -267,6 +277,15 @@ type Playlist struct {
 	Entries   Entities `json:"entry"`
 }
 
+type MusicFolders struct {
+	MusicFolders []MusicFolder `json:"musicFolder"`
+}
+
+type MusicFolder struct {
+	Id   Id     `json:"id"`
+	Name string `json:"name"`
+}
+
 type Info struct{}
 
 type responseWrapper struct {
@@ -283,15 +302,19 @@ type Response struct {
 	// There's no better way to do this, because Go generics are useless
 	RandomSongs            Songs
 	SimilarSongs           Songs
+	SimilarSongs2          Songs
 	Starred                Results
 	SearchResult3          Results
 	Directory              Directory
 	Album                  Album
+	Song                   Entity
 	Artists                Indexes
+	AlbumList2             AlbumList
 	Artist                 Artist
 	ScanStatus             ScanStatus
 	PlayQueue              PlayQueue
 	Genres                 GenreEntries
+	MusicFolders           MusicFolders
 	SongsByGenre           Songs
 	Indexes                Indexes
 	LyricsList             LyricsList
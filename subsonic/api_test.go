@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -86,3 +87,57 @@ func TestGetResponse(t *testing.T) {
 func containsCallerInError(err error, caller string) bool {
 	return err != nil && (caller == "" || strings.Contains(err.Error(), "["+caller+"]"))
 }
+
+func TestGetAlbumList2(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/rest/getAlbumList2" || query.Get("type") != "newest" ||
+			query.Get("size") != "2" || query.Get("offset") != "4" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body := `{"subsonic-response": {"status": "ok", "albumList2": {"album": [
+			{"id": "1", "name": "One", "coverArt": "al-1"},
+			{"id": "2", "name": "Two"}]}}}`
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatalf("failed to write server response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	connection := &Connection{Host: server.URL}
+	albums, err := connection.GetAlbumList2("newest", 2, 4)
+	if err != nil {
+		t.Fatalf("expected no error but got: %v", err)
+	}
+	if len(albums) != 2 || albums[0].Name != "One" || albums[0].CoverArtId != "al-1" || albums[1].Id != "2" {
+		t.Errorf("unexpected albums %+v", albums)
+	}
+}
+
+func TestGetAlbumConcurrently(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := `{"subsonic-response": {"status": "ok", "album": {"id": "` + r.URL.Query().Get("id") + `", "name": "Album"}}}`
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Errorf("failed to write server response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	connection := &Connection{Host: server.URL}
+	connection.ClearCache()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, id := range []string{"1", "2", "3"} {
+				if _, err := connection.GetAlbum(id); err != nil {
+					t.Errorf("GetAlbum(%s): %v", id, err)
+				}
+			}
+			connection.RemoveAlbumCacheEntry("2")
+		}()
+	}
+	wg.Wait()
+}
@@ -18,6 +18,8 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/spezifisch/stmps/logger"
 )
@@ -36,6 +38,10 @@ type Connection struct {
 	clientVersion string
 
 	logger logger.LoggerInterface
+
+	// cacheLock guards the caches, since the control socket, the HTTP API,
+	// and the auto DJ add songs from their own goroutines
+	cacheLock sync.Mutex
 	// TODO replace this by a Cache in the client
 	directoryCache map[string]Directory
 	// TODO replace this by a Cache in the client
@@ -61,20 +67,28 @@ func (s *Connection) SetClientInfo(name, version string) {
 }
 
 func (s *Connection) ClearCache() {
+	s.cacheLock.Lock()
+	defer s.cacheLock.Unlock()
 	s.directoryCache = make(map[string]Directory)
 	s.artistCache = make(map[string]Artist)
 	s.albumCache = make(map[string]Album)
 }
 
 func (s *Connection) RemoveDirectoryCacheEntry(key string) {
+	s.cacheLock.Lock()
+	defer s.cacheLock.Unlock()
 	delete(s.directoryCache, key)
 }
 
 func (s *Connection) RemoveArtistCacheEntry(key string) {
+	s.cacheLock.Lock()
+	defer s.cacheLock.Unlock()
 	delete(s.artistCache, key)
 }
 
 func (s *Connection) RemoveAlbumCacheEntry(key string) {
+	s.cacheLock.Lock()
+	defer s.cacheLock.Unlock()
 	delete(s.albumCache, key)
 }
 
@@ -141,7 +155,10 @@ func (connection *Connection) GetArtists() (Indexes, error) {
 // The albums in the response are sorted before return.
 // https://opensubsonic.netlify.app/docs/endpoints/getartist/
 func (connection *Connection) GetArtist(id string) (Artist, error) {
-	if cachedArtist, present := connection.artistCache[id]; present {
+	connection.cacheLock.Lock()
+	cachedArtist, present := connection.artistCache[id]
+	connection.cacheLock.Unlock()
+	if present {
 		return cachedArtist, nil
 	}
 
@@ -165,7 +182,9 @@ func (connection *Connection) GetArtist(id string) (Artist, error) {
 	sort.Slice(artist.Albums, func(i, j int) bool {
 		return artist.Albums[i].Name < artist.Albums[j].Name
 	})
+	connection.cacheLock.Lock()
 	connection.artistCache[id] = artist
+	connection.cacheLock.Unlock()
 
 	return artist, nil
 }
@@ -176,11 +195,12 @@ func (connection *Connection) GetArtist(id string) (Artist, error) {
 // The songs in the album are sorted before return.
 // https://opensubsonic.netlify.app/docs/endpoints/getalbum/
 func (connection *Connection) GetAlbum(id string) (Album, error) {
-	if cachedResponse, present := connection.albumCache[id]; present {
-		// This is because Albums that were fetched as Directories aren't populated correctly
-		if cachedResponse.Name != "" {
-			return cachedResponse, nil
-		}
+	connection.cacheLock.Lock()
+	cachedResponse, present := connection.albumCache[id]
+	connection.cacheLock.Unlock()
+	// This is because Albums that were fetched as Directories aren't populated correctly
+	if present && cachedResponse.Name != "" {
+		return cachedResponse, nil
 	}
 
 	query := defaultQuery(connection)
@@ -203,18 +223,42 @@ func (connection *Connection) GetAlbum(id string) (Album, error) {
 	sort.Slice(album.Songs, func(i, j int) bool {
 		return album.Songs[i].Title < album.Songs[j].Title
 	})
+	connection.cacheLock.Lock()
 	connection.albumCache[id] = album
+	connection.cacheLock.Unlock()
 
 	return album, nil
 }
 
+// GetSong fetches the details of a single song, by ID.
+// https://opensubsonic.netlify.app/docs/endpoints/getsong/
+func (connection *Connection) GetSong(id string) (Entity, error) {
+	query := defaultQuery(connection)
+	query.Set("id", id)
+	requestUrl := connection.Host + "/rest/getSong" + "?" + query.Encode()
+	resp, err := connection.getResponse("GetSong", requestUrl)
+	if err != nil {
+		return Entity{}, err
+	}
+	if resp == nil {
+		return Entity{}, fmt.Errorf("GetSong(%s) nil response from server: %s", id, err)
+	}
+	if resp.Status != "ok" {
+		return resp.Song, fmt.Errorf("server reported an error for GetSong(%s): %s", id, resp.Error.Message)
+	}
+	return resp.Song, nil
+}
+
 // GetMusicDirector fetches a listing of all files in a music directory, by ID.
 // If the item is in the cache, the cached item is returned; if not, it is put
 // in the cache and returned.
 // The entities in the directory are sorted before return.
 // https://opensubsonic.netlify.app/docs/endpoints/getmusicdirectory/
 func (connection *Connection) GetMusicDirectory(id string) (Directory, error) {
-	if cachedResponse, present := connection.directoryCache[id]; present {
+	connection.cacheLock.Lock()
+	cachedResponse, present := connection.directoryCache[id]
+	connection.cacheLock.Unlock()
+	if present {
 		return cachedResponse, nil
 	}
 
@@ -236,7 +280,9 @@ func (connection *Connection) GetMusicDirectory(id string) (Directory, error) {
 	}
 
 	sort.Sort(directory.Entities)
+	connection.cacheLock.Lock()
 	connection.directoryCache[id] = directory
+	connection.cacheLock.Unlock()
 
 	return directory, nil
 }
@@ -251,12 +297,21 @@ func (connection *Connection) GetMusicDirectory(id string) (Directory, error) {
 // These assets are not cached by this connection.
 // https://opensubsonic.netlify.app/docs/endpoints/getcoverart/
 func (connection *Connection) GetCoverArt(id string) (image.Image, error) {
+	return connection.GetCoverArtSize(id, 0)
+}
+
+// GetCoverArtSize fetches album art like GetCoverArt, scaled by the server
+// to at most size pixels wide and high. A size of 0 is the original size.
+func (connection *Connection) GetCoverArtSize(id string, size int) (image.Image, error) {
 	if id == "" {
 		return nil, fmt.Errorf("GetCoverArt: no ID provided")
 	}
 	query := defaultQuery(connection)
 	query.Set("id", id)
 	query.Set("f", "image/png")
+	if size > 0 {
+		query.Set("size", strconv.Itoa(size))
+	}
 	caller := "GetCoverArt"
 	res, err := http.Get(connection.Host + "/rest/getCoverArt" + "?" + query.Encode())
 	if err != nil {
@@ -294,6 +349,28 @@ func (connection *Connection) GetCoverArt(id string) (image.Image, error) {
 	return art, err
 }
 
+// GetAlbumList2 fetches a page of albums (ID3) of a list: "newest",
+// "recent", "frequent", "highest", "random", "alphabeticalByName",
+// "alphabeticalByArtist", or "starred". size is at most 500.
+// https://opensubsonic.netlify.app/docs/endpoints/getalbumlist2/
+func (connection *Connection) GetAlbumList2(listType string, size, offset int) ([]Album, error) {
+	query := defaultQuery(connection)
+	query.Set("type", listType)
+	query.Set("size", strconv.Itoa(size))
+	if offset != 0 {
+		query.Set("offset", strconv.Itoa(offset))
+	}
+	requestUrl := connection.Host + "/rest/getAlbumList2?" + query.Encode()
+	resp, err := connection.getResponse("GetAlbumList2", requestUrl)
+	if err != nil {
+		return []Album{}, err
+	}
+	if resp == nil {
+		return []Album{}, fmt.Errorf("GetAlbumList2(%s, %d, %d) nil response from server", listType, size, offset)
+	}
+	return resp.AlbumList2.Albums, nil
+}
+
 // GetRandomSongs fetches a number of random songs. The results are not sorted.
 // If a song Id is provided, songs similar to that song will be selected.
 // The function returns Connection.RandomSongNumber or fewer songs; if it is 0,
@@ -326,6 +403,70 @@ func (connection *Connection) GetRandomSongs(id string) (Entities, error) {
 	return resp.SimilarSongs.Songs, err
 }
 
+// GetSimilarSongs2 fetches songs similar to an artist's (ID3), from the
+// artist and others. It returns as many songs as GetRandomSongs.
+func (connection *Connection) GetSimilarSongs2(artistId string) (Entities, error) {
+	query := defaultQuery(connection)
+
+	size := fmt.Sprintf("%d", MAX_RANDOM_SONGS)
+	if connection.RandomSongNumber > 0 && connection.RandomSongNumber < 500 {
+		size = fmt.Sprintf("%d", connection.RandomSongNumber)
+	}
+	query.Set("id", artistId)
+	query.Set("count", size)
+	requestUrl := connection.Host + "/rest/getSimilarSongs2?" + query.Encode()
+	resp, err := connection.getResponse("GetSimilarSongs2", requestUrl)
+	if resp == nil {
+		return Entities{}, fmt.Errorf("GetSimilarSongs2(%s) nil response from server: %s", artistId, err)
+	}
+	return resp.SimilarSongs2.Songs, err
+}
+
+// RandomSongsFilter narrows down the songs GetRandomSongsFiltered picks from.
+// Zero values don't filter.
+type RandomSongsFilter struct {
+	// number of songs; 0 is Connection.RandomSongNumber
+	Size          int
+	Genre         string
+	FromYear      int
+	ToYear        int
+	MusicFolderId string
+}
+
+// GetRandomSongsFiltered fetches random songs of a genre, years, or music
+// folder
+func (connection *Connection) GetRandomSongsFiltered(filter RandomSongsFilter) (Entities, error) {
+	query := defaultQuery(connection)
+
+	size := MAX_RANDOM_SONGS
+	if connection.RandomSongNumber > 0 && connection.RandomSongNumber < 500 {
+		size = int(connection.RandomSongNumber)
+	}
+	if filter.Size > 0 && filter.Size < 500 {
+		size = filter.Size
+	}
+	query.Set("size", strconv.Itoa(size))
+	if filter.Genre != "" {
+		query.Set("genre", filter.Genre)
+	}
+	if filter.FromYear > 0 {
+		query.Set("fromYear", strconv.Itoa(filter.FromYear))
+	}
+	if filter.ToYear > 0 {
+		query.Set("toYear", strconv.Itoa(filter.ToYear))
+	}
+	if filter.MusicFolderId != "" {
+		query.Set("musicFolderId", filter.MusicFolderId)
+	}
+
+	requestUrl := connection.Host + "/rest/getRandomSongs?" + query.Encode()
+	resp, err := connection.getResponse("GetRandomSongsFiltered", requestUrl)
+	if resp == nil {
+		return Entities{}, fmt.Errorf("GetRandomSongsFiltered(%+v) nil response from server: %s", filter, err)
+	}
+	return resp.RandomSongs.Songs, err
+}
+
 func (connection *Connection) ScrobbleSubmission(id string, isSubmission bool) (Response, error) {
 	query := defaultQuery(connection)
 	query.Set("id", id)
@@ -341,6 +482,23 @@ func (connection *Connection) ScrobbleSubmission(id string, isSubmission bool) (
 	return *resp, err
 }
 
+// ScrobbleAt submits a scrobble for a song that started playing at playedAt,
+// e.g. one that couldn't be submitted while it was playing
+func (connection *Connection) ScrobbleAt(id string, playedAt time.Time) (Response, error) {
+	query := defaultQuery(connection)
+	query.Set("id", id)
+	query.Set("submission", "true")
+	// milliseconds since the epoch
+	query.Set("time", strconv.FormatInt(playedAt.UnixMilli(), 10))
+
+	requestUrl := connection.Host + "/rest/scrobble" + "?" + query.Encode()
+	resp, err := connection.getResponse("ScrobbleAt", requestUrl)
+	if resp == nil {
+		return Response{}, fmt.Errorf("ScrobbleAt(%s) nil response from server: %s", id, err)
+	}
+	return *resp, err
+}
+
 func (connection *Connection) GetStarred() (Results, error) {
 	query := defaultQuery(connection)
 	requestUrl := connection.Host + "/rest/getStarred" + "?" + query.Encode()
@@ -467,9 +625,16 @@ func (connection *Connection) DeletePlaylist(id string) error {
 }
 
 func (connection *Connection) AddSongToPlaylist(playlistId string, songId string) error {
+	return connection.AddSongsToPlaylist(playlistId, []string{songId})
+}
+
+// AddSongsToPlaylist appends songs to a playlist with a single request
+func (connection *Connection) AddSongsToPlaylist(playlistId string, songIds []string) error {
 	query := defaultQuery(connection)
-	query.Set("playlistId", string(playlistId))
-	query.Set("songIdToAdd", string(songId))
+	query.Set("playlistId", playlistId)
+	for _, songId := range songIds {
+		query.Add("songIdToAdd", songId)
+	}
 	requestUrl := connection.Host + "/rest/updatePlaylist" + "?" + query.Encode()
 	_, err := http.Get(requestUrl)
 	return err
@@ -620,6 +785,20 @@ func (connection *Connection) GetGenres() ([]GenreEntry, error) {
 	return resp.Genres.Genres, nil
 }
 
+// GetMusicFolders fetches the top-level folders of the server's library
+func (connection *Connection) GetMusicFolders() ([]MusicFolder, error) {
+	query := defaultQuery(connection)
+	requestUrl := connection.Host + "/rest/getMusicFolders" + "?" + query.Encode()
+	resp, err := connection.getResponse("GetMusicFolders", requestUrl)
+	if err != nil {
+		return []MusicFolder{}, err
+	}
+	if resp == nil {
+		return []MusicFolder{}, fmt.Errorf("GetMusicFolders nil response from server: %s", err)
+	}
+	return resp.MusicFolders.MusicFolders, nil
+}
+
 func (connection *Connection) GetSongsByGenre(genre string, offset int, musicFolderID string) (Entities, error) {
 	query := defaultQuery(connection)
 	query.Add("genre", genre)
@@ -0,0 +1,490 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/spf13/viper"
+)
+
+// The named styles of a theme
+const (
+	StyleText          = "text"
+	StyleDim           = "dim"
+	StyleBorder        = "border"
+	StyleTitle         = "title"
+	StyleLabel         = "label"
+	StyleSelection     = "selection"
+	StyleMarked        = "marked"
+	StyleStopAfter     = "stopAfter"
+	StyleField         = "field"
+	StyleButton        = "button"
+	StyleButtonActive  = "buttonActive"
+	StyleDialog        = "dialog"
+	StylePlaying       = "playing"
+	StylePaused        = "paused"
+	StyleStopped       = "stopped"
+	StyleScanning      = "scanning"
+	StyleStar          = "star"
+	StyleInfoLabel     = "infoLabel"
+	StyleInfoValue     = "infoValue"
+	StyleInfoTitle     = "infoTitle"
+	StyleInfoDuration  = "infoDuration"
+	StyleLyrics        = "lyrics"
+	StyleLyricsCurrent = "lyricsCurrent"
+	StyleLogError      = "logError"
+	StyleLogWarning    = "logWarning"
+	StyleLogDebug      = "logDebug"
+)
+
+// themeStyles are the names of all styles, with what they're for
+var themeStyles = map[string]string{
+	StyleText:          "text and background",
+	StyleDim:           "less important text, like hints",
+	StyleBorder:        "borders",
+	StyleTitle:         "titles of borders",
+	StyleLabel:         "labels of input fields",
+	StyleSelection:     "the selected item of lists and tables",
+	StyleMarked:        "the marked songs of the queue",
+	StyleStopAfter:     "the songs of the queue that playback stops after",
+	StyleField:         "input fields",
+	StyleButton:        "menu buttons",
+	StyleButtonActive:  "the active menu button",
+	StyleDialog:        "dialogs",
+	StylePlaying:       "Playing in the status bar",
+	StylePaused:        "Paused in the status bar",
+	StyleStopped:       "Stopped in the status bar",
+	StyleScanning:      "the library scan marker in the status bar",
+	StyleStar:          "the marker of starred items",
+	StyleInfoLabel:     "labels of the song info panel",
+	StyleInfoValue:     "values of the song info panel",
+	StyleInfoTitle:     "the title in the song info panel",
+	StyleInfoDuration:  "the duration in the song info panel",
+	StyleLyrics:        "lyrics",
+	StyleLyricsCurrent: "the lyrics line being sung",
+	StyleLogError:      "errors in the log",
+	StyleLogWarning:    "warnings in the log",
+	StyleLogDebug:      "debug messages in the log",
+}
+
+// themeStyleNames returns the names of all styles, sorted
+func themeStyleNames() []string {
+	names := make([]string, 0, len(themeStyles))
+	for name := range themeStyles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ThemeStyle is a style written like a tview color tag, without the
+// brackets: "foreground:background:attributes", e.g. "yellow::b" or
+// "black:lightgray". Empty parts are left as they are, "-" is the default.
+type ThemeStyle struct {
+	fg, bg, attrs string
+}
+
+// styleAttrs are the attribute letters, as tview tags have them
+var styleAttrs = map[rune]tcell.AttrMask{
+	'b': tcell.AttrBold,
+	'd': tcell.AttrDim,
+	'i': tcell.AttrItalic,
+	'l': tcell.AttrBlink,
+	'r': tcell.AttrReverse,
+	's': tcell.AttrStrikeThrough,
+	'u': tcell.AttrUnderline,
+}
+
+// parseThemeStyle parses a style like "yellow:black:b"
+func parseThemeStyle(s string) (ThemeStyle, error) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(s)), ":")
+	if len(parts) > 3 {
+		return ThemeStyle{}, fmt.Errorf("invalid style %q: use foreground:background:attributes", s)
+	}
+	parts = append(parts, "", "")
+	style := ThemeStyle{fg: parts[0], bg: parts[1], attrs: parts[2]}
+	for _, color := range []string{style.fg, style.bg} {
+		if !validColor(color) {
+			return ThemeStyle{}, fmt.Errorf("invalid color %q in style %q", color, s)
+		}
+	}
+	if style.attrs != "-" {
+		for _, attr := range style.attrs {
+			if _, ok := styleAttrs[attr]; !ok {
+				return ThemeStyle{}, fmt.Errorf("invalid attribute %q in style %q: use b, d, i, l, r, s, or u", attr, s)
+			}
+		}
+	}
+	return style, nil
+}
+
+func validColor(color string) bool {
+	switch color {
+	case "", "-", "default":
+		return true
+	}
+	if _, ok := tcell.ColorNames[color]; ok {
+		return true
+	}
+	return len(color) == 7 && color[0] == '#' && tcell.GetColor(color) != tcell.ColorDefault
+}
+
+func themeColor(color string) tcell.Color {
+	if color == "" || color == "-" {
+		return tcell.ColorDefault
+	}
+	return tcell.GetColor(color)
+}
+
+// Foreground is the style's text color
+func (s ThemeStyle) Foreground() tcell.Color {
+	return themeColor(s.fg)
+}
+
+// Background is the style's background color
+func (s ThemeStyle) Background() tcell.Color {
+	return themeColor(s.bg)
+}
+
+// Tcell returns the style for widgets
+func (s ThemeStyle) Tcell() tcell.Style {
+	style := tcell.StyleDefault.Foreground(s.Foreground()).Background(s.Background())
+	for _, attr := range s.attrs {
+		style = style.Attributes(styleAttrs[attr] | attrsOf(style))
+	}
+	return style
+}
+
+func attrsOf(style tcell.Style) tcell.AttrMask {
+	_, _, attrs := style.Decompose()
+	return attrs
+}
+
+// Tag returns the style as a tview color tag, for text with dynamic colors.
+// Reset it with themeReset.
+func (s ThemeStyle) Tag() string {
+	switch {
+	case s.attrs != "":
+		return "[" + s.fg + ":" + s.bg + ":" + s.attrs + "]"
+	case s.bg != "":
+		return "[" + s.fg + ":" + s.bg + "]"
+	case s.fg != "":
+		return "[" + s.fg + "]"
+	}
+	return ""
+}
+
+// ColorTag returns a tview color tag of only the style's text color, for
+// text with its own background, like list items
+func (s ThemeStyle) ColorTag() string {
+	if s.fg == "" {
+		return ""
+	}
+	return "[" + s.fg + "]"
+}
+
+func (s ThemeStyle) String() string {
+	return strings.TrimRight(s.fg+":"+s.bg+":"+s.attrs, ":")
+}
+
+// themeReset ends the text of a Tag
+const themeReset = "[-:-:-]"
+
+// Theme is a set of named styles, see themeStyles
+type Theme struct {
+	Name   string
+	styles map[string]ThemeStyle
+}
+
+// Style returns a named style
+func (t *Theme) Style(name string) ThemeStyle {
+	return t.styles[name]
+}
+
+// Tag returns the tview color tag of a named style
+func (t *Theme) Tag(name string) string {
+	return t.styles[name].Tag()
+}
+
+// Styled wraps escaped text in a named style
+func (t *Theme) Styled(name, text string) string {
+	tag := t.Tag(name)
+	if tag == "" {
+		return tview.Escape(text)
+	}
+	return tag + tview.Escape(text) + themeReset
+}
+
+// set parses and sets styles, and returns all problems
+func (t *Theme) set(styles map[string]string) error {
+	var errs []error
+	for _, name := range sortedKeys(styles) {
+		canonical := ""
+		for known := range themeStyles {
+			if strings.EqualFold(known, name) {
+				canonical = known
+			}
+		}
+		if canonical == "" {
+			errs = append(errs, fmt.Errorf("unknown style %q", name))
+			continue
+		}
+		style, err := parseThemeStyle(styles[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		t.styles[canonical] = style
+	}
+	return errors.Join(errs...)
+}
+
+// copyTheme returns a copy of a theme, with another name
+func copyTheme(t *Theme, name string) *Theme {
+	theme := &Theme{Name: name, styles: make(map[string]ThemeStyle, len(t.styles))}
+	for k, v := range t.styles {
+		theme.styles[k] = v
+	}
+	return theme
+}
+
+// mustTheme makes a built-in theme
+func mustTheme(name string, styles map[string]string) *Theme {
+	theme := &Theme{Name: name, styles: make(map[string]ThemeStyle)}
+	if err := theme.set(styles); err != nil {
+		panic(err)
+	}
+	return theme
+}
+
+// builtinThemes can be used by name. "default" is the look stmps always had,
+// for dark terminals.
+var builtinThemes = map[string]*Theme{
+	"default": mustTheme("default", map[string]string{
+		StyleText:          "white:black",
+		StyleDim:           "gray",
+		StyleBorder:        "white",
+		StyleTitle:         "white",
+		StyleLabel:         "yellow",
+		StyleSelection:     "black:lightgray",
+		StyleMarked:        "white:navy",
+		StyleStopAfter:     "::u",
+		StyleField:         "white:black",
+		StyleButton:        "white:black",
+		StyleButtonActive:  "red:white",
+		StyleDialog:        "white:black",
+		StylePlaying:       "green::b",
+		StylePaused:        "yellow::b",
+		StyleStopped:       "red::b",
+		StyleScanning:      "green",
+		StyleStar:          "red",
+		StyleInfoLabel:     "blue::b",
+		StyleInfoValue:     "::i",
+		StyleInfoTitle:     "green::i",
+		StyleInfoDuration:  "yellow::i",
+		StyleLyrics:        "",
+		StyleLyricsCurrent: "::b",
+		StyleLogError:      "red",
+		StyleLogWarning:    "yellow",
+		StyleLogDebug:      "gray",
+	}),
+	// for terminals with a light background
+	"light": mustTheme("light", map[string]string{
+		StyleText:          "black:white",
+		StyleDim:           "gray",
+		StyleBorder:        "darkgray",
+		StyleTitle:         "black::b",
+		StyleLabel:         "navy",
+		StyleSelection:     "white:royalblue",
+		StyleMarked:        "black:lightyellow",
+		StyleStopAfter:     "::u",
+		StyleField:         "black:lightgray",
+		StyleButton:        "black:white",
+		StyleButtonActive:  "white:darkred",
+		StyleDialog:        "black:lightgray",
+		StylePlaying:       "darkgreen::b",
+		StylePaused:        "darkorange::b",
+		StyleStopped:       "darkred::b",
+		StyleScanning:      "darkgreen",
+		StyleStar:          "crimson",
+		StyleInfoLabel:     "navy::b",
+		StyleInfoValue:     "::i",
+		StyleInfoTitle:     "darkgreen::i",
+		StyleInfoDuration:  "darkorange::i",
+		StyleLyrics:        "",
+		StyleLyricsCurrent: "navy::b",
+		StyleLogError:      "darkred",
+		StyleLogWarning:    "darkorange",
+		StyleLogDebug:      "gray",
+	}),
+	// the terminal's own colors, with attributes only
+	"mono": mustTheme("mono", map[string]string{
+		StyleText:          "-:-",
+		StyleDim:           "::d",
+		StyleBorder:        "-",
+		StyleTitle:         "::b",
+		StyleLabel:         "::b",
+		StyleSelection:     "::r",
+		StyleMarked:        "::u",
+		StyleStopAfter:     "::bu",
+		StyleField:         "::u",
+		StyleButton:        "-:-",
+		StyleButtonActive:  "::r",
+		StyleDialog:        "-:-",
+		StylePlaying:       "::b",
+		StylePaused:        "::bi",
+		StyleStopped:       "::d",
+		StyleScanning:      "::b",
+		StyleStar:          "::b",
+		StyleInfoLabel:     "::b",
+		StyleInfoValue:     "",
+		StyleInfoTitle:     "::i",
+		StyleInfoDuration:  "",
+		StyleLyrics:        "::d",
+		StyleLyricsCurrent: "::b",
+		StyleLogError:      "::b",
+		StyleLogWarning:    "::u",
+		StyleLogDebug:      "::d",
+	}),
+}
+
+// builtinThemeNames returns the names of the built-in themes, sorted
+func builtinThemeNames() []string {
+	names := make([]string, 0, len(builtinThemes))
+	for name := range builtinThemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// themesDir is where theme files are looked for: a themes directory next to
+// the config file
+func themesDir() string {
+	dir := configDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, "themes")
+}
+
+// loadTheme returns the theme of the config:
+//
+//	[theme]
+//	name = "light"       # a built-in theme, or a file <name>.toml in themesDir
+//	file = "mine.toml"   # or a theme file
+//	[theme.styles]
+//	star = "magenta"     # styles that replace the theme's
+//
+// A theme file can extend another theme, and sets styles:
+//
+//	extends = "light"
+//	[styles]
+//	selection = "white:darkcyan"
+func loadTheme() (*Theme, error) {
+	theme := builtinThemes["default"]
+	var err error
+	if file := viper.GetString("theme.file"); file != "" {
+		theme, err = loadThemeFile(file, nil)
+	} else if name := viper.GetString("theme.name"); name != "" {
+		theme, err = findTheme(name, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	styles := viper.GetStringMapString("theme.styles")
+	if len(styles) == 0 {
+		return theme, nil
+	}
+	theme = copyTheme(theme, theme.Name)
+	if err := theme.set(styles); err != nil {
+		return nil, fmt.Errorf("[theme.styles]: %w", err)
+	}
+	return theme, nil
+}
+
+// findTheme returns a built-in theme, or loads one from themesDir. seen are
+// the files being loaded, to catch themes that extend themselves.
+func findTheme(name string, seen []string) (*Theme, error) {
+	if theme, ok := builtinThemes[strings.ToLower(name)]; ok {
+		return theme, nil
+	}
+	dir := themesDir()
+	path := filepath.Join(dir, name+".toml")
+	if _, err := os.Stat(path); dir == "" || err != nil {
+		return nil, fmt.Errorf("unknown theme %q: use one of %s, or put %s.toml in %s",
+			name, strings.Join(builtinThemeNames(), ", "), name, dir)
+	}
+	return loadThemeFile(path, seen)
+}
+
+// loadThemeFile loads a theme file, see loadTheme
+func loadThemeFile(path string, seen []string) (*Theme, error) {
+	for _, s := range seen {
+		if s == path {
+			return nil, fmt.Errorf("%s: theme extends itself", path)
+		}
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("toml")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	base := builtinThemes["default"]
+	if extends := v.GetString("extends"); extends != "" {
+		var err error
+		if base, err = findTheme(extends, append(seen, path)); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	theme := copyTheme(base, name)
+	if err := theme.set(v.GetStringMapString("styles")); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return theme, nil
+}
+
+// apply makes the theme tview's default, for all widgets created afterwards
+func (t *Theme) apply() {
+	text := t.Style(StyleText)
+	tview.Styles.PrimitiveBackgroundColor = text.Background()
+	tview.Styles.PrimaryTextColor = text.Foreground()
+	tview.Styles.BorderColor = t.Style(StyleBorder).Foreground()
+	tview.Styles.GraphicsColor = t.Style(StyleBorder).Foreground()
+	tview.Styles.TitleColor = t.Style(StyleTitle).Foreground()
+	tview.Styles.SecondaryTextColor = t.Style(StyleLabel).Foreground()
+	tview.Styles.ContrastBackgroundColor = t.Style(StyleField).Background()
+	tview.Styles.MoreContrastBackgroundColor = t.Style(StyleSelection).Background()
+	tview.Styles.InverseTextColor = t.Style(StyleSelection).Foreground()
+	tview.Styles.ContrastSecondaryTextColor = t.Style(StyleDim).Foreground()
+}
+
+// styleList gives a list the theme's selection style
+func (t *Theme) styleList(list *tview.List) {
+	list.SetSelectedStyle(t.Style(StyleSelection).Tcell())
+}
+
+// styleTable gives a table the theme's selection style
+func (t *Theme) styleTable(table *tview.Table) {
+	table.SetSelectedStyle(t.Style(StyleSelection).Tcell())
+}
+
+// styleField gives an input field the theme's field and label styles
+func (t *Theme) styleField(field *tview.InputField) {
+	field.SetFieldStyle(t.Style(StyleField).Tcell()).
+		SetLabelStyle(t.Style(StyleLabel).Tcell().Background(t.Style(StyleText).Background()))
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseThemeStyle(t *testing.T) {
+	style, err := parseThemeStyle("yellow::b")
+	require.NoError(t, err)
+	assert.Equal(t, "[yellow::b]", style.Tag())
+	assert.Equal(t, "[yellow]", style.ColorTag())
+	assert.Equal(t, tcell.ColorYellow, style.Foreground())
+	assert.Equal(t, tcell.ColorDefault, style.Background())
+	_, _, attrs := style.Tcell().Decompose()
+	assert.Equal(t, tcell.AttrBold, attrs)
+
+	style, err = parseThemeStyle("Black:#c0c0c0")
+	require.NoError(t, err)
+	assert.Equal(t, "[black:#c0c0c0]", style.Tag())
+	assert.Equal(t, tcell.GetColor("#c0c0c0"), style.Background())
+
+	style, err = parseThemeStyle("")
+	require.NoError(t, err)
+	assert.Equal(t, "", style.Tag())
+
+	for _, invalid := range []string{"nocolor", "red:blue:x", "#12345", "red:blue:b:u"} {
+		_, err := parseThemeStyle(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestBuiltinThemesAreComplete(t *testing.T) {
+	for _, name := range builtinThemeNames() {
+		for _, style := range themeStyleNames() {
+			_, ok := builtinThemes[name].styles[style]
+			assert.True(t, ok, "theme %s has no style %s", name, style)
+		}
+	}
+}
+
+func TestThemeStyled(t *testing.T) {
+	theme := builtinThemes["default"]
+	assert.Equal(t, "[red::b]Stopped [x[]"+themeReset, theme.Styled(StyleStopped, "Stopped [x]"))
+	assert.Equal(t, "plain", builtinThemes["default"].Styled(StyleLyrics, "plain"))
+}
+
+func TestLoadTheme(t *testing.T) {
+	defer viper.Reset()
+	dir := t.TempDir()
+	config := filepath.Join(dir, "stmp.toml")
+	require.NoError(t, os.WriteFile(config, []byte(`
+[theme]
+name = "mine"
+[theme.styles]
+Star = "fuchsia"
+`), 0600))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "themes"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "themes", "mine.toml"), []byte(`
+extends = "light"
+[styles]
+selection = "white:darkcyan"
+`), 0600))
+
+	viper.SetConfigFile(config)
+	require.NoError(t, viper.ReadInConfig())
+	theme, err := loadTheme()
+	require.NoError(t, err)
+	assert.Equal(t, "mine", theme.Name)
+	assert.Equal(t, "white:darkcyan", theme.Style(StyleSelection).String())
+	assert.Equal(t, "fuchsia", theme.Style(StyleStar).String())
+	assert.Equal(t, builtinThemes["light"].Style(StylePlaying), theme.Style(StylePlaying))
+	// the built-in theme is unchanged
+	assert.Equal(t, "crimson", builtinThemes["light"].Style(StyleStar).String())
+
+	viper.Set("theme.styles", map[string]string{"nostyle": "red"})
+	_, err = loadTheme()
+	assert.ErrorContains(t, err, `unknown style "nostyle"`)
+
+	viper.Set("theme.styles", map[string]string{})
+	viper.Set("theme.name", "missing")
+	_, err = loadTheme()
+	assert.ErrorContains(t, err, `unknown theme "missing"`)
+}
+
+func TestThemeExtendsItself(t *testing.T) {
+	defer viper.Reset()
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "themes"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "themes", "loop.toml"), []byte(`extends = "loop"`), 0600))
+	viper.SetConfigFile(filepath.Join(dir, "stmp.toml"))
+	viper.Set("theme.name", "loop")
+
+	_, err := loadTheme()
+	assert.ErrorContains(t, err, "theme extends itself")
+}
+
+func TestLogLevelStyle(t *testing.T) {
+	assert.Equal(t, StyleLogError, logLevelStyle("Error(GetArtist) -> timeout"))
+	assert.Equal(t, StyleLogError, logLevelStyle("error: something"))
+	assert.Equal(t, StyleLogWarning, logLevelStyle("warning: hmm"))
+	assert.Equal(t, StyleLogDebug, logLevelStyle("debug: details"))
+	assert.Equal(t, "", logLevelStyle("mpvEvent: playing"))
+}
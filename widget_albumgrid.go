@@ -0,0 +1,230 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"image"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/spezifisch/stmps/subsonic"
+)
+
+// the size of an album of the grid, in characters: the cover art, then the
+// album name and artist, then a blank line
+const (
+	albumGridCellWidth   = 22
+	albumGridImageWidth  = 20
+	albumGridImageHeight = 10
+	albumGridCellHeight  = albumGridImageHeight + 3
+)
+
+// gridThumbnail draws the cover art of one place of the grid. The image it
+// shows is kept, because tview.Image renders it again whenever it's set.
+type gridThumbnail struct {
+	image *tview.Image
+	shown image.Image
+}
+
+// AlbumGrid shows albums as a grid of cover art thumbnails with their names
+// underneath. Like ListWidget, it shows a model: count returns the number of
+// albums, and album one of them. Only the albums on screen are drawn, and
+// only their cover art is asked for.
+type AlbumGrid struct {
+	*tview.Box
+
+	count    func() int
+	album    func(index int) subsonic.Album
+	coverArt func(album subsonic.Album) image.Image
+
+	// selected is the index of the selected album, and offset the first row
+	// shown
+	selected int
+	offset   int
+	// the grid's size when it was last drawn
+	columns int
+	rows    int
+
+	thumbnails []*gridThumbnail
+
+	// changedFunc is called when another album is selected
+	changedFunc func(index int)
+
+	theme *Theme
+}
+
+// newAlbumGrid creates a grid with a border and a title, which shows the
+// model of count and album, with the cover art coverArt returns
+func newAlbumGrid(theme *Theme, title string, count func() int, album func(int) subsonic.Album, coverArt func(subsonic.Album) image.Image) *AlbumGrid {
+	g := &AlbumGrid{
+		Box:      tview.NewBox(),
+		count:    count,
+		album:    album,
+		coverArt: coverArt,
+		columns:  1,
+		rows:     1,
+		theme:    theme,
+	}
+	g.Box.
+		SetTitle(title).
+		SetTitleAlign(tview.AlignLeft).
+		SetBorder(true)
+	return g
+}
+
+// SetChangedFunc sets the function that's called when another album is
+// selected
+func (g *AlbumGrid) SetChangedFunc(changed func(index int)) *AlbumGrid {
+	g.changedFunc = changed
+	return g
+}
+
+// GetCurrentItem returns the index of the selected album, or 0 if there are
+// none
+func (g *AlbumGrid) GetCurrentItem() int {
+	return max(min(g.selected, g.count()-1), 0)
+}
+
+// SetCurrentItem selects an album, which calls the changed function if it
+// wasn't selected
+func (g *AlbumGrid) SetCurrentItem(index int) *AlbumGrid {
+	index = max(min(index, g.count()-1), 0)
+	if index == g.selected {
+		return g
+	}
+	g.selected = index
+	if g.changedFunc != nil {
+		g.changedFunc(index)
+	}
+	return g
+}
+
+// Reset selects the first album and scrolls to it, without calling the
+// changed function; call it when the model has changed entirely
+func (g *AlbumGrid) Reset() *AlbumGrid {
+	g.selected = 0
+	g.offset = 0
+	return g
+}
+
+func (g *AlbumGrid) Draw(screen tcell.Screen) {
+	g.Box.DrawForSubclass(screen, g)
+	x, y, width, height := g.GetInnerRect()
+	g.columns = max(width/albumGridCellWidth, 1)
+	g.rows = max(height/albumGridCellHeight, 1)
+
+	// scroll so that the selected album is shown
+	count := g.count()
+	selected := g.GetCurrentItem()
+	if row := selected / g.columns; row < g.offset {
+		g.offset = row
+	} else if row >= g.offset+g.rows {
+		g.offset = row - g.rows + 1
+	}
+
+	for len(g.thumbnails) < g.columns*g.rows {
+		g.thumbnails = append(g.thumbnails, &gridThumbnail{image: tview.NewImage()})
+	}
+	for i := 0; i < g.columns*g.rows; i++ {
+		index := g.offset*g.columns + i
+		if index >= count {
+			break
+		}
+		album := g.album(index)
+		cellX := x + i%g.columns*albumGridCellWidth
+		cellY := y + i/g.columns*albumGridCellHeight
+
+		thumbnail := g.thumbnails[i]
+		if art := g.coverArt(album); art != thumbnail.shown {
+			thumbnail.image.SetImage(art)
+			thumbnail.shown = art
+		}
+		thumbnail.image.SetRect(cellX+1, cellY, albumGridImageWidth, albumGridImageHeight)
+		thumbnail.image.Draw(screen)
+
+		nameStyle, artistStyle := StyleText, StyleDim
+		if index == selected && g.HasFocus() {
+			nameStyle, artistStyle = StyleSelection, StyleSelection
+		}
+		tview.Print(screen, g.theme.Styled(nameStyle, album.Name),
+			cellX, cellY+albumGridImageHeight, albumGridCellWidth-1, tview.AlignCenter, tcell.ColorDefault)
+		tview.Print(screen, g.theme.Styled(artistStyle, album.Artist),
+			cellX, cellY+albumGridImageHeight+1, albumGridCellWidth-1, tview.AlignCenter, tcell.ColorDefault)
+	}
+}
+
+func (g *AlbumGrid) InputHandler() func(event *tcell.EventKey, setFocus func(p tview.Primitive)) {
+	return g.WrapInputHandler(func(event *tcell.EventKey, setFocus func(p tview.Primitive)) {
+		selected := g.GetCurrentItem()
+		switch event.Key() {
+		case tcell.KeyLeft:
+			g.SetCurrentItem(selected - 1)
+		case tcell.KeyRight:
+			g.SetCurrentItem(selected + 1)
+		case tcell.KeyUp:
+			g.up(selected)
+		case tcell.KeyDown:
+			g.SetCurrentItem(selected + g.columns)
+		case tcell.KeyPgUp:
+			g.SetCurrentItem(selected - g.columns*g.rows)
+		case tcell.KeyPgDn:
+			g.SetCurrentItem(selected + g.columns*g.rows)
+		case tcell.KeyHome:
+			g.SetCurrentItem(0)
+		case tcell.KeyEnd:
+			g.SetCurrentItem(g.count() - 1)
+		case tcell.KeyRune:
+			switch event.Rune() {
+			case 'h':
+				g.SetCurrentItem(selected - 1)
+			case 'l':
+				g.SetCurrentItem(selected + 1)
+			case 'k':
+				g.up(selected)
+			case 'j':
+				g.SetCurrentItem(selected + g.columns)
+			case 'g':
+				g.SetCurrentItem(0)
+			case 'G':
+				g.SetCurrentItem(g.count() - 1)
+			}
+		}
+	})
+}
+
+// up selects the album above, if it isn't in the first row
+func (g *AlbumGrid) up(selected int) {
+	if selected >= g.columns {
+		g.SetCurrentItem(selected - g.columns)
+	}
+}
+
+func (g *AlbumGrid) MouseHandler() func(action tview.MouseAction, event *tcell.EventMouse, setFocus func(p tview.Primitive)) (consumed bool, capture tview.Primitive) {
+	return g.WrapMouseHandler(func(action tview.MouseAction, event *tcell.EventMouse, setFocus func(p tview.Primitive)) (consumed bool, capture tview.Primitive) {
+		if !g.InRect(event.Position()) {
+			return false, nil
+		}
+		switch action {
+		case tview.MouseLeftClick:
+			setFocus(g)
+			x, y, width, _ := g.GetInnerRect()
+			mouseX, mouseY := event.Position()
+			if mouseX < x || mouseX >= x+min(g.columns*albumGridCellWidth, width) || mouseY < y {
+				return true, nil
+			}
+			index := (g.offset+(mouseY-y)/albumGridCellHeight)*g.columns + (mouseX-x)/albumGridCellWidth
+			if index < g.count() {
+				g.SetCurrentItem(index)
+			}
+			return true, nil
+		case tview.MouseScrollUp:
+			g.up(g.GetCurrentItem())
+			return true, nil
+		case tview.MouseScrollDown:
+			g.SetCurrentItem(g.GetCurrentItem() + g.columns)
+			return true, nil
+		}
+		return false, nil
+	})
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"image"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/spezifisch/stmps/subsonic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlbumGridNavigation(t *testing.T) {
+	albums := make([]subsonic.Album, 10)
+	grid := newAlbumGrid(builtinThemes["default"], " test ",
+		func() int { return len(albums) },
+		func(i int) subsonic.Album { return albums[i] },
+		func(subsonic.Album) image.Image { return nil })
+	var changed []int
+	grid.SetChangedFunc(func(i int) { changed = append(changed, i) })
+
+	// room for 3 columns and 2 rows
+	screen := tcell.NewSimulationScreen("")
+	assert.NoError(t, screen.Init())
+	screen.SetSize(3*albumGridCellWidth+2, 2*albumGridCellHeight+2)
+	grid.SetRect(0, 0, 3*albumGridCellWidth+2, 2*albumGridCellHeight+2)
+	grid.Draw(screen)
+
+	press := func(key tcell.Key, r rune) {
+		grid.InputHandler()(tcell.NewEventKey(key, r, tcell.ModNone), nil)
+	}
+	press(tcell.KeyDown, 0)
+	assert.Equal(t, 3, grid.GetCurrentItem())
+	press(tcell.KeyRune, 'l')
+	assert.Equal(t, 4, grid.GetCurrentItem())
+	press(tcell.KeyPgDn, 0)
+	assert.Equal(t, 9, grid.GetCurrentItem(), "stops at the last album")
+	press(tcell.KeyUp, 0)
+	assert.Equal(t, 6, grid.GetCurrentItem())
+	press(tcell.KeyHome, 0)
+	press(tcell.KeyUp, 0)
+	assert.Equal(t, 0, grid.GetCurrentItem(), "stays in the first row")
+	assert.Equal(t, []int{3, 4, 9, 6, 0}, changed)
+
+	// the selected album's row is scrolled to
+	grid.SetCurrentItem(9)
+	grid.Draw(screen)
+	assert.Equal(t, 2, grid.offset)
+}
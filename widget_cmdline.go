@@ -0,0 +1,232 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+	"github.com/spezifisch/stmps/cmdline"
+)
+
+const (
+	// pages of the bottom bar
+	bottomBarMenu        = "menu"
+	bottomBarCommandLine = "commandLine"
+
+	// how many command lines are remembered
+	commandHistorySize = 500
+	commandHistoryName = "command-history"
+)
+
+// CommandLineWidget is the ":" prompt, which replaces the menu in the bottom
+// bar while it's open
+type CommandLineWidget struct {
+	Root *tview.InputField
+
+	completer   cmdline.Completer
+	history     *cmdline.History
+	historyFile string
+
+	// the context of the list that had the focus when the prompt opened, for
+	// running its commands by name
+	context string
+	// where the focus goes back to when the prompt closes
+	returnFocus tview.Primitive
+	// Tab was pressed and the completions drop-down is open
+	completing bool
+	// visible reflects whether the prompt is shown
+	visible bool
+
+	// external references
+	ui *Ui
+}
+
+func (ui *Ui) createCommandLineWidget() (c *CommandLineWidget) {
+	c = &CommandLineWidget{
+		history: cmdline.NewHistory(commandHistorySize),
+		ui:      ui,
+	}
+	c.completer.Names = ui.completeNames
+
+	if dir, err := stateDir(); err != nil {
+		ui.logger.PrintError("createCommandLineWidget", err)
+	} else {
+		c.historyFile = filepath.Join(dir, commandHistoryName)
+		if history, err := cmdline.LoadHistory(c.historyFile, commandHistorySize); err != nil {
+			ui.logger.PrintError("LoadHistory", err)
+		} else {
+			c.history = history
+		}
+	}
+
+	c.Root = tview.NewInputField().
+		SetLabel(":")
+	ui.theme.styleField(c.Root)
+	c.Root.SetAutocompleteFunc(func(text string) []string {
+		// only after Tab, then the drop-down follows the typing
+		if !c.completing {
+			return nil
+		}
+		lines := c.completer.Complete(text)
+		if len(lines) == 0 {
+			c.completing = false
+		}
+		return lines
+	})
+	c.Root.SetAutocompletedFunc(func(text string, index, source int) bool {
+		if source == tview.AutocompletedNavigate {
+			return false
+		}
+		c.Root.SetText(text + " ")
+		c.completing = false
+		return true
+	})
+	c.Root.SetInputCapture(c.handleInput)
+	c.Root.SetDoneFunc(func(key tcell.Key) {
+		switch key {
+		case tcell.KeyEnter:
+			line := c.Root.GetText()
+			context := c.context
+			c.Close()
+			c.run(line, context)
+		case tcell.KeyEscape:
+			c.Close()
+		}
+	})
+
+	return
+}
+
+func (c *CommandLineWidget) handleInput(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyTab:
+		if c.completing {
+			// the drop-down picks the selected line
+			return event
+		}
+		c.complete()
+		return nil
+	case tcell.KeyBacktab:
+		return nil
+	case tcell.KeyEscape:
+		if c.completing {
+			// closes the drop-down, but not the prompt
+			c.completing = false
+		}
+	case tcell.KeyUp, tcell.KeyDown:
+		if c.completing {
+			return event
+		}
+		var line string
+		var ok bool
+		if event.Key() == tcell.KeyUp {
+			line, ok = c.history.Previous(c.Root.GetText())
+		} else {
+			line, ok = c.history.Next()
+		}
+		if ok {
+			c.Root.SetText(line)
+		}
+		return nil
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		// like vim, backspace on an empty line closes the prompt
+		if c.Root.GetText() == "" {
+			c.Close()
+			return nil
+		}
+	}
+	return event
+}
+
+// complete fills in the only completion, or as much as all completions
+// have in common and shows them in a drop-down
+func (c *CommandLineWidget) complete() {
+	text := c.Root.GetText()
+	lines := c.completer.Complete(text)
+	switch len(lines) {
+	case 0:
+		return
+	case 1:
+		c.Root.SetText(lines[0] + " ")
+		return
+	}
+
+	prefix := cmdline.CommonPrefix(lines)
+	// not if it ends inside of quotes
+	if _, err := cmdline.Split(prefix); err == nil && len(prefix) > len(text) {
+		c.Root.SetText(prefix)
+	}
+	c.completing = true
+	c.Root.Autocomplete()
+}
+
+// Open shows the prompt. The commands that can be run by name are the
+// Global ones, and those of the list that has the focus.
+func (c *CommandLineWidget) Open() {
+	c.returnFocus = c.ui.app.GetFocus()
+	c.context = c.ui.focusedContext(c.returnFocus)
+	c.completer.Specs = c.ui.commandSpecs(c.context)
+	c.history.Reset()
+	c.completing = false
+	c.Root.SetText("")
+
+	c.visible = true
+	c.ui.bottomBar.SwitchToPage(bottomBarCommandLine)
+	c.ui.app.SetFocus(c.Root)
+}
+
+// Close hides the prompt, and gives the focus back
+func (c *CommandLineWidget) Close() {
+	c.visible = false
+	c.completing = false
+	c.ui.bottomBar.SwitchToPage(bottomBarMenu)
+	if c.returnFocus != nil {
+		c.ui.app.SetFocus(c.returnFocus)
+	}
+}
+
+// run runs a command line, remembers it, and shows what went wrong
+func (c *CommandLineWidget) run(line, context string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	c.history.Add(line)
+	if c.historyFile != "" {
+		if err := c.history.Save(c.historyFile); err != nil {
+			c.ui.logger.PrintError("History.Save", err)
+		}
+	}
+
+	if err := c.ui.runCommand(line, context); err != nil {
+		c.ui.logger.Printf(":%s: %s", strings.TrimSpace(line), err)
+		c.ui.showMessageBox(err.Error())
+	}
+}
+
+// focusedContext returns the keybinding context of a focused list
+func (ui *Ui) focusedContext(focused tview.Primitive) string {
+	switch focused {
+	case ui.browserPage.artistList:
+		return ContextBrowserArtists
+	case ui.browserPage.entityList:
+		return ContextBrowserEntities
+	case ui.queuePage.queueList:
+		return ContextQueue
+	case ui.playlistPage.playlistList:
+		return ContextPlaylists
+	case ui.playlistPage.selectedPlaylist:
+		return ContextPlaylistSongs
+	case ui.searchPage.artistList, ui.searchPage.albumList, ui.searchPage.songList:
+		return ContextSearch
+	case ui.albumsPage.grid:
+		return ContextAlbums
+	}
+	if ui.menuWidget.GetActivePage() == PageStats {
+		return ContextStats
+	}
+	return ContextGlobal
+}
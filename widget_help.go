@@ -4,6 +4,7 @@
 package main
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/rivo/tview"
@@ -46,29 +47,35 @@ func (ui *Ui) createHelpWidget() (m *HelpWidget) {
 	return
 }
 
-func (h *HelpWidget) RenderHelp(context string) {
-	leftText := "[::b]Playback[::-]\n" + tview.Escape(strings.TrimSpace(helpPlayback))
-	h.leftColumn.SetText(leftText)
-
-	rightText := ""
-	switch context {
-	case PageBrowser:
-		rightText = "[::b]Browser[::-]\n" + tview.Escape(strings.TrimSpace(helpPageBrowser))
-
-	case PageQueue:
-		rightText = "[::b]Queue[::-]\n" + tview.Escape(strings.TrimSpace(helpPageQueue))
-
-	case PagePlaylists:
-		rightText = "[::b]Playlists[::-]\n" + tview.Escape(strings.TrimSpace(helpPagePlaylists))
+// pageKeyContexts are the contexts of the lists on each page
+var pageKeyContexts = map[string][]string{
+	PageBrowser:   {ContextBrowserArtists, ContextBrowserEntities},
+	PageQueue:     {ContextQueue},
+	PagePlaylists: {ContextPlaylists, ContextPlaylistSongs},
+	PageSearch:    {ContextSearch},
+	PageStats:     {ContextStats},
+	PageAlbums:    {ContextAlbums},
+}
 
-	case PageSearch:
-		rightText = "[::b]Search[::-]\n" + tview.Escape(strings.TrimSpace(helpSearchPage))
+// RenderHelp shows the keys bound on a page, next to the global ones
+func (h *HelpWidget) RenderHelp(page string) {
+	leftText := h.contextHelp(ContextGlobal) + "\n\n"
+	if presets := h.randomPresetsHelp(); presets != "" {
+		leftText += presets + "\n\n"
+	}
+	leftText += h.commandLineHelp()
+	h.leftColumn.SetText(leftText)
 
-	case PageLog:
-		fallthrough
-	default:
-		// no text
+	sections := make([]string, 0)
+	for _, context := range pageKeyContexts[page] {
+		if text := h.contextHelp(context); text != "" {
+			sections = append(sections, text)
+		}
 	}
+	if extra, ok := pageHelpNotes[page]; ok {
+		sections = append(sections, tview.Escape(strings.TrimSpace(extra)))
+	}
+	rightText := strings.Join(sections, "\n\n")
 
 	h.rightColumn.SetText(rightText)
 
@@ -80,3 +87,37 @@ func (h *HelpWidget) RenderHelp(context string) {
 		h.helpBook.AddItem(h.leftColumn, 0, 1, false)
 	}
 }
+
+// contextHelp is the help section of a context, or "" if nothing is bound
+// in it
+func (h *HelpWidget) contextHelp(contextName string) string {
+	text := h.ui.keybindings.HelpText(contextName)
+	if text == "" {
+		return ""
+	}
+	return "[::b]" + findKeyContext(contextName).title + "[::-]\n" + tview.Escape(text)
+}
+
+// commandLineHelp lists the commands of the ":" prompt
+func (h *HelpWidget) commandLineHelp() string {
+	lines := []string{"[::b]Command line[::-] (Tab completes)"}
+	for _, spec := range h.ui.commandLineSpecs() {
+		lines = append(lines, tview.Escape(":"+spec.Name+" "+spec.Usage))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// randomPresetsHelp lists the random presets that have a key, or is "" if
+// none has
+func (h *HelpWidget) randomPresetsHelp() string {
+	lines := []string{"[::b]Random presets[::-]"}
+	for _, preset := range h.ui.randomPresets {
+		if key := h.ui.keybindings.Key(ContextGlobal, randomPresetCommand(preset.Name)); key != "" {
+			lines = append(lines, tview.Escape(fmt.Sprintf("%-7s %s", key, preset.Name)))
+		}
+	}
+	if len(lines) == 1 {
+		return ""
+	}
+	return strings.Join(lines, "\n")
+}
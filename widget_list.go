@@ -0,0 +1,160 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// listData is the content of a ListWidget. Like queueData, it makes the
+// cells when they're drawn, so only the rows on screen cost anything.
+type listData struct {
+	tview.TableContentReadOnly
+
+	list  *ListWidget
+	count func() int
+	text  func(row int) string
+}
+
+var _ tview.TableContent = (*listData)(nil)
+
+func (d *listData) GetCell(row, column int) *tview.TableCell {
+	if column != 0 || row < 0 || row >= d.count() {
+		return nil
+	}
+	cell := tview.NewTableCell(d.text(row)).
+		SetExpansion(1)
+	if d.list.selectedFocusOnly && !d.list.HasFocus() {
+		cell.SetSelectedStyle(d.list.unfocusedStyle)
+	}
+	return cell
+}
+
+func (d *listData) GetRowCount() int {
+	return d.count()
+}
+
+func (d *listData) GetColumnCount() int {
+	return 1
+}
+
+// ListWidget is a list of one column, like tview.List, but it shows a model
+// instead of holding items: count returns the number of items, and text the
+// text of one, which may have color tags. That keeps lists of many thousands
+// of artists cheap; when the model changes, the list shows it the next time
+// it's drawn.
+type ListWidget struct {
+	*tview.Table
+	data listData
+
+	// changed is called with the index of the item the selection moved to
+	changed func(index int)
+	// notified is the index changed was last called with
+	notified int
+
+	selectedFocusOnly bool
+	unfocusedStyle    tcell.Style
+}
+
+// newListWidget creates a list with a border and a title, which shows the
+// model of count and text
+func newListWidget(theme *Theme, title string, count func() int, text func(index int) string) *ListWidget {
+	l := &ListWidget{
+		Table: tview.NewTable().
+			SetSelectable(true, false),
+	}
+	l.data = listData{list: l, count: count, text: text}
+	l.Table.SetContent(&l.data)
+	l.Table.Box.
+		SetTitle(title).
+		SetTitleAlign(tview.AlignLeft).
+		SetBorder(true)
+	theme.styleTable(l.Table)
+
+	// a selected style that looks unselected; the default one would swap the
+	// colors
+	l.unfocusedStyle = theme.Style(StyleText).Tcell()
+	if l.unfocusedStyle == tcell.StyleDefault {
+		l.unfocusedStyle = tcell.StyleDefault.Foreground(tcell.ColorReset).Background(tcell.ColorReset)
+	}
+
+	l.Table.SetSelectionChangedFunc(func(row, _ int) {
+		if row == l.notified || row >= count() {
+			return
+		}
+		l.notified = row
+		if l.changed != nil {
+			l.changed(row)
+		}
+	})
+	return l
+}
+
+// SetChangedFunc sets the function that's called when the selection moves
+// to another item
+func (l *ListWidget) SetChangedFunc(changed func(index int)) *ListWidget {
+	l.changed = changed
+	return l
+}
+
+// SetSelectedFunc sets the function that's called when Enter is pressed on
+// an item
+func (l *ListWidget) SetSelectedFunc(selected func(index int)) *ListWidget {
+	l.Table.SetSelectedFunc(func(row, _ int) {
+		if row < l.GetItemCount() {
+			selected(row)
+		}
+	})
+	return l
+}
+
+// SetSelectedFocusOnly sets whether the selected item is only highlighted
+// while the list has the focus
+func (l *ListWidget) SetSelectedFocusOnly(focusOnly bool) *ListWidget {
+	l.selectedFocusOnly = focusOnly
+	return l
+}
+
+// GetItemCount returns the number of items of the model
+func (l *ListWidget) GetItemCount() int {
+	return l.data.count()
+}
+
+// GetCurrentItem returns the index of the selected item, or 0 if the list is
+// empty
+func (l *ListWidget) GetCurrentItem() int {
+	row, _ := l.GetSelection()
+	return max(min(row, l.GetItemCount()-1), 0)
+}
+
+// SetCurrentItem selects an item, which calls the changed function if it
+// wasn't selected
+func (l *ListWidget) SetCurrentItem(index int) *ListWidget {
+	l.Select(max(min(index, l.GetItemCount()-1), 0), 0)
+	return l
+}
+
+// Reset selects the first item and scrolls to it, without calling the
+// changed function; call it when the model has changed entirely
+func (l *ListWidget) Reset() *ListWidget {
+	l.notified = 0
+	l.Select(0, 0)
+	l.ScrollToBeginning()
+	return l
+}
+
+// MouseHandler focuses the list, rather than the table in it, when it's
+// clicked, so that the focus can be compared with the list
+func (l *ListWidget) MouseHandler() func(action tview.MouseAction, event *tcell.EventMouse, setFocus func(p tview.Primitive)) (consumed bool, capture tview.Primitive) {
+	handler := l.Table.MouseHandler()
+	return func(action tview.MouseAction, event *tcell.EventMouse, setFocus func(p tview.Primitive)) (consumed bool, capture tview.Primitive) {
+		return handler(action, event, func(p tview.Primitive) {
+			if p == l.Table {
+				p = l
+			}
+			setFocus(p)
+		})
+	}
+}
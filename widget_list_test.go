@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListWidget(t *testing.T) {
+	items := []string{"a", "b", "c"}
+	list := newListWidget(builtinThemes["default"], " test ",
+		func() int { return len(items) },
+		func(i int) string { return items[i] })
+	var changed []int
+	list.SetChangedFunc(func(i int) { changed = append(changed, i) })
+
+	assert.Equal(t, 3, list.GetItemCount())
+	assert.Equal(t, "b", list.data.GetCell(1, 0).Text)
+	assert.Nil(t, list.data.GetCell(3, 0))
+
+	list.SetCurrentItem(2)
+	list.SetCurrentItem(2)
+	list.SetCurrentItem(5)
+	assert.Equal(t, 2, list.GetCurrentItem())
+	assert.Equal(t, []int{2}, changed, "changed is called once per item")
+
+	// the model shrinks under the selection
+	items = items[:1]
+	assert.Equal(t, 0, list.GetCurrentItem())
+	list.Reset()
+	assert.Equal(t, []int{2}, changed, "Reset doesn't call changed")
+
+	items = nil
+	list.Reset()
+	assert.Equal(t, 0, list.GetCurrentItem())
+	assert.Equal(t, 0, list.GetRowCount())
+}
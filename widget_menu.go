@@ -32,17 +32,39 @@ const (
 	PAGE_PLAYLISTS
 	PAGE_SEARCH
 	PAGE_LOG
+	PAGE_STATS
+	PAGE_ALBUMS
 )
 
-var buttonOrder = []string{PageBrowser, PageQueue, PagePlaylists, PageSearch, PageLog}
+var buttonOrder = []string{PageBrowser, PageQueue, PagePlaylists, PageSearch, PageLog, PageStats, PageAlbums}
+
+// pageCommands are the Global commands that show the pages
+var pageCommands = map[string]string{
+	PageBrowser:   "showBrowser",
+	PageQueue:     "showQueue",
+	PagePlaylists: "showPlaylists",
+	PageSearch:    "showSearch",
+	PageLog:       "showLog",
+	PageStats:     "showStats",
+	PageAlbums:    "showAlbums",
+}
+
+// buttonLabel prefixes a button's label with the key of its command, if
+// there is one
+func (m *MenuWidget) buttonLabel(command, label string) string {
+	if key := m.ui.keybindings.Key(ContextGlobal, command); key != "" {
+		return tview.Escape(key) + ": " + label
+	}
+	return label
+}
 
 func (ui *Ui) createMenuWidget() (m *MenuWidget) {
 	m = &MenuWidget{
 		activeButton: buttonOrder[PAGE_BROWSER],
 		buttons:      make(map[string]*tview.Button),
 
-		buttonStyle:     tcell.StyleDefault.Background(tcell.ColorBlack).Foreground(tcell.ColorWhite),
-		quitActiveStyle: tcell.StyleDefault.Background(tcell.ColorWhite).Foreground(tcell.ColorRed),
+		buttonStyle:     ui.theme.Style(StyleButton).Tcell(),
+		quitActiveStyle: ui.theme.Style(StyleButtonActive).Tcell(),
 
 		ui: ui,
 	}
@@ -54,14 +76,14 @@ func (ui *Ui) createMenuWidget() (m *MenuWidget) {
 	m.updatePageButtons()
 
 	// help and quit button on the right
-	quitButton := tview.NewButton("Q: quit").
+	quitButton := tview.NewButton(m.buttonLabel("quit", "quit")).
 		SetStyle(m.buttonStyle).
 		SetActivatedStyle(m.quitActiveStyle).
 		SetSelectedFunc(func() {
 			ui.Quit()
 		})
 
-	helpButton := tview.NewButton("?: help").
+	helpButton := tview.NewButton(m.buttonLabel("help", "help")).
 		SetStyle(m.buttonStyle).
 		SetActivatedStyle(m.buttonStyle).
 		SetSelectedFunc(func() {
@@ -88,7 +110,7 @@ func (m *MenuWidget) createPageButtons() {
 	for i, page := range buttonOrder {
 		button := tview.NewButton(page)
 		button.SetStyle(m.buttonStyle)
-		// HACK because I couldn't find a way to un-focus a button after switching with 1,2,3,4 keys:
+		// HACK because I couldn't find a way to un-focus a button after switching pages with keys:
 		button.SetActivatedStyle(m.buttonStyle)
 
 		// create copy for our function
@@ -109,15 +131,13 @@ func (m *MenuWidget) createPageButtons() {
 }
 
 func (m *MenuWidget) updatePageButtons() {
-	for i, page := range buttonOrder {
-		var text string
+	for _, page := range buttonOrder {
+		label := page
 		if page == m.activeButton {
-			text = fmt.Sprintf("%d: [::b]%s[::-]", i+1, page)
-		} else {
-			text = fmt.Sprintf("%d: %s", i+1, page)
+			label = fmt.Sprintf("[::b]%s[::-]", page)
 		}
 
-		m.buttons[page].SetLabel(text)
+		m.buttons[page].SetLabel(m.buttonLabel(pageCommands[page], label))
 	}
 }
 
@@ -0,0 +1,221 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rivo/tview"
+	"github.com/spezifisch/stmps/subsonic"
+)
+
+// the first option of the drop-downs, which doesn't filter
+const (
+	randomNoPreset   = "(none)"
+	randomAnyGenre   = "(any)"
+	randomAllFolders = "(all)"
+)
+
+// RandomSongsWidget is the dialog that adds random songs of a genre, years,
+// or music folder to the queue, optionally starting from a preset
+type RandomSongsWidget struct {
+	Root *tview.Form
+	ui   *Ui
+
+	preset   *tview.DropDown
+	size     *tview.InputField
+	genre    *tview.DropDown
+	fromYear *tview.InputField
+	toYear   *tview.InputField
+	folder   *tview.DropDown
+
+	// the options of the drop-downs, without the first
+	genres  []string
+	folders []subsonic.MusicFolder
+
+	visible bool
+}
+
+func (ui *Ui) createRandomSongsWidget() (w *RandomSongsWidget) {
+	w = &RandomSongsWidget{ui: ui}
+
+	digits := func(text string, ch rune) bool {
+		if text == "" {
+			return true
+		}
+		_, err := strconv.ParseUint(text, 10, 0)
+		return err == nil && len(text) <= 4
+	}
+
+	presetNames := []string{randomNoPreset}
+	for _, preset := range ui.randomPresets {
+		presetNames = append(presetNames, preset.Name)
+	}
+	w.preset = tview.NewDropDown().
+		SetLabel("Preset").
+		SetOptions(presetNames, func(text string, index int) {
+			if index > 0 {
+				w.setFilter(ui.randomPresets[index-1].Filter)
+			}
+		})
+	w.size = tview.NewInputField().
+		SetLabel("Songs").
+		SetFieldWidth(5).
+		SetAcceptanceFunc(digits)
+	w.genre = tview.NewDropDown().
+		SetLabel("Genre").
+		SetOptions([]string{randomAnyGenre}, nil)
+	w.fromYear = tview.NewInputField().
+		SetLabel("From year").
+		SetFieldWidth(5).
+		SetAcceptanceFunc(digits)
+	w.toYear = tview.NewInputField().
+		SetLabel("To year").
+		SetFieldWidth(5).
+		SetAcceptanceFunc(digits)
+	w.folder = tview.NewDropDown().
+		SetLabel("Music folder").
+		SetOptions([]string{randomAllFolders}, nil)
+
+	list := ui.theme.Style(StyleText).Tcell()
+	for _, dropDown := range []*tview.DropDown{w.preset, w.genre, w.folder} {
+		dropDown.SetCurrentOption(0).
+			SetListStyles(list, ui.theme.Style(StyleSelection).Tcell())
+	}
+
+	field := ui.theme.Style(StyleField)
+	dialog := ui.theme.Style(StyleDialog)
+	w.Root = tview.NewForm().
+		AddFormItem(w.preset).
+		AddFormItem(w.size).
+		AddFormItem(w.genre).
+		AddFormItem(w.fromYear).
+		AddFormItem(w.toYear).
+		AddFormItem(w.folder).
+		AddButton("Add", w.add).
+		AddButton("Cancel", w.Close).
+		SetLabelColor(ui.theme.Style(StyleLabel).Foreground()).
+		SetFieldTextColor(field.Foreground()).
+		SetFieldBackgroundColor(field.Background()).
+		SetButtonStyle(ui.theme.Style(StyleButton).Tcell()).
+		SetButtonActivatedStyle(ui.theme.Style(StyleButtonActive).Tcell()).
+		SetCancelFunc(w.Close)
+	w.Root.SetBackgroundColor(dialog.Background())
+	w.Root.SetTitle(" Add random songs ").
+		SetBorder(true)
+	return w
+}
+
+// Show opens the dialog, with the filter used last
+func (w *RandomSongsWidget) Show() {
+	w.updateOptions()
+	w.visible = true
+	w.Root.SetFocus(0)
+	w.ui.pages.ShowPage(PageRandomSongs)
+	w.ui.pages.SendToFront(PageRandomSongs)
+	w.ui.app.SetFocus(w.Root)
+}
+
+func (w *RandomSongsWidget) Close() {
+	w.visible = false
+	w.ui.pages.HidePage(PageRandomSongs)
+	_, prim := w.ui.pages.GetFrontPage()
+	w.ui.app.SetFocus(prim)
+}
+
+// updateOptions fills the genre and folder drop-downs, once the server told
+// which there are
+func (w *RandomSongsWidget) updateOptions() {
+	if len(w.genres) == 0 {
+		w.genres = w.ui.genreNames()
+		w.genre.SetOptions(append([]string{randomAnyGenre}, w.genres...), nil)
+		w.genre.SetCurrentOption(0)
+	}
+	if len(w.folders) == 0 {
+		w.folders = w.ui.musicFolders()
+		names := []string{randomAllFolders}
+		for _, folder := range w.folders {
+			names = append(names, folder.Name)
+		}
+		w.folder.SetOptions(names, nil)
+		w.folder.SetCurrentOption(0)
+	}
+}
+
+// setFilter shows a filter in the fields
+func (w *RandomSongsWidget) setFilter(filter subsonic.RandomSongsFilter) {
+	number := func(n int) string {
+		if n == 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+	w.size.SetText(number(filter.Size))
+	w.fromYear.SetText(number(filter.FromYear))
+	w.toYear.SetText(number(filter.ToYear))
+
+	w.genre.SetCurrentOption(0)
+	for i, genre := range w.genres {
+		if strings.EqualFold(genre, filter.Genre) {
+			w.genre.SetCurrentOption(i + 1)
+		}
+	}
+	w.folder.SetCurrentOption(0)
+	for i, folder := range w.folders {
+		if string(folder.Id) == filter.MusicFolderId {
+			w.folder.SetCurrentOption(i + 1)
+		}
+	}
+}
+
+// filter returns the filter the fields describe
+func (w *RandomSongsWidget) filter() (subsonic.RandomSongsFilter, error) {
+	var filter subsonic.RandomSongsFilter
+	number := func(text string) int {
+		// the fields only take digits
+		n, _ := strconv.Atoi(text)
+		return n
+	}
+	filter.Size = number(w.size.GetText())
+	filter.FromYear = number(w.fromYear.GetText())
+	filter.ToYear = number(w.toYear.GetText())
+	if filter.FromYear != 0 && filter.ToYear != 0 && filter.FromYear > filter.ToYear {
+		return filter, fmt.Errorf("%d is after %d", filter.FromYear, filter.ToYear)
+	}
+	if i, _ := w.genre.GetCurrentOption(); i > 0 {
+		filter.Genre = w.genres[i-1]
+	}
+	if i, _ := w.folder.GetCurrentOption(); i > 0 {
+		filter.MusicFolderId = string(w.folders[i-1].Id)
+	}
+	return filter, nil
+}
+
+func (w *RandomSongsWidget) add() {
+	filter, err := w.filter()
+	if err == nil {
+		err = w.ui.addFilteredRandomSongs(filter)
+	}
+	w.Close()
+	if err != nil {
+		w.ui.showMessageBox("Random songs: " + err.Error())
+	}
+}
+
+// addFilteredRandomSongs adds random songs that match the filter to the queue
+func (ui *Ui) addFilteredRandomSongs(filter subsonic.RandomSongsFilter) error {
+	songs, err := ui.connection.GetRandomSongsFiltered(filter)
+	if err != nil {
+		return err
+	}
+	if len(songs) == 0 {
+		return errors.New("no songs match")
+	}
+	ui.playback.AddSongs(songs...)
+	ui.queuePage.UpdateQueue()
+	return nil
+}
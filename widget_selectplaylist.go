@@ -28,8 +28,12 @@ func (ui *Ui) createPlaylistSelectionWidget() (m *PlaylistSelectionWidget) {
 	m.overwrite = tview.NewCheckbox()
 	m.overwrite.SetDisabled(true)
 	m.overwriteEnabled = false
-	m.overwrite.SetLabel("Overwrite?").SetFieldTextColor(tcell.ColorBlack)
-	m.overwrite.SetBackgroundColor(tcell.ColorGray)
+	field := ui.theme.Style(StyleField)
+	m.overwrite.SetLabel("Overwrite?").
+		SetLabelStyle(ui.theme.Style(StyleLabel).Tcell().Background(ui.theme.Style(StyleDialog).Background())).
+		SetFieldTextColor(field.Foreground()).
+		SetFieldBackgroundColor(field.Background())
+	m.overwrite.SetBackgroundColor(ui.theme.Style(StyleDialog).Background())
 	m.overwrite.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		if event.Rune() == ' ' {
 			m.overwrite.SetChecked(!m.overwrite.IsChecked())
@@ -38,8 +42,12 @@ func (ui *Ui) createPlaylistSelectionWidget() (m *PlaylistSelectionWidget) {
 		}
 		return event
 	})
-	m.accept = tview.NewButton("Accept").SetLabelColor(tcell.ColorBlack)
-	m.cancel = tview.NewButton("Cancel").SetLabelColor(tcell.ColorBlack)
+	m.accept = tview.NewButton("Accept").
+		SetStyle(ui.theme.Style(StyleButton).Tcell()).
+		SetActivatedStyle(ui.theme.Style(StyleButtonActive).Tcell())
+	m.cancel = tview.NewButton("Cancel").
+		SetStyle(ui.theme.Style(StyleButton).Tcell()).
+		SetActivatedStyle(ui.theme.Style(StyleButtonActive).Tcell())
 	m.inputField = tview.NewInputField().SetAutocompleteFunc(func(current string) []string {
 		// if the playlists page hasn't been created, there's nothing to work with
 		if ui.playlistPage == nil {
@@ -65,7 +73,8 @@ func (ui *Ui) createPlaylistSelectionWidget() (m *PlaylistSelectionWidget) {
 			m.accept.SetDisabled(false)
 		}
 		return rv
-	}).SetFieldTextColor(tcell.ColorBlack)
+	})
+	ui.theme.styleField(m.inputField)
 	m.inputField.SetDoneFunc(func(key tcell.Key) {
 		m.focusNext(nil)
 	})
@@ -0,0 +1,51 @@
+// Copyright 2023 The STMPS Authors
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+)
+
+// xdgDir returns the stmps directory in the XDG base directory named by env,
+// or in fallback (relative to the home directory) if env isn't set. It
+// doesn't create the directory.
+func xdgDir(env, fallback string) (string, error) {
+	if dir := os.Getenv(env); dir != "" {
+		return filepath.Join(dir, "stmps"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, fallback, "stmps"), nil
+}
+
+// stateDir is where stmps keeps state that should survive a restart, but
+// isn't worth backing up, like pending scrobbles
+func stateDir() (string, error) {
+	return xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state"))
+}
+
+// dataDir is where stmps keeps data that it created, like the listening
+// history
+func dataDir() (string, error) {
+	return xdgDir("XDG_DATA_HOME", filepath.Join(".local", "share"))
+}
+
+// configDir is where the user's config files are, like keybindings and
+// themes: next to the config file, or ~/.config/stmps. It's empty if there's
+// no home directory.
+func configDir() string {
+	if config := viper.ConfigFileUsed(); config != "" {
+		return filepath.Dir(config)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "stmps")
+}